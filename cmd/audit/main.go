@@ -0,0 +1,84 @@
+// The audit command measures the accuracy of the global pagerank estimated from
+// the random walks in Redis, by comparing it with the exact pagerank computed
+// with the power iteration method. The whole follow graph is loaded in memory.
+//
+// Usage:
+//
+//	go run ./cmd/audit [-topk 1000] [-tolerance 1e-9] [-redis localhost:6379]
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/database/redisdb"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/pagerank"
+	"github.com/vertex-lab/crawler/pkg/store/redistore"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+// the number of nodes whose visits are fetched at once
+const batchSize = 10000
+
+func main() {
+	ctx := context.Background()
+	log := logger.New(os.Stdout)
+
+	topK := flag.Int("topk", 1000, "number of top nodes used for the rank correlation")
+	tolerance := flag.Float64("tolerance", 1e-9, "L1 distance between two iterations at which the power iteration stops")
+	redisAddress := flag.String("redis", "localhost:6379", "address of the redis instance")
+	flag.Parse()
+
+	redis := redis.NewClient(&redis.Options{Addr: *redisAddress})
+	DB, err := redisdb.NewDatabaseConnection(ctx, redis)
+	if err != nil {
+		panic("failed to connect to the database: " + err.Error())
+	}
+
+	RWS, err := redistore.NewRWSConnection(ctx, redis)
+	if err != nil {
+		panic("failed to connect to the random walk store: " + err.Error())
+	}
+
+	start := time.Now()
+	exact, err := pagerank.PowerIteration(ctx, DB, RWS.Alpha(ctx), *tolerance)
+	if err != nil {
+		panic(err)
+	}
+	log.Info("power iteration completed in %v", time.Since(start))
+
+	nodeIDs := make([]uint32, 0, len(exact))
+	for ID := range exact {
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	estimate := make(models.PagerankMap, len(exact))
+	for batch := range slices.Chunk(nodeIDs, batchSize) {
+		pr, err := pagerank.Global(ctx, RWS, batch...)
+		if err != nil {
+			panic(err)
+		}
+
+		for ID, rank := range pr {
+			estimate[ID] = rank
+		}
+	}
+
+	top := pagerank.TopNodes(exact, *topK)
+	overlap := 0
+	for _, ID := range pagerank.TopNodes(estimate, *topK) {
+		if slices.Contains(top, ID) {
+			overlap++
+		}
+	}
+
+	log.Info("nodes: %d", len(exact))
+	log.Info("L1 distance: %f", pagerank.Distance(exact, estimate))
+	log.Info("top %d rank correlation: %f", len(top), pagerank.RankCorrelation(exact, estimate, *topK))
+	log.Info("top %d overlap: %d", len(top), overlap)
+}
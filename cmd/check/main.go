@@ -0,0 +1,58 @@
+// The check command verifies the consistency of the random walk store in Redis,
+// and optionally repairs the inconsistencies found. Stop the crawler before running it.
+//
+// Usage:
+//
+//	go run ./cmd/check [-repair] [-batch 10000] [-redis localhost:6379]
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/database/redisdb"
+	"github.com/vertex-lab/crawler/pkg/store/redistore"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+func main() {
+	ctx := context.Background()
+	log := logger.New(os.Stdout)
+
+	repair := flag.Bool("repair", false, "repair the inconsistencies found")
+	batchSize := flag.Int("batch", 10000, "number of walks scanned (or fixed) at once")
+	redisAddress := flag.String("redis", "localhost:6379", "address of the redis instance")
+	flag.Parse()
+
+	redis := redis.NewClient(&redis.Options{Addr: *redisAddress})
+	DB, err := redisdb.NewDatabaseConnection(ctx, redis)
+	if err != nil {
+		panic("failed to connect to the database: " + err.Error())
+	}
+
+	RWS, err := redistore.NewRWSConnection(ctx, redis)
+	if err != nil {
+		panic("failed to connect to the random walk store: " + err.Error())
+	}
+
+	start := time.Now()
+	report, err := redistore.Check(ctx, RWS, DB, *batchSize)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Info("check completed in %v: %v", time.Since(start), report)
+	if report.OK() || !*repair {
+		return
+	}
+
+	start = time.Now()
+	if err := redistore.Repair(ctx, RWS, report, *batchSize); err != nil {
+		panic(err)
+	}
+
+	log.Info("repair completed in %v", time.Since(start))
+}
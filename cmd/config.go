@@ -9,19 +9,36 @@ import (
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/api"
 	"github.com/vertex-lab/crawler/pkg/crawler"
+	"github.com/vertex-lab/crawler/pkg/dvm"
+	"github.com/vertex-lab/crawler/pkg/queue"
 	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+	"github.com/vertex-lab/crawler/pkg/walks"
 )
 
 type SystemConfig struct {
-	Log          *logger.Aggregate
-	LogWriter    io.Writer
-	DisplayStats bool
+	Log       *logger.Aggregate
+	LogWriter io.Writer
+
+	// the address of the metrics endpoint. If empty, the metrics are served on
+	// the API server (if started) under /metrics.
+	MetricsAddress string
 
 	RedisAddress string
 	SQLiteURL    string
 
-	EventQueueCapacity  int
+	// if not empty, the graph is stored in the SQLite database at this path instead of Redis
+	GraphSQLitePath string
+
+	// if true, the follow graph is kept in memory to speed up the generation and update of the walks
+	GraphSnapshot bool
+
+	// if not 0, the random walks and pageranks are reproducible given the same sequence of events,
+	// and the events are processed by a single worker regardless of PROCESS_WORKERS
+	Seed int64
+
 	PubkeyQueueCapacity int
 
 	InitPubkeys []string // only used during initialization
@@ -32,18 +49,24 @@ type Config struct {
 	SystemConfig
 	Firehose crawler.FirehoseConfig
 	Query    crawler.QueryPubkeysConfig
+	Pool     crawler.PoolSourceConfig
 	Arbiter  crawler.NodeArbiterConfig
 	Process  crawler.ProcessEventsConfig
+	Verifier crawler.VerifierConfig
+	Limiter  crawler.FollowLimiterConfig
+	Queue    queue.RedisConfig
+	API      api.ServerConfig
+	DVM      dvm.Config
+	Generate walks.GenerateConfig
 }
 
 func NewSystemConfig() SystemConfig {
 	return SystemConfig{
 		Log:                 logger.New(os.Stdout),
 		LogWriter:           os.Stdout,
-		DisplayStats:        false,
+		MetricsAddress:      "",
 		RedisAddress:        "localhost:6379",
 		SQLiteURL:           "events.sqlite",
-		EventQueueCapacity:  1000,
 		PubkeyQueueCapacity: 1000,
 	}
 }
@@ -54,18 +77,27 @@ func NewConfig() *Config {
 		SystemConfig: NewSystemConfig(),
 		Firehose:     crawler.NewFirehoseConfig(),
 		Query:        crawler.NewQueryPubkeysConfig(),
+		Pool:         crawler.NewPoolSourceConfig(),
 		Arbiter:      crawler.NewNodeArbiterConfig(),
 		Process:      crawler.NewProcessEventsConfig(),
+		Verifier:     crawler.NewVerifierConfig(),
+		Limiter:      crawler.NewFollowLimiterConfig(),
+		Queue:        queue.NewRedisConfig(),
+		API:          api.NewServerConfig(),
+		DVM:          dvm.NewConfig(),
+		Generate:     walks.NewGenerateConfig(),
 	}
 }
 
 func (c SystemConfig) Print() {
 	fmt.Println("System:")
 	fmt.Printf("  LogWriter: %T\n", c.LogWriter)
-	fmt.Printf("  DisplayStats: %t\n", c.DisplayStats)
+	fmt.Printf("  MetricsAddress: %s\n", c.MetricsAddress)
 	fmt.Printf("  RedisAddress: %s\n", c.RedisAddress)
 	fmt.Printf("  SQLiteURL: %s\n", c.SQLiteURL)
-	fmt.Printf("  EventQueueCapacity: %d\n", c.EventQueueCapacity)
+	fmt.Printf("  GraphSQLitePath: %s\n", c.GraphSQLitePath)
+	fmt.Printf("  GraphSnapshot: %v\n", c.GraphSnapshot)
+	fmt.Printf("  Seed: %d\n", c.Seed)
 	fmt.Printf("  PubkeyQueueCapacity: %d\n", c.PubkeyQueueCapacity)
 	fmt.Printf("  InitPubkeys: %v\n", c.InitPubkeys)
 }
@@ -74,8 +106,15 @@ func (c *Config) Print() {
 	c.SystemConfig.Print()
 	c.Firehose.Print()
 	c.Query.Print()
+	c.Pool.Print()
 	c.Arbiter.Print()
 	c.Process.Print()
+	c.Verifier.Print()
+	c.Limiter.Print()
+	c.Queue.Print()
+	c.API.Print()
+	c.DVM.Print()
+	c.Generate.Print()
 }
 
 // LoadConfig() read the variables from the enviroment and parses them into a config struct.
@@ -100,14 +139,15 @@ func LoadConfig() (*Config, error) {
 			config.Log = logger.New(config.LogWriter)
 			config.Firehose.Log = config.Log
 			config.Query.Log = config.Log
+			config.Pool.Log = config.Log
 			config.Process.Log = config.Log
 			config.Arbiter.Log = config.Log
+			config.API.Log = config.Log
+			config.DVM.Log = config.Log
+			config.Generate.Log = config.Log
 
-		case "DISPLAY_STATS":
-			config.DisplayStats, err = strconv.ParseBool(val)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
-			}
+		case "METRICS_ADDRESS":
+			config.MetricsAddress = val
 
 		case "REDIS_ADDRESS":
 			config.RedisAddress = val
@@ -115,12 +155,43 @@ func LoadConfig() (*Config, error) {
 		case "SQLITE_URL":
 			config.SQLiteURL = val
 
+		case "GRAPH_SQLITE_PATH":
+			config.GraphSQLitePath = val
+
+		case "GRAPH_SNAPSHOT":
+			config.GraphSnapshot, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "SEED":
+			config.Seed, err = strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+			if config.Seed != 0 {
+				// each process gets its own source, so that their order of execution doesn't matter
+				config.Generate.Seed = config.Seed
+				config.Process.Rand = randutils.NewSource(config.Seed)
+				config.Arbiter.Rand = randutils.NewSource(config.Seed + 1)
+				config.API.Rand = randutils.NewSource(config.Seed + 2)
+				config.DVM.Rand = randutils.NewSource(config.Seed + 3)
+			}
+
 		case "EVENT_QUEUE_CAPACITY":
-			config.EventQueueCapacity, err = strconv.Atoi(val)
+			config.Queue.Capacity, err = strconv.Atoi(val)
 			if err != nil {
 				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
 			}
 
+		case "EVENT_QUEUE_DEDUP_TTL":
+			dedupTTL, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.Queue.DedupTTL = time.Duration(dedupTTL) * time.Second
+
 		case "PUBKEY_QUEUE_CAPACITY":
 			config.PubkeyQueueCapacity, err = strconv.Atoi(val)
 			if err != nil {
@@ -141,6 +212,8 @@ func LoadConfig() (*Config, error) {
 
 			config.Firehose.Relays = relays
 			config.Query.Relays = relays
+			config.DVM.Relays = relays
+			config.Verifier.Relays = relays
 
 		case "INIT_PUBKEYS":
 			pubkeys := strings.Split(val, ",")
@@ -165,6 +238,29 @@ func LoadConfig() (*Config, error) {
 			}
 			config.Query.Interval = time.Duration(queryInterval) * time.Second
 
+		case "QUERY_MAX_RELAYS_PER_PUBKEY":
+			config.Query.MaxRelaysPerPubkey, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+			if config.Query.MaxRelaysPerPubkey < 1 {
+				return nil, fmt.Errorf("error parsing %v: the max relays per pubkey should be at least 1", keyVal)
+			}
+
+		case "POOL_MAX_CONNECTIONS":
+			config.Pool.MaxConnections, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "POOL_MAX_IDLE":
+			maxIdle, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.Pool.MaxIdle = time.Duration(maxIdle) * time.Second
+
 		case "NODE_ARBITER_ACTIVATION_THRESHOLD":
 			config.Arbiter.ActivationThreshold, err = strconv.ParseFloat(val, 64)
 			if err != nil {
@@ -190,15 +286,123 @@ func LoadConfig() (*Config, error) {
 			}
 			config.Arbiter.PromotionWaitPeriod = time.Duration(duration) * time.Second
 
+		case "NODE_ARBITER_INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.Arbiter.Interval = time.Duration(interval) * time.Second
+
 		case "PROCESS_PRINT_EVERY":
 			printEvery, err := strconv.Atoi(val)
 			if err != nil {
 				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
 			}
 			config.Process.PrintEvery = uint32(printEvery)
+
+		case "PROCESS_BATCH_SIZE":
+			config.Process.BatchSize, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "PROCESS_WORKERS":
+			config.Process.Workers, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "PROCESS_MAX_ATTEMPTS":
+			config.Process.MaxAttempts, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "PROCESS_COALESCE_WINDOW_MS":
+			window, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.Process.CoalesceWindow = time.Duration(window) * time.Millisecond
+
+		case "VERIFIER_WORKERS":
+			config.Verifier.Workers, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "VERIFIER_CACHE_SIZE":
+			config.Verifier.CacheSize, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "LIMITER_RATE":
+			config.Limiter.Rate, err = strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "LIMITER_BURST":
+			config.Limiter.Burst, err = strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "LIMITER_MAX_MULTIPLIER":
+			config.Limiter.MaxMultiplier, err = strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "LIMITER_MAX_DEFER":
+			maxDefer, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.Limiter.MaxDefer = time.Duration(maxDefer) * time.Second
+
+		case "GENERATE_WORKERS":
+			config.Generate.Workers, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "GENERATE_BATCH_SIZE":
+			config.Generate.BatchSize, err = strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "GENERATE_RESUME":
+			config.Generate.Resume, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+
+		case "API_ADDRESS":
+			config.API.Address = val
+
+		case "API_MAX_TOPK":
+			maxTopK, err := strconv.ParseUint(val, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", keyVal, err)
+			}
+			config.API.MaxTopK = uint16(maxTopK)
+
+		case "DVM_PRIVATE_KEY":
+			if _, err := nostr.GetPublicKey(val); err != nil {
+				return nil, fmt.Errorf("error parsing %v: %v", key, err)
+			}
+			config.DVM.PrivateKey = val
 		}
 	}
 
+	if config.Seed != 0 {
+		// the walks are reproducible only if the events are processed one at the time, in order
+		config.Process.Workers = 1
+	}
+
 	return config, nil
 }
 
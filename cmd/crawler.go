@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"net/http"
 	"runtime"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	_ "github.com/joho/godotenv/autoload" // responsible for loading .env
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/api"
 	"github.com/vertex-lab/crawler/pkg/crawler"
+	"github.com/vertex-lab/crawler/pkg/database/csrdb"
 	"github.com/vertex-lab/crawler/pkg/database/redisdb"
+	"github.com/vertex-lab/crawler/pkg/database/sqlitedb"
+	"github.com/vertex-lab/crawler/pkg/dvm"
+	"github.com/vertex-lab/crawler/pkg/metrics"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
 	"github.com/vertex-lab/crawler/pkg/store/redistore"
 	"github.com/vertex-lab/crawler/pkg/utils/logger"
 	"github.com/vertex-lab/crawler/pkg/walks"
@@ -38,43 +43,57 @@ func main() {
 	defer PrintShutdown(config.Log)
 	go crawler.HandleSignals(cancel, config.Log)
 
+	registry := metrics.NewRegistry()
+	config.Process.Metrics = crawler.NewMetrics(registry)
+	config.Arbiter.Metrics = config.Process.Metrics
+	config.Verifier.Metrics = config.Process.Metrics
+	config.Limiter.Metrics = config.Process.Metrics
+
 	redis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	redis.AddHook(metrics.NewRedisHook(registry))
 	size, err := redis.DBSize(ctx).Result()
 	if err != nil {
 		panic("failed to connect to redis: " + err.Error())
 	}
 
-	var DB models.Database
-	var RWS models.RandomWalkStore
+	DB, err := NewDatabase(ctx, config, redis, size == 0)
+	if err != nil {
+		panic("failed to connect to the database: " + err.Error())
+	}
 
-	switch size {
-	case 0:
-		// if redis is empty, initialize a new database with the INIT_PUBKEYS specified in the enviroment
-		config.Log.Info("initializing crawler from empty database")
-		DB, err = redisdb.NewDatabaseFromPubkeys(ctx, redis, config.InitPubkeys)
+	if config.GraphSnapshot {
+		config.Log.Info("loading the follow graph in memory")
+		DB, err = csrdb.NewDatabase(ctx, DB)
 		if err != nil {
-			panic("failed to connect to the database: " + err.Error())
+			panic("failed to build the graph snapshot: " + err.Error())
 		}
+	}
 
+	var RWS models.RandomWalkStore
+
+	switch size {
+	case 0:
 		RWS, err = redistore.NewRWS(ctx, redis, 0.85, 100)
 		if err != nil {
 			panic("failed to connect to the random walk store: " + err.Error())
 		}
 
-		if err = walks.GenerateAll(ctx, DB, RWS); err != nil {
+		if err = walks.GenerateAll(ctx, config.Generate, DB, RWS); err != nil {
 			panic(err)
 		}
 
 	default:
-		DB, err = redisdb.NewDatabaseConnection(ctx, redis)
-		if err != nil {
-			panic("failed to connect to the database: " + err.Error())
-		}
-
 		RWS, err = redistore.NewRWSConnection(ctx, redis)
 		if err != nil {
 			panic("failed to connect to the random walk store: " + err.Error())
 		}
+
+		if config.Generate.Resume {
+			// completing a bootstrap that was interrupted
+			if err = walks.GenerateAll(ctx, config.Generate, DB, RWS); err != nil {
+				panic(err)
+			}
+		}
 	}
 
 	eventStore, err := eventstore.New(config.SQLiteURL)
@@ -86,38 +105,41 @@ func main() {
 	walksTracker := &atomic.Uint32{} // tracks the number of walks updated since the last scan of NodeArbiter
 	walksTracker.Add(1000000)        // to make NodeArbiter activate immediately
 
-	eventQueue := make(chan *nostr.Event, config.EventQueueCapacity)
+	eventQueue, err := queue.NewRedisQueue(ctx, redis, config.Queue)
+	if err != nil {
+		panic("failed to connect to the event queue: " + err.Error())
+	}
+
 	pubkeyQueue := make(chan string, config.PubkeyQueueCapacity)
 	for _, pk := range config.InitPubkeys { // send the initialization pubkeys to the queue (if any)
 		pubkeyQueue <- pk
 	}
 
+	// the Firehose and QueryPubkeys share the same relay connections, and only receive verified events
+	pool := crawler.NewPoolSource(ctx, config.Pool)
+	defer pool.Close()
+
+	verifier := crawler.NewVerifier(config.Verifier)
+	source := verifier.Source(pool)
+	config.Process.Verifier = verifier
+
+	limiter := crawler.NewFollowLimiter(config.Limiter)
+	config.Process.Limiter = limiter
+
 	// spawn the Firehose, the QueryPubkeys and NodeArbiter as three goroutines.
 	var wg sync.WaitGroup
 	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
-		crawler.Firehose(ctx, config.Firehose, DB, func(event *nostr.Event) error {
-			select {
-			case eventQueue <- event:
-			default:
-				config.Log.Warn("Firehose: Channel is full, dropping eventID: %v by %v", event.ID, event.PubKey)
-			}
-			return nil
-		})
+		crawler.Firehose(ctx, config.Firehose, source, DB,
+			crawler.Enqueue(ctx, eventQueue, crawler.ProducerFirehose, config.Process.Metrics))
 	}()
 
 	go func() {
 		defer wg.Done()
-		crawler.QueryPubkeys(ctx, config.Query, pubkeyQueue, func(event *nostr.Event) error {
-			select {
-			case eventQueue <- event:
-			default:
-				config.Log.Warn("QueryPubkeys: Channel is full, dropping eventID: %v by %v", event.ID, event.PubKey)
-			}
-			return nil
-		})
+		crawler.QueryPubkeys(ctx, config.Query, source, DB, pubkeyQueue,
+			crawler.Enqueue(ctx, eventQueue, crawler.ProducerQueryPubkeys, config.Process.Metrics))
 	}()
 
 	go func() {
@@ -125,15 +147,57 @@ func main() {
 		crawler.NodeArbiter(ctx, config.Arbiter, DB, RWS, walksTracker, func(pubkey string) error {
 			select {
 			case pubkeyQueue <- pubkey:
+				return nil
 			default:
-				config.Log.Warn("NodeArbiter: Channel is full, dropping pubkey: %v", pubkey)
+				// waiting for QueryPubkeys instead of dropping the pubkey
+				config.Process.Metrics.Blocked(crawler.ProducerNodeArbiter)
+			}
+
+			select {
+			case pubkeyQueue <- pubkey:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-			return nil
 		})
 	}()
 
-	if config.DisplayStats {
-		go DisplayStats(ctx, DB, RWS, eventQueue, pubkeyQueue, eventCounter, walksTracker)
+	RegisterSystemMetrics(ctx, registry, DB, RWS, eventQueue, pubkeyQueue, limiter)
+
+	if config.API.Address != "" {
+		server := api.NewServer(config.API, DB, RWS)
+		if config.MetricsAddress == "" {
+			server.Handle("GET /metrics", registry)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			api.ServeHandler(ctx, config.API, server)
+		}()
+	}
+
+	if config.MetricsAddress != "" {
+		metricsConfig := api.NewServerConfig()
+		metricsConfig.Log = config.Log
+		metricsConfig.Address = config.MetricsAddress
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", registry)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			api.ServeHandler(ctx, metricsConfig, mux)
+		}()
+	}
+
+	if config.DVM.PrivateKey != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dvm.DVM(ctx, config.DVM, DB, RWS)
+		}()
 	}
 
 	config.Log.Info("ready to process events")
@@ -143,49 +207,73 @@ func main() {
 
 // -----------------------------------HELPERS----------------------------------
 
-func DisplayStats(
+/*
+NewDatabase() returns the database of the graph, stored in SQLite if config.GraphSQLitePath
+is set, otherwise in Redis. If initialize is true, the database is initialized with the
+config.InitPubkeys, unless it already contains nodes (e.g. a pre-existing SQLite file).
+*/
+func NewDatabase(ctx context.Context, config *Config, redis *redis.Client, initialize bool) (models.Database, error) {
+	if config.GraphSQLitePath == "" {
+		if initialize {
+			config.Log.Info("initializing crawler from empty database")
+			return redisdb.NewDatabaseFromPubkeys(ctx, redis, config.InitPubkeys)
+		}
+		return redisdb.NewDatabaseConnection(ctx, redis)
+	}
+
+	DB, err := sqlitedb.Open(ctx, config.GraphSQLitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if initialize && DB.Size(ctx) == 0 {
+		config.Log.Info("initializing crawler from empty database")
+		if _, err := DB.AddNodes(ctx, config.InitPubkeys...); err != nil {
+			return nil, err
+		}
+	}
+
+	return DB, nil
+}
+
+// RegisterSystemMetrics() registers the gauges of the queues, of the throttled authors, of the DB and RWS sizes, and of the Go runtime.
+func RegisterSystemMetrics(
 	ctx context.Context,
+	registry *metrics.Registry,
 	DB models.Database,
 	RWS models.RandomWalkStore,
-	eventQueue <-chan *nostr.Event,
-	pubkeyQueue <-chan string,
-	eventCounter, walksChanged *atomic.Uint32) {
-
-	const statsLines = 9
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println(" Stopped stats display.")
-			return
-
-		case <-ticker.C:
-			eventQueueLen := len(eventQueue)
-			eventQueueCap := cap(eventQueue)
-			pubkeyQueueLen := len(pubkeyQueue)
-			pubkeyQueueCap := cap(pubkeyQueue)
-			goroutines := runtime.NumGoroutine()
+	eventQueue queue.Queue,
+	pubkeyQueue chan string,
+	limiter *crawler.FollowLimiter) {
+
+	registry.NewGaugeFunc("crawler_event_queue_length", "The number of events in the event queue, processed or not.",
+		func() float64 {
+			length, _ := eventQueue.Len(ctx)
+			return float64(length)
+		})
+	registry.NewGaugeFunc("crawler_event_queue_capacity", "The capacity of the event queue.",
+		func() float64 { return float64(eventQueue.Capacity()) })
+	registry.NewGaugeFunc("crawler_pubkey_queue_length", "The number of pubkeys in the pubkey queue.",
+		func() float64 { return float64(len(pubkeyQueue)) })
+	registry.NewGaugeFunc("crawler_pubkey_queue_capacity", "The capacity of the pubkey queue.",
+		func() float64 { return float64(cap(pubkeyQueue)) })
+
+	registry.NewGaugeFunc("crawler_throttled_authors", "The number of authors whose follow-lists are deferred or rejected by the FollowLimiter.",
+		func() float64 { return float64(limiter.Throttled()) })
+
+	registry.NewGaugeFunc("database_nodes", "The number of nodes in the database.",
+		func() float64 { return float64(DB.Size(ctx)) })
+	registry.NewGaugeFunc("rws_total_visits", "The total number of visits of the random walks.",
+		func() float64 { return float64(RWS.TotalVisits(ctx)) })
+
+	registry.NewGaugeFunc("go_goroutines", "The number of goroutines.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	registry.NewGaugeFunc("go_memstats_alloc_bytes", "The number of bytes of allocated heap objects.",
+		func() float64 {
 			memStats := new(runtime.MemStats)
 			runtime.ReadMemStats(memStats)
-
-			// clear stats
-			fmt.Printf("\033[%dA", statsLines)
-			fmt.Print("\033[J")
-
-			fmt.Printf("------------ System Stats -------------\n")
-			fmt.Printf("Database Size: %d nodes\n", DB.Size(ctx))
-			fmt.Printf("Event Queue: %d/%d\n", eventQueueLen, eventQueueCap)
-			fmt.Printf("Pubkey Queue: %d/%d\n", pubkeyQueueLen, pubkeyQueueCap)
-			fmt.Printf("Processed Events: %d\n", eventCounter.Load())
-			fmt.Printf("Walks changed since last scan: %v\n", walksChanged.Load())
-			fmt.Printf("Goroutines: %d\n", goroutines)
-			fmt.Printf("Memory Usage: %.2f MB\n", float64(memStats.Alloc)/(1024*1024))
-			fmt.Println("---------------------------------------")
-		}
-	}
+			return float64(memStats.Alloc)
+		})
 }
 
 // PrintStartup() prints a simple start up message.
@@ -0,0 +1,74 @@
+// The import command seeds an empty Redis instance from a dump of follow-lists,
+// so that the crawler can start from a converged graph instead of INIT_PUBKEYS.
+//
+// Usage:
+//
+//	go run ./cmd/import -dump follow-lists.jsonl [-redis localhost:6379] [-batch 10000] [-workers 8]
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/crawler"
+	"github.com/vertex-lab/crawler/pkg/database/redisdb"
+	"github.com/vertex-lab/crawler/pkg/importer"
+	"github.com/vertex-lab/crawler/pkg/store/redistore"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := importer.NewConfig()
+	dumpPath := flag.String("dump", "", "path to the newline-delimited dump of kind:3 events")
+	redisAddress := flag.String("redis", "localhost:6379", "address of the (empty) redis instance")
+	flag.IntVar(&config.BatchSize, "batch", config.BatchSize, "number of pubkeys added to the database at once")
+	flag.IntVar(&config.Generate.Workers, "workers", config.Generate.Workers, "number of goroutines generating the random walks")
+	flag.Parse()
+
+	if *dumpPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config.Print()
+	go crawler.HandleSignals(cancel, config.Log)
+
+	dump, err := os.Open(*dumpPath)
+	if err != nil {
+		panic("failed to open the dump: " + err.Error())
+	}
+	defer dump.Close()
+
+	redis := redis.NewClient(&redis.Options{Addr: *redisAddress})
+	size, err := redis.DBSize(ctx).Result()
+	if err != nil {
+		panic("failed to connect to redis: " + err.Error())
+	}
+
+	if size != 0 {
+		panic("redis is not empty: the import can only seed a fresh instance")
+	}
+
+	DB, err := redisdb.NewDatabase(ctx, redis)
+	if err != nil {
+		panic("failed to connect to the database: " + err.Error())
+	}
+
+	RWS, err := redistore.NewRWS(ctx, redis, 0.85, 100)
+	if err != nil {
+		panic("failed to connect to the random walk store: " + err.Error())
+	}
+
+	start := time.Now()
+	stats, err := importer.Import(ctx, config, DB, RWS, dump)
+	if err != nil {
+		panic(err)
+	}
+
+	config.Log.Info("import completed in %v: %v", time.Since(start), stats)
+}
@@ -0,0 +1,107 @@
+// The snapshot command exports the state held in Redis into a binary snapshot,
+// or restores a snapshot into an empty Redis instance.
+//
+// Usage:
+//
+//	go run ./cmd/snapshot -export state.snap [-redis localhost:6379]
+//	go run ./cmd/snapshot -import state.snap [-redis localhost:6379]
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/database/redisdb"
+	"github.com/vertex-lab/crawler/pkg/snapshot"
+	"github.com/vertex-lab/crawler/pkg/store/redistore"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+func main() {
+	ctx := context.Background()
+	log := logger.New(os.Stdout)
+
+	exportPath := flag.String("export", "", "path of the snapshot to write")
+	importPath := flag.String("import", "", "path of the snapshot to restore into an empty redis")
+	redisAddress := flag.String("redis", "localhost:6379", "address of the redis instance")
+	flag.Parse()
+
+	if (*exportPath == "") == (*importPath == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	redis := redis.NewClient(&redis.Options{Addr: *redisAddress})
+	size, err := redis.DBSize(ctx).Result()
+	if err != nil {
+		panic("failed to connect to redis: " + err.Error())
+	}
+
+	start := time.Now()
+	switch {
+	case *exportPath != "":
+		DB, err := redisdb.NewDatabaseConnection(ctx, redis)
+		if err != nil {
+			panic("failed to connect to the database: " + err.Error())
+		}
+
+		RWS, err := redistore.NewRWSConnection(ctx, redis)
+		if err != nil {
+			panic("failed to connect to the random walk store: " + err.Error())
+		}
+
+		file, err := os.Create(*exportPath)
+		if err != nil {
+			panic("failed to create the snapshot: " + err.Error())
+		}
+		defer file.Close()
+
+		if err := snapshot.Export(ctx, DB, RWS, file); err != nil {
+			panic(err)
+		}
+
+		log.Info("exported snapshot to %s in %v", *exportPath, time.Since(start))
+
+	case *importPath != "":
+		if size != 0 {
+			panic("redis is not empty: a snapshot can only be restored into a fresh instance")
+		}
+
+		file, err := os.Open(*importPath)
+		if err != nil {
+			panic("failed to open the snapshot: " + err.Error())
+		}
+		defer file.Close()
+
+		// the RWS is created with the parameters of the snapshot
+		header, err := snapshot.ReadHeader(file)
+		if err != nil {
+			panic(err)
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			panic(err)
+		}
+
+		DB, err := redisdb.NewDatabase(ctx, redis)
+		if err != nil {
+			panic("failed to connect to the database: " + err.Error())
+		}
+
+		RWS, err := redistore.NewRWS(ctx, redis, header.Alpha, header.WalksPerNode)
+		if err != nil {
+			panic("failed to connect to the random walk store: " + err.Error())
+		}
+
+		remap, err := snapshot.Import(ctx, DB, RWS, file)
+		if err != nil {
+			panic(err)
+		}
+
+		log.Info("imported %d nodes from %s in %v", len(remap), *importPath, time.Since(start))
+	}
+}
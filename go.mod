@@ -11,6 +11,7 @@ replace github.com/nbd-wtf/go-nostr => ../go-nostr
 require (
 	github.com/deckarep/golang-set/v2 v2.6.0
 	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.24
 	github.com/nbd-wtf/go-nostr v0.49.7
 	github.com/redis/go-redis/v9 v9.7.0
 	github.com/vertex-lab/relay v0.0.0-20250223154722-5f7589ff7e3e
@@ -27,7 +28,6 @@ require (
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
-	github.com/mattn/go-sqlite3 v1.14.24 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/puzpuzpuz/xsync/v3 v3.4.0 // indirect
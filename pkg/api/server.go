@@ -0,0 +1,571 @@
+// The api package exposes the global and personalized pageranks, the follow
+// recommendations, as well as the metadata of nodes, through a JSON HTTP API.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/pagerank"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+)
+
+type ServerConfig struct {
+	Log       *logger.Aggregate
+	Address   string // if empty, the server is not started
+	MaxTopK   uint16
+	MaxPubkey int // the maximum number of pubkeys per request
+	Timeout   time.Duration
+	Rand      *randutils.Source // if nil, the pageranks are computed with time-seeded generators
+
+	// reporters are reputable if visited by ReputableMultiplier * walksPerNode walks
+	ReputableMultiplier float64
+}
+
+func NewServerConfig() ServerConfig {
+	return ServerConfig{
+		Log:       logger.New(os.Stdout),
+		Address:   "",
+		MaxTopK:   1000,
+		MaxPubkey: 1000,
+		Timeout:   10 * time.Second,
+
+		ReputableMultiplier: 1.0,
+	}
+}
+
+func (c ServerConfig) Print() {
+	fmt.Printf("API\n")
+	fmt.Printf("  Address: %s\n", c.Address)
+	fmt.Printf("  MaxTopK: %d\n", c.MaxTopK)
+	fmt.Printf("  MaxPubkey: %d\n", c.MaxPubkey)
+	fmt.Printf("  Timeout: %v\n", c.Timeout)
+	fmt.Printf("  ReputableMultiplier: %f\n", c.ReputableMultiplier)
+}
+
+// Server handles the HTTP requests by querying the Database and the RandomWalkStore.
+type Server struct {
+	config ServerConfig
+	DB     models.Database
+	RWS    models.RandomWalkStore
+	mux    *http.ServeMux
+}
+
+// NewServer() returns a Server with all the routes registered.
+func NewServer(config ServerConfig, DB models.Database, RWS models.RandomWalkStore) *Server {
+	s := &Server{
+		config: config,
+		DB:     DB,
+		RWS:    RWS,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /rank/global", s.handleGlobal)
+	s.mux.HandleFunc("GET /rank/top", s.handleTop)
+	s.mux.HandleFunc("POST /rank/personalized", s.handlePersonalized)
+	s.mux.HandleFunc("GET /recommend/{pubkey}", s.handleRecommend)
+	s.mux.HandleFunc("GET /node/{pubkey}", s.handleNode)
+	s.mux.HandleFunc("GET /reports/{pubkey}", s.handleReports)
+	return s
+}
+
+// Handle() registers an additional handler, for example to expose metrics.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+/*
+Serve() starts the HTTP server on config.Address and blocks until the context
+is cancelled, after which the server is gracefully shut down.
+*/
+func Serve(
+	ctx context.Context,
+	config ServerConfig,
+	DB models.Database,
+	RWS models.RandomWalkStore) {
+
+	ServeHandler(ctx, config, NewServer(config, DB, RWS))
+}
+
+// ServeHandler() is like Serve(), but it uses the provided handler.
+func ServeHandler(ctx context.Context, config ServerConfig, handler http.Handler) {
+	server := &http.Server{
+		Addr:              config.Address,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		config.Log.Info("  > API: shutting down the server... ")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	config.Log.Info("API: listening on %s", config.Address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		config.Log.Error("API: %v", err)
+	}
+}
+
+// NodeResponse contains the metadata and the global pagerank of a node.
+type NodeResponse struct {
+	Pubkey    string     `json:"pubkey"`
+	ID        uint32     `json:"id"`
+	Status    string     `json:"status"`
+	Rank      float64    `json:"rank"`
+	Follows   int        `json:"follows"`
+	Followers int        `json:"followers"`
+	MutedBy   int        `json:"mutedBy"`
+	MuteRatio float64    `json:"muteRatio"`
+	Added     *time.Time `json:"added,omitempty"`
+	Promoted  *time.Time `json:"promoted,omitempty"`
+	Demoted   *time.Time `json:"demoted,omitempty"`
+}
+
+// RankEntry associates a pubkey with its pagerank score. MutedBy and MuteRatio
+// are negative signals that help flagging spam accounts with a decent rank.
+type RankEntry struct {
+	Pubkey    string  `json:"pubkey"`
+	Rank      float64 `json:"rank"`
+	Status    string  `json:"status,omitempty"`
+	Follows   int     `json:"follows"`
+	Followers int     `json:"followers"`
+	MutedBy   int     `json:"mutedBy"`
+	MuteRatio float64 `json:"muteRatio"`
+}
+
+type GlobalResponse struct {
+	Ranks    []RankEntry `json:"ranks"`
+	NotFound []string    `json:"notFound,omitempty"`
+}
+
+type TopResponse struct {
+	Offset int         `json:"offset"`
+	Ranks  []RankEntry `json:"ranks"`
+}
+
+type PersonalizedRequest struct {
+	Source string `json:"source"`
+	TopK   uint16 `json:"topK"`
+}
+
+type PersonalizedResponse struct {
+	Source string      `json:"source"`
+	Ranks  []RankEntry `json:"ranks"`
+}
+
+type RecommendResponse struct {
+	Source          string                    `json:"source"`
+	Recommendations []pagerank.Recommendation `json:"recommendations"`
+}
+
+type ReportsResponse struct {
+	Pubkey  string                   `json:"pubkey"`
+	Reports []pagerank.ReportSummary `json:"reports"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// handleGlobal() returns the global pagerank of the pubkeys specified in the query.
+// Pubkeys can be specified as repeated parameters or as a comma separated list.
+func (s *Server) handleGlobal(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	pubkeys := parsePubkeys(r.URL.Query()["pubkey"])
+	if len(pubkeys) == 0 {
+		s.writeError(w, http.StatusBadRequest, ErrMissingPubkey)
+		return
+	}
+
+	if len(pubkeys) > s.config.MaxPubkey {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: max is %d", ErrTooManyPubkeys, s.config.MaxPubkey))
+		return
+	}
+
+	IDs, err := s.DB.NodeIDs(ctx, pubkeys...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var response GlobalResponse
+	nodeIDs := make([]uint32, 0, len(IDs))
+	found := make([]string, 0, len(IDs))
+	for i, ID := range IDs {
+		if ID == nil {
+			response.NotFound = append(response.NotFound, pubkeys[i])
+			continue
+		}
+
+		nodeIDs = append(nodeIDs, *ID)
+		found = append(found, pubkeys[i])
+	}
+
+	response.Ranks, err = s.rankEntries(ctx, nodeIDs, found, true)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleTop() returns the topK nodes by global pagerank, skipping the first offset.
+// Both are query parameters, and offset defaults to 0.
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	query := r.URL.Query()
+	topK, err := strconv.Atoi(query.Get("topK"))
+	if err != nil || topK <= 0 || topK > int(s.config.MaxTopK) {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: must be in [1, %d]", ErrInvalidTopK, s.config.MaxTopK))
+		return
+	}
+
+	offset := 0
+	if query.Has("offset") {
+		offset, err = strconv.Atoi(query.Get("offset"))
+		if err != nil || offset < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: must be a non-negative integer", ErrInvalidOffset))
+			return
+		}
+	}
+
+	nodeIDs, err := s.RWS.TopNodes(ctx, topK, offset)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	pks, err := s.DB.Pubkeys(ctx, nodeIDs...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found := make([]uint32, 0, len(nodeIDs))
+	pubkeys := make([]string, 0, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if pks[i] == nil {
+			continue
+		}
+
+		found = append(found, ID)
+		pubkeys = append(pubkeys, *pks[i])
+	}
+
+	response := TopResponse{Offset: offset}
+	response.Ranks, err = s.rankEntries(ctx, found, pubkeys, true)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handlePersonalized() returns the topK nodes by personalized pagerank of the source.
+func (s *Server) handlePersonalized(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	var request PersonalizedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidBody, err))
+		return
+	}
+
+	if request.TopK == 0 || request.TopK > s.config.MaxTopK {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: must be in [1, %d]", ErrInvalidTopK, s.config.MaxTopK))
+		return
+	}
+
+	IDs, err := s.DB.NodeIDs(ctx, request.Source)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(IDs) != 1 || IDs[0] == nil {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", models.ErrNodeNotFoundDB, request.Source))
+		return
+	}
+
+	pp, err := pagerank.Personalized(ctx, s.config.Rand, s.DB, s.RWS, *IDs[0], request.TopK)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	nodeIDs := pagerank.TopNodes(pp, int(request.TopK))
+	pks, err := s.DB.Pubkeys(ctx, nodeIDs...)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := PersonalizedResponse{
+		Source: request.Source,
+		Ranks:  make([]RankEntry, 0, len(nodeIDs)),
+	}
+
+	found := make([]uint32, 0, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if pks[i] == nil {
+			continue
+		}
+
+		found = append(found, ID)
+		response.Ranks = append(response.Ranks, RankEntry{Pubkey: *pks[i], Rank: pp[ID]})
+	}
+
+	if err := s.fillCounts(ctx, response.Ranks, found); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleRecommend() returns up to topK pubkeys that the specified pubkey doesn't
+// follow, ranked by personalized pagerank and with the data that explains them.
+func (s *Server) handleRecommend(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	topK, err := strconv.Atoi(r.URL.Query().Get("topK"))
+	if err != nil || topK <= 0 || topK > int(s.config.MaxTopK) {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: must be in [1, %d]", ErrInvalidTopK, s.config.MaxTopK))
+		return
+	}
+
+	pubkey := r.PathValue("pubkey")
+	recs, err := pagerank.Recommend(ctx, s.config.Rand, s.DB, s.RWS, pubkey, uint16(topK))
+	if errors.Is(err, models.ErrNodeNotFoundDB) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, RecommendResponse{Source: pubkey, Recommendations: recs})
+}
+
+// handleNode() returns the metadata and global pagerank of the node with the specified pubkey.
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	pubkey := r.PathValue("pubkey")
+	node, err := s.DB.NodeByKey(ctx, pubkey)
+	if errors.Is(err, models.ErrNodeNotFoundDB) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	entries, err := s.rankEntries(ctx, []uint32{node.ID}, []string{pubkey}, false)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := NodeResponse{
+		Pubkey:    node.Pubkey,
+		ID:        node.ID,
+		Status:    node.Status,
+		Rank:      entries[0].Rank,
+		Follows:   entries[0].Follows,
+		Followers: entries[0].Followers,
+		MutedBy:   entries[0].MutedBy,
+		MuteRatio: entries[0].MuteRatio,
+		Added:     node.Added(),
+		Promoted:  node.Promoted(),
+		Demoted:   node.Demoted(),
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleReports() returns the reports received by the node with the specified pubkey,
+// grouped by type and weighted by the global pagerank of the reporters.
+func (s *Server) handleReports(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+	defer cancel()
+
+	pubkey := r.PathValue("pubkey")
+	node, err := s.DB.NodeByKey(ctx, pubkey)
+	if errors.Is(err, models.ErrNodeNotFoundDB) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	reports, err := s.DB.Reports(ctx, node.ID)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	threshold := pagerank.ReputableThreshold(ctx, s.RWS, s.config.ReputableMultiplier)
+	summaries, err := pagerank.WeightReports(ctx, s.RWS, reports[0], threshold)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, ReportsResponse{Pubkey: pubkey, Reports: summaries})
+}
+
+// rankEntries() returns the global pagerank and counts of the nodeIDs, which
+// correspond to the pubkeys. If withStatus is true, the status of the nodes is also fetched, with a single call.
+func (s *Server) rankEntries(
+	ctx context.Context,
+	nodeIDs []uint32,
+	pubkeys []string,
+	withStatus bool) ([]RankEntry, error) {
+
+	if len(nodeIDs) == 0 {
+		return []RankEntry{}, nil
+	}
+
+	ranks, err := pagerank.Global(ctx, s.RWS, nodeIDs...)
+	if err != nil && !errors.Is(err, models.ErrEmptyRWS) {
+		return nil, err
+	}
+
+	entries := make([]RankEntry, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		entries[i] = RankEntry{Pubkey: pubkeys[i], Rank: ranks[ID]}
+	}
+
+	if withStatus {
+		nodes, err := s.DB.Nodes(ctx, nodeIDs...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, node := range nodes {
+			if node == nil {
+				return nil, fmt.Errorf("%w: nodeID %d", models.ErrNodeNotFoundDB, nodeIDs[i])
+			}
+			entries[i].Status = node.Status
+		}
+	}
+
+	if err := s.fillCounts(ctx, entries, nodeIDs); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// fillCounts() sets the follow, follower and mute counts of each entry, which correspond to the nodeIDs.
+func (s *Server) fillCounts(ctx context.Context, entries []RankEntry, nodeIDs []uint32) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	follows, err := s.DB.FollowCounts(ctx, nodeIDs...)
+	if err != nil {
+		return err
+	}
+
+	followers, err := s.DB.FollowerCounts(ctx, nodeIDs...)
+	if err != nil {
+		return err
+	}
+
+	mutedBy, err := s.DB.MutedByCounts(ctx, nodeIDs...)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		entries[i].Follows = follows[i]
+		entries[i].Followers = followers[i]
+		entries[i].MutedBy = mutedBy[i]
+		entries[i].MuteRatio = MuteRatio(followers[i], mutedBy[i])
+	}
+
+	return nil
+}
+
+// MuteRatio() returns the fraction of the users that muted the node, among
+// those who expressed an opinion about it (by following or muting).
+func MuteRatio(followers, mutedBy int) float64 {
+	if followers+mutedBy == 0 {
+		return 0
+	}
+	return float64(mutedBy) / float64(followers+mutedBy)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.config.Log.Error("API: failed to encode response: %v", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// ------------------------------------HELPERS----------------------------------
+
+// parsePubkeys() splits comma separated values and removes the empty ones.
+func parsePubkeys(values []string) []string {
+	pubkeys := make([]string, 0, len(values))
+	for _, val := range values {
+		for _, pk := range strings.Split(val, ",") {
+			pk = strings.TrimSpace(pk)
+			if pk != "" {
+				pubkeys = append(pubkeys, pk)
+			}
+		}
+	}
+
+	return pubkeys
+}
+
+//---------------------------------ERROR-CODES---------------------------------
+
+var (
+	ErrMissingPubkey  = errors.New("missing pubkey parameter")
+	ErrTooManyPubkeys = errors.New("too many pubkeys")
+	ErrInvalidBody    = errors.New("invalid request body")
+	ErrInvalidTopK    = errors.New("invalid topK")
+	ErrInvalidOffset  = errors.New("invalid offset")
+)
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/pagerank"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+func setupServer(DBType, RWSType string) *Server {
+	config := NewServerConfig()
+	config.Log = logger.New(os.Stdout)
+	return NewServer(config, mockdb.SetupDB(DBType), mockstore.SetupRWS(RWSType))
+}
+
+func TestGlobal(t *testing.T) {
+	testCases := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedRanks    []RankEntry
+		expectedNotFound []string
+	}{
+		{
+			name:           "missing pubkey",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "pubkey not found",
+			query:          "?pubkey=69",
+			expectedStatus: http.StatusOK,
+			expectedRanks:  []RankEntry{},
+			expectedNotFound: []string{
+				"69",
+			},
+		},
+		{
+			name:           "valid",
+			query:          "?pubkey=0,1&pubkey=69",
+			expectedStatus: http.StatusOK,
+			expectedRanks: []RankEntry{
+				{Pubkey: "0", Rank: 1.0 / 3.0, Follows: 1, Followers: 1},
+				{Pubkey: "1", Rank: 1.0 / 3.0, Follows: 1, Followers: 1},
+			},
+			expectedNotFound: []string{"69"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("triangle", "triangle")
+			request := httptest.NewRequest(http.MethodGet, "/rank/global"+test.query, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("GET /rank/global: expected status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response GlobalResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if !reflect.DeepEqual(response.Ranks, test.expectedRanks) {
+				t.Errorf("GET /rank/global: expected ranks %v, got %v", test.expectedRanks, response.Ranks)
+			}
+
+			if !reflect.DeepEqual(response.NotFound, test.expectedNotFound) {
+				t.Errorf("GET /rank/global: expected not found %v, got %v", test.expectedNotFound, response.NotFound)
+			}
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	testCases := []struct {
+		name            string
+		query           string
+		expectedStatus  int
+		expectedPubkeys []string
+	}{
+		{
+			name:           "missing topK",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "topK too big",
+			query:          "?topK=1001",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative offset",
+			query:          "?topK=1&offset=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "offset too big",
+			query:           "?topK=2&offset=3",
+			expectedStatus:  http.StatusOK,
+			expectedPubkeys: []string{},
+		},
+		{
+			name:            "valid",
+			query:           "?topK=2&offset=1",
+			expectedStatus:  http.StatusOK,
+			expectedPubkeys: []string{"1", "2"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("triangle", "triangle")
+			request := httptest.NewRequest(http.MethodGet, "/rank/top"+test.query, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("GET /rank/top: expected status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response TopResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			pubkeys := make([]string, len(response.Ranks))
+			for i, entry := range response.Ranks {
+				pubkeys[i] = entry.Pubkey
+			}
+
+			if !reflect.DeepEqual(pubkeys, test.expectedPubkeys) {
+				t.Errorf("GET /rank/top: expected pubkeys %v, got %v", test.expectedPubkeys, pubkeys)
+			}
+		})
+	}
+}
+
+func TestPersonalized(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedLen    int
+	}{
+		{
+			name:           "invalid body",
+			body:           "{",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid topK",
+			body:           `{"source": "0", "topK": 0}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "source not found",
+			body:           `{"source": "69", "topK": 5}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "valid",
+			body:           `{"source": "0", "topK": 2}`,
+			expectedStatus: http.StatusOK,
+			expectedLen:    2,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("triangle", "triangle")
+			request := httptest.NewRequest(http.MethodPost, "/rank/personalized", bytes.NewBufferString(test.body))
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("POST /rank/personalized: expected status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response PersonalizedResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if len(response.Ranks) != test.expectedLen {
+				t.Fatalf("POST /rank/personalized: expected %d ranks, got %v", test.expectedLen, response.Ranks)
+			}
+
+			for i := 1; i < len(response.Ranks); i++ {
+				if response.Ranks[i-1].Rank < response.Ranks[i].Rank {
+					t.Errorf("POST /rank/personalized: ranks are not sorted: %v", response.Ranks)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	testCases := []struct {
+		name            string
+		path            string
+		expectedStatus  int
+		expectedPubkeys []string
+	}{
+		{
+			name:           "invalid topK",
+			path:           "/recommend/0?topK=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "source not found",
+			path:           "/recommend/69?topK=5",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:            "valid",
+			path:            "/recommend/0?topK=5",
+			expectedStatus:  http.StatusOK,
+			expectedPubkeys: []string{"2"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("triangle", "triangle")
+			request := httptest.NewRequest(http.MethodGet, test.path, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("GET %s: expected status %d, got %d: %s", test.path, test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response RecommendResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			pubkeys := make([]string, len(response.Recommendations))
+			for i, rec := range response.Recommendations {
+				pubkeys[i] = rec.Pubkey
+			}
+
+			if !reflect.DeepEqual(pubkeys, test.expectedPubkeys) {
+				t.Errorf("GET %s: expected pubkeys %v, got %v", test.path, test.expectedPubkeys, pubkeys)
+			}
+		})
+	}
+}
+
+func TestNode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		pubkey           string
+		expectedStatus   int
+		expectedResponse NodeResponse
+	}{
+		{
+			name:           "node not found",
+			pubkey:         "69",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "valid",
+			pubkey:         "1",
+			expectedStatus: http.StatusOK,
+			expectedResponse: NodeResponse{
+				Pubkey:    "1",
+				ID:        1,
+				Status:    models.StatusActive,
+				Rank:      0.5,
+				Follows:   0,
+				Followers: 1,
+			},
+		},
+		{
+			name:           "muted",
+			pubkey:         "0",
+			expectedStatus: http.StatusOK,
+			expectedResponse: NodeResponse{
+				Pubkey:    "0",
+				ID:        0,
+				Status:    models.StatusInactive,
+				Rank:      0.5,
+				Follows:   1,
+				Followers: 0,
+				MutedBy:   1,
+				MuteRatio: 1,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("simple", "simple")
+			request := httptest.NewRequest(http.MethodGet, "/node/"+test.pubkey, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("GET /node: expected status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response NodeResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if !reflect.DeepEqual(response, test.expectedResponse) {
+				t.Errorf("GET /node: expected %v, got %v", test.expectedResponse, response)
+			}
+		})
+	}
+}
+
+func TestReports(t *testing.T) {
+	testCases := []struct {
+		name             string
+		pubkey           string
+		expectedStatus   int
+		expectedResponse ReportsResponse
+	}{
+		{
+			name:           "node not found",
+			pubkey:         "69",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "no reports",
+			pubkey:         "1",
+			expectedStatus: http.StatusOK,
+			expectedResponse: ReportsResponse{
+				Pubkey:  "1",
+				Reports: []pagerank.ReportSummary{},
+			},
+		},
+		{
+			name:           "valid",
+			pubkey:         "0",
+			expectedStatus: http.StatusOK,
+			expectedResponse: ReportsResponse{
+				Pubkey: "0",
+				Reports: []pagerank.ReportSummary{
+					{Type: "spam", Reporters: 1, Reputable: 0, Weight: 0},
+				},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := setupServer("simple", "simple")
+			request := httptest.NewRequest(http.MethodGet, "/reports/"+test.pubkey, nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.expectedStatus {
+				t.Fatalf("GET /reports: expected status %d, got %d: %s", test.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if recorder.Code != http.StatusOK {
+				return
+			}
+
+			var response ReportsResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if !reflect.DeepEqual(response, test.expectedResponse) {
+				t.Errorf("GET /reports: expected %v, got %v", test.expectedResponse, response)
+			}
+		})
+	}
+}
@@ -9,15 +9,19 @@ import (
 
 	"github.com/vertex-lab/crawler/pkg/models"
 	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/walks"
 )
 
 type NodeArbiterConfig struct {
 	Log                 *logger.Aggregate
+	Metrics             *Metrics          // if nil, no metrics are recorded
+	Rand                *randutils.Source // if nil, the walks are generated with time-seeded generators
 	ActivationThreshold float64
 	PromotionMultiplier float64
 	DemotionMultiplier  float64
 	PromotionWaitPeriod time.Duration
+	Interval            time.Duration // how often the arbiter checks whether to scan
 }
 
 func NewNodeArbiterConfig() NodeArbiterConfig {
@@ -27,6 +31,7 @@ func NewNodeArbiterConfig() NodeArbiterConfig {
 		PromotionMultiplier: 0.1,
 		DemotionMultiplier:  1.05,
 		PromotionWaitPeriod: time.Hour,
+		Interval:            10 * time.Second,
 	}
 }
 
@@ -36,6 +41,7 @@ func (c NodeArbiterConfig) Print() {
 	fmt.Printf("  Promotion: %f\n", c.PromotionMultiplier)
 	fmt.Printf("  Demotion: %f\n", c.DemotionMultiplier)
 	fmt.Printf("  WaitPeriod: %v\n", c.PromotionWaitPeriod)
+	fmt.Printf("  Interval: %v\n", c.Interval)
 }
 
 // NodeArbiter() activates when pagerankTotal > threshold. When that happens it:
@@ -52,7 +58,7 @@ func NodeArbiter(
 	var totalWalks float64
 	var changeRatio float64
 
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(config.Interval)
 	defer ticker.Stop()
 
 	for {
@@ -66,7 +72,9 @@ func NodeArbiter(
 			changeRatio = float64(walksChanged.Load()) / totalWalks
 
 			if changeRatio >= config.ActivationThreshold {
+				start := time.Now()
 				promoted, demoted, err := ArbiterScan(ctx, config, DB, RWS, queueHandler)
+				config.Metrics.ArbiterScanned(promoted, demoted, time.Since(start))
 				if err != nil {
 					config.Log.Error("%v", err)
 					continue
@@ -134,7 +142,7 @@ func ArbiterScan(
 					demoted++
 
 				case shouldPromote(node, visits[i], walksPerNode, config):
-					if err := PromoteNode(opCtx, DB, RWS, ID); err != nil {
+					if err := PromoteNode(opCtx, config.Rand, DB, RWS, ID); err != nil {
 						return fmt.Errorf("failed to promote node %d: %w", ID, err)
 					}
 
@@ -191,11 +199,12 @@ func shouldPromote(node *models.Node, visits int, walksPerNode uint16, config No
 // PromoteNode() makes a node active, which means it generates random walks for it and updates the status to active.
 func PromoteNode(
 	ctx context.Context,
+	src *randutils.Source,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32) error {
 
-	if err := walks.Generate(ctx, DB, RWS, nodeID); err != nil {
+	if err := walks.Generate(ctx, src, DB, RWS, nodeID); err != nil {
 		return fmt.Errorf("failed to generate walks: %w", err)
 	}
 
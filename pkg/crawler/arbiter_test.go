@@ -8,6 +8,7 @@ import (
 	"slices"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
 	"github.com/vertex-lab/crawler/pkg/models"
@@ -171,6 +172,7 @@ func TestNodeArbiter(t *testing.T) {
 		ActivationThreshold: 0,
 		PromotionMultiplier: 0,
 		DemotionMultiplier:  0,
+		Interval:            10 * time.Second,
 	}
 
 	go HandleSignals(cancel, config.Log)
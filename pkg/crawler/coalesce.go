@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/queue"
+)
+
+// CoalescedKinds are the kinds for which only the newest event of each author in a batch is processed.
+var CoalescedKinds = []int{
+	nostr.KindFollowList,
+	nostr.KindProfileMetadata,
+}
+
+/*
+Coalesce() splits the messages into the latest, which should be processed, and those
+superseded by a newer event of the same author and kind, which can be skipped.
+Only events of the CoalescedKinds can be superseded, and the order of the messages is preserved.
+
+Like for replaceable events (NIP-01), an event is newer if it has a later created_at,
+or the same created_at and a lower ID.
+*/
+func Coalesce(msgs []queue.Message) (latest, superseded []queue.Message) {
+	type key struct {
+		pubkey string
+		kind   int
+	}
+
+	newest := make(map[key]*nostr.Event, len(msgs))
+	for _, msg := range msgs {
+		if msg.Event == nil || !slices.Contains(CoalescedKinds, msg.Event.Kind) {
+			continue
+		}
+
+		k := key{pubkey: msg.Event.PubKey, kind: msg.Event.Kind}
+		if e, exists := newest[k]; !exists || isNewer(msg.Event, e) {
+			newest[k] = msg.Event
+		}
+	}
+
+	latest = make([]queue.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.Event == nil || !slices.Contains(CoalescedKinds, msg.Event.Kind) {
+			latest = append(latest, msg)
+			continue
+		}
+
+		k := key{pubkey: msg.Event.PubKey, kind: msg.Event.Kind}
+		if newest[k] == msg.Event {
+			latest = append(latest, msg)
+			continue
+		}
+
+		superseded = append(superseded, msg)
+	}
+
+	return latest, superseded
+}
+
+// isNewer() returns whether the event e1 replaces e2.
+func isNewer(e1, e2 *nostr.Event) bool {
+	if e1.CreatedAt != e2.CreatedAt {
+		return e1.CreatedAt > e2.CreatedAt
+	}
+	return e1.ID < e2.ID
+}
+
+/*
+readWindow() reads up to count messages from the queue, waiting up to block for the first.
+Once the first messages arrive, it keeps reading until count messages or the window elapses,
+to give the events of the same author a chance to be coalesced.
+
+Because the messages read are delivered, errors after the first read are logged and the
+messages read so far are returned.
+*/
+func readWindow(
+	ctx context.Context,
+	config ProcessEventsConfig,
+	events queue.Queue,
+	count int,
+	block time.Duration) ([]queue.Message, error) {
+
+	msgs, err := events.Read(ctx, count, block)
+	if err != nil || len(msgs) == 0 || config.CoalesceWindow <= 0 {
+		return msgs, err
+	}
+
+	deadline := time.Now().Add(config.CoalesceWindow)
+	for len(msgs) < count {
+		wait := time.Until(deadline)
+		if wait < time.Millisecond || ctx.Err() != nil {
+			break
+		}
+
+		more, err := events.Read(ctx, count-len(msgs), wait)
+		if err != nil {
+			if ctx.Err() == nil {
+				config.Log.Error("ProcessEvents: failed to read the events: %v", err)
+			}
+			break
+		}
+
+		msgs = append(msgs, more...)
+	}
+
+	return msgs, nil
+}
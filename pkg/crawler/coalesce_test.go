@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/relay/pkg/eventstore"
+)
+
+func TestCoalesce(t *testing.T) {
+	event := func(ID, pubkey string, kind int, createdAt nostr.Timestamp) *nostr.Event {
+		return &nostr.Event{ID: ID, PubKey: pubkey, Kind: kind, CreatedAt: createdAt}
+	}
+
+	testCases := []struct {
+		name               string
+		events             []*nostr.Event
+		expectedLatest     []string
+		expectedSuperseded []string
+	}{
+		{
+			name:               "empty",
+			expectedLatest:     []string{},
+			expectedSuperseded: nil,
+		},
+		{
+			name: "nil event",
+			events: []*nostr.Event{
+				nil,
+				event("a", pip, nostr.KindFollowList, 1),
+			},
+			expectedLatest: []string{"0-0", "1-0"},
+		},
+		{
+			name: "different authors and kinds",
+			events: []*nostr.Event{
+				event("a", pip, nostr.KindFollowList, 1),
+				event("b", calle, nostr.KindFollowList, 2),
+				event("c", pip, nostr.KindProfileMetadata, 3),
+			},
+			expectedLatest: []string{"0-0", "1-0", "2-0"},
+		},
+		{
+			name: "superseded",
+			events: []*nostr.Event{
+				event("a", pip, nostr.KindFollowList, 1),
+				event("b", pip, nostr.KindProfileMetadata, 1),
+				event("c", pip, nostr.KindFollowList, 3),
+				event("d", pip, nostr.KindProfileMetadata, 2),
+				event("e", pip, nostr.KindFollowList, 2),
+			},
+			expectedLatest:     []string{"2-0", "3-0"},
+			expectedSuperseded: []string{"0-0", "1-0", "4-0"},
+		},
+		{
+			name: "same created_at",
+			events: []*nostr.Event{
+				event("b", pip, nostr.KindFollowList, 1),
+				event("a", pip, nostr.KindFollowList, 1),
+			},
+			expectedLatest:     []string{"1-0"},
+			expectedSuperseded: []string{"0-0"},
+		},
+		{
+			name: "other kinds are not coalesced",
+			events: []*nostr.Event{
+				event("a", pip, nostr.KindMuteList, 1),
+				event("b", pip, nostr.KindMuteList, 2),
+				event("c", pip, nostr.KindReporting, 3),
+			},
+			expectedLatest: []string{"0-0", "1-0", "2-0"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			msgs := make([]queue.Message, len(test.events))
+			for i, event := range test.events {
+				msgs[i] = queue.Message{ID: fmt.Sprintf("%d-0", i), Event: event}
+			}
+
+			latest, superseded := Coalesce(msgs)
+			if !reflect.DeepEqual(messageIDs(latest), test.expectedLatest) {
+				t.Errorf("Coalesce(): expected latest %v, got %v", test.expectedLatest, messageIDs(latest))
+			}
+
+			if !reflect.DeepEqual(messageIDs(superseded), test.expectedSuperseded) {
+				t.Errorf("Coalesce(): expected superseded %v, got %v", test.expectedSuperseded, messageIDs(superseded))
+			}
+		})
+	}
+}
+
+func TestReadWindow(t *testing.T) {
+	ctx := context.Background()
+	events, _ := queue.NewMemoryQueue(10)
+	config := ProcessEventsConfig{Log: logger.New(os.Stdout), CoalesceWindow: 200 * time.Millisecond}
+
+	go func() {
+		events.Push(ctx, followList("a", pip, 1))
+		time.Sleep(50 * time.Millisecond)
+		events.Push(ctx, followList("b", pip, 2))
+	}()
+
+	msgs, err := readWindow(ctx, config, events, 10, time.Second)
+	if err != nil {
+		t.Fatalf("readWindow(): expected nil, got %v", err)
+	}
+
+	if len(msgs) != 2 {
+		t.Errorf("readWindow(): expected 2 messages, got %d", len(msgs))
+	}
+}
+
+func TestProcessEventsCoalesce(t *testing.T) {
+	DB := mockdb.SetupDB("pip")
+	RWS := mockstore.SetupRWS("one-node0")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	ctx := context.Background()
+	events, _ := queue.NewMemoryQueue(10)
+	for i, follows := range [][]string{{odell}, {odell, calle}, {calle}} {
+		ID := fmt.Sprintf("pip:%d", i)
+		if _, err := events.Push(ctx, followList(ID, pip, nostr.Timestamp(100+i), follows...)); err != nil {
+			t.Fatalf("Push(): expected nil, got %v", err)
+		}
+	}
+
+	eventCounter := &atomic.Uint32{}
+	func() {
+		ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer cancel()
+		config := ProcessEventsConfig{Log: logger.New(os.Stdout), PrintEvery: 1000, BatchSize: 10, CoalesceWindow: 50 * time.Millisecond}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, eventCounter, &atomic.Uint32{})
+	}()
+
+	if eventCounter.Load() != 1 {
+		t.Errorf("expected 1 processed event, got %d", eventCounter.Load())
+	}
+
+	if length, _ := events.Len(ctx); length != 0 {
+		t.Errorf("Len(): expected 0, got %d", length)
+	}
+
+	// only the latest follow-list was processed, so odell was never added
+	assertStatus(t, DB, map[string]string{calle: models.StatusInactive})
+	if IDs, _ := DB.NodeIDs(ctx, odell); IDs[0] != nil {
+		t.Errorf("expected odell not to be in the DB, got nodeID %d", *IDs[0])
+	}
+}
+
+// messageIDs() returns the IDs of the messages.
+func messageIDs(msgs []queue.Message) []string {
+	if msgs == nil {
+		return nil
+	}
+
+	IDs := make([]string, len(msgs))
+	for i, msg := range msgs {
+		IDs[i] = msg.ID
+	}
+	return IDs
+}
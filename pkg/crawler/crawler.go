@@ -2,23 +2,33 @@ package crawler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
 	"github.com/vertex-lab/crawler/pkg/utils/logger"
 )
 
 var (
+	// the replaceable kinds, fetched by both the Firehose and QueryPubkeys.
 	RelevantKinds = []int{
 		nostr.KindFollowList,
 		nostr.KindProfileMetadata,
+		nostr.KindMuteList,
+		nostr.KindRelayListMetadata,
 	}
 
+	// the kinds fetched by the Firehose. Regular events (e.g. reports) are only
+	// received in real-time, as their history can be arbitrarely large.
+	FirehoseKinds = append([]int{nostr.KindReporting}, RelevantKinds...)
+
 	defaultRelays = []string{
 		"wss://purplepag.es",
 		"wss://njump.me",
@@ -78,19 +88,17 @@ queue for further processing and/or to be written to the database.
 func Firehose(
 	ctx context.Context,
 	config FirehoseConfig,
+	source EventSource,
 	DB models.Database,
 	queueHandler func(event *nostr.Event) error) {
 
-	pool := nostr.NewSimplePool(ctx)
-	defer close(config.Log, pool, "Firehose")
-
 	ts := nostr.Now()
-	filters := nostr.Filters{{
-		Kinds: RelevantKinds,
+	filter := nostr.Filter{
+		Kinds: FirehoseKinds,
 		Since: &ts,
-	}}
+	}
 
-	for event := range pool.SubMany(ctx, config.Relays, filters) {
+	for event := range source.Subscribe(ctx, config.Relays, filter) {
 		ID, err := DB.NodeIDs(ctx, event.PubKey)
 		if err != nil {
 			config.Log.Error("Firehose: failed to fetch ID of %s: %v", event.PubKey, err)
@@ -109,17 +117,21 @@ func Firehose(
 
 type QueryPubkeysConfig struct {
 	Log       *logger.Aggregate
-	Relays    []string
+	Relays    []string // the fallback relays, used for pubkeys without write relays
 	BatchSize int
 	Interval  time.Duration
+
+	// the maximum number of write relays queried for each pubkey
+	MaxRelaysPerPubkey int
 }
 
 func NewQueryPubkeysConfig() QueryPubkeysConfig {
 	return QueryPubkeysConfig{
-		Log:       logger.New(os.Stdout),
-		Relays:    defaultRelays,
-		BatchSize: 50,
-		Interval:  time.Minute,
+		Log:                logger.New(os.Stdout),
+		Relays:             defaultRelays,
+		BatchSize:          50,
+		Interval:           time.Minute,
+		MaxRelaysPerPubkey: 3,
 	}
 }
 
@@ -128,22 +140,23 @@ func (c QueryPubkeysConfig) Print() {
 	fmt.Printf("  Relays: %v\n", c.Relays)
 	fmt.Printf("  BatchSize: %d\n", c.BatchSize)
 	fmt.Printf("  Interval: %v\n", c.Interval)
+	fmt.Printf("  MaxRelaysPerPubkey: %d\n", c.MaxRelaysPerPubkey)
 }
 
 // QueryPubkeys() extracts pubkeys from the pubkeyChan channel, and queries for
 // their events when the batch is bigger than config.batchSize, OR after config.Interval since the last query.
+// Each pubkey is queried from its own write relays, or from config.Relays if it has none.
 func QueryPubkeys(
 	ctx context.Context,
 	config QueryPubkeysConfig,
+	source EventSource,
+	DB models.Database,
 	pubkeyChan <-chan string,
 	queueHandler func(event *nostr.Event) error) {
 
 	batch := make([]string, 0, config.BatchSize)
 	timer := time.After(config.Interval)
 
-	pool := nostr.NewSimplePool(ctx)
-	defer close(config.Log, pool, "QueryPubkeys")
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -160,7 +173,7 @@ func QueryPubkeys(
 				continue
 			}
 
-			if err := QueryPubkeyBatch(ctx, pool, config.Relays, batch, queueHandler); err != nil {
+			if err := queryPubkeys(ctx, config, source, DB, batch, queueHandler); err != nil {
 				config.Log.Error("QueryPubkeys(): %v", err)
 				continue
 			}
@@ -171,7 +184,7 @@ func QueryPubkeys(
 
 		case <-timer:
 
-			if err := QueryPubkeyBatch(ctx, pool, config.Relays, batch, queueHandler); err != nil {
+			if err := queryPubkeys(ctx, config, source, DB, batch, queueHandler); err != nil {
 				config.Log.Error("QueryPubkeys(): %v", err)
 				continue
 			}
@@ -183,39 +196,122 @@ func QueryPubkeys(
 	}
 }
 
-// QueryPubkeyBatch() queries the follow lists of the specified pubkeys.
-// It sends the newest events for each pubkey to the queue using the provided queueHandler.
-func QueryPubkeyBatch(
+// queryPubkeys() groups the pubkeys by relay and queries them with QueryPubkeyBatch.
+func queryPubkeys(
 	ctx context.Context,
-	pool *nostr.SimplePool,
-	relays []string,
+	config QueryPubkeysConfig,
+	source EventSource,
+	DB models.Database,
 	pubkeys []string,
 	queueHandler func(event *nostr.Event) error) error {
 
+	groups, err := GroupByRelay(ctx, DB, pubkeys, config.Relays, config.MaxRelaysPerPubkey)
+	if err != nil {
+		return fmt.Errorf("GroupByRelay(): %w", err)
+	}
+
+	return QueryPubkeyBatch(ctx, source, groups, queueHandler)
+}
+
+// GroupByRelay() returns a map that associates each relay with the pubkeys to be queried there.
+// Each pubkey is assigned to (at most maxRelays of) its write relays, or to all of them if maxRelays is not positive.
+// Pubkeys that are not found or have no write relays are assigned to all the fallback relays.
+func GroupByRelay(
+	ctx context.Context,
+	DB models.Database,
+	pubkeys []string,
+	fallback []string,
+	maxRelays int) (map[string][]string, error) {
+
 	if len(pubkeys) == 0 {
+		return nil, nil
+	}
+
+	IDs, err := DB.NodeIDs(ctx, pubkeys...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the IDs: %w", err)
+	}
+
+	found := make([]uint32, 0, len(IDs))
+	for _, ID := range IDs {
+		if ID != nil {
+			found = append(found, *ID)
+		}
+	}
+
+	relays, err := DB.WriteRelays(ctx, found...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the write relays: %w", err)
+	}
+
+	groups := make(map[string][]string, len(fallback))
+	var j int // index over the found IDs, hence over the relays
+	for i, ID := range IDs {
+		var writeRelays []string
+		if ID != nil {
+			writeRelays = relays[j]
+			j++
+		}
+
+		if len(writeRelays) == 0 {
+			writeRelays = fallback
+		} else if maxRelays > 0 && len(writeRelays) > maxRelays {
+			writeRelays = writeRelays[:maxRelays]
+		}
+
+		for _, relay := range writeRelays {
+			groups[relay] = append(groups[relay], pubkeys[i])
+		}
+	}
+
+	return groups, nil
+}
+
+// QueryPubkeyBatch() queries the events of the specified pubkeys, grouped by relay.
+// It sends the newest events for each pubkey to the queue using the provided queueHandler.
+func QueryPubkeyBatch(
+	ctx context.Context,
+	source EventSource,
+	groups map[string][]string,
+	queueHandler func(event *nostr.Event) error) error {
+
+	if len(groups) == 0 {
 		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*15)
 	defer cancel()
 
-	filter := nostr.Filter{
-		Kinds:   RelevantKinds,
-		Authors: pubkeys,
-	}
-
 	// a map that associates each pair (pubkey,kind) with the latest event from that authors for that kind.
-	latest := make(map[string]*nostr.Event, len(pubkeys)*len(filter.Kinds))
-	for event := range pool.SubManyEose(ctx, relays, nostr.Filters{filter}) {
+	latest := make(map[string]*nostr.Event)
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for relay, pubkeys := range groups {
+		wg.Add(1)
+		go func(relay string, pubkeys []string) {
+			defer wg.Done()
+
+			filter := nostr.Filter{
+				Kinds:   RelevantKinds,
+				Authors: pubkeys,
+			}
 
-		key := fmt.Sprintf("%s:%d", event.PubKey, event.Kind) // "<pubkey>:<kind>"" represent the pair (pubkey, kind)
-		e, exists := latest[key]
+			for event := range source.Query(ctx, []string{relay}, filter) {
+				key := fmt.Sprintf("%s:%d", event.PubKey, event.Kind) // "<pubkey>:<kind>"" represent the pair (pubkey, kind)
 
-		if !exists || event.CreatedAt > e.CreatedAt {
-			latest[key] = event.Event
-		}
+				mu.Lock()
+				e, exists := latest[key]
+				if !exists || event.CreatedAt > e.CreatedAt {
+					latest[key] = event.Event
+				}
+				mu.Unlock()
+			}
+		}(relay, pubkeys)
 	}
 
+	wg.Wait()
+
 	// send only the latest events to the queue.
 	for _, event := range latest {
 		if err := queueHandler(event); err != nil {
@@ -228,8 +324,45 @@ func QueryPubkeyBatch(
 
 // ------------------------------------HELPERS----------------------------------
 
-// Close() iterates over the relays in the pool and closes all connections.
-func close(logger *logger.Aggregate, pool *nostr.SimplePool, funcName string) {
+/*
+Enqueue() returns a queueHandler that pushes the events to the queue, for the specified producer.
+
+When the queue is full, it retries until there is space or the context is cancelled,
+slowing down the producer instead of dropping the events. Events already in the queue
+are recognized by their ID and skipped.
+*/
+func Enqueue(ctx context.Context, q queue.Queue, producer string, m *Metrics) func(event *nostr.Event) error {
+	return func(event *nostr.Event) error {
+		blocked := false
+		for {
+			added, err := q.Push(ctx, event)
+			switch {
+			case err == nil:
+				if !added {
+					m.Duplicate(producer)
+				}
+				return nil
+
+			case !errors.Is(err, queue.ErrFull):
+				return err
+			}
+
+			if !blocked {
+				m.Blocked(producer)
+				blocked = true
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to enqueue eventID %s: %w", event.ID, ctx.Err())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+}
+
+// CloseRelays() iterates over the relays in the pool and closes all connections.
+func CloseRelays(logger *logger.Aggregate, pool *nostr.SimplePool, funcName string) {
 	logger.Info("  > " + funcName + ": closing relay connections... ")
 	pool.Relays.Range(func(_ string, relay *nostr.Relay) bool {
 		relay.Close()
@@ -3,6 +3,7 @@ package crawler
 import (
 	"context"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -22,7 +23,7 @@ func TestFirehose(t *testing.T) {
 	}
 
 	go HandleSignals(cancel, config.Log)
-	Firehose(ctx, config, DB, PrintEvent)
+	Firehose(ctx, config, NewPoolSource(ctx, PoolSourceConfig{Log: config.Log, MaxConnections: 10, MaxIdle: time.Minute}), DB, PrintEvent)
 }
 
 func TestQueryPubkeys(t *testing.T) {
@@ -36,6 +37,8 @@ func TestQueryPubkeys(t *testing.T) {
 			Relays:    defaultRelays,
 			BatchSize: 4,
 			Interval:  30 * time.Second,
+
+			MaxRelaysPerPubkey: 3,
 		}
 
 		config.Log.Info("---------------------BatchSize---------------------")
@@ -48,7 +51,7 @@ func TestQueryPubkeys(t *testing.T) {
 			pubkeyChan <- pk
 		}
 
-		QueryPubkeys(ctx, config, pubkeyChan, PrintEvent)
+		QueryPubkeys(ctx, config, NewPoolSource(ctx, PoolSourceConfig{Log: config.Log, MaxConnections: 10, MaxIdle: time.Minute}), mockdb.SetupDB("empty"), pubkeyChan, PrintEvent)
 	})
 
 	t.Run("timer", func(t *testing.T) {
@@ -60,6 +63,8 @@ func TestQueryPubkeys(t *testing.T) {
 			Relays:    defaultRelays,
 			BatchSize: 5,
 			Interval:  3 * time.Second,
+
+			MaxRelaysPerPubkey: 3,
 		}
 
 		config.Log.Info("---------------------timer---------------------")
@@ -72,6 +77,81 @@ func TestQueryPubkeys(t *testing.T) {
 			pubkeyChan <- pk
 		}
 
-		QueryPubkeys(ctx, config, pubkeyChan, PrintEvent)
+		QueryPubkeys(ctx, config, NewPoolSource(ctx, PoolSourceConfig{Log: config.Log, MaxConnections: 10, MaxIdle: time.Minute}), mockdb.SetupDB("empty"), pubkeyChan, PrintEvent)
 	})
 }
+
+func TestGroupByRelay(t *testing.T) {
+	fallback := []string{"wss://fallback.one", "wss://fallback.two"}
+	testCases := []struct {
+		name           string
+		pubkeys        []string
+		relays         map[uint32][]string
+		maxRelays      int
+		expectedGroups map[string][]string
+	}{
+		{
+			name:      "empty pubkeys",
+			maxRelays: 2,
+		},
+		{
+			name:      "no write relays",
+			pubkeys:   []string{odell, gigi},
+			maxRelays: 2,
+			expectedGroups: map[string][]string{
+				"wss://fallback.one": {odell, gigi},
+				"wss://fallback.two": {odell, gigi},
+			},
+		},
+		{
+			name:    "valid",
+			pubkeys: []string{odell, calle, gigi},
+			relays: map[uint32][]string{
+				0: {"wss://odell.relay", "wss://shared.relay", "wss://third.relay"},
+				1: {"wss://shared.relay"},
+			},
+			maxRelays: 2,
+			expectedGroups: map[string][]string{
+				"wss://odell.relay":  {odell},
+				"wss://shared.relay": {odell, calle},
+				"wss://fallback.one": {gigi},
+				"wss://fallback.two": {gigi},
+			},
+		},
+		{
+			name:    "no limit",
+			pubkeys: []string{odell, calle},
+			relays: map[uint32][]string{
+				0: {"wss://odell.relay", "wss://shared.relay", "wss://third.relay"},
+				1: {"wss://shared.relay"},
+			},
+			maxRelays: 0,
+			expectedGroups: map[string][]string{
+				"wss://odell.relay":  {odell},
+				"wss://shared.relay": {odell, calle},
+				"wss://third.relay":  {odell},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := mockdb.SetupDB("simple-with-pks")
+			for ID, relays := range test.relays {
+				if err := DB.SetWriteRelays(ctx, ID, relays); err != nil {
+					t.Fatalf("SetWriteRelays(): expected nil, got %v", err)
+				}
+			}
+
+			groups, err := GroupByRelay(ctx, DB, test.pubkeys, fallback, test.maxRelays)
+			if err != nil {
+				t.Fatalf("GroupByRelay(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(groups, test.expectedGroups) {
+				t.Errorf("GroupByRelay(): expected %v, got %v", test.expectedGroups, groups)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+// the number of calls to the FollowLimiter after which the full buckets are removed.
+const pruneEvery = 10000
+
+type FollowLimiterConfig struct {
+	Metrics *Metrics // if nil, no metrics are recorded
+
+	// the follow changes per second and at once granted to an author with the baseline pagerank,
+	// which is the one of a node visited by walksPerNode walks.
+	Rate  float64
+	Burst float64
+
+	// the maximum factor by which a pagerank higher than the baseline scales the Rate and Burst
+	MaxMultiplier float64
+
+	// follow-lists that would have to wait longer than MaxDefer are rejected instead of deferred
+	MaxDefer time.Duration
+}
+
+func NewFollowLimiterConfig() FollowLimiterConfig {
+	return FollowLimiterConfig{
+		Rate:          1,
+		Burst:         1000,
+		MaxMultiplier: 100,
+		MaxDefer:      time.Hour,
+	}
+}
+
+func (c FollowLimiterConfig) Print() {
+	fmt.Printf("Limiter\n")
+	fmt.Printf("  Rate: %f\n", c.Rate)
+	fmt.Printf("  Burst: %f\n", c.Burst)
+	fmt.Printf("  MaxMultiplier: %f\n", c.MaxMultiplier)
+	fmt.Printf("  MaxDefer: %v\n", c.MaxDefer)
+}
+
+/*
+FollowLimiter bounds how fast each author can change its follows, which protects the
+random walks from authors that republish huge alternating follow-lists, each forcing the update
+of thousands of walks.
+
+Each author has a token bucket, and an applied follow-list costs one token for each follow added or removed.
+The rate and capacity of the bucket are scaled by the pagerank of the author, up to config.MaxMultiplier.
+A follow-list is allowed if the bucket is not empty, even if its cost exceeds the tokens
+left, so that an honest author can always import a big follow-list at once. The bucket then
+goes into debt, and the following follow-lists are deferred until the debt is repaid, or
+rejected if that would take longer than config.MaxDefer.
+*/
+type FollowLimiter struct {
+	config FollowLimiterConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[uint32]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+// refill() adds the tokens accumulated since the last refill, up to the burst.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+b.rate*now.Sub(b.last).Seconds())
+	b.last = now
+}
+
+// DeferredError is returned by [FollowLimiter.Allow] when the follow-list can
+// be processed after Wait. It matches ErrDeferred with errors.Is.
+type DeferredError struct {
+	Wait time.Duration
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("%v: retry in %v", ErrDeferred, e.Wait)
+}
+
+func (e *DeferredError) Unwrap() error {
+	return ErrDeferred
+}
+
+// NewFollowLimiter() returns a FollowLimiter where every author has a full bucket.
+func NewFollowLimiter(config FollowLimiterConfig) *FollowLimiter {
+	return &FollowLimiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[uint32]*bucket),
+	}
+}
+
+/*
+Allow() returns nil if the author of the follow-list can change its follows now, a [DeferredError]
+if it can later, and ErrThrottled if the follow-list should be discarded.
+
+Allow() doesn't charge the author, which is done by Charge() once the follow-list has been applied,
+so that follow-lists older than the stored one (e.g. replayed by anyone) cost nothing.
+Follow-lists of authors not in the database are always allowed.
+*/
+func (l *FollowLimiter) Allow(ctx context.Context, DB models.Database, event *nostr.Event) error {
+	author, err := DB.NodeByKey(ctx, event.PubKey)
+	if errors.Is(err, models.ErrNodeNotFoundDB) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch node by key %v: %w", event.PubKey, err)
+	}
+
+	return l.check(author.ID)
+}
+
+/*
+Charge() removes from the bucket of the nodeID one token for each follow added or removed.
+If the pagerank of the nodeID can't be fetched, its bucket is not scaled, as the follow-list
+has already been applied and the error shouldn't interrupt its processing.
+A nil FollowLimiter charges nothing.
+*/
+func (l *FollowLimiter) Charge(ctx context.Context, RWS models.RandomWalkStore, nodeID uint32, changes int) {
+	if l == nil || changes == 0 {
+		return
+	}
+
+	multiplier, err := l.multiplier(ctx, RWS, nodeID)
+	if err != nil {
+		multiplier = 1
+	}
+
+	l.charge(nodeID, float64(changes), multiplier)
+}
+
+// check() returns nil if the bucket of the nodeID is not empty, otherwise the error that
+// defers or rejects the follow-list, depending on how long it takes to repay the debt.
+func (l *FollowLimiter) check(nodeID uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, exists := l.buckets[nodeID]
+	if !exists {
+		return nil
+	}
+
+	b.refill(now)
+	if b.tokens >= 0 {
+		return nil
+	}
+
+	if b.rate <= 0 || -b.tokens/b.rate > l.config.MaxDefer.Seconds() {
+		l.config.Metrics.Throttled(ThrottleRejected)
+		return ErrThrottled
+	}
+
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	l.config.Metrics.Throttled(ThrottleDeferred)
+	return &DeferredError{Wait: wait}
+}
+
+// charge() removes the cost from the bucket of the nodeID, whose rate and burst are scaled by the multiplier.
+func (l *FollowLimiter) charge(nodeID uint32, cost, multiplier float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate, burst := l.config.Rate*multiplier, l.config.Burst*multiplier
+	b, exists := l.buckets[nodeID]
+	if !exists {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[nodeID] = b
+	}
+
+	b.rate, b.burst = rate, burst
+	b.refill(now)
+	b.tokens -= cost
+}
+
+// prune() removes the buckets that are full, as they are equivalent to missing ones.
+// It must be called holding the lock.
+func (l *FollowLimiter) prune(now time.Time) {
+	l.calls++
+	if l.calls%pruneEvery != 0 {
+		return
+	}
+
+	for ID, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.buckets, ID)
+		}
+	}
+}
+
+// Throttled() returns the number of authors whose bucket is in debt, whose follow-lists are deferred or rejected.
+func (l *FollowLimiter) Throttled() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var count int
+	for _, b := range l.buckets {
+		b.refill(now)
+		if b.tokens < 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// multiplier() returns the factor by which the pagerank of the nodeID scales its bucket,
+// which is its visits relative to walksPerNode, clamped between 1 and config.MaxMultiplier.
+func (l *FollowLimiter) multiplier(ctx context.Context, RWS models.RandomWalkStore, nodeID uint32) (float64, error) {
+	walksPerNode := RWS.WalksPerNode(ctx)
+	if walksPerNode == 0 {
+		return 1, nil
+	}
+
+	visits, err := RWS.VisitCounts(ctx, nodeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch the visits of %d: %w", nodeID, err)
+	}
+
+	multiplier := float64(visits[0]) / float64(walksPerNode)
+	return max(1, min(multiplier, l.config.MaxMultiplier)), nil
+}
@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/metrics"
+	"github.com/vertex-lab/crawler/pkg/queue"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/relay/pkg/eventstore"
+)
+
+func TestCheckAndCharge(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewFollowLimiter(FollowLimiterConfig{Rate: 1, Burst: 10, MaxMultiplier: 10, MaxDefer: 20 * time.Second})
+	limiter.now = func() time.Time { return now }
+
+	type step struct {
+		name          string
+		elapsed       time.Duration
+		nodeID        uint32
+		cost          float64 // charged if the check passes
+		multiplier    float64
+		expectedError error
+		expectedWait  time.Duration
+	}
+
+	steps := []step{
+		{name: "bigger than the burst", nodeID: 0, cost: 15, multiplier: 1},
+		{name: "in debt", nodeID: 0, cost: 1, multiplier: 1, expectedError: ErrDeferred, expectedWait: 5 * time.Second},
+		{name: "debt repaid", elapsed: 5 * time.Second, nodeID: 0, cost: 1, multiplier: 1},
+		{name: "other author", nodeID: 1, cost: 100, multiplier: 1},
+		{name: "debt too big", nodeID: 1, cost: 1, multiplier: 1, expectedError: ErrThrottled},
+		{name: "high pagerank", nodeID: 2, cost: 15, multiplier: 2},
+		{name: "high pagerank again", nodeID: 2, cost: 15, multiplier: 2},
+		{name: "high pagerank in debt", nodeID: 2, cost: 1, multiplier: 2, expectedError: ErrDeferred, expectedWait: 5 * time.Second},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.elapsed)
+		err := limiter.check(s.nodeID)
+		if !errors.Is(err, s.expectedError) {
+			t.Fatalf("%s: check(): expected %v, got %v", s.name, s.expectedError, err)
+		}
+
+		var deferred *DeferredError
+		if errors.As(err, &deferred) && deferred.Wait != s.expectedWait {
+			t.Errorf("%s: check(): expected wait %v, got %v", s.name, s.expectedWait, deferred.Wait)
+		}
+
+		if err == nil {
+			limiter.charge(s.nodeID, s.cost, s.multiplier)
+		}
+	}
+
+	if throttled := limiter.Throttled(); throttled != 3 {
+		t.Errorf("Throttled(): expected 3, got %d", throttled)
+	}
+
+	// after a long time, all the debts are repaid
+	now = now.Add(time.Hour)
+	if throttled := limiter.Throttled(); throttled != 0 {
+		t.Errorf("Throttled(): expected 0, got %d", throttled)
+	}
+}
+
+// TestThrottleReplayed checks that follow-lists older than the stored one, like
+// those replayed by a third party, don't drain the bucket of their author.
+func TestThrottleReplayed(t *testing.T) {
+	DB := mockdb.SetupDB("pip")
+	RWS := mockstore.SetupRWS("one-node0")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	limiter := NewFollowLimiter(FollowLimiterConfig{Rate: 1, Burst: 2, MaxMultiplier: 1, MaxDefer: time.Hour})
+	limiter.now = func() time.Time { return time.Unix(1000, 0) }
+	config := ProcessEventsConfig{Limiter: limiter}
+
+	latest := followList("latest", pip, 100, odell)
+	if err := processEvent(config, DB, RWS, eventStore, latest, &atomic.Uint32{}); err != nil {
+		t.Fatalf("processEvent(): expected nil, got %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		old := followList(fmt.Sprintf("old-%d", i), pip, nostr.Timestamp(i), odell, calle, gigi)
+		if err := processEvent(config, DB, RWS, eventStore, old, &atomic.Uint32{}); err != nil {
+			t.Fatalf("processEvent(): expected nil, got %v", err)
+		}
+	}
+
+	// only the follow added by the latest follow-list has been charged
+	if err := limiter.check(0); err != nil {
+		t.Errorf("check(): expected nil, got %v", err)
+	}
+
+	if tokens := limiter.buckets[0].tokens; tokens != 1 {
+		t.Errorf("expected 1 token left, got %v", tokens)
+	}
+}
+
+func TestDeferrals(t *testing.T) {
+	now := time.Unix(1000, 0)
+	msg := func(ID string, createdAt nostr.Timestamp) queue.Message {
+		return queue.Message{ID: ID, Event: followList(ID, pip, createdAt, odell)}
+	}
+
+	deferrals := newDeferrals()
+	steps := []struct {
+		name               string
+		msg                queue.Message
+		expectedSuperseded string
+	}{
+		{name: "first", msg: msg("1-0", 100), expectedSuperseded: ""},
+		{name: "newer", msg: msg("2-0", 101), expectedSuperseded: "1-0"},
+		{name: "older", msg: msg("3-0", 99), expectedSuperseded: "3-0"},
+	}
+
+	for _, s := range steps {
+		if superseded := deferrals.add(s.msg, now.Add(time.Second)); superseded != s.expectedSuperseded {
+			t.Errorf("%s: add(): expected %q, got %q", s.name, s.expectedSuperseded, superseded)
+		}
+	}
+
+	if IDs := deferrals.due(now); len(IDs) != 0 {
+		t.Errorf("due(): expected none, got %v", IDs)
+	}
+
+	if IDs := deferrals.due(now.Add(time.Second)); !reflect.DeepEqual(IDs, []string{"2-0"}) {
+		t.Errorf("due(): expected [2-0], got %v", IDs)
+	}
+
+	if IDs := deferrals.due(now.Add(time.Hour)); len(IDs) != 0 {
+		t.Errorf("due(): expected none, got %v", IDs)
+	}
+}
+
+func TestProcessEventsThrottle(t *testing.T) {
+	DB := mockdb.SetupDB("pip")
+	RWS := mockstore.SetupRWS("one-node0")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	ctx := context.Background()
+	events, _ := queue.NewMemoryQueue(10)
+	for _, event := range []*nostr.Event{
+		followList("first", pip, 100, odell, calle),
+		followList("second", pip, 101, odell),
+	} {
+		if _, err := events.Push(ctx, event); err != nil {
+			t.Fatalf("Push(): expected nil, got %v", err)
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	limiter := NewFollowLimiter(FollowLimiterConfig{Metrics: NewMetrics(registry), Rate: 10, Burst: 1, MaxMultiplier: 1, MaxDefer: time.Second})
+	eventCounter := &atomic.Uint32{}
+
+	func() {
+		ctx, cancel := context.WithTimeout(ctx, 600*time.Millisecond)
+		defer cancel()
+		config := ProcessEventsConfig{Log: logger.New(os.Stdout), PrintEvery: 1000, BatchSize: 1, Limiter: limiter}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, eventCounter, &atomic.Uint32{})
+	}()
+
+	// the second follow-list is deferred, requeued and processed after the debt is repaid
+	if eventCounter.Load() != 2 {
+		t.Errorf("expected 2 processed events, got %d", eventCounter.Load())
+	}
+
+	if length, _ := events.Len(ctx); length != 0 {
+		t.Errorf("Len(): expected 0, got %d", length)
+	}
+
+	IDs, err := DB.NodeIDs(ctx, odell)
+	if err != nil || IDs[0] == nil {
+		t.Fatalf("NodeIDs(): expected odell in the DB, got %v, %v", IDs, err)
+	}
+
+	follows, err := DB.Follows(ctx, 0)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	if !reflect.DeepEqual(follows[0], []uint32{*IDs[0]}) {
+		t.Errorf("Follows(): expected %v, got %v", []uint32{*IDs[0]}, follows[0])
+	}
+
+	builder := &strings.Builder{}
+	registry.WriteTo(builder)
+	if !strings.Contains(builder.String(), `crawler_throttled_events_total{decision="deferred"} 1`) {
+		t.Errorf("expected a deferred follow-list in\n%s", builder.String())
+	}
+}
@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/vertex-lab/crawler/pkg/metrics"
+)
+
+// The producers that send events or pubkeys to the queues.
+const (
+	ProducerFirehose     = "firehose"
+	ProducerQueryPubkeys = "query_pubkeys"
+	ProducerNodeArbiter  = "node_arbiter"
+)
+
+// The decisions of the FollowLimiter about the follow-lists that exceed the budget of their author.
+const (
+	ThrottleDeferred = "deferred"
+	ThrottleRejected = "rejected"
+)
+
+// The outcomes of the events that failed to be processed.
+const (
+	FailureRetried      = "retried"
+	FailureDeadLettered = "dead_lettered"
+)
+
+// Metrics records the activity of the crawler processes. A nil *Metrics records nothing.
+type Metrics struct {
+	processed    *metrics.CounterVec
+	blocked      *metrics.CounterVec
+	duplicates   *metrics.CounterVec
+	superseded   *metrics.CounterVec
+	failed       *metrics.CounterVec
+	rejected     *metrics.CounterVec
+	invalid      *metrics.CounterVec
+	throttled    *metrics.CounterVec
+	walksUpdated *metrics.Counter
+	promotions   *metrics.Counter
+	demotions    *metrics.Counter
+	scanDuration *metrics.Histogram
+}
+
+// NewMetrics() registers the crawler metrics in the registry.
+func NewMetrics(r *metrics.Registry) *Metrics {
+	return &Metrics{
+		processed:    r.NewCounterVec("crawler_processed_events_total", "The number of events processed, by kind.", "kind"),
+		blocked:      r.NewCounterVec("crawler_blocked_total", "The number of events (pubkeys for the NodeArbiter) that waited because the queue was full, by producer.", "producer"),
+		duplicates:   r.NewCounterVec("crawler_duplicates_total", "The number of events skipped because they were already in the queue, by producer.", "producer"),
+		superseded:   r.NewCounterVec("crawler_superseded_events_total", "The number of events skipped because superseded by a newer event of the same author, by kind.", "kind"),
+		failed:       r.NewCounterVec("crawler_failed_events_total", "The number of events that failed to be processed, by outcome.", "outcome"),
+		rejected:     r.NewCounterVec("crawler_rejected_events_total", "The number of events rejected by the Verifier, by relay.", "relay"),
+		invalid:      r.NewCounterVec("crawler_invalid_events_total", "The number of events rejected by the Verifier, by reason.", "reason"),
+		throttled:    r.NewCounterVec("crawler_throttled_events_total", "The number of follow-lists deferred or rejected because their author changed too many follows, by decision.", "decision"),
+		walksUpdated: r.NewCounter("crawler_walks_updated_total", "The number of random walks updated by follow-lists."),
+		promotions:   r.NewCounter("crawler_arbiter_promotions_total", "The number of nodes promoted by the NodeArbiter."),
+		demotions:    r.NewCounter("crawler_arbiter_demotions_total", "The number of nodes demoted by the NodeArbiter."),
+		scanDuration: r.NewHistogram("crawler_arbiter_scan_duration_seconds", "The duration of the NodeArbiter scans.", nil),
+	}
+}
+
+// EventProcessed() records that an event of the specified kind has been processed.
+func (m *Metrics) EventProcessed(kind int) {
+	if m == nil {
+		return
+	}
+	m.processed.With(strconv.Itoa(kind)).Inc()
+}
+
+// Blocked() records that the producer had to wait to send an event or a pubkey, because the queue was full.
+func (m *Metrics) Blocked(producer string) {
+	if m == nil {
+		return
+	}
+	m.blocked.With(producer).Inc()
+}
+
+// Duplicate() records that the producer sent an event that was already in the queue.
+func (m *Metrics) Duplicate(producer string) {
+	if m == nil {
+		return
+	}
+	m.duplicates.With(producer).Inc()
+}
+
+// Superseded() records that an event of the specified kind was skipped, because superseded by a newer one.
+func (m *Metrics) Superseded(kind int) {
+	if m == nil {
+		return
+	}
+	m.superseded.With(strconv.Itoa(kind)).Inc()
+}
+
+// Failed() records that an event failed to be processed, and whether it was retried or moved to the dead-letters.
+func (m *Metrics) Failed(outcome string) {
+	if m == nil {
+		return
+	}
+	m.failed.With(outcome).Inc()
+}
+
+// Rejected() records that the relay sent an event that was rejected for the specified reason.
+func (m *Metrics) Rejected(relay, reason string) {
+	if m == nil {
+		return
+	}
+	m.rejected.With(relay).Inc()
+	m.invalid.With(reason).Inc()
+}
+
+// Throttled() records that a follow-list has been deferred or rejected by the FollowLimiter.
+func (m *Metrics) Throttled(decision string) {
+	if m == nil {
+		return
+	}
+	m.throttled.With(decision).Inc()
+}
+
+// WalksUpdated() records that n random walks have been updated.
+func (m *Metrics) WalksUpdated(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.walksUpdated.Add(uint64(n))
+}
+
+// ArbiterScanned() records the result and the duration of a NodeArbiter scan.
+func (m *Metrics) ArbiterScanned(promoted, demoted int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.promotions.Add(uint64(promoted))
+	m.demotions.Add(uint64(demoted))
+	m.scanDuration.Observe(duration.Seconds())
+}
@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var m *Metrics
+		m.EventProcessed(nostr.KindFollowList)
+		m.Blocked(ProducerFirehose)
+		m.Duplicate(ProducerFirehose)
+		m.Superseded(nostr.KindFollowList)
+		m.Rejected("wss://relay.example.com", "invalid_id")
+		m.Throttled(ThrottleDeferred)
+		m.WalksUpdated(10)
+		m.ArbiterScanned(1, 2, time.Second)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		r := metrics.NewRegistry()
+		m := NewMetrics(r)
+
+		m.EventProcessed(nostr.KindFollowList)
+		m.EventProcessed(nostr.KindFollowList)
+		m.EventProcessed(nostr.KindMuteList)
+		m.Blocked(ProducerNodeArbiter)
+		m.Duplicate(ProducerQueryPubkeys)
+		m.Superseded(nostr.KindFollowList)
+		m.Rejected("wss://relay.example.com", "invalid_id")
+		m.Rejected("wss://relay.example.com", "invalid_signature")
+		m.Throttled(ThrottleDeferred)
+		m.Throttled(ThrottleRejected)
+		m.Throttled(ThrottleDeferred)
+		m.WalksUpdated(10)
+		m.WalksUpdated(-1)
+		m.ArbiterScanned(1, 2, time.Second)
+
+		builder := &strings.Builder{}
+		if _, err := r.WriteTo(builder); err != nil {
+			t.Fatalf("WriteTo(): expected nil, got %v", err)
+		}
+
+		expectedLines := []string{
+			`crawler_processed_events_total{kind="3"} 2`,
+			`crawler_processed_events_total{kind="10000"} 1`,
+			`crawler_blocked_total{producer="node_arbiter"} 1`,
+			`crawler_duplicates_total{producer="query_pubkeys"} 1`,
+			`crawler_superseded_events_total{kind="3"} 1`,
+			`crawler_rejected_events_total{relay="wss://relay.example.com"} 2`,
+			`crawler_invalid_events_total{reason="invalid_id"} 1`,
+			`crawler_throttled_events_total{decision="deferred"} 2`,
+			`crawler_throttled_events_total{decision="rejected"} 1`,
+			`crawler_walks_updated_total 10`,
+			`crawler_arbiter_promotions_total 1`,
+			`crawler_arbiter_demotions_total 2`,
+			`crawler_arbiter_scan_duration_seconds_count 1`,
+		}
+
+		for _, line := range expectedLines {
+			if !strings.Contains(builder.String(), line+"\n") {
+				t.Errorf("expected %q in\n%s", line, builder.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,190 @@
+/*
+The mock package provides an in-memory relay, which allows testing the crawler
+without network. It fulfills the EventSource interface defined in the crawler
+package, as well as the Publisher interface defined in the dvm package.
+
+Events are scripted per relay url using [Relay.Add]; events added with an empty
+url are served by every relay, and are reported as coming from the first relay requested.
+*/
+package mock
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// the number of live events that a subscription can buffer before dropping them.
+const subscriptionBuffer = 1000
+
+// Relay is an in-memory, scripted relay.
+type Relay struct {
+	mu            sync.Mutex
+	events        []scripted
+	subscriptions []*subscription
+}
+
+type scripted struct {
+	url   string
+	event *nostr.Event
+}
+
+type subscription struct {
+	ctx    context.Context
+	relays []string
+	filter nostr.Filter
+	queue  chan nostr.RelayEvent
+}
+
+// NewRelay() returns an empty Relay.
+func NewRelay() *Relay {
+	return &Relay{}
+}
+
+// Add() stores the events on the relay with the specified url, and sends them
+// to the matching subscriptions. If the url is empty, the events are served by every relay.
+func (r *Relay) Add(url string, events ...*nostr.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		r.events = append(r.events, scripted{url: url, event: event})
+
+		for _, sub := range r.subscriptions {
+			if sub.ctx.Err() != nil || !matches(url, sub.relays, sub.filter, event) {
+				continue
+			}
+
+			select {
+			case sub.queue <- relayEvent(url, sub.relays, event):
+			default:
+				// the subscription is too slow, drop the event like a real relay would
+			}
+		}
+	}
+}
+
+// Publish() adds the event to every relay.
+func (r *Relay) Publish(ctx context.Context, event *nostr.Event) error {
+	_ = ctx
+	r.Add("", event)
+	return nil
+}
+
+// Events() returns all the events stored on the relay, in the order they were added.
+func (r *Relay) Events() []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]*nostr.Event, len(r.events))
+	for i, s := range r.events {
+		events[i] = s.event
+	}
+	return events
+}
+
+// Subscribe() returns a channel that receives the stored events that match the
+// filter, followed by the ones added later. The channel is closed when the context is cancelled.
+func (r *Relay) Subscribe(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	sub := &subscription{
+		ctx:    ctx,
+		relays: relays,
+		filter: filter,
+		queue:  make(chan nostr.RelayEvent, subscriptionBuffer),
+	}
+
+	r.mu.Lock()
+	stored := r.matching(relays, filter)
+	r.subscriptions = append(r.subscriptions, sub)
+	r.mu.Unlock()
+
+	events := make(chan nostr.RelayEvent)
+	go func() {
+		defer close(events)
+		defer r.unsubscribe(sub)
+
+		for _, event := range stored {
+			select {
+			case <-ctx.Done():
+				return
+			case events <- event:
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-sub.queue:
+				select {
+				case <-ctx.Done():
+					return
+				case events <- event:
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// Query() returns a channel that receives the stored events that match the filter.
+// The channel is closed after the last event (EOSE) or when the context is cancelled.
+func (r *Relay) Query(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	r.mu.Lock()
+	stored := r.matching(relays, filter)
+	r.mu.Unlock()
+
+	events := make(chan nostr.RelayEvent)
+	go func() {
+		defer close(events)
+		for _, event := range stored {
+			select {
+			case <-ctx.Done():
+				return
+			case events <- event:
+			}
+		}
+	}()
+
+	return events
+}
+
+// matching() returns the stored events that match the filter on the relays. It must be called holding the lock.
+func (r *Relay) matching(relays []string, filter nostr.Filter) []nostr.RelayEvent {
+	var events []nostr.RelayEvent
+	for _, s := range r.events {
+		if matches(s.url, relays, filter, s.event) {
+			events = append(events, relayEvent(s.url, relays, s.event))
+		}
+	}
+	return events
+}
+
+func (r *Relay) unsubscribe(sub *subscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscriptions = slices.DeleteFunc(r.subscriptions, func(s *subscription) bool {
+		return s == sub
+	})
+}
+
+// matches() returns whether the event stored at url should be sent to a request to the relays with the filter.
+func matches(url string, relays []string, filter nostr.Filter, event *nostr.Event) bool {
+	if url != "" && !slices.Contains(relays, url) {
+		return false
+	}
+	return filter.Matches(event)
+}
+
+// relayEvent() returns the event stored at url as sent by a relay. Events served by
+// every relay are attributed to the first of the relays requested.
+func relayEvent(url string, relays []string, event *nostr.Event) nostr.RelayEvent {
+	if url == "" && len(relays) > 0 {
+		url = relays[0]
+	}
+	return nostr.RelayEvent{Event: event, Relay: &nostr.Relay{URL: url}}
+}
@@ -0,0 +1,105 @@
+package mock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func collect(events <-chan nostr.RelayEvent) []string {
+	var IDs []string
+	for event := range events {
+		IDs = append(IDs, event.ID)
+	}
+	return IDs
+}
+
+func TestQuery(t *testing.T) {
+	relay := NewRelay()
+	relay.Add("", &nostr.Event{ID: "0", Kind: 3, PubKey: "pk0"})
+	relay.Add("wss://one", &nostr.Event{ID: "1", Kind: 3, PubKey: "pk1"})
+	relay.Add("wss://two", &nostr.Event{ID: "2", Kind: 0, PubKey: "pk1"})
+
+	testCases := []struct {
+		name        string
+		relays      []string
+		filter      nostr.Filter
+		expectedIDs []string
+	}{
+		{
+			name:        "no match",
+			relays:      []string{"wss://one"},
+			filter:      nostr.Filter{Authors: []string{"pk69"}},
+			expectedIDs: nil,
+		},
+		{
+			name:        "served by every relay",
+			relays:      []string{"wss://three"},
+			filter:      nostr.Filter{Kinds: []int{3}},
+			expectedIDs: []string{"0"},
+		},
+		{
+			name:        "valid",
+			relays:      []string{"wss://one", "wss://two"},
+			filter:      nostr.Filter{Authors: []string{"pk1"}},
+			expectedIDs: []string{"1", "2"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			IDs := collect(relay.Query(context.Background(), test.relays, test.filter))
+			if !reflect.DeepEqual(IDs, test.expectedIDs) {
+				t.Errorf("Query(): expected %v, got %v", test.expectedIDs, IDs)
+			}
+		})
+	}
+}
+
+func TestRelayURL(t *testing.T) {
+	relay := NewRelay()
+	relay.Add("", &nostr.Event{ID: "0", Kind: 3})
+	relay.Add("wss://two", &nostr.Event{ID: "1", Kind: 3})
+
+	var URLs []string
+	for event := range relay.Query(context.Background(), []string{"wss://one", "wss://two"}, nostr.Filter{}) {
+		URLs = append(URLs, event.Relay.URL)
+	}
+
+	// events served by every relay are attributed to the first relay
+	expected := []string{"wss://one", "wss://two"}
+	if !reflect.DeepEqual(URLs, expected) {
+		t.Errorf("Query(): expected relays %v, got %v", expected, URLs)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	relay := NewRelay()
+	relay.Add("", &nostr.Event{ID: "0", Kind: 3, CreatedAt: 10})
+	relay.Add("", &nostr.Event{ID: "1", Kind: 3, CreatedAt: 100})
+
+	since := nostr.Timestamp(50)
+	events := relay.Subscribe(ctx, []string{"wss://one"}, nostr.Filter{Kinds: []int{3}, Since: &since})
+
+	// live events
+	relay.Publish(ctx, &nostr.Event{ID: "2", Kind: 3, CreatedAt: 200})
+	relay.Add("wss://two", &nostr.Event{ID: "3", Kind: 3, CreatedAt: 200})
+	relay.Add("wss://one", &nostr.Event{ID: "4", Kind: 1, CreatedAt: 200})
+
+	// the channel is closed when the context expires
+	IDs := collect(events)
+	expected := []string{"1", "2"}
+	if !reflect.DeepEqual(IDs, expected) {
+		t.Errorf("Subscribe(): expected %v, got %v", expected, IDs)
+	}
+
+	if len(relay.Events()) != 5 {
+		t.Errorf("Events(): expected 5 events, got %d", len(relay.Events()))
+	}
+}
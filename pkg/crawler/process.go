@@ -2,14 +2,21 @@ package crawler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"os"
+	"runtime"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
 	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/utils/sliceutils"
 	"github.com/vertex-lab/crawler/pkg/walks"
 	"github.com/vertex-lab/relay/pkg/eventstore"
@@ -17,70 +24,460 @@ import (
 
 type ProcessEventsConfig struct {
 	Log        *logger.Aggregate
+	Metrics    *Metrics          // if nil, no metrics are recorded
+	Rand       *randutils.Source // if nil, the walks are updated with time-seeded generators
 	PrintEvery uint32
+	BatchSize  int // the number of events read from the queue at once
+
+	// the number of goroutines that process events concurrently. The walks are
+	// reproducible given the same sequence of events only if Workers is 1.
+	Workers int
+
+	// the number of times an event is processed before being moved to the dead-letters, if it keeps failing.
+	MaxAttempts int
+
+	// how long to keep reading events after the first of a batch arrives, so that
+	// older events superseded by newer ones in the same batch are skipped (see [Coalesce]).
+	CoalesceWindow time.Duration
+
+	// if not nil, the events are verified again before being processed, which protects
+	// from events that entered the queue without being verified (e.g. before an upgrade).
+	Verifier *Verifier
+
+	// if not nil, the follow-lists of authors that change too many follows are deferred or rejected.
+	Limiter *FollowLimiter
+
+	// serializes the updates of the same walk by the workers. It must be shared with anything else
+	// that calls walks.Update on the same RWS concurrently. If nil, ProcessEvents uses its own.
+	Guard *walks.Guard
 }
 
 func NewProcessEventsConfig() ProcessEventsConfig {
 	return ProcessEventsConfig{
-		Log:        logger.New(os.Stdout),
-		PrintEvery: 5000,
+		Log:            logger.New(os.Stdout),
+		PrintEvery:     5000,
+		BatchSize:      100,
+		Workers:        runtime.NumCPU(),
+		MaxAttempts:    3,
+		CoalesceWindow: time.Second,
 	}
 }
 
 func (c ProcessEventsConfig) Print() {
 	fmt.Printf("Process\n")
 	fmt.Printf("  PrintEvery: %d\n", c.PrintEvery)
+	fmt.Printf("  BatchSize: %d\n", c.BatchSize)
+	fmt.Printf("  Workers: %d\n", c.Workers)
+	fmt.Printf("  MaxAttempts: %d\n", c.MaxAttempts)
+	fmt.Printf("  CoalesceWindow: %v\n", c.CoalesceWindow)
 }
 
-// ProcessEvents() process one event at the time from the eventChannel, based on their kind.
+/*
+ProcessEvents() process the events from the queue, based on their kind.
+
+The events are read in batches, and each batch is processed by config.Workers goroutines.
+Events superseded by a newer event in the same batch are acked without being processed.
+Events are assigned to workers by author, so the events of the same author are processed
+one at the time and in order, while those of different authors are processed concurrently.
+
+An event is acked only after it has been processed successfully, so the events that
+were being processed when the crawler stopped remain pending in the queue, and are replayed
+when ProcessEvents starts. An event that fails is requeued, and after config.MaxAttempts
+it's moved to the dead-letters, so that it stops taking space in the queue.
+*/
 func ProcessEvents(
 	ctx context.Context,
 	config ProcessEventsConfig,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	eventStore *eventstore.Store,
-	eventChan <-chan *nostr.Event,
+	events queue.Queue,
 	eventCounter, walksTracker *atomic.Uint32) {
 
-	var err error
+	batchSize := max(config.BatchSize, 1)
+	workers := max(config.Workers, 1)
+	if config.Guard == nil {
+		config.Guard = walks.NewGuard()
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			config.Log.Info("  > Finishing processing the event... ")
-			return
+	failures := newFailures()
+	deferrals := newDeferrals()
 
-		case event, ok := <-eventChan:
-			if !ok {
-				config.Log.Warn("Event queue closed, stopped processing.")
-				return
+	// process() returns whether the message should be acked
+	process := func(msg queue.Message) bool {
+		err := processEvent(config, DB, RWS, eventStore, msg.Event, walksTracker)
+
+		var deferred *DeferredError
+		if errors.As(err, &deferred) {
+			superseded := deferrals.add(msg, time.Now().Add(deferred.Wait))
+			if superseded == "" {
+				return false
 			}
 
-			if event == nil {
-				config.Log.Error("ProcessEvents: event is nil")
-				continue
+			config.Metrics.Superseded(msg.Event.Kind)
+			if superseded == msg.ID {
+				return true
 			}
 
-			switch event.Kind {
-			case nostr.KindFollowList:
-				err = HandleFollowList(DB, RWS, eventStore, event, walksTracker)
+			ack(config.Log, events, []string{superseded})
+			return false
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrThrottled):
+			// already recorded in the metrics, logging would flood the logs during an attack
+		case msg.Event == nil:
+			config.Log.Error("ProcessEvents: message %s: %v", msg.ID, err)
+		default:
+			config.Log.Error("ProcessEvents: eventID %s, kind %d by %s: %v", msg.Event.ID, msg.Event.Kind, msg.Event.PubKey, err)
+		}
 
-			case nostr.KindProfileMetadata:
-				err = HandleProfileMetadata(eventStore, event)
+		count := eventCounter.Add(1)
+		if count%config.PrintEvery == 0 {
+			config.Log.Info("processed %d events", count)
+		}
 
-			default:
-				err = fmt.Errorf("unsupported event kind")
+		if err == nil || msg.Event == nil || errors.Is(err, ErrUnsupportedKind) ||
+			errors.Is(err, ErrThrottled) || isInvalid(err) {
+			if msg.Event != nil {
+				failures.forget(msg.Event.ID)
 			}
+			return true
+		}
+
+		retry(config, events, failures, msg)
+		return false
+	}
+
+	// replaying the events that were delivered but not acked before the last shutdown
+	after := "0"
+	for {
+		msgs, err := events.Pending(ctx, after, batchSize)
+		if err != nil {
+			config.Log.Error("ProcessEvents: failed to fetch the pending events: %v", err)
+			break
+		}
+
+		if len(msgs) == 0 {
+			break
+		}
+
+		config.Log.Info("replaying %d pending events", len(msgs))
+		latest, superseded := coalesce(config, failures, msgs)
+		IDs := processBatch(ctx, workers, latest, process)
+		ack(config.Log, events, append(IDs, superseded...))
+
+		if ctx.Err() != nil {
+			config.Log.Info("  > Finishing processing the event... ")
+			return
+		}
+
+		after = msgs[len(msgs)-1].ID
+	}
+
+	for {
+		if ctx.Err() != nil {
+			config.Log.Info("  > Finishing processing the event... ")
+			return
+		}
 
-			if err != nil {
-				config.Log.Error("ProcessEvents: eventID %s, kind %d by %s: %v", event.ID, event.Kind, event.PubKey, err)
+		now := time.Now()
+		requeue(config.Log, events, deferrals.due(now))
+
+		// waiting for new events no longer than the next deferral
+		msgs, err := readWindow(ctx, config, events, batchSize, deferrals.wait(now, time.Second))
+		if err != nil {
+			if ctx.Err() == nil {
+				config.Log.Error("ProcessEvents: failed to read the events: %v", err)
+				time.Sleep(time.Second)
 			}
+			continue
+		}
+
+		latest, superseded := coalesce(config, failures, msgs)
+		IDs := processBatch(ctx, workers, latest, process)
+		ack(config.Log, events, append(IDs, superseded...))
+	}
+}
+
+// coalesce() returns the messages to process, and the IDs of the superseded ones, which are recorded in the metrics.
+func coalesce(config ProcessEventsConfig, failures *failures, msgs []queue.Message) ([]queue.Message, []string) {
+	latest, superseded := Coalesce(msgs)
+	IDs := make([]string, len(superseded))
+	for i, msg := range superseded {
+		config.Metrics.Superseded(msg.Event.Kind)
+		failures.forget(msg.Event.ID)
+		IDs[i] = msg.ID
+	}
+	return latest, IDs
+}
 
-			count := eventCounter.Add(1)
-			if count%config.PrintEvery == 0 {
-				config.Log.Info("processed %d events", count)
+/*
+processBatch() processes the messages with the specified number of workers, where
+all the messages of the same author go to the same worker, in order.
+It returns the IDs of the messages that should be acked, according to process.
+
+When the context is cancelled, the workers stop and the remaining messages are not processed.
+*/
+func processBatch(
+	ctx context.Context,
+	workers int,
+	msgs []queue.Message,
+	process func(msg queue.Message) bool) []string {
+
+	shards := make([][]int, workers)
+	for i, msg := range msgs {
+		s := shard(msg.Event, workers)
+		shards[s] = append(shards[s], i)
+	}
+
+	toAck := make([]bool, len(msgs))
+	var wg sync.WaitGroup
+	for _, indices := range shards {
+		if len(indices) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range indices {
+				if ctx.Err() != nil {
+					// the remaining events stay pending, and will be replayed
+					return
+				}
+				toAck[i] = process(msgs[i])
 			}
+		}()
+	}
+	wg.Wait()
+
+	IDs := make([]string, 0, len(msgs))
+	for i, msg := range msgs {
+		if toAck[i] {
+			IDs = append(IDs, msg.ID)
+		}
+	}
+	return IDs
+}
+
+// shard() returns the worker of the event, based on its author. Nil events go to the first worker.
+func shard(event *nostr.Event, workers int) int {
+	if event == nil || workers <= 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(event.PubKey))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// processEvent() process the event based on its kind.
+func processEvent(
+	config ProcessEventsConfig,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	eventStore *eventstore.Store,
+	event *nostr.Event,
+	walksTracker *atomic.Uint32) error {
+
+	if event == nil {
+		return ErrNilEvent
+	}
+
+	if config.Verifier != nil {
+		if err := config.Verifier.Verify(event); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch event.Kind {
+	case nostr.KindFollowList:
+		if err := throttle(config.Limiter, DB, event); err != nil {
+			return err
 		}
+
+		var walksChanged int
+		walksChanged, err = HandleFollowList(config.Rand, config.Guard, config.Limiter, DB, RWS, eventStore, event)
+		walksTracker.Add(uint32(walksChanged))
+		config.Metrics.WalksUpdated(walksChanged)
+
+	case nostr.KindProfileMetadata:
+		err = HandleProfileMetadata(eventStore, event)
+
+	case nostr.KindMuteList:
+		err = HandleMuteList(DB, eventStore, event)
+
+	case nostr.KindReporting:
+		err = HandleReport(DB, event)
+
+	case nostr.KindRelayListMetadata:
+		err = HandleRelayList(DB, eventStore, event)
+
+	default:
+		err = ErrUnsupportedKind
+	}
+
+	config.Metrics.EventProcessed(event.Kind)
+	return err
+}
+
+// throttle() returns an error if the limiter doesn't allow the follow-list to be processed now.
+func throttle(limiter *FollowLimiter, DB models.Database, event *nostr.Event) error {
+	if limiter == nil {
+		return nil
+	}
+
+	// use a new context for the operation to avoid it being interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return limiter.Allow(ctx, DB, event)
+}
+
+/*
+deferrals holds the follow-lists deferred by the [FollowLimiter] until they are due.
+Deferred messages remain pending in the queue, so only the newest of each author is kept,
+to bound the space they take. If ProcessEvents stops, they are replayed on restart.
+*/
+type deferrals struct {
+	mu       sync.Mutex
+	byAuthor map[string]deferral
+}
+
+type deferral struct {
+	msg queue.Message
+	due time.Time
+}
+
+func newDeferrals() *deferrals {
+	return &deferrals{byAuthor: make(map[string]deferral)}
+}
+
+// add() defers the message until due. It returns the ID of the message that is superseded
+// by the newest follow-list of the author, which can be the message itself, or "" if none.
+func (d *deferrals) add(msg queue.Message, due time.Time) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	author := msg.Event.PubKey
+	old, exists := d.byAuthor[author]
+	if exists && !isNewer(msg.Event, old.msg.Event) {
+		return msg.ID
+	}
+
+	d.byAuthor[author] = deferral{msg: msg, due: due}
+	if exists {
+		return old.msg.ID
+	}
+	return ""
+}
+
+// due() removes and returns the IDs of the messages whose deferral has expired.
+func (d *deferrals) due(now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var IDs []string
+	for author, deferral := range d.byAuthor {
+		if !now.Before(deferral.due) {
+			IDs = append(IDs, deferral.msg.ID)
+			delete(d.byAuthor, author)
+		}
+	}
+	return IDs
+}
+
+// wait() returns how long until the next deferral is due, at most maxWait.
+func (d *deferrals) wait(now time.Time, maxWait time.Duration) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wait := maxWait
+	for _, deferral := range d.byAuthor {
+		wait = min(wait, deferral.due.Sub(now))
+	}
+	return max(wait, time.Millisecond)
+}
+
+// requeue() moves the messages back to the end of the queue, using a new context to avoid it being interrupted.
+func requeue(log *logger.Aggregate, events queue.Queue, IDs []string) {
+	if len(IDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, ID := range IDs {
+		if err := events.Requeue(ctx, ID); err != nil {
+			log.Error("ProcessEvents: %v", err)
+		}
+	}
+}
+
+// failures counts how many times each event has failed, by event ID.
+type failures struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newFailures() *failures {
+	return &failures{counts: make(map[string]int)}
+}
+
+// add() records a failure of the event, and returns the number of its failures.
+func (f *failures) add(eventID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[eventID]++
+	return f.counts[eventID]
+}
+
+// forget() removes the failures of the event, once it has left the queue.
+func (f *failures) forget(eventID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.counts, eventID)
+}
+
+/*
+retry() moves the message that failed to the end of the queue, to be processed again.
+If it failed config.MaxAttempts times, it's moved to the dead-letters instead.
+*/
+func retry(config ProcessEventsConfig, events queue.Queue, failures *failures, msg queue.Message) {
+	// use a new context for the operation to avoid it being interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if failures.add(msg.Event.ID) < max(config.MaxAttempts, 1) {
+		config.Metrics.Failed(FailureRetried)
+		if err := events.Requeue(ctx, msg.ID); err != nil {
+			config.Log.Error("ProcessEvents: %v", err)
+		}
+		return
+	}
+
+	failures.forget(msg.Event.ID)
+	config.Metrics.Failed(FailureDeadLettered)
+	if err := events.DeadLetter(ctx, msg.ID); err != nil {
+		config.Log.Error("ProcessEvents: %v", err)
+	}
+}
+
+// ack() acknowledges the messages, using a new context to avoid it being interrupted.
+func ack(log *logger.Aggregate, events queue.Queue, IDs []string) {
+	if len(IDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := events.Ack(ctx, IDs...); err != nil {
+		log.Error("ProcessEvents: %v", err)
 	}
 }
 
@@ -96,34 +493,50 @@ func HandleProfileMetadata(eventStore *eventstore.Store, event *nostr.Event) err
 	return nil
 }
 
-// HandleFollowList() saves the event to the eventStore, replacing an older event
-// if present, and then process the follow-list.
+// HandleFollowList() process the follow-list if it's newer than the one in the eventStore, and
+// then saves it, replacing the older one. It returns the number of walks that have been updated.
+// The event is saved only once processed, so that if it fails it's processed again when retried or replayed.
+// The follows changed are charged to the author in the limiter, if not nil, and the walks are updated under the guard.
 func HandleFollowList(
+	src *randutils.Source,
+	guard *walks.Guard,
+	limiter *FollowLimiter,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	eventStore *eventstore.Store,
-	event *nostr.Event,
-	walksTracker *atomic.Uint32) error {
+	event *nostr.Event) (int, error) {
 
 	// use a new context for the operation to avoid it being interrupted
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	replaced, err := eventStore.Replace(ctx, event)
+	stale, err := isStale(ctx, eventStore, event)
+	if err != nil || stale {
+		return 0, err
+	}
+
+	walksChanged, err := processFollowList(ctx, src, guard, limiter, DB, RWS, event)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("failed to process follow-list: %w", err)
 	}
 
-	if replaced {
-		walksChanged, err := processFollowList(ctx, DB, RWS, event)
-		if err != nil {
-			return fmt.Errorf("failed to process follow-list: %w", err)
-		}
+	if _, err := eventStore.Replace(ctx, event); err != nil {
+		return walksChanged, err
+	}
 
-		walksTracker.Add(uint32(walksChanged))
+	return walksChanged, nil
+}
+
+// isStale() returns whether the eventStore has an event of the same author and kind that is
+// at least as recent as the event, meaning that the event has already been processed or is superseded.
+func isStale(ctx context.Context, eventStore *eventstore.Store, event *nostr.Event) (bool, error) {
+	filter := nostr.Filter{Authors: []string{event.PubKey}, Kinds: []int{event.Kind}, Limit: 1}
+	stored, err := eventStore.Query(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("failed to query the stored event: %w", err)
 	}
 
-	return nil
+	return len(stored) > 0 && stored[0].CreatedAt >= event.CreatedAt, nil
 }
 
 // processFollowList() updates the follow relationships for the event's author in the database, as well as the random walks.
@@ -131,6 +544,9 @@ func HandleFollowList(
 // It returns the number of walks that have been updated.
 func processFollowList(
 	ctx context.Context,
+	src *randutils.Source,
+	guard *walks.Guard,
+	limiter *FollowLimiter,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	event *nostr.Event) (int, error) {
@@ -163,7 +579,149 @@ func processFollowList(
 		return 0, fmt.Errorf("failed to update nodeID %d: %w", author.ID, err)
 	}
 
-	return walks.Update(ctx, DB, RWS, author.ID, removed, common, added)
+	limiter.Charge(ctx, RWS, author.ID, len(added)+len(removed))
+	return walks.Update(ctx, src, guard, DB, RWS, author.ID, removed, common, added)
+}
+
+// HandleMuteList() process the mute-list if it's newer than the one in the eventStore,
+// and then saves it, replacing the older one.
+func HandleMuteList(
+	DB models.Database,
+	eventStore *eventstore.Store,
+	event *nostr.Event) error {
+
+	// use a new context for the operation to avoid it being interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stale, err := isStale(ctx, eventStore, event)
+	if err != nil || stale {
+		return err
+	}
+
+	if err := processMuteList(ctx, DB, event); err != nil {
+		return fmt.Errorf("failed to process mute-list: %w", err)
+	}
+
+	_, err = eventStore.Replace(ctx, event)
+	return err
+}
+
+// processMuteList() updates the mute relationships for the event's author in the database.
+// Muted pubkeys that are not in the database are ignored, as there is nothing to flag.
+// Mutes don't affect the random walks.
+func processMuteList(
+	ctx context.Context,
+	DB models.Database,
+	event *nostr.Event) error {
+
+	author, err := DB.NodeByKey(ctx, event.PubKey)
+	if err != nil {
+		return fmt.Errorf("failed to fetch node by key %v: %w", event.PubKey, err)
+	}
+
+	// the public mutes are listed in the "p" tags like the follows.
+	// Resolving as inactive guarantees that no new node is added.
+	pubkeys := ParsePubkeys(event)
+	newMutes, err := resolveIDs(ctx, DB, pubkeys, models.StatusInactive)
+	if err != nil {
+		return fmt.Errorf("resolveIDs: %w", err)
+	}
+
+	mutes, err := DB.Mutes(ctx, author.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the old mutes of %d: %w", author.ID, err)
+	}
+
+	removed, _, added := sliceutils.Partition(mutes[0], newMutes)
+	delta := &models.Delta{
+		Kind:    nostr.KindMuteList,
+		NodeID:  author.ID,
+		Added:   added,
+		Removed: removed,
+	}
+
+	if err := DB.Update(ctx, delta); err != nil {
+		return fmt.Errorf("failed to update nodeID %d: %w", author.ID, err)
+	}
+
+	return nil
+}
+
+// HandleReport() adds the reports contained in the event to the database.
+// Reports of pubkeys that are not in the database are ignored.
+func HandleReport(DB models.Database, event *nostr.Event) error {
+	// use a new context for the operation to avoid it being interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reporter, err := DB.NodeByKey(ctx, event.PubKey)
+	if err != nil {
+		return fmt.Errorf("failed to fetch node by key %v: %w", event.PubKey, err)
+	}
+
+	pubkeys, types := ParseReports(event)
+	IDs, err := DB.NodeIDs(ctx, pubkeys...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the IDs: %w", err)
+	}
+
+	reports := make([]models.Report, 0, len(IDs))
+	for i, ID := range IDs {
+		if ID == nil {
+			continue
+		}
+
+		reports = append(reports, models.Report{
+			Reporter: reporter.ID,
+			Reported: *ID,
+			Type:     types[i],
+		})
+	}
+
+	if err := DB.AddReports(ctx, reports...); err != nil {
+		return fmt.Errorf("failed to add the reports of %d: %w", reporter.ID, err)
+	}
+
+	return nil
+}
+
+// HandleRelayList() stores the write relays of the author if the relay-list is newer than
+// the one in the eventStore, and then saves it, replacing the older one.
+func HandleRelayList(
+	DB models.Database,
+	eventStore *eventstore.Store,
+	event *nostr.Event) error {
+
+	// use a new context for the operation to avoid it being interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stale, err := isStale(ctx, eventStore, event)
+	if err != nil || stale {
+		return err
+	}
+
+	if err := processRelayList(ctx, DB, event); err != nil {
+		return fmt.Errorf("failed to process relay-list: %w", err)
+	}
+
+	_, err = eventStore.Replace(ctx, event)
+	return err
+}
+
+// processRelayList() replaces the write relays of the event's author in the database.
+func processRelayList(ctx context.Context, DB models.Database, event *nostr.Event) error {
+	author, err := DB.NodeByKey(ctx, event.PubKey)
+	if err != nil {
+		return fmt.Errorf("failed to fetch node by key %v: %w", event.PubKey, err)
+	}
+
+	if err := DB.SetWriteRelays(ctx, author.ID, ParseWriteRelays(event)); err != nil {
+		return fmt.Errorf("failed to set the write relays of %d: %w", author.ID, err)
+	}
+
+	return nil
 }
 
 // resolveIDs() returns an ID for each pubkey. If the authorStatus is active and
@@ -193,7 +751,7 @@ func resolveIDs(
 					continue
 				}
 
-				newID, err := DB.AddNode(ctx, pubkeys[i])
+				newID, err := addNode(ctx, DB, pubkeys[i])
 				if err != nil {
 					return nil, fmt.Errorf("failed to add %s: %w", pubkeys[i], err)
 				}
@@ -219,6 +777,111 @@ func resolveIDs(
 	return newFollows, nil
 }
 
+// addNode() adds a node with the pubkey and returns its ID. If the pubkey has been added
+// concurrently (e.g. by another worker of ProcessEvents), the ID of the existing node is returned.
+func addNode(ctx context.Context, DB models.Database, pubkey string) (uint32, error) {
+	nodeID, err := DB.AddNode(ctx, pubkey)
+	if !errors.Is(err, models.ErrNodeAlreadyInDB) {
+		return nodeID, err
+	}
+
+	IDs, err := DB.NodeIDs(ctx, pubkey)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(IDs) != 1 || IDs[0] == nil {
+		return 0, fmt.Errorf("%w: %s", models.ErrNodeNotFoundDB, pubkey)
+	}
+
+	return *IDs[0], nil
+}
+
+// ReportTypes are the report types defined in NIP-56.
+var ReportTypes = []string{"nudity", "malware", "profanity", "illegal", "spam", "impersonation", "other"}
+
+// ParseReports() returns the pubkeys reported in the event (kind:1984) and the
+// corresponding report types, in the form ["p", <pubkey>, <type>].
+// - Badly formatted tags are ignored.
+// - Pubkeys will be uniquely added (no repetitions).
+// - The author of the event will be removed from the reported pubkeys if present.
+// - If the type is not specified in the "p" tag, the type of the "e" tag is used (reports of notes).
+// - Unknown or missing types are classified as "other".
+func ParseReports(event *nostr.Event) (pubkeys []string, types []string) {
+	if event == nil || len(event.Tags) == 0 || len(event.Tags) > 1000 {
+		return nil, nil
+	}
+
+	noteType := ""
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "e" {
+			noteType = tag[2]
+			break
+		}
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "p" {
+			continue
+		}
+
+		pubkey := tag[1]
+		if pubkey == event.PubKey || slices.Contains(pubkeys, pubkey) {
+			continue
+		}
+
+		reportType := noteType
+		if len(tag) >= 3 && tag[2] != "" {
+			reportType = tag[2]
+		}
+
+		if !slices.Contains(ReportTypes, reportType) {
+			reportType = "other"
+		}
+
+		pubkeys = append(pubkeys, pubkey)
+		types = append(types, reportType)
+	}
+
+	return pubkeys, types
+}
+
+// ParseWriteRelays() returns the write relays listed in the relay list (kind:10002),
+// in the form ["r", <url>] or ["r", <url>, "write"]. Read-only relays are ignored.
+// - Badly formatted tags and invalid urls are ignored.
+// - Relays are normalized and uniquely added (no repetitions).
+// - At most maxWriteRelays are returned, in the order they are listed.
+func ParseWriteRelays(event *nostr.Event) []string {
+	const maxWriteRelays = 10
+	if event == nil || len(event.Tags) == 0 {
+		return nil
+	}
+
+	relays := make([]string, 0, maxWriteRelays)
+	for _, tag := range event.Tags {
+		if len(relays) >= maxWriteRelays {
+			break
+		}
+
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+
+		if len(tag) >= 3 && tag[2] != "write" {
+			continue
+		}
+
+		relay := nostr.NormalizeURL(tag[1])
+		if !nostr.IsValidRelayURL(relay) || slices.Contains(relays, relay) {
+			continue
+		}
+
+		relays = append(relays, relay)
+	}
+
+	return relays
+}
+
 // ParsePubkeys() returns the slice of pubkeys that are correctly listed in the nostr.Tags.
 // - Badly formatted tags are ignored.
 // - Pubkeys will be uniquely added (no repetitions).
@@ -253,3 +916,15 @@ func ParsePubkeys(event *nostr.Event) []string {
 
 	return sliceutils.Unique(pubkeys)
 }
+
+//---------------------------------ERROR-CODES---------------------------------
+
+var (
+	ErrNilEvent         = errors.New("event is nil")
+	ErrUnsupportedKind  = errors.New("unsupported event kind")
+	ErrMalformedEvent   = errors.New("event ID, pubkey or signature are not valid hex")
+	ErrInvalidID        = errors.New("event ID doesn't match the serialized event")
+	ErrInvalidSignature = errors.New("event signature is not valid")
+	ErrDeferred         = errors.New("follow-list deferred, the author changed too many follows")
+	ErrThrottled        = errors.New("follow-list rejected, the author changed too many follows")
+)
@@ -4,13 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nbd-wtf/go-nostr"
 	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
 	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/walks"
+	"github.com/vertex-lab/relay/pkg/eventstore"
 )
 
 const odell = "04c915daefee38317fa734444acee390a8269fe5810b2241e5e6dd343dfbecc9"
@@ -170,6 +183,385 @@ func TestResolveIDs(t *testing.T) {
 	}
 }
 
+func TestProcessEvents(t *testing.T) {
+	DB := mockdb.SetupDB("pip")
+	RWS := mockstore.SetupRWS("one-node0")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	events, err := queue.NewMemoryQueue(10)
+	if err != nil {
+		t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+	}
+
+	eventCounter, walksTracker := &atomic.Uint32{}, &atomic.Uint32{}
+	process := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		config := ProcessEventsConfig{Log: logger.New(os.Stdout), PrintEvery: 1000, BatchSize: 2, MaxAttempts: 3}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, eventCounter, walksTracker)
+	}
+
+	ctx := context.Background()
+	push := func(event *nostr.Event) {
+		if _, err := events.Push(ctx, event); err != nil {
+			t.Fatalf("Push(): expected nil, got %v", err)
+		}
+	}
+
+	// the follow-list of pip is delivered, but the crawler stops before processing it
+	push(followList("pip", pip, nostr.Now(), odell, calle))
+	if _, err := events.Read(ctx, 1, 0); err != nil {
+		t.Fatalf("Read(): expected nil, got %v", err)
+	}
+
+	push(followList("gigi", gigi, nostr.Now(), pip))     // fails because gigi is not in the DB
+	push(&nostr.Event{ID: "note", PubKey: pip, Kind: 1}) // unsupported kinds are acked
+
+	// the pending follow-list of pip is replayed, and the failed event is retried
+	process()
+	assertStatus(t, DB, map[string]string{
+		odell: models.StatusInactive,
+		calle: models.StatusInactive,
+	})
+
+	length, err := events.Len(ctx)
+	if err != nil {
+		t.Fatalf("Len(): expected nil, got %v", err)
+	}
+
+	if length != 0 {
+		t.Errorf("Len(): expected 0, got %d", length)
+	}
+
+	// the follow-list of gigi is processed MaxAttempts times, and then dead-lettered
+	if eventCounter.Load() != 5 {
+		t.Errorf("expected 5 processed events, got %d", eventCounter.Load())
+	}
+}
+
+// TestProcessEventsRetry checks that a follow-list whose first processing fails
+// is applied when retried, instead of being found already in the eventStore.
+func TestProcessEventsRetry(t *testing.T) {
+	DB := &failOnceDB{Database: mockdb.SetupDB("pip")}
+	RWS := mockstore.SetupRWS("one-node0")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	events, err := queue.NewMemoryQueue(10)
+	if err != nil {
+		t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := events.Push(ctx, followList("pip", pip, nostr.Now(), odell, calle)); err != nil {
+		t.Fatalf("Push(): expected nil, got %v", err)
+	}
+
+	func() {
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		config := ProcessEventsConfig{Log: logger.New(io.Discard), PrintEvery: 1000, BatchSize: 2, MaxAttempts: 3}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, &atomic.Uint32{}, &atomic.Uint32{})
+	}()
+
+	if !DB.failed.Load() {
+		t.Fatalf("expected the first Update to fail")
+	}
+
+	node, err := DB.NodeByKey(ctx, pip)
+	if err != nil {
+		t.Fatalf("NodeByKey(): expected nil, got %v", err)
+	}
+
+	follows, err := DB.Follows(ctx, node.ID)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	IDs, err := DB.NodeIDs(ctx, odell, calle)
+	if err != nil {
+		t.Fatalf("NodeIDs(): expected nil, got %v", err)
+	}
+
+	expected := []uint32{*IDs[0], *IDs[1]}
+	slices.Sort(expected)
+	slices.Sort(follows[0])
+	if !slices.Equal(follows[0], expected) {
+		t.Errorf("Follows(): expected %v, got %v", expected, follows[0])
+	}
+
+	if length, _ := events.Len(ctx); length != 0 {
+		t.Errorf("Len(): expected 0, got %d", length)
+	}
+}
+
+// failOnceDB fails the first Update, like a database that is temporarily unavailable.
+type failOnceDB struct {
+	failed atomic.Bool
+	*mockdb.Database
+}
+
+func (f *failOnceDB) Update(ctx context.Context, deltas ...*models.Delta) error {
+	if f.failed.CompareAndSwap(false, true) {
+		return errors.New("temporarily unavailable")
+	}
+	return f.Database.Update(ctx, deltas...)
+}
+
+// TestProcessEventsFailing checks that events that always fail are moved to the
+// dead-letters after MaxAttempts, so that the producers are never blocked by them.
+func TestProcessEventsFailing(t *testing.T) {
+	const reports = 50
+	DB := mockdb.NewDatabase()
+	RWS := mockstore.SetupRWS("empty")
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	events, err := queue.NewMemoryQueue(5)
+	if err != nil {
+		t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		config := ProcessEventsConfig{Log: logger.New(io.Discard), PrintEvery: 1000, BatchSize: 2, Workers: 2, MaxAttempts: 2}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, &atomic.Uint32{}, &atomic.Uint32{})
+	}()
+
+	// the reports fail because their authors are not in the DB
+	enqueue := Enqueue(ctx, events, ProducerFirehose, nil)
+	for i := 0; i < reports; i++ {
+		report := &nostr.Event{ID: strconv.Itoa(i), PubKey: strconv.Itoa(i), Kind: nostr.KindReporting}
+		if err := enqueue(report); err != nil {
+			t.Fatalf("enqueue(): expected nil, got %v", err)
+		}
+	}
+
+	for ctx.Err() == nil {
+		if length, _ := events.Len(ctx); length == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if length, _ := events.Len(context.Background()); length != 0 {
+		t.Fatalf("Len(): expected 0, got %d", length)
+	}
+
+	// only the last dead-letters are kept, up to the capacity
+	dead, err := events.DeadLetters(context.Background(), reports)
+	if err != nil {
+		t.Fatalf("DeadLetters(): expected nil, got %v", err)
+	}
+
+	if len(dead) != events.Capacity() {
+		t.Errorf("DeadLetters(): expected %d, got %d", events.Capacity(), len(dead))
+	}
+}
+
+// TestProcessEventsConcurrent processes several follow-lists for each author with
+// multiple workers, and checks that the events of each author were processed in order
+// and that the walks are consistent with the final follow graph.
+func TestProcessEventsConcurrent(t *testing.T) {
+	const authors = 30
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42))
+	mockDB := mockdb.NewDatabase()
+	DB := &syncDB{Database: mockDB}
+
+	for i := 0; i < authors; i++ {
+		nodeID, err := mockDB.AddNode(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("AddNode(): expected nil, got %v", err)
+		}
+		mockDB.NodeIndex[nodeID].Status = models.StatusActive
+	}
+
+	// the follows of each follow-list, as nodeIDs. Authors >= authors are the new
+	// pubkeys, which are added concurrently by the workers
+	newPubkeys := []string{odell, calle, pip, gigi}
+	pubkeyOf := func(ID int) string {
+		if ID >= authors {
+			return newPubkeys[ID-authors]
+		}
+		return strconv.Itoa(ID)
+	}
+
+	randomFollows := func() []int {
+		return rng.Perm(authors + len(newPubkeys))[:10]
+	}
+
+	for i := 0; i < authors; i++ {
+		follows := make([]uint32, 0, 10)
+		for _, ID := range randomFollows() {
+			if ID < authors && ID != i {
+				follows = append(follows, uint32(ID))
+			}
+		}
+
+		if err := mockDB.Update(ctx, &models.Delta{Kind: nostr.KindFollowList, NodeID: uint32(i), Added: follows}); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+	}
+
+	mockRWS, _ := mockstore.NewRWS(0.85, 10)
+	RWS := mockstore.NewSyncRWS(mockRWS)
+	if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
+		t.Fatalf("GenerateAll(): expected nil, got %v", err)
+	}
+
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	events, err := queue.NewMemoryQueue(1000)
+	if err != nil {
+		t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+	}
+
+	// three versions of the follow-list of each author, where the latest is expected in the DB
+	latest := make(map[string][]string, authors)
+	for version := 0; version < 3; version++ {
+		for i := 0; i < authors; i++ {
+			author := strconv.Itoa(i)
+			follows := make([]string, 0, 10)
+			for _, ID := range randomFollows() {
+				follows = append(follows, pubkeyOf(ID))
+			}
+
+			ID := fmt.Sprintf("%s:%d", author, version)
+			if _, err := events.Push(ctx, followList(ID, author, nostr.Timestamp(100+version), follows...)); err != nil {
+				t.Fatalf("Push(): expected nil, got %v", err)
+			}
+			latest[author] = slices.DeleteFunc(follows, func(pk string) bool { return pk == author })
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		config := ProcessEventsConfig{Log: logger.New(io.Discard), PrintEvery: 1000, BatchSize: 16, Workers: 4}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, events, &atomic.Uint32{}, &atomic.Uint32{})
+	}()
+
+	for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(10 * time.Millisecond) {
+		if length, _ := events.Len(ctx); length == 0 {
+			break
+		}
+	}
+	cancel()
+	<-done
+
+	if length, _ := events.Len(context.Background()); length != 0 {
+		t.Fatalf("Len(): expected 0, got %d", length)
+	}
+
+	ctx = context.Background()
+	if size := mockDB.Size(ctx); size != authors+len(newPubkeys) {
+		t.Errorf("Size(): expected %d nodes, got %d", authors+len(newPubkeys), size)
+	}
+
+	for author, expected := range latest {
+		node, err := mockDB.NodeByKey(ctx, author)
+		if err != nil {
+			t.Fatalf("NodeByKey(%s): expected nil, got %v", author, err)
+		}
+
+		follows, err := mockDB.Follows(ctx, node.ID)
+		if err != nil {
+			t.Fatalf("Follows(%d): expected nil, got %v", node.ID, err)
+		}
+
+		pubkeys, err := mockDB.Pubkeys(ctx, follows[0]...)
+		if err != nil {
+			t.Fatalf("Pubkeys(): expected nil, got %v", err)
+		}
+
+		got := make([]string, len(pubkeys))
+		for i, pk := range pubkeys {
+			got[i] = *pk
+		}
+
+		slices.Sort(got)
+		slices.Sort(expected)
+		if !slices.Equal(got, expected) {
+			t.Errorf("author %s: expected follows %v, got %v", author, expected, got)
+		}
+	}
+
+	totalVisits := 0
+	for walkID, walk := range mockRWS.WalkIndex {
+		totalVisits += len(walk)
+		for i := 1; i < len(walk); i++ {
+			if !mockDB.Follow[walk[i-1]].Contains(walk[i]) {
+				t.Fatalf("walk %d: %v contains the invalid step %d -> %d", walkID, walk, walk[i-1], walk[i])
+			}
+		}
+	}
+
+	if RWS.TotalVisits(ctx) != totalVisits {
+		t.Errorf("TotalVisits(): expected %d, got %d", totalVisits, RWS.TotalVisits(ctx))
+	}
+}
+
+// syncDB serializes the methods of the mock database used by ProcessEvents,
+// to make it safe for concurrent use like Redis.
+type syncDB struct {
+	mu sync.Mutex
+	*mockdb.Database
+}
+
+func (s *syncDB) ContainsNode(ctx context.Context, nodeID uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.ContainsNode(ctx, nodeID)
+}
+
+func (s *syncDB) NodeByKey(ctx context.Context, pubkey string) (*models.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.NodeByKey(ctx, pubkey)
+}
+
+func (s *syncDB) NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.NodeIDs(ctx, pubkeys...)
+}
+
+func (s *syncDB) AddNode(ctx context.Context, pubkey string) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.AddNode(ctx, pubkey)
+}
+
+func (s *syncDB) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.Follows(ctx, nodeIDs...)
+}
+
+func (s *syncDB) Update(ctx context.Context, deltas ...*models.Delta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Database.Update(ctx, deltas...)
+}
+
 func TestProcessFollowList(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -205,7 +597,7 @@ func TestProcessFollowList(t *testing.T) {
 					nostr.Tag{"p", odell}},
 			}
 
-			_, err := processFollowList(ctx, DB, RWS, event)
+			_, err := processFollowList(ctx, nil, nil, nil, DB, RWS, event)
 			if !errors.Is(err, test.expectedError) {
 				t.Fatalf("ProcessFollowList(): expected %v, got %v", test.expectedError, err)
 			}
@@ -213,6 +605,286 @@ func TestProcessFollowList(t *testing.T) {
 	}
 }
 
+func TestProcessMuteList(t *testing.T) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		expectedError   error
+		expectedMutes   []uint32
+		expectedMutedBy [][]uint32
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "event.PubKey not found",
+			DBType:        "one-node0",
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:            "valid",
+			DBType:          "simple-with-pks",
+			expectedMutes:   []uint32{0},
+			expectedMutedBy: [][]uint32{{1}, {}, {}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := mockdb.SetupDB(test.DBType)
+			event := &nostr.Event{
+				PubKey:    calle,
+				Kind:      nostr.KindMuteList,
+				CreatedAt: nostr.Timestamp(11),
+				Tags: nostr.Tags{
+					nostr.Tag{"p", gigi},
+					nostr.Tag{"p", odell}},
+			}
+
+			err := processMuteList(ctx, DB, event)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("processMuteList(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			// gigi is not in the DB, so it must not be added
+			if DB.Size(ctx) != 3 {
+				t.Errorf("processMuteList(): expected size 3, got %d", DB.Size(ctx))
+			}
+
+			mutes, err := DB.Mutes(ctx, 1)
+			if err != nil {
+				t.Fatalf("Mutes(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(mutes[0], test.expectedMutes) {
+				t.Errorf("processMuteList(): expected mutes %v, got %v", test.expectedMutes, mutes[0])
+			}
+
+			mutedBy, err := DB.MutedBy(ctx, 0, 1, 2)
+			if err != nil {
+				t.Fatalf("MutedBy(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(mutedBy, test.expectedMutedBy) {
+				t.Errorf("processMuteList(): expected mutedBy %v, got %v", test.expectedMutedBy, mutedBy)
+			}
+		})
+	}
+}
+
+func TestParseReports(t *testing.T) {
+	testCases := []struct {
+		name            string
+		event           *nostr.Event
+		expectedPubkeys []string
+		expectedTypes   []string
+	}{
+		{
+			name:  "nil event",
+			event: nil,
+		},
+		{
+			name: "report of a pubkey",
+			event: &nostr.Event{
+				PubKey: odell,
+				Tags: nostr.Tags{
+					nostr.Tag{"p", odell, "spam"},
+					nostr.Tag{"p", calle, "impersonation"},
+					nostr.Tag{"p", calle, "spam"},
+					nostr.Tag{"p", pip, "something"},
+					nostr.Tag{"p"},
+				},
+			},
+			expectedPubkeys: []string{calle, pip},
+			expectedTypes:   []string{"impersonation", "other"},
+		},
+		{
+			name: "report of a note",
+			event: &nostr.Event{
+				PubKey: odell,
+				Tags: nostr.Tags{
+					nostr.Tag{"e", "note-id", "nudity"},
+					nostr.Tag{"p", gigi},
+				},
+			},
+			expectedPubkeys: []string{gigi},
+			expectedTypes:   []string{"nudity"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			pubkeys, types := ParseReports(test.event)
+			if !reflect.DeepEqual(pubkeys, test.expectedPubkeys) {
+				t.Errorf("ParseReports(): expected pubkeys %v, got %v", test.expectedPubkeys, pubkeys)
+			}
+
+			if !reflect.DeepEqual(types, test.expectedTypes) {
+				t.Errorf("ParseReports(): expected types %v, got %v", test.expectedTypes, types)
+			}
+		})
+	}
+}
+
+func TestHandleReport(t *testing.T) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		expectedError   error
+		expectedReports []models.ReportMap
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "event.PubKey not found",
+			DBType:        "one-node0",
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:            "valid",
+			DBType:          "simple-with-pks",
+			expectedReports: []models.ReportMap{{"spam": {1}}, {}, {}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := mockdb.SetupDB(test.DBType)
+			event := &nostr.Event{
+				PubKey:    calle,
+				Kind:      nostr.KindReporting,
+				CreatedAt: nostr.Timestamp(11),
+				Tags: nostr.Tags{
+					nostr.Tag{"p", gigi, "spam"},
+					nostr.Tag{"p", odell, "spam"}},
+			}
+
+			err := HandleReport(DB, event)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("HandleReport(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			reports, err := DB.Reports(context.Background(), 0, 1, 2)
+			if err != nil {
+				t.Fatalf("Reports(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(reports, test.expectedReports) {
+				t.Errorf("HandleReport(): expected reports %v, got %v", test.expectedReports, reports)
+			}
+		})
+	}
+}
+
+func TestParseWriteRelays(t *testing.T) {
+	testCases := []struct {
+		name           string
+		event          *nostr.Event
+		expectedRelays []string
+	}{
+		{
+			name:  "nil event",
+			event: nil,
+		},
+		{
+			name: "valid",
+			event: &nostr.Event{
+				Tags: nostr.Tags{
+					nostr.Tag{"r", "wss://relay.damus.io"},
+					nostr.Tag{"r", "wss://relay.damus.io/"},
+					nostr.Tag{"r", "wss://read.only", "read"},
+					nostr.Tag{"r", "wss://write.only", "write"},
+					nostr.Tag{"r", ""},
+					nostr.Tag{"p", "wss://not.a.relay"},
+					nostr.Tag{"r"},
+				},
+			},
+			expectedRelays: []string{"wss://relay.damus.io", "wss://write.only"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			relays := ParseWriteRelays(test.event)
+			if !reflect.DeepEqual(relays, test.expectedRelays) {
+				t.Errorf("ParseWriteRelays(): expected %v, got %v", test.expectedRelays, relays)
+			}
+		})
+	}
+}
+
+func TestProcessRelayList(t *testing.T) {
+	testCases := []struct {
+		name           string
+		DBType         string
+		expectedError  error
+		expectedRelays [][]string
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "event.PubKey not found",
+			DBType:        "one-node0",
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:           "valid",
+			DBType:         "simple-with-pks",
+			expectedRelays: [][]string{{"wss://relay.damus.io"}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := mockdb.SetupDB(test.DBType)
+			event := &nostr.Event{
+				PubKey:    calle,
+				Kind:      nostr.KindRelayListMetadata,
+				CreatedAt: nostr.Timestamp(11),
+				Tags: nostr.Tags{
+					nostr.Tag{"r", "wss://relay.damus.io"},
+					nostr.Tag{"r", "wss://nos.lol", "read"}},
+			}
+
+			err := processRelayList(ctx, DB, event)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("processRelayList(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			relays, err := DB.WriteRelays(ctx, 1)
+			if err != nil {
+				t.Fatalf("WriteRelays(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(relays, test.expectedRelays) {
+				t.Errorf("processRelayList(): expected relays %v, got %v", test.expectedRelays, relays)
+			}
+		})
+	}
+}
+
 // ---------------------------------BENCHMARKS----------------------------------
 
 func BenchmarkIsValidPubkey(b *testing.B) {
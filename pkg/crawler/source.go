@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+// EventSource abstracts the relays from which the crawler fetches events, which
+// allows the Firehose and QueryPubkeys to be tested without network.
+type EventSource interface {
+	// Subscribe() returns a channel of the events that match the filter, starting
+	// from filter.Since, together with the relay that sent them.
+	// The channel is closed when the context is cancelled.
+	Subscribe(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent
+
+	// Query() returns a channel of the stored events that match the filter, together with the relay that sent them.
+	// The channel is closed when all relays have sent EOSE (or the context is cancelled).
+	Query(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent
+}
+
+type PoolSourceConfig struct {
+	Log *logger.Aggregate
+
+	// the maximum number of connections kept open between queries, besides those of the subscriptions
+	MaxConnections int
+
+	// the connections that haven't been queried for longer than MaxIdle are closed
+	MaxIdle time.Duration
+}
+
+func NewPoolSourceConfig() PoolSourceConfig {
+	return PoolSourceConfig{
+		Log:            logger.New(os.Stdout),
+		MaxConnections: 200,
+		MaxIdle:        10 * time.Minute,
+	}
+}
+
+func (c PoolSourceConfig) Print() {
+	fmt.Printf("Pool\n")
+	fmt.Printf("  MaxConnections: %d\n", c.MaxConnections)
+	fmt.Printf("  MaxIdle: %v\n", c.MaxIdle)
+}
+
+/*
+PoolSource is the EventSource that connects to the relays using a nostr.SimplePool.
+
+The relays queried come from the relay lists of the pubkeys (kind:10002), which anyone can publish,
+so the pool would otherwise keep open a connection to every relay ever queried. Before each query,
+the connections idle for longer than config.MaxIdle are closed, and then the least recently queried
+ones until at most config.MaxConnections are left. The relays of the subscriptions, and those with
+queries in flight (possibly from other goroutines), are never closed.
+*/
+type PoolSource struct {
+	pool   *nostr.SimplePool
+	config PoolSourceConfig
+	now    func() time.Time
+
+	mu         sync.Mutex
+	subscribed map[string]struct{}  // the normalized urls of the relays of the subscriptions
+	active     map[string]int       // the normalized urls of the relays with queries in flight, and how many
+	lastUsed   map[string]time.Time // the normalized urls of the relays queried, and when
+}
+
+// NewPoolSource() returns a PoolSource whose connections are bound to the context.
+func NewPoolSource(ctx context.Context, config PoolSourceConfig) *PoolSource {
+	return &PoolSource{
+		pool:       nostr.NewSimplePool(ctx),
+		config:     config,
+		now:        time.Now,
+		subscribed: make(map[string]struct{}),
+		active:     make(map[string]int),
+		lastUsed:   make(map[string]time.Time),
+	}
+}
+
+func (s *PoolSource) Subscribe(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	s.mu.Lock()
+	for _, relay := range relays {
+		s.subscribed[nostr.NormalizeURL(relay)] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	return s.pool.SubMany(ctx, relays, nostr.Filters{filter})
+}
+
+func (s *PoolSource) Query(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	s.acquire(relays)
+	events := s.pool.SubManyEose(ctx, relays, nostr.Filters{filter})
+
+	// the relays are released only when the query is over, so that concurrent queries don't close them
+	forwarded := make(chan nostr.RelayEvent)
+	go func() {
+		defer close(forwarded)
+		defer s.release(relays)
+
+		for event := range events {
+			select {
+			case <-ctx.Done():
+				return
+			case forwarded <- event:
+			}
+		}
+	}()
+
+	return forwarded
+}
+
+// acquire() marks the relays as in use, and prunes the connections of the other relays.
+func (s *PoolSource) acquire(relays []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, relay := range relays {
+		url := nostr.NormalizeURL(relay)
+		s.active[url]++
+		s.lastUsed[url] = now
+	}
+
+	s.prune(now)
+}
+
+// release() marks the relays as no longer in use by a query, and used now.
+func (s *PoolSource) release(relays []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, relay := range relays {
+		url := nostr.NormalizeURL(relay)
+		s.lastUsed[url] = now
+		if s.active[url]--; s.active[url] <= 0 {
+			delete(s.active, url)
+		}
+	}
+}
+
+// prune() closes the connections of the relays not subscribed nor in use that are idle for
+// longer than config.MaxIdle, or are the least recently used above config.MaxConnections.
+// It must be called with the mutex held.
+func (s *PoolSource) prune(now time.Time) {
+	type connection struct {
+		url      string
+		lastUsed time.Time
+	}
+
+	open := make(map[string]struct{})
+	var idle []connection
+	s.pool.Relays.Range(func(url string, _ *nostr.Relay) bool {
+		open[url] = struct{}{}
+		_, subscribed := s.subscribed[url]
+		_, inUse := s.active[url]
+		if !subscribed && !inUse {
+			idle = append(idle, connection{url: url, lastUsed: s.lastUsed[url]})
+		}
+		return true
+	})
+
+	// the most recently used first, so that the connections to close are at the end
+	slices.SortFunc(idle, func(c1, c2 connection) int {
+		return c2.lastUsed.Compare(c1.lastUsed)
+	})
+
+	keep := s.config.MaxConnections - len(s.active)
+	for i, conn := range idle {
+		if i < keep && now.Sub(conn.lastUsed) <= s.config.MaxIdle {
+			continue
+		}
+
+		if relay, ok := s.pool.Relays.Load(conn.url); ok {
+			relay.Close()
+		}
+		s.pool.Relays.Delete(conn.url)
+		delete(open, conn.url)
+	}
+
+	// only the relays of the open connections, or in use, are remembered
+	for url := range s.lastUsed {
+		_, isOpen := open[url]
+		_, inUse := s.active[url]
+		if !isOpen && !inUse {
+			delete(s.lastUsed, url)
+		}
+	}
+}
+
+// Close() closes all the relay connections of the pool.
+func (s *PoolSource) Close() {
+	CloseRelays(s.config.Log, s.pool, "PoolSource")
+}
@@ -0,0 +1,317 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockrelay "github.com/vertex-lab/crawler/pkg/crawler/mock"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/queue"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/relay/pkg/eventstore"
+)
+
+func followList(ID, author string, createdAt nostr.Timestamp, follows ...string) *nostr.Event {
+	event := &nostr.Event{ID: ID, PubKey: author, Kind: nostr.KindFollowList, CreatedAt: createdAt}
+	for _, pk := range follows {
+		event.Tags = append(event.Tags, nostr.Tag{"p", pk})
+	}
+	return event
+}
+
+func TestFirehoseSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	relay := mockrelay.NewRelay()
+	relay.Add("", followList("old", pip, nostr.Now()-100, odell))
+
+	config := FirehoseConfig{Log: logger.New(os.Stdout), Relays: []string{"wss://one"}}
+	queue := make(chan *nostr.Event, 10)
+
+	go func() {
+		// wait for the Firehose to subscribe, then send live events
+		time.Sleep(50 * time.Millisecond)
+		relay.Add("", followList("unknown author", gigi, nostr.Now()+10, odell))
+		relay.Add("wss://one", followList("new", pip, nostr.Now()+10, odell))
+	}()
+
+	Firehose(ctx, config, relay, mockdb.SetupDB("pip"), func(event *nostr.Event) error {
+		queue <- event
+		return nil
+	})
+	close(queue)
+
+	var IDs []string
+	for event := range queue {
+		IDs = append(IDs, event.ID)
+	}
+
+	expected := []string{"new"}
+	if !reflect.DeepEqual(IDs, expected) {
+		t.Errorf("Firehose(): expected %v, got %v", expected, IDs)
+	}
+}
+
+func TestPoolSourcePrune(t *testing.T) {
+	now := time.Unix(1000, 0)
+	source := NewPoolSource(context.Background(), PoolSourceConfig{Log: logger.New(os.Stdout), MaxConnections: 3, MaxIdle: time.Minute})
+	source.now = func() time.Time { return now }
+
+	// the pool connects to the relays after they have been acquired
+	query := func(URLs ...string) {
+		source.acquire(URLs)
+		for _, URL := range URLs {
+			source.pool.Relays.Store(URL, &nostr.Relay{URL: URL})
+		}
+		source.release(URLs)
+	}
+
+	source.subscribed["wss://firehose.relay"] = struct{}{}
+	source.pool.Relays.Store("wss://firehose.relay", &nostr.Relay{URL: "wss://firehose.relay"})
+	query("wss://old.relay")
+
+	now = now.Add(30 * time.Second)
+	query("wss://recent.relay")
+
+	// old.relay is idle for longer than MaxIdle
+	now = now.Add(45 * time.Second)
+	query()
+	assertConnected(t, source, "wss://firehose.relay", "wss://recent.relay")
+
+	// above MaxConnections the least recently used are closed, but never the queried or subscribed ones
+	now = now.Add(time.Second)
+	query("wss://one.relay", "wss://two.relay")
+	now = now.Add(time.Second)
+	query("wss://three.relay")
+	assertConnected(t, source, "wss://firehose.relay", "wss://one.relay", "wss://three.relay", "wss://two.relay")
+}
+
+// TestPoolSourcePruneConcurrent queries more relays than MaxConnections concurrently, like QueryPubkeyBatch,
+// and checks that the relays of the queries in flight are never closed.
+func TestPoolSourcePruneConcurrent(t *testing.T) {
+	const relays = 50
+	source := NewPoolSource(context.Background(), PoolSourceConfig{Log: logger.New(os.Stdout), MaxConnections: 3, MaxIdle: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < relays; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			URL := fmt.Sprintf("wss://relay%d.com", i)
+			source.acquire([]string{URL})
+			source.pool.Relays.Store(URL, &nostr.Relay{URL: URL})
+
+			// reading from the relay, while the other goroutines are pruning
+			for range 10 {
+				if _, ok := source.pool.Relays.Load(URL); !ok {
+					t.Errorf("%s was closed while in use", URL)
+					break
+				}
+				runtime.Gosched()
+			}
+			source.release([]string{URL})
+		}()
+	}
+	wg.Wait()
+
+	source.acquire(nil)
+	connections := 0
+	source.pool.Relays.Range(func(string, *nostr.Relay) bool {
+		connections++
+		return true
+	})
+
+	if connections > 3 {
+		t.Errorf("expected at most 3 connections, got %d", connections)
+	}
+
+	if len(source.active) != 0 || len(source.lastUsed) != connections {
+		t.Errorf("expected no active relays and %d last used, got %v and %v", connections, source.active, source.lastUsed)
+	}
+}
+
+// assertConnected() checks that the pool of the source has exactly the expected relays, sorted.
+func assertConnected(t *testing.T, source *PoolSource, expected ...string) {
+	t.Helper()
+	var URLs []string
+	source.pool.Relays.Range(func(URL string, _ *nostr.Relay) bool {
+		URLs = append(URLs, URL)
+		return true
+	})
+
+	sort.Strings(URLs)
+	if !reflect.DeepEqual(URLs, expected) {
+		t.Errorf("expected the relays %v, got %v", expected, URLs)
+	}
+}
+
+func TestQueryPubkeyBatchSource(t *testing.T) {
+	relay := mockrelay.NewRelay()
+	relay.Add("wss://odell.relay", followList("odell-old", odell, 1, calle))
+	relay.Add("wss://odell.relay", followList("odell-new", odell, 2, calle, pip))
+	relay.Add("wss://calle.relay", followList("calle", calle, 1, odell))
+	relay.Add("wss://other.relay", followList("pip", pip, 1, odell))
+
+	groups := map[string][]string{
+		"wss://odell.relay": {odell},
+		"wss://calle.relay": {calle, pip},
+	}
+
+	var IDs []string
+	err := QueryPubkeyBatch(context.Background(), relay, groups, func(event *nostr.Event) error {
+		IDs = append(IDs, event.ID)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("QueryPubkeyBatch(): expected nil, got %v", err)
+	}
+
+	sort.Strings(IDs)
+	expected := []string{"calle", "odell-new"}
+	if !reflect.DeepEqual(IDs, expected) {
+		t.Errorf("QueryPubkeyBatch(): expected %v, got %v", expected, IDs)
+	}
+}
+
+// TestPipeline runs Firehose -> ProcessEvents -> NodeArbiter -> QueryPubkeys -> ProcessEvents
+// against the in-memory relay. The stages run one after the other because the mock database is not thread-safe.
+func TestPipeline(t *testing.T) {
+	DB := mockdb.SetupDB("pip")
+	RWS := mockstore.SetupRWS("one-node0")
+	log := logger.New(os.Stdout)
+
+	eventStore, err := eventstore.New(filepath.Join(t.TempDir(), "events.sqlite"))
+	if err != nil {
+		t.Fatalf("eventstore.New(): expected nil, got %v", err)
+	}
+
+	relay := mockrelay.NewRelay()
+	relay.Add("", followList("calle", calle, nostr.Now()-100, gigi))
+
+	eventQueue, err := queue.NewMemoryQueue(10)
+	if err != nil {
+		t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+	}
+
+	pubkeyQueue := make(chan string, 10)
+	eventCounter, walksTracker := &atomic.Uint32{}, &atomic.Uint32{}
+
+	process := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		config := ProcessEventsConfig{Log: log, PrintEvery: 1000}
+		ProcessEvents(ctx, config, DB, RWS, eventStore, eventQueue, eventCounter, walksTracker)
+	}
+
+	// Firehose: pip publishes a new follow-list while the firehose is running
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			relay.Add("", followList("pip", pip, nostr.Now()+10, odell, calle))
+		}()
+
+		config := FirehoseConfig{Log: log, Relays: []string{"wss://one"}}
+		Firehose(ctx, config, relay, DB, Enqueue(ctx, eventQueue, ProducerFirehose, nil))
+	}()
+
+	process()
+	assertStatus(t, DB, map[string]string{
+		pip:   models.StatusActive,
+		odell: models.StatusInactive,
+		calle: models.StatusInactive,
+	})
+
+	// NodeArbiter: odell and calle get promoted and their pubkeys are queued
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		config := NodeArbiterConfig{
+			Log:                 log,
+			ActivationThreshold: 0,
+			PromotionMultiplier: 0,
+			DemotionMultiplier:  0,
+			Interval:            50 * time.Millisecond,
+		}
+
+		NodeArbiter(ctx, config, DB, RWS, walksTracker, func(pk string) error {
+			pubkeyQueue <- pk
+			return nil
+		})
+	}()
+
+	assertStatus(t, DB, map[string]string{
+		pip:   models.StatusActive,
+		odell: models.StatusActive,
+		calle: models.StatusActive,
+	})
+
+	// QueryPubkeys: fetches calle's follow-list, which adds gigi
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		config := QueryPubkeysConfig{
+			Log:                log,
+			Relays:             []string{"wss://one"},
+			BatchSize:          2,
+			Interval:           time.Minute,
+			MaxRelaysPerPubkey: 3,
+		}
+
+		QueryPubkeys(ctx, config, relay, DB, pubkeyQueue, Enqueue(ctx, eventQueue, ProducerQueryPubkeys, nil))
+	}()
+
+	process()
+	assertStatus(t, DB, map[string]string{
+		pip:   models.StatusActive,
+		odell: models.StatusActive,
+		calle: models.StatusActive,
+		gigi:  models.StatusInactive,
+	})
+
+	if eventCounter.Load() != 2 {
+		t.Errorf("expected 2 processed events, got %d", eventCounter.Load())
+	}
+
+	length, err := eventQueue.Len(context.Background())
+	if err != nil {
+		t.Fatalf("Len(): expected nil, got %v", err)
+	}
+
+	if length != 0 {
+		t.Errorf("Len(): expected all events to be acked, got %d in the queue", length)
+	}
+}
+
+// assertStatus() checks that each pubkey is in the DB with the expected status.
+func assertStatus(t *testing.T, DB models.Database, expected map[string]string) {
+	t.Helper()
+	for pubkey, status := range expected {
+		node, err := DB.NodeByKey(context.Background(), pubkey)
+		if err != nil {
+			t.Fatalf("NodeByKey(%s): expected nil, got %v", pubkey, err)
+		}
+
+		if node.Status != status {
+			t.Errorf("%s: expected status %s, got %s", pubkey, status, node.Status)
+		}
+	}
+}
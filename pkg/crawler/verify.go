@@ -0,0 +1,255 @@
+package crawler
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RelayOther is the label of the rejections of the relays that are not in the VerifierConfig.Relays.
+const RelayOther = "other"
+
+type VerifierConfig struct {
+	Metrics   *Metrics // if nil, no metrics are recorded
+	Workers   int      // the number of goroutines that check the signatures of each subscription or query
+	CacheSize int      // the number of verified events remembered, to avoid checking their signature again
+
+	// the relays whose rejections are counted separately. Those of any other relay,
+	// like the ones found in the relay lists of the pubkeys, are counted as RelayOther.
+	Relays []string
+}
+
+func NewVerifierConfig() VerifierConfig {
+	return VerifierConfig{
+		Workers:   runtime.NumCPU(),
+		CacheSize: 100000,
+		Relays:    defaultRelays,
+	}
+}
+
+func (c VerifierConfig) Print() {
+	fmt.Printf("Verifier\n")
+	fmt.Printf("  Workers: %d\n", c.Workers)
+	fmt.Printf("  CacheSize: %d\n", c.CacheSize)
+	fmt.Printf("  Relays: %v\n", c.Relays)
+}
+
+/*
+Verifier checks that the events are well formed, that their ID is the hash of
+their serialization, and that they are signed by their author (NIP-01).
+
+The verified events are cached by ID and signature, so that the same event received
+from multiple relays, or verified again before processing, costs only the hash of its
+serialization instead of a Schnorr verification. The cache is bounded to config.CacheSize
+events, and the oldest are forgotten first.
+
+The rejected events are counted by the relay that sent them, if it's one of config.Relays,
+otherwise as [RelayOther]. Relays are announced by anyone in their relay lists (kind:10002),
+so counting each of them separately would let anyone grow the counters without bound.
+*/
+type Verifier struct {
+	config VerifierConfig
+	known  map[string]struct{} // the normalized config.Relays
+
+	mu         sync.Mutex
+	verified   map[string]struct{}
+	order      []string // the keys of the verified events, in insertion order (ring buffer)
+	next       int      // the position in order of the next key to insert
+	rejections map[string]int
+}
+
+// NewVerifier() returns a Verifier with an empty cache.
+func NewVerifier(config VerifierConfig) *Verifier {
+	known := make(map[string]struct{}, len(config.Relays))
+	for _, relay := range config.Relays {
+		known[nostr.NormalizeURL(relay)] = struct{}{}
+	}
+
+	return &Verifier{
+		config:     config,
+		known:      known,
+		verified:   make(map[string]struct{}, max(config.CacheSize, 0)),
+		order:      make([]string, 0, max(config.CacheSize, 0)),
+		rejections: make(map[string]int),
+	}
+}
+
+// Verify() returns nil if the event is valid, or the reason why it isn't,
+// which is one of ErrNilEvent, ErrMalformedEvent, ErrInvalidID and ErrInvalidSignature.
+func (v *Verifier) Verify(event *nostr.Event) error {
+	if event == nil {
+		return ErrNilEvent
+	}
+
+	if !nostr.IsValid32ByteHex(event.ID) || !nostr.IsValidPublicKey(event.PubKey) || !isValidSig(event.Sig) {
+		return ErrMalformedEvent
+	}
+
+	if !event.CheckID() {
+		return ErrInvalidID
+	}
+
+	key := event.ID + event.Sig
+	if v.isVerified(key) {
+		return nil
+	}
+
+	ok, err := event.CheckSignature()
+	if err != nil || !ok {
+		return ErrInvalidSignature
+	}
+
+	v.remember(key)
+	return nil
+}
+
+// Check() verifies the event and records it as rejected by the relay if it isn't valid.
+func (v *Verifier) Check(relay string, event *nostr.Event) error {
+	err := v.Verify(event)
+	if err != nil {
+		label := v.label(relay)
+		v.mu.Lock()
+		v.rejections[label]++
+		v.mu.Unlock()
+		v.config.Metrics.Rejected(label, rejectReason(err))
+	}
+	return err
+}
+
+// label() returns the normalized url of the relay if it's one of config.Relays, otherwise [RelayOther].
+func (v *Verifier) label(relay string) string {
+	relay = nostr.NormalizeURL(relay)
+	if _, known := v.known[relay]; known {
+		return relay
+	}
+	return RelayOther
+}
+
+// Rejections() returns the number of events rejected, by relay (see [Verifier.Check]).
+func (v *Verifier) Rejections() map[string]int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	rejections := make(map[string]int, len(v.rejections))
+	for relay, count := range v.rejections {
+		rejections[relay] = count
+	}
+	return rejections
+}
+
+func (v *Verifier) isVerified(key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, exists := v.verified[key]
+	return exists
+}
+
+// remember() adds the key to the cache, evicting the oldest if the cache is full.
+func (v *Verifier) remember(key string) {
+	if v.config.CacheSize <= 0 {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, exists := v.verified[key]; exists {
+		return
+	}
+
+	if len(v.order) < v.config.CacheSize {
+		v.order = append(v.order, key)
+	} else {
+		delete(v.verified, v.order[v.next])
+		v.order[v.next] = key
+		v.next = (v.next + 1) % v.config.CacheSize
+	}
+	v.verified[key] = struct{}{}
+}
+
+// Source() returns an EventSource that only forwards the events of the source that are valid.
+func (v *Verifier) Source(source EventSource) EventSource {
+	return &verifiedSource{source: source, verifier: v}
+}
+
+// verifiedSource is the EventSource returned by [Verifier.Source].
+type verifiedSource struct {
+	source   EventSource
+	verifier *Verifier
+}
+
+func (s *verifiedSource) Subscribe(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	return s.verifier.filter(ctx, s.source.Subscribe(ctx, relays, filter))
+}
+
+func (s *verifiedSource) Query(ctx context.Context, relays []string, filter nostr.Filter) <-chan nostr.RelayEvent {
+	return s.verifier.filter(ctx, s.source.Query(ctx, relays, filter))
+}
+
+// filter() checks the events with config.Workers goroutines, and forwards the valid ones.
+// The order of the events is not preserved. The channel is closed after the input channel.
+func (v *Verifier) filter(ctx context.Context, events <-chan nostr.RelayEvent) <-chan nostr.RelayEvent {
+	valid := make(chan nostr.RelayEvent)
+	wg := &sync.WaitGroup{}
+
+	for range max(v.config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range events {
+				if err := v.Check(relayURL(event), event.Event); err != nil {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case valid <- event:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(valid)
+	}()
+
+	return valid
+}
+
+// relayURL() returns the url of the relay that sent the event, or an empty string if unknown.
+func relayURL(event nostr.RelayEvent) string {
+	if event.Relay == nil {
+		return ""
+	}
+	return event.Relay.URL
+}
+
+// isValidSig() returns whether the sig is the hex encoding of 64 bytes.
+func isValidSig(sig string) bool {
+	b, err := hex.DecodeString(sig)
+	return err == nil && len(b) == 64
+}
+
+// isInvalid() returns whether the error is one of those returned by [Verifier.Verify] for an invalid event.
+func isInvalid(err error) bool {
+	return errors.Is(err, ErrMalformedEvent) || errors.Is(err, ErrInvalidID) || errors.Is(err, ErrInvalidSignature)
+}
+
+// rejectReason() returns the label of the error returned by [Verifier.Verify].
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidID):
+		return "invalid_id"
+	case errors.Is(err, ErrInvalidSignature):
+		return "invalid_signature"
+	default:
+		return "malformed"
+	}
+}
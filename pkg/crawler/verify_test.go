@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockrelay "github.com/vertex-lab/crawler/pkg/crawler/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+// signed() returns a follow-list signed with the secret key.
+func signed(t *testing.T, sk string, createdAt nostr.Timestamp, follows ...string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: nostr.KindFollowList, CreatedAt: createdAt, Tags: nostr.Tags{}}
+	for _, pk := range follows {
+		event.Tags = append(event.Tags, nostr.Tag{"p", pk})
+	}
+
+	if err := event.Sign(sk); err != nil {
+		t.Fatalf("Sign(): expected nil, got %v", err)
+	}
+	return event
+}
+
+func TestVerify(t *testing.T) {
+	sk, otherSk := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	otherPk, _ := nostr.GetPublicKey(otherSk)
+
+	testCases := []struct {
+		name          string
+		event         func() *nostr.Event
+		expectedError error
+	}{
+		{
+			name:          "nil event",
+			event:         func() *nostr.Event { return nil },
+			expectedError: ErrNilEvent,
+		},
+		{
+			name: "malformed ID",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.ID = "not hex"
+				return event
+			},
+			expectedError: ErrMalformedEvent,
+		},
+		{
+			name: "malformed pubkey",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.PubKey = event.PubKey[:60]
+				return event
+			},
+			expectedError: ErrMalformedEvent,
+		},
+		{
+			name: "malformed signature",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.Sig = event.Sig[:64]
+				return event
+			},
+			expectedError: ErrMalformedEvent,
+		},
+		{
+			name: "tampered content",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.Tags = append(event.Tags, nostr.Tag{"p", calle})
+				return event
+			},
+			expectedError: ErrInvalidID,
+		},
+		{
+			name: "tampered content with recomputed ID",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.Tags = append(event.Tags, nostr.Tag{"p", calle})
+				event.ID = event.GetID()
+				return event
+			},
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name: "impersonated author",
+			event: func() *nostr.Event {
+				event := signed(t, sk, 1, odell)
+				event.PubKey = otherPk
+				event.ID = event.GetID()
+				return event
+			},
+			expectedError: ErrInvalidSignature,
+		},
+		{
+			name:  "valid",
+			event: func() *nostr.Event { return signed(t, sk, 1, odell) },
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := NewVerifier(NewVerifierConfig())
+			if err := verifier.Verify(test.event()); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Verify(): expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestVerifierCache(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	verifier := NewVerifier(VerifierConfig{Workers: 1, CacheSize: 2})
+
+	events := []*nostr.Event{signed(t, sk, 1), signed(t, sk, 2), signed(t, sk, 3)}
+	for _, event := range events {
+		if err := verifier.Verify(event); err != nil {
+			t.Fatalf("Verify(): expected nil, got %v", err)
+		}
+	}
+
+	// the oldest event has been evicted
+	for i, expected := range []bool{false, true, true} {
+		if verified := verifier.isVerified(events[i].ID + events[i].Sig); verified != expected {
+			t.Errorf("event %d: expected verified %v, got %v", i, expected, verified)
+		}
+	}
+
+	t.Run("forged signature of a cached event", func(t *testing.T) {
+		forged := *events[2]
+		forged.Sig = events[1].Sig
+		if err := verifier.Verify(&forged); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Verify(): expected %v, got %v", ErrInvalidSignature, err)
+		}
+	})
+}
+
+func TestVerifiedSource(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	valid := signed(t, sk, 2, odell)
+	tampered := signed(t, sk, 1, odell)
+	tampered.Tags = append(tampered.Tags, nostr.Tag{"p", calle})
+	unsigned := &nostr.Event{PubKey: pk, Kind: nostr.KindFollowList, CreatedAt: 3, Tags: nostr.Tags{}}
+	unsigned.ID = unsigned.GetID()
+
+	relay := mockrelay.NewRelay()
+	relay.Add("wss://good.relay", valid)
+	relay.Add("wss://bad.relay", tampered, unsigned)
+	relay.Add("wss://unknown.relay", tampered)
+
+	verifier := NewVerifier(VerifierConfig{Workers: 4, CacheSize: 10, Relays: []string{"wss://good.relay", "wss://bad.relay"}})
+	source := verifier.Source(relay)
+
+	var IDs []string
+	groups := map[string][]string{
+		"wss://good.relay":    {pk},
+		"wss://bad.relay":     {pk},
+		"wss://unknown.relay": {pk},
+	}
+
+	err := QueryPubkeyBatch(context.Background(), source, groups, func(event *nostr.Event) error {
+		IDs = append(IDs, event.ID)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("QueryPubkeyBatch(): expected nil, got %v", err)
+	}
+
+	// the newest event is unsigned, so the valid one is sent to the queue
+	expected := []string{valid.ID}
+	sort.Strings(IDs)
+	if !reflect.DeepEqual(IDs, expected) {
+		t.Errorf("QueryPubkeyBatch(): expected %v, got %v", expected, IDs)
+	}
+
+	// the rejections of the relays that are not in the config are counted together
+	expectedRejections := map[string]int{"wss://bad.relay": 2, RelayOther: 1}
+	if !reflect.DeepEqual(verifier.Rejections(), expectedRejections) {
+		t.Errorf("Rejections(): expected %v, got %v", expectedRejections, verifier.Rejections())
+	}
+}
+
+func TestProcessEventVerify(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	forged := signed(t, sk, 1, odell)
+	forged.Tags = append(forged.Tags, nostr.Tag{"p", calle})
+	forged.ID = forged.GetID()
+
+	config := ProcessEventsConfig{
+		Log:      logger.New(os.Stdout),
+		Verifier: NewVerifier(NewVerifierConfig()),
+	}
+
+	// the forged event is rejected before touching the DB, RWS or eventStore
+	err := processEvent(config, nil, nil, nil, forged, &atomic.Uint32{})
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("processEvent(): expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	if !isInvalid(err) {
+		t.Errorf("isInvalid(): expected true, got false")
+	}
+}
@@ -0,0 +1,621 @@
+/*
+The csrdb package defines an in-memory snapshot of the follow graph that fulfills
+the Database interface in models, by wrapping another Database.
+
+The follows are stored in compressed sparse row (CSR) form: the follows of nodeID are
+follows[offsets[nodeID]:offsets[nodeID+1]]. This makes Follows() a couple of slice
+operations instead of a round trip to the underlying database, which dominates the
+cost of generating and updating the random walks.
+
+Everything that is not part of the follow graph (pubkeys, records, mutes, reports...)
+is delegated to the underlying database. Writes go through to the underlying database,
+and the follow-list updates are applied to an overlay on top of the CSR arrays, which is
+periodically compacted into new arrays.
+*/
+package csrdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+const (
+	// the number of nodes fetched at once when building the snapshot
+	batchSize int = 10000
+
+	// the overlay is compacted when it contains more than max(minCompaction, nodes/4) nodes.
+	minCompaction int = 1024
+)
+
+// Database is an in-memory snapshot of the follow graph of DB.
+type Database struct {
+	DB models.Database // the underlying database
+
+	mu      sync.RWMutex
+	offsets []int    // the follows of nodeID are follows[offsets[nodeID]:offsets[nodeID+1]]
+	follows []uint32 // the concatenation of the follows of all nodes, sorted by nodeID
+	present []bool   // present[nodeID] is true if nodeID is in the CSR arrays
+	nodes   int      // the number of nodes in the CSR arrays
+
+	// the follows of the nodes added or updated after the CSR arrays were built.
+	// The slices are never modified in place, so they can be safely returned.
+	overlay map[uint32][]uint32
+
+	// the number of deltas ignored by Apply() because their node was not in the snapshot.
+	// Follows() doesn't add the nodes it fetched if it changed meanwhile, as they might be stale.
+	ignored uint64
+}
+
+// NewDatabase() builds a snapshot of the follow graph of DB.
+func NewDatabase(ctx context.Context, DB models.Database) (*Database, error) {
+	if DB == nil {
+		return nil, models.ErrNilDB
+	}
+
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	snapshot := &Database{DB: DB}
+	if err := snapshot.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Validate() returns the appropriate error if the snapshot or the underlying DB are nil.
+func (DB *Database) Validate() error {
+	if DB == nil || DB.DB == nil {
+		return models.ErrNilDB
+	}
+
+	return DB.DB.Validate()
+}
+
+/*
+Refresh() rebuilds the snapshot from the underlying database, discarding the overlay.
+
+Writes that go through the snapshot while Refresh() is running might be lost from the
+snapshot (not from the underlying database), hence it should be called when no writer is active.
+*/
+func (DB *Database) Refresh(ctx context.Context) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	nodeIDs, err := DB.scanAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh the snapshot: %w", err)
+	}
+
+	adjacency := make(map[uint32][]uint32, len(nodeIDs))
+	for start := 0; start < len(nodeIDs); start += batchSize {
+		batch := nodeIDs[start:min(start+batchSize, len(nodeIDs))]
+		followsByNode, err := DB.DB.Follows(ctx, batch...)
+		if err != nil {
+			return fmt.Errorf("failed to refresh the snapshot: %w", err)
+		}
+
+		for i, ID := range batch {
+			adjacency[ID] = followsByNode[i]
+		}
+	}
+
+	offsets, follows, present := build(adjacency)
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+
+	DB.offsets, DB.follows, DB.present = offsets, follows, present
+	DB.nodes = len(adjacency)
+	DB.overlay = make(map[uint32][]uint32)
+	return nil
+}
+
+// scanAll() returns the sorted IDs of all the nodes in the underlying database.
+func (DB *Database) scanAll(ctx context.Context) ([]uint32, error) {
+	var nodeIDs []uint32
+	var cursor uint64
+
+	for {
+		IDs, newCursor, err := DB.DB.ScanNodes(ctx, cursor, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeIDs = append(nodeIDs, IDs...)
+		cursor = newCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// the scan might return the same node more than once
+	slices.Sort(nodeIDs)
+	return slices.Compact(nodeIDs), nil
+}
+
+/*
+Compact() merges the overlay into new CSR arrays. It is called automatically when
+the overlay grows too big, but it can be called to control when the cost is paid.
+*/
+func (DB *Database) Compact() {
+	if DB == nil {
+		return
+	}
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+	DB.compact()
+}
+
+func (DB *Database) compact() {
+	adjacency := make(map[uint32][]uint32, DB.nodes+len(DB.overlay))
+	for ID, present := range DB.present {
+		if present {
+			adjacency[uint32(ID)] = DB.follows[DB.offsets[ID]:DB.offsets[ID+1]]
+		}
+	}
+
+	for ID, follows := range DB.overlay {
+		adjacency[ID] = follows
+	}
+
+	DB.offsets, DB.follows, DB.present = build(adjacency)
+	DB.nodes = len(adjacency)
+	DB.overlay = make(map[uint32][]uint32)
+}
+
+// build() returns the CSR arrays of the adjacency map.
+func build(adjacency map[uint32][]uint32) (offsets []int, follows []uint32, present []bool) {
+	var maxID int = -1
+	var edges int
+	for ID, f := range adjacency {
+		maxID = max(maxID, int(ID))
+		edges += len(f)
+	}
+
+	offsets = make([]int, maxID+2)
+	follows = make([]uint32, 0, edges)
+	present = make([]bool, maxID+1)
+
+	for ID := 0; ID <= maxID; ID++ {
+		offsets[ID] = len(follows)
+		if f, exists := adjacency[uint32(ID)]; exists {
+			follows = append(follows, f...)
+			present[ID] = true
+		}
+	}
+
+	offsets[maxID+1] = len(follows)
+	return offsets, follows, present
+}
+
+// lookup() returns the follows of nodeID, and whether nodeID is in the snapshot.
+// It must be called while holding the lock.
+func (DB *Database) lookup(nodeID uint32) ([]uint32, bool) {
+	if follows, exists := DB.overlay[nodeID]; exists {
+		return follows, true
+	}
+
+	if int(nodeID) >= len(DB.present) || !DB.present[nodeID] {
+		return nil, false
+	}
+
+	start, end := DB.offsets[nodeID], DB.offsets[nodeID+1]
+	return DB.follows[start:end:end], true
+}
+
+// store() sets the follows of nodeID in the overlay, compacting it if it's too big.
+// It must be called while holding the write lock.
+func (DB *Database) store(nodeID uint32, follows []uint32) {
+	DB.overlay[nodeID] = follows
+	if len(DB.overlay) > max(minCompaction, DB.nodes/4) {
+		DB.compact()
+	}
+}
+
+/*
+Apply() applies the follow-list deltas to the snapshot, without writing them to the
+underlying database. It's meant to keep the snapshot up to date with writes that didn't
+go through it. Deltas of other kinds are ignored, because they don't change the follow graph.
+
+Deltas of nodes that are not in the snapshot are also ignored, because their follows
+are fetched from the underlying database (which already reflects the delta) on demand.
+*/
+func (DB *Database) Apply(deltas ...*models.Delta) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+
+	for _, delta := range deltas {
+		if delta == nil {
+			return models.ErrNilDelta
+		}
+
+		if delta.Kind != nostr.KindFollowList {
+			continue
+		}
+
+		current, exists := DB.lookup(delta.NodeID)
+		if !exists {
+			DB.ignored++
+			continue
+		}
+
+		DB.store(delta.NodeID, applyDelta(current, delta))
+	}
+
+	return nil
+}
+
+// applyDelta() returns a new slice with the follows after the delta.
+func applyDelta(follows []uint32, delta *models.Delta) []uint32 {
+	removed := make(map[uint32]struct{}, len(delta.Removed))
+	for _, ID := range delta.Removed {
+		removed[ID] = struct{}{}
+	}
+
+	updated := make([]uint32, 0, len(follows)+len(delta.Added))
+	contained := make(map[uint32]struct{}, len(follows)+len(delta.Added))
+	for _, ID := range follows {
+		if _, isRemoved := removed[ID]; !isRemoved {
+			updated = append(updated, ID)
+			contained[ID] = struct{}{}
+		}
+	}
+
+	for _, ID := range delta.Added {
+		if _, exists := contained[ID]; !exists {
+			updated = append(updated, ID)
+			contained[ID] = struct{}{}
+		}
+	}
+
+	return updated
+}
+
+// ContainsNode() returns whether nodeID is found in the DB. Nodes not found in
+// the snapshot are looked up in the underlying database.
+func (DB *Database) ContainsNode(ctx context.Context, nodeID uint32) bool {
+	if err := DB.Validate(); err != nil {
+		return false
+	}
+
+	DB.mu.RLock()
+	_, exists := DB.lookup(nodeID)
+	DB.mu.RUnlock()
+
+	if exists {
+		return true
+	}
+
+	_, err := DB.Follows(ctx, nodeID)
+	return err == nil
+}
+
+/*
+Follows() returns the slice of follows of each nodeID. Nodes not found in the snapshot
+(e.g. because they were added without going through it) are fetched from the underlying
+database and added to the snapshot, unless a delta of a node not in the snapshot was applied
+while fetching them, which might have made them stale. The returned slices must not be modified.
+*/
+func (DB *Database) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	var missing []int // the positions of the nodeIDs not found in the snapshot
+	followSlice := make([][]uint32, len(nodeIDs))
+
+	DB.mu.RLock()
+	ignored := DB.ignored
+	for i, ID := range nodeIDs {
+		follows, exists := DB.lookup(ID)
+		if !exists {
+			missing = append(missing, i)
+			continue
+		}
+		followSlice[i] = follows
+	}
+	DB.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return followSlice, nil
+	}
+
+	missingIDs := make([]uint32, len(missing))
+	for j, i := range missing {
+		missingIDs[j] = nodeIDs[i]
+	}
+
+	followsByNode, err := DB.DB.Follows(ctx, missingIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+
+	stale := DB.ignored != ignored
+	for j, i := range missing {
+		// a concurrent write might have added the node in the meantime, and it takes precedence
+		follows, exists := DB.lookup(nodeIDs[i])
+		if !exists {
+			follows = slices.Clip(followsByNode[j])
+			if !stale {
+				DB.store(nodeIDs[i], follows)
+			}
+		}
+		followSlice[i] = follows
+	}
+
+	return followSlice, nil
+}
+
+/*
+FollowCounts() returns the number of follows of each nodeID. If a node is not found, it returns the value 0.
+Like in Follows(), nodes not found in the snapshot are fetched from the underlying database and
+added to the snapshot. If some of them are not in the underlying database either, their counts are
+fetched from it without being added.
+*/
+func (DB *Database) FollowCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	var missing []int // the positions of the nodeIDs not found in the snapshot
+	counts := make([]int, len(nodeIDs))
+
+	DB.mu.RLock()
+	for i, ID := range nodeIDs {
+		follows, exists := DB.lookup(ID)
+		if !exists {
+			missing = append(missing, i)
+			continue
+		}
+		counts[i] = len(follows)
+	}
+	DB.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return counts, nil
+	}
+
+	missingIDs := make([]uint32, len(missing))
+	for j, i := range missing {
+		missingIDs[j] = nodeIDs[i]
+	}
+
+	missingCounts := make([]int, len(missing))
+	followSlice, err := DB.Follows(ctx, missingIDs...)
+	switch {
+	case err == nil:
+		for j, follows := range followSlice {
+			missingCounts[j] = len(follows)
+		}
+
+	case errors.Is(err, models.ErrNodeNotFoundDB):
+		if missingCounts, err = DB.DB.FollowCounts(ctx, missingIDs...); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	for j, i := range missing {
+		counts[i] = missingCounts[j]
+	}
+
+	return counts, nil
+}
+
+// AddNode() adds a node to the underlying database and to the snapshot.
+func (DB *Database) AddNode(ctx context.Context, pubkey string) (uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return math.MaxUint32, err
+	}
+
+	nodeID, err := DB.DB.AddNode(ctx, pubkey)
+	if err != nil {
+		return math.MaxUint32, err
+	}
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+
+	DB.store(nodeID, []uint32{})
+	return nodeID, nil
+}
+
+// AddNodes() adds the nodes to the underlying database and to the snapshot.
+func (DB *Database) AddNodes(ctx context.Context, pubkeys ...string) ([]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	nodeIDs, err := DB.DB.AddNodes(ctx, pubkeys...)
+	if err != nil {
+		return nil, err
+	}
+
+	DB.mu.Lock()
+	defer DB.mu.Unlock()
+
+	for _, ID := range nodeIDs {
+		DB.store(ID, []uint32{})
+	}
+
+	return nodeIDs, nil
+}
+
+// Update() applies the deltas to the underlying database and to the snapshot.
+func (DB *Database) Update(ctx context.Context, deltas ...*models.Delta) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if err := DB.DB.Update(ctx, deltas...); err != nil {
+		return err
+	}
+
+	return DB.Apply(deltas...)
+}
+
+// ----------------------------DELEGATED-TO-THE-DB------------------------------
+
+// Size() returns the number of nodes in the underlying database (ignores errors).
+func (DB *Database) Size(ctx context.Context) int {
+	if err := DB.Validate(); err != nil {
+		return 0
+	}
+	return DB.DB.Size(ctx)
+}
+
+// NodeByID() retrieves a node by its nodeID from the underlying database.
+func (DB *Database) NodeByID(ctx context.Context, nodeID uint32) (*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.NodeByID(ctx, nodeID)
+}
+
+// Nodes() retrieves the node of each nodeID from the underlying database.
+func (DB *Database) Nodes(ctx context.Context, nodeIDs ...uint32) ([]*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.Nodes(ctx, nodeIDs...)
+}
+
+// NodeByKey() retrieves a node by its pubkey from the underlying database.
+func (DB *Database) NodeByKey(ctx context.Context, pubkey string) (*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.NodeByKey(ctx, pubkey)
+}
+
+// Followers() returns the slice of followers of each nodeID, from the underlying database.
+func (DB *Database) Followers(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.Followers(ctx, nodeIDs...)
+}
+
+// FollowerCounts() returns the number of followers of each nodeID, from the underlying database.
+func (DB *Database) FollowerCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.FollowerCounts(ctx, nodeIDs...)
+}
+
+// Mutes() returns the slice of mutes of each nodeID, from the underlying database.
+func (DB *Database) Mutes(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.Mutes(ctx, nodeIDs...)
+}
+
+// MutedBy() returns the slice of nodes that muted each nodeID, from the underlying database.
+func (DB *Database) MutedBy(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.MutedBy(ctx, nodeIDs...)
+}
+
+// MutedByCounts() returns the number of muters of each nodeID, from the underlying database.
+func (DB *Database) MutedByCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.MutedByCounts(ctx, nodeIDs...)
+}
+
+// AddReports() adds the reports to the underlying database.
+func (DB *Database) AddReports(ctx context.Context, reports ...models.Report) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+	return DB.DB.AddReports(ctx, reports...)
+}
+
+// Reports() returns the reports received by each nodeID, from the underlying database.
+func (DB *Database) Reports(ctx context.Context, nodeIDs ...uint32) ([]models.ReportMap, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.Reports(ctx, nodeIDs...)
+}
+
+// SetWriteRelays() replaces the write relays of nodeID in the underlying database.
+func (DB *Database) SetWriteRelays(ctx context.Context, nodeID uint32, relays []string) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+	return DB.DB.SetWriteRelays(ctx, nodeID, relays)
+}
+
+// WriteRelays() returns the write relays of each nodeID, from the underlying database.
+func (DB *Database) WriteRelays(ctx context.Context, nodeIDs ...uint32) ([][]string, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.WriteRelays(ctx, nodeIDs...)
+}
+
+// NodeIDs() returns the nodeIDs of the pubkeys, from the underlying database.
+func (DB *Database) NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.NodeIDs(ctx, pubkeys...)
+}
+
+// Pubkeys() returns the pubkeys of the nodeIDs, from the underlying database.
+func (DB *Database) Pubkeys(ctx context.Context, nodeIDs ...uint32) ([]*string, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.Pubkeys(ctx, nodeIDs...)
+}
+
+// ScanNodes() scans over the nodes of the underlying database.
+func (DB *Database) ScanNodes(ctx context.Context, cursor uint64, limit int) ([]uint32, uint64, error) {
+	if err := DB.Validate(); err != nil {
+		return []uint32{}, 0, err
+	}
+	return DB.DB.ScanNodes(ctx, cursor, limit)
+}
+
+// AllNodes() returns the IDs of all the nodes of the underlying database.
+func (DB *Database) AllNodes(ctx context.Context) ([]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+	return DB.DB.AllNodes(ctx)
+}
@@ -0,0 +1,397 @@
+package csrdb
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/models/modelstest"
+)
+
+// setupDB() returns a snapshot of the mock database of the specified type.
+func setupDB(t testing.TB, DBType string) *Database {
+	t.Helper()
+	if DBType == "nil" {
+		return nil
+	}
+
+	DB, err := NewDatabase(context.Background(), mock.SetupDB(DBType))
+	if err != nil {
+		t.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+	return DB
+}
+
+func TestNewDatabase(t *testing.T) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		expectedError   error
+		expectedFollows [][]uint32
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:            "empty DB",
+			DBType:          "empty",
+			expectedError:   nil,
+			expectedFollows: [][]uint32{},
+		},
+		{
+			name:            "triangle",
+			DBType:          "triangle",
+			expectedError:   nil,
+			expectedFollows: [][]uint32{{1}, {2}, {0}},
+		},
+		{
+			name:            "simple",
+			DBType:          "simple",
+			expectedError:   nil,
+			expectedFollows: [][]uint32{{1}, {}, {}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var DB models.Database = mock.SetupDB(test.DBType)
+			if test.DBType == "nil" {
+				DB = nil
+			}
+
+			snapshot, err := NewDatabase(context.Background(), DB)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("NewDatabase(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if snapshot.nodes != len(test.expectedFollows) {
+				t.Fatalf("NewDatabase(): expected %d nodes, got %d", len(test.expectedFollows), snapshot.nodes)
+			}
+
+			for ID, expected := range test.expectedFollows {
+				follows, exists := snapshot.lookup(uint32(ID))
+				if !exists || !slices.Equal(follows, expected) {
+					t.Errorf("NewDatabase(): expected follows of %d %v, got %v", ID, expected, follows)
+				}
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name            string
+		deltas          []*models.Delta
+		expectedError   error
+		expectedFollows [][]uint32
+	}{
+		{
+			name:          "nil delta",
+			deltas:        []*models.Delta{nil},
+			expectedError: models.ErrNilDelta,
+		},
+		{
+			name:            "ignored kinds",
+			deltas:          []*models.Delta{{Kind: nostr.KindMuteList, NodeID: 0, Added: []uint32{2}}, {Kind: models.Promotion, NodeID: 0}},
+			expectedFollows: [][]uint32{{1}, {2}, {0}},
+		},
+		{
+			name:            "node not in the snapshot",
+			deltas:          []*models.Delta{{Kind: nostr.KindFollowList, NodeID: 69, Added: []uint32{0}}},
+			expectedFollows: [][]uint32{{1}, {2}, {0}},
+		},
+		{
+			name: "valid",
+			deltas: []*models.Delta{
+				{Kind: nostr.KindFollowList, NodeID: 0, Removed: []uint32{1}, Added: []uint32{2}},
+				{Kind: nostr.KindFollowList, NodeID: 1, Added: []uint32{0, 2}}, // 2 is already followed
+				{Kind: nostr.KindFollowList, NodeID: 0, Added: []uint32{1}},
+			},
+			expectedFollows: [][]uint32{{2, 1}, {2, 0}, {0}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := setupDB(t, "triangle")
+
+			if err := DB.Apply(test.deltas...); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Apply(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if test.expectedFollows == nil {
+				return
+			}
+
+			follows, err := DB.Follows(ctx, 0, 1, 2)
+			if err != nil {
+				t.Fatalf("Follows(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(follows, test.expectedFollows) {
+				t.Errorf("Follows(): expected %v, got %v", test.expectedFollows, follows)
+			}
+		})
+	}
+}
+
+func TestFollowsFallback(t *testing.T) {
+	ctx := context.Background()
+	mockDB := mock.SetupDB("triangle")
+	DB, err := NewDatabase(ctx, mockDB)
+	if err != nil {
+		t.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+
+	// adding a node without going through the snapshot
+	nodeID, err := mockDB.AddNode(ctx, "3")
+	if err != nil {
+		t.Fatalf("AddNode(): expected nil, got %v", err)
+	}
+
+	if err := mockDB.Update(ctx, &models.Delta{Kind: nostr.KindFollowList, NodeID: nodeID, Added: []uint32{0}}); err != nil {
+		t.Fatalf("Update(): expected nil, got %v", err)
+	}
+
+	if !DB.ContainsNode(ctx, nodeID) {
+		t.Fatalf("ContainsNode(%d): expected true, got false", nodeID)
+	}
+
+	follows, err := DB.Follows(ctx, 0, nodeID)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	expected := [][]uint32{{1}, {0}}
+	if !reflect.DeepEqual(follows, expected) {
+		t.Errorf("Follows(): expected %v, got %v", expected, follows)
+	}
+
+	if _, exists := DB.overlay[nodeID]; !exists {
+		t.Errorf("Follows(): expected node %d to be added to the snapshot", nodeID)
+	}
+
+	if _, err := DB.Follows(ctx, 0, 69); !errors.Is(err, models.ErrNodeNotFoundDB) {
+		t.Errorf("Follows(): expected %v, got %v", models.ErrNodeNotFoundDB, err)
+	}
+}
+
+// TestFollowsFallbackStale checks that the follows fetched from the underlying database
+// are not added to the snapshot if a delta of a missing node is applied while fetching them.
+func TestFollowsFallbackStale(t *testing.T) {
+	ctx := context.Background()
+	mockDB := mock.SetupDB("triangle")
+	nodeID, err := mockDB.AddNode(ctx, "3")
+	if err != nil {
+		t.Fatalf("AddNode(): expected nil, got %v", err)
+	}
+
+	DB := &Database{DB: mockDB, overlay: make(map[uint32][]uint32)}
+	DB.DB = &slowDB{Database: mockDB, beforeReturn: func() {
+		// the write lands after the old follows were read
+		delta := &models.Delta{Kind: nostr.KindFollowList, NodeID: nodeID, Added: []uint32{0}}
+		if err := mockDB.Update(ctx, delta); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+		if err := DB.Apply(delta); err != nil {
+			t.Fatalf("Apply(): expected nil, got %v", err)
+		}
+	}}
+
+	if _, err := DB.Follows(ctx, nodeID); err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	if _, exists := DB.overlay[nodeID]; exists {
+		t.Fatalf("Follows(): expected the stale follows of %d not to be added to the snapshot", nodeID)
+	}
+
+	follows, err := DB.Follows(ctx, nodeID)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	if expected := [][]uint32{{0}}; !reflect.DeepEqual(follows, expected) {
+		t.Errorf("Follows(): expected %v, got %v", expected, follows)
+	}
+}
+
+// slowDB calls beforeReturn once, after reading the follows and before returning them.
+type slowDB struct {
+	*mock.Database
+	beforeReturn func()
+}
+
+func (s *slowDB) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	follows, err := s.Database.Follows(ctx, nodeIDs...)
+	if s.beforeReturn != nil {
+		s.beforeReturn()
+		s.beforeReturn = nil
+	}
+	return follows, err
+}
+
+func TestFollowCountsFallback(t *testing.T) {
+	ctx := context.Background()
+	mockDB := mock.SetupDB("triangle")
+	DB, err := NewDatabase(ctx, mockDB)
+	if err != nil {
+		t.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+
+	// adding a node without going through the snapshot
+	nodeID, err := mockDB.AddNode(ctx, "3")
+	if err != nil {
+		t.Fatalf("AddNode(): expected nil, got %v", err)
+	}
+
+	if err := mockDB.Update(ctx, &models.Delta{Kind: nostr.KindFollowList, NodeID: nodeID, Added: []uint32{0, 1}}); err != nil {
+		t.Fatalf("Update(): expected nil, got %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		nodeIDs  []uint32
+		expected []int
+	}{
+		{name: "not in the snapshot", nodeIDs: []uint32{0, nodeID}, expected: []int{1, 2}},
+		{name: "not in the DB", nodeIDs: []uint32{0, 69}, expected: []int{1, 0}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			counts, err := DB.FollowCounts(ctx, test.nodeIDs...)
+			if err != nil {
+				t.Fatalf("FollowCounts(): expected nil, got %v", err)
+			}
+
+			if !reflect.DeepEqual(counts, test.expected) {
+				t.Errorf("FollowCounts(): expected %v, got %v", test.expected, counts)
+			}
+		})
+	}
+
+	if _, exists := DB.overlay[nodeID]; !exists {
+		t.Errorf("FollowCounts(): expected node %d to be added to the snapshot", nodeID)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42))
+	mockDB := mock.GenerateDB(2000, 10, rng)
+
+	DB, err := NewDatabase(ctx, mockDB)
+	if err != nil {
+		t.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+
+	// enough updates to trigger at least one automatic compaction
+	for i := 0; i < 3*minCompaction; i++ {
+		nodeID := uint32(rng.Intn(2000))
+		delta := &models.Delta{Kind: nostr.KindFollowList, NodeID: nodeID, Added: []uint32{uint32(rng.Intn(2000))}}
+		if err := DB.Update(ctx, delta); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+	}
+	DB.Compact()
+
+	if len(DB.overlay) != 0 {
+		t.Fatalf("Compact(): expected empty overlay, got %d nodes", len(DB.overlay))
+	}
+
+	for ID := uint32(0); ID < 2000; ID++ {
+		expected, err := mockDB.Follows(ctx, ID)
+		if err != nil {
+			t.Fatalf("Follows(%d): expected nil, got %v", ID, err)
+		}
+
+		follows, err := DB.Follows(ctx, ID)
+		if err != nil {
+			t.Fatalf("Follows(%d): expected nil, got %v", ID, err)
+		}
+
+		slices.Sort(expected[0])
+		slices.Sort(follows[0])
+		if !slices.Equal(follows[0], expected[0]) {
+			t.Fatalf("Follows(%d): expected %v, got %v", ID, expected[0], follows[0])
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(69))
+	DB, err := NewDatabase(ctx, mock.GenerateDB(200, 5, rng))
+	if err != nil {
+		t.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+
+	deltas := make([]*models.Delta, 2*minCompaction)
+	for i := range deltas {
+		deltas[i] = &models.Delta{Kind: nostr.KindFollowList, NodeID: uint32(rng.Intn(200)), Added: []uint32{uint32(rng.Intn(200))}}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		for _, delta := range deltas {
+			if err := DB.Apply(delta); err != nil {
+				t.Errorf("Apply(): expected nil, got %v", err)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if _, err := DB.Follows(ctx, uint32(j%200)); err != nil {
+					t.Errorf("Follows(): expected nil, got %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConformance(t *testing.T) {
+	modelstest.TestDatabase(t, func(t testing.TB, DBType string) models.Database {
+		return setupDB(t, DBType)
+	})
+}
+
+func TestInterface(t *testing.T) {
+	var _ models.Database = &Database{}
+}
+
+func BenchmarkFollows(b *testing.B) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(69))
+	DB, err := NewDatabase(ctx, mock.GenerateDB(10000, 100, rng))
+	if err != nil {
+		b.Fatalf("NewDatabase(): expected nil, got %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DB.Follows(ctx, uint32(i%10000)); err != nil {
+			b.Fatalf("Follows(): expected nil, got %v", err)
+		}
+	}
+}
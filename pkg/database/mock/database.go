@@ -30,6 +30,16 @@ type Database struct {
 	Follow   map[uint32]NodeSet
 	Follower map[uint32]NodeSet
 
+	// maps that associate each nodeID with the slice of its mutes
+	Mute  map[uint32]NodeSet
+	Muter map[uint32]NodeSet
+
+	// a map that associates each nodeID with its reporters, grouped by report type
+	Reported map[uint32]map[string]NodeSet
+
+	// a map that associates each nodeID with its write relays
+	Relays map[uint32][]string
+
 	// the next nodeID to be used. When a new node is added, this fiels is incremented by one
 	LastNodeID int
 }
@@ -41,6 +51,10 @@ func NewDatabase() *Database {
 		NodeIndex:  make(map[uint32]*models.Node),
 		Follow:     make(map[uint32]NodeSet),
 		Follower:   make(map[uint32]NodeSet),
+		Mute:       make(map[uint32]NodeSet),
+		Muter:      make(map[uint32]NodeSet),
+		Reported:   make(map[uint32]map[string]NodeSet),
+		Relays:     make(map[uint32][]string),
 		LastNodeID: -1, // the first nodeID will be 0
 	}
 }
@@ -86,35 +100,74 @@ func (DB *Database) AddNode(ctx context.Context, pubkey string) (uint32, error)
 	return nodeID, nil
 }
 
-// Update() applies the delta to nodeID.
-func (DB *Database) Update(ctx context.Context, delta *models.Delta) error {
+// AddNodes() adds the nodes to the database and returns their assigned nodeIDs.
+func (DB *Database) AddNodes(ctx context.Context, pubkeys ...string) ([]uint32, error) {
+	if DB == nil {
+		return nil, models.ErrNilDB
+	}
+
+	if len(pubkeys) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{}, len(pubkeys))
+	for _, pk := range pubkeys {
+		_, exist := DB.KeyIndex[pk]
+		_, repeated := seen[pk]
+		if exist || repeated {
+			return nil, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pk)
+		}
+		seen[pk] = struct{}{}
+	}
+
+	nodeIDs := make([]uint32, len(pubkeys))
+	for i, pk := range pubkeys {
+		nodeID, err := DB.AddNode(ctx, pk)
+		if err != nil {
+			return nil, err
+		}
+		nodeIDs[i] = nodeID
+	}
+
+	return nodeIDs, nil
+}
+
+// Update() applies the deltas in order. If any node is not found, no delta is applied.
+func (DB *Database) Update(ctx context.Context, deltas ...*models.Delta) error {
 	_ = ctx
 	var err error
 	if err = DB.Validate(); err != nil {
 		return err
 	}
 
-	if delta == nil {
-		return models.ErrNilDelta
-	}
+	for _, delta := range deltas {
+		if delta == nil {
+			return models.ErrNilDelta
+		}
 
-	if _, exist := DB.NodeIndex[delta.NodeID]; !exist {
-		return models.ErrNodeNotFoundDB
+		if _, exist := DB.NodeIndex[delta.NodeID]; !exist {
+			return models.ErrNodeNotFoundDB
+		}
 	}
 
-	switch delta.Kind {
-	case models.Promotion:
-		err = DB.promote(ctx, delta.NodeID)
+	for _, delta := range deltas {
+		switch delta.Kind {
+		case models.Promotion:
+			err = DB.promote(ctx, delta.NodeID)
 
-	case models.Demotion:
-		err = DB.demote(ctx, delta.NodeID)
+		case models.Demotion:
+			err = DB.demote(ctx, delta.NodeID)
 
-	case nostr.KindFollowList:
-		err = DB.updateFollows(ctx, delta)
-	}
+		case nostr.KindFollowList:
+			err = DB.updateFollows(ctx, delta)
+
+		case nostr.KindMuteList:
+			err = DB.updateMutes(ctx, delta)
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to update with delta %v: %w", delta, err)
+		if err != nil {
+			return fmt.Errorf("failed to update with delta %v: %w", delta, err)
+		}
 	}
 
 	return nil
@@ -166,6 +219,34 @@ func (DB *Database) updateFollows(ctx context.Context, delta *models.Delta) erro
 	return nil
 }
 
+// updateMutes adds and removed mute relationships.
+func (DB *Database) updateMutes(ctx context.Context, delta *models.Delta) error {
+	_ = ctx
+	// add all added to the mutes of nodeID
+	if _, exists := DB.Mute[delta.NodeID]; !exists {
+		DB.Mute[delta.NodeID] = mapset.NewSet[uint32]()
+	}
+	DB.Mute[delta.NodeID].Append(delta.Added...)
+	DB.Mute[delta.NodeID].RemoveAll(delta.Removed...)
+
+	// add nodeID to the muters of added
+	for _, ID := range delta.Added {
+		if _, exists := DB.Muter[ID]; !exists {
+			DB.Muter[ID] = mapset.NewSet[uint32]()
+		}
+		DB.Muter[ID].Add(delta.NodeID)
+	}
+
+	// remove nodeID from the muters of removed
+	for _, ID := range delta.Removed {
+		if _, exists := DB.Muter[ID]; exists {
+			DB.Muter[ID].Remove(delta.NodeID)
+		}
+	}
+
+	return nil
+}
+
 // ContainsNode() returns whether nodeID is found in the DB
 func (DB *Database) ContainsNode(ctx context.Context, nodeID uint32) bool {
 	_ = ctx
@@ -207,6 +288,21 @@ func (DB *Database) NodeByID(ctx context.Context, nodeID uint32) (*models.Node,
 	return node, nil
 }
 
+// Nodes() returns the node of each nodeID. If a nodeID is not found, nil is returned.
+func (DB *Database) Nodes(ctx context.Context, nodeIDs ...uint32) ([]*models.Node, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*models.Node, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		nodes[i] = DB.NodeIndex[ID]
+	}
+
+	return nodes, nil
+}
+
 // Follows() returns the slice of follows of each nodeID
 func (DB *Database) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
 	_ = ctx
@@ -303,6 +399,150 @@ func (DB *Database) FollowCounts(ctx context.Context, nodeIDs ...uint32) ([]int,
 	return counts, nil
 }
 
+// Mutes() returns the slice of mutes of each nodeID
+func (DB *Database) Mutes(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(DB.Mute, nodeIDs...)
+}
+
+// MutedBy() returns the slice of nodes that muted each nodeID
+func (DB *Database) MutedBy(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(DB.Muter, nodeIDs...)
+}
+
+func (DB *Database) MutedByCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	counts := make([]int, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if mutedBy, exists := DB.Muter[ID]; exists {
+			counts[i] = mutedBy.Cardinality()
+		}
+	}
+
+	return counts, nil
+}
+
+// members() returns the members of the sets of each nodeID. Because these sets
+// are created lazily, a missing set means empty, as long as the node exists.
+func (DB *Database) members(sets map[uint32]NodeSet, nodeIDs ...uint32) ([][]uint32, error) {
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	members := make([][]uint32, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if _, exists := DB.NodeIndex[ID]; !exists {
+			return nil, models.ErrNodeNotFoundDB
+		}
+
+		members[i] = []uint32{}
+		if set, exists := sets[ID]; exists {
+			members[i] = set.ToSlice()
+		}
+	}
+
+	return members, nil
+}
+
+// AddReports() adds the reporters to the reports of the reported nodes.
+func (DB *Database) AddReports(ctx context.Context, reports ...models.Report) error {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if _, exists := DB.Reported[report.Reported]; !exists {
+			DB.Reported[report.Reported] = make(map[string]NodeSet)
+		}
+
+		if _, exists := DB.Reported[report.Reported][report.Type]; !exists {
+			DB.Reported[report.Reported][report.Type] = mapset.NewSet[uint32]()
+		}
+
+		DB.Reported[report.Reported][report.Type].Add(report.Reporter)
+	}
+
+	return nil
+}
+
+// Reports() returns the reports received by each nodeID, grouped by type.
+// If a node is not found or has no reports, an empty map is returned.
+func (DB *Database) Reports(ctx context.Context, nodeIDs ...uint32) ([]models.ReportMap, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	reports := make([]models.ReportMap, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		reports[i] = make(models.ReportMap)
+		for reportType, reporters := range DB.Reported[ID] {
+			reports[i][reportType] = reporters.ToSlice()
+		}
+	}
+
+	return reports, nil
+}
+
+// SetWriteRelays() replaces the write relays of nodeID.
+func (DB *Database) SetWriteRelays(ctx context.Context, nodeID uint32, relays []string) error {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if _, exist := DB.NodeIndex[nodeID]; !exist {
+		return models.ErrNodeNotFoundDB
+	}
+
+	DB.Relays[nodeID] = slices.Clone(relays)
+	return nil
+}
+
+// WriteRelays() returns the write relays of each nodeID. If a node is not found, an empty slice is returned.
+func (DB *Database) WriteRelays(ctx context.Context, nodeIDs ...uint32) ([][]string, error) {
+	_ = ctx
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	relays := make([][]string, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		relays[i] = []string{}
+		if rels, exists := DB.Relays[ID]; exists {
+			relays[i] = slices.Clone(rels)
+		}
+	}
+
+	return relays, nil
+}
+
 // Pubkeys() returns a slice of pubkeys that correspond with the given slice of nodeIDs.
 // If a pubkey is not found, nil is returned.
 func (DB *Database) Pubkeys(ctx context.Context, nodeIDs ...uint32) ([]*string, error) {
@@ -355,13 +595,17 @@ func (DB *Database) NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32,
 	return nodeIDs, nil
 }
 
-// All returns a slice with the IDs of all the nodes
+// AllNodes() returns a slice with the IDs of all the nodes. If the DB is empty, it returns ErrEmptyDB.
 func (DB *Database) AllNodes(ctx context.Context) ([]uint32, error) {
 	_ = ctx
 	if err := DB.Validate(); err != nil {
 		return nil, err
 	}
 
+	if len(DB.NodeIndex) == 0 {
+		return nil, fmt.Errorf("AllNodes(): %w", models.ErrEmptyDB)
+	}
+
 	nodeIDs := make([]uint32, 0, len(DB.NodeIndex))
 	for nodeID := range DB.NodeIndex {
 		nodeIDs = append(nodeIDs, nodeID)
@@ -383,10 +627,17 @@ func (DB *Database) Size(ctx context.Context) int {
 func (DB *Database) ScanNodes(ctx context.Context, cursor uint64, limit int) ([]uint32, uint64, error) {
 	_ = ctx
 	_ = limit
+	if err := DB.Validate(); err != nil {
+		return []uint32{}, 0, err
+	}
 
 	// Cursor simulation: returning 0 as the cursor for simplicity
-	nodeIDs, err := DB.AllNodes(ctx)
-	return nodeIDs, 0, err
+	nodeIDs := make([]uint32, 0, len(DB.NodeIndex))
+	for nodeID := range DB.NodeIndex {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	return nodeIDs, 0, nil
 }
 
 // ------------------------------------HELPERS----------------------------------
@@ -473,6 +724,10 @@ func SetupDB(DBType string) *Database {
 		DB.Follower[0] = mapset.NewSet[uint32]()
 		DB.Follower[1] = mapset.NewSet[uint32](0)
 		DB.Follower[2] = mapset.NewSet[uint32]()
+
+		DB.Mute[2] = mapset.NewSet[uint32](0)
+		DB.Muter[0] = mapset.NewSet[uint32](2)
+		DB.Reported[0] = map[string]NodeSet{"spam": mapset.NewSet[uint32](2)}
 		return DB
 
 	case "simple-with-pks":
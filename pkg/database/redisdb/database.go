@@ -8,6 +8,7 @@ import (
 	"math"
 	"math/rand"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -25,6 +26,10 @@ const (
 	KeyNodePrefix      string = "node:"
 	KeyFollowsPrefix   string = "follows:"
 	KeyFollowersPrefix string = "followers:"
+	KeyMutesPrefix     string = "mutes:"
+	KeyMutedByPrefix   string = "mutedBy:"
+	KeyReportsPrefix   string = "reports:"
+	KeyRelaysPrefix    string = "writeRelays:"
 
 	// redis node HASH fields
 	NodeID          string = "id"
@@ -150,6 +155,43 @@ func (DB *Database) NodeByID(ctx context.Context, nodeID uint32) (*models.Node,
 	return ParseNode(nodeMap)
 }
 
+// Nodes() retrieves the node of each nodeID in a single pipeline. If a nodeID is not found, nil is returned.
+func (DB *Database) Nodes(ctx context.Context, nodeIDs ...uint32) ([]*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := DB.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		cmds[i] = pipe.HGetAll(ctx, KeyNode(nodeID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to fetch %d nodes: %w", len(nodeIDs), err)
+	}
+
+	nodes := make([]*models.Node, len(nodeIDs))
+	for i, cmd := range cmds {
+		// add nil where the key was not found
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+
+		node, err := ParseNode(cmd.Val())
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+
+	return nodes, nil
+}
+
 // NodeByKey() retrieves a node by its pubkey.
 func (DB *Database) NodeByKey(ctx context.Context, pubkey string) (*models.Node, error) {
 
@@ -199,65 +241,182 @@ func (DB *Database) AddNode(ctx context.Context, pubkey string) (uint32, error)
 
 	// add pubkey to the KeyIndex, and node
 	pipe := DB.client.TxPipeline()
-	pipe.HSetNX(ctx, KeyKeyIndex, pubkey, nodeID)
+	added := pipe.HSetNX(ctx, KeyKeyIndex, pubkey, nodeID)
 	pipe.HSet(ctx, KeyNode(nodeID), NodeID, nodeID, NodePubkey, pubkey, NodeStatus, models.StatusInactive, NodeAddedTS, time.Now().Unix())
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return math.MaxUint32, fmt.Errorf("failed to add %v: %w", pubkey, err)
 	}
 
+	if !added.Val() {
+		// the pubkey was added concurrently after the check, so this node is discarded
+		if err := DB.client.Del(ctx, KeyNode(nodeID)).Err(); err != nil {
+			return math.MaxUint32, fmt.Errorf("failed to discard the duplicate of %v: %w", pubkey, err)
+		}
+		return math.MaxUint32, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pubkey)
+	}
+
 	return uint32(nodeID), nil
 }
 
-// UpdateNode() updates the nodeID using the new values inside the nodeDiff.
-func (DB *Database) Update(ctx context.Context, delta *models.Delta) error {
+/*
+addNodesScript adds the nodes atomically, unless any of their pubkeys is already in the key index.
+
+KEYS = [key index, node keys...]
+ARGV = [status, added timestamp, pubkeys..., nodeIDs...]
+
+Returns 0 if the nodes were added, otherwise the position (starting from 1) of the first pubkey already in the key index.
+*/
+var addNodesScript = redis.NewScript(fmt.Sprintf(`
+local n = #KEYS - 1
+for i = 1, n do
+	if redis.call('HEXISTS', KEYS[1], ARGV[2 + i]) == 1 then
+		return i
+	end
+end
+for i = 1, n do
+	local pubkey, nodeID = ARGV[2 + i], ARGV[2 + n + i]
+	redis.call('HSET', KEYS[1], pubkey, nodeID)
+	redis.call('HSET', KEYS[1 + i], %q, nodeID, %q, pubkey, %q, ARGV[1], %q, ARGV[2])
+end
+return 0
+`, NodeID, NodePubkey, NodeStatus, NodeAddedTS))
+
+// AddNodes() adds the nodes to the database atomically and returns their assigned nodeIDs.
+// If any of the pubkeys is already in the database (or repeated), including when it's added
+// concurrently, no node is added.
+func (DB *Database) AddNodes(ctx context.Context, pubkeys ...string) ([]uint32, error) {
 	if err := DB.Validate(); err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(pubkeys) == 0 {
+		return nil, nil
 	}
 
-	if delta == nil {
-		return models.ErrNilDelta
+	seen := make(map[string]struct{}, len(pubkeys))
+	for _, pk := range pubkeys {
+		if _, repeated := seen[pk]; repeated {
+			return nil, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pk)
+		}
+		seen[pk] = struct{}{}
 	}
 
-	// check if nodeID exists
-	exists, err := DB.client.Exists(ctx, KeyNode(delta.NodeID)).Result()
+	// check if any pubkey already exists in the DB, to avoid reserving the nodeIDs in vain
+	IDs, err := DB.client.HMGet(ctx, KeyKeyIndex, pubkeys...).Result()
 	if err != nil {
-		return fmt.Errorf("failed to check for the existance of nodeID %d: %w", delta.NodeID, err)
+		return nil, fmt.Errorf("failed to check for existance of the pubkeys: %w", err)
 	}
-	if exists <= 0 {
-		return fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, delta.NodeID)
+
+	for i, ID := range IDs {
+		if ID != nil {
+			return nil, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pubkeys[i])
+		}
 	}
 
-	switch delta.Kind {
-	case models.Promotion:
-		err = DB.promote(ctx, delta.NodeID)
+	// reserve the nodeIDs outside the script, as in AddNode()
+	lastID, err := DB.client.HIncrBy(ctx, KeyDatabase, KeyLastNodeID, int64(len(pubkeys))).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	firstID := lastID - int64(len(pubkeys)) + 1
+	nodeIDs := make([]uint32, len(pubkeys))
+	keys := make([]string, 0, len(pubkeys)+1)
+	args := make([]any, 0, 2*len(pubkeys)+2)
 
-	case models.Demotion:
-		err = DB.demote(ctx, delta.NodeID)
+	keys = append(keys, KeyKeyIndex)
+	args = append(args, models.StatusInactive, time.Now().Unix())
+	for i, pk := range pubkeys {
+		nodeIDs[i] = uint32(firstID + int64(i))
+		keys = append(keys, KeyNode(nodeIDs[i]))
+		args = append(args, pk)
+	}
 
-	case nostr.KindFollowList:
-		err = DB.updateFollows(ctx, delta)
+	for _, ID := range nodeIDs {
+		args = append(args, ID)
 	}
 
+	existing, err := addNodesScript.Run(ctx, DB.client, keys, args...).Int()
 	if err != nil {
-		return fmt.Errorf("failed to update with delta %v: %w", delta, err)
+		return nil, fmt.Errorf("failed to add %d nodes: %w", len(pubkeys), err)
+	}
+
+	if existing > 0 {
+		// a pubkey was added concurrently after the check
+		return nil, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pubkeys[existing-1])
+	}
+
+	return nodeIDs, nil
+}
+
+/*
+Update() applies the deltas in a single transaction. The existence of all the nodes
+is checked in a pipeline beforehand, and if any of them is not found no delta is applied.
+*/
+func (DB *Database) Update(ctx context.Context, deltas ...*models.Delta) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	// check if the nodeIDs exist
+	pipe := DB.client.Pipeline()
+	exists := make([]*redis.IntCmd, len(deltas))
+	for i, delta := range deltas {
+		if delta == nil {
+			return models.ErrNilDelta
+		}
+		exists[i] = pipe.Exists(ctx, KeyNode(delta.NodeID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to check for the existance of %d nodes: %w", len(deltas), err)
+	}
+
+	for i, cmd := range exists {
+		if cmd.Val() <= 0 {
+			return fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, deltas[i].NodeID)
+		}
+	}
+
+	tx := DB.client.TxPipeline()
+	for _, delta := range deltas {
+		switch delta.Kind {
+		case models.Promotion:
+			promote(ctx, tx, delta.NodeID)
+
+		case models.Demotion:
+			demote(ctx, tx, delta.NodeID)
+
+		case nostr.KindFollowList:
+			updateFollows(ctx, tx, delta)
+
+		case nostr.KindMuteList:
+			updateMutes(ctx, tx, delta)
+		}
+	}
+
+	if _, err := tx.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update with %d deltas: %w", len(deltas), err)
 	}
 
 	return nil
 }
 
-func (DB *Database) promote(ctx context.Context, nodeID uint32) error {
-	return DB.client.HSet(ctx, KeyNode(nodeID), NodeStatus, models.StatusActive, NodePromotionTS, time.Now().Unix()).Err()
+func promote(ctx context.Context, pipe redis.Pipeliner, nodeID uint32) {
+	pipe.HSet(ctx, KeyNode(nodeID), NodeStatus, models.StatusActive, NodePromotionTS, time.Now().Unix())
 }
 
-func (DB *Database) demote(ctx context.Context, nodeID uint32) error {
-	return DB.client.HSet(ctx, KeyNode(nodeID), NodeStatus, models.StatusInactive, NodeDemotionTS, time.Now().Unix()).Err()
+func demote(ctx context.Context, pipe redis.Pipeliner, nodeID uint32) {
+	pipe.HSet(ctx, KeyNode(nodeID), NodeStatus, models.StatusInactive, NodeDemotionTS, time.Now().Unix())
 }
 
 // updateFollows adds and removed follow relationships
-func (DB *Database) updateFollows(ctx context.Context, delta *models.Delta) error {
-	pipe := DB.client.TxPipeline()
-
+func updateFollows(ctx context.Context, pipe redis.Pipeliner, delta *models.Delta) {
 	if len(delta.Added) > 0 {
 		// add all to the follows of nodeID
 		pipe.SAdd(ctx, KeyFollows(delta.NodeID), redisutils.FormatIDs(delta.Added))
@@ -277,9 +436,29 @@ func (DB *Database) updateFollows(ctx context.Context, delta *models.Delta) erro
 			pipe.SRem(ctx, KeyFollowers(ID), delta.NodeID)
 		}
 	}
+}
 
-	_, err := pipe.Exec(ctx)
-	return err
+// updateMutes adds and removed mute relationships
+func updateMutes(ctx context.Context, pipe redis.Pipeliner, delta *models.Delta) {
+	if len(delta.Added) > 0 {
+		// add all to the mutes of nodeID
+		pipe.SAdd(ctx, KeyMutes(delta.NodeID), redisutils.FormatIDs(delta.Added))
+
+		// add nodeID to the mutedBy of all
+		for _, ID := range delta.Added {
+			pipe.SAdd(ctx, KeyMutedBy(ID), delta.NodeID)
+		}
+	}
+
+	if len(delta.Removed) > 0 {
+		// remove all from the mutes of nodeID
+		pipe.SRem(ctx, KeyMutes(delta.NodeID), redisutils.FormatIDs(delta.Removed))
+
+		// remove nodeID from the mutedBy of all
+		for _, ID := range delta.Removed {
+			pipe.SRem(ctx, KeyMutedBy(ID), delta.NodeID)
+		}
+	}
 }
 
 // ContainsNode() returns wheter the DB contains nodeID. In case of errors returns false.
@@ -314,6 +493,24 @@ func (DB *Database) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32,
 	return pipelineSMembers(ctx, DB, KeyFollows, nodeIDs...)
 }
 
+// Mutes() returns a slice containing the mutes of each of the specified nodeIDs.
+func (DB *Database) Mutes(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return pipelineSMembers(ctx, DB, KeyMutes, nodeIDs...)
+}
+
+// MutedBy() returns a slice containing the nodes that muted each of the specified nodeIDs.
+func (DB *Database) MutedBy(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return pipelineSMembers(ctx, DB, KeyMutedBy, nodeIDs...)
+}
+
 // The method pipelineSMembers() fetches the SMembers of the specified keys, which are:
 // KeyFunc(nodeID). If some commands return empty arrays, it checks the existence
 // of KeyNode(nodeID) and returns an error if a node was not found.
@@ -383,6 +580,14 @@ func (DB *Database) FollowCounts(ctx context.Context, nodeIDs ...uint32) ([]int,
 	return pipelineSCard(ctx, DB, KeyFollows, nodeIDs...)
 }
 
+func (DB *Database) MutedByCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return pipelineSCard(ctx, DB, KeyMutedBy, nodeIDs...)
+}
+
 func pipelineSCard(
 	ctx context.Context,
 	DB *Database,
@@ -411,6 +616,121 @@ func pipelineSCard(
 	return counts, nil
 }
 
+// AddReports() adds each report to the set of reports of the reported node.
+// The members of the set are formatted as "<type>:<reporterID>".
+func (DB *Database) AddReports(ctx context.Context, reports ...models.Report) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	pipe := DB.client.TxPipeline()
+	for _, report := range reports {
+		pipe.SAdd(ctx, KeyReports(report.Reported), FormatReport(report))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add the reports: %w", err)
+	}
+
+	return nil
+}
+
+// Reports() returns the reports received by each nodeID, grouped by type.
+// If a node is not found or has no reports, an empty map is returned.
+func (DB *Database) Reports(ctx context.Context, nodeIDs ...uint32) ([]models.ReportMap, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := DB.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		cmds[i] = pipe.SMembers(ctx, KeyReports(ID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	reports := make([]models.ReportMap, len(nodeIDs))
+	for i, cmd := range cmds {
+		reports[i] = make(models.ReportMap)
+		for _, member := range cmd.Val() {
+			reportType, reporter, err := ParseReport(member)
+			if err != nil {
+				return nil, err
+			}
+
+			reports[i][reportType] = append(reports[i][reportType], reporter)
+		}
+	}
+
+	return reports, nil
+}
+
+// SetWriteRelays() replaces the write relays of nodeID, preserving their order.
+func (DB *Database) SetWriteRelays(ctx context.Context, nodeID uint32, relays []string) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	exists, err := DB.client.Exists(ctx, KeyNode(nodeID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check for the existance of nodeID %d: %w", nodeID, err)
+	}
+	if exists <= 0 {
+		return fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, nodeID)
+	}
+
+	pipe := DB.client.TxPipeline()
+	pipe.Del(ctx, KeyRelays(nodeID))
+	if len(relays) > 0 {
+		pipe.RPush(ctx, KeyRelays(nodeID), relays)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set the write relays of %d: %w", nodeID, err)
+	}
+
+	return nil
+}
+
+// WriteRelays() returns the write relays of each nodeID. If a node is not found, an empty slice is returned.
+func (DB *Database) WriteRelays(ctx context.Context, nodeIDs ...uint32) ([][]string, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := DB.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		cmds[i] = pipe.LRange(ctx, KeyRelays(ID), 0, -1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	relays := make([][]string, len(nodeIDs))
+	for i, cmd := range cmds {
+		relays[i] = cmd.Val()
+	}
+
+	return relays, nil
+}
+
 // NodeIDs() returns a slice of nodeIDs that correspond with the given slice of pubkeys.
 // If a pubkey is not found, nil is returned
 func (DB *Database) NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32, error) {
@@ -645,6 +965,20 @@ func SetupDB(cl *redis.Client, DBType string) (*Database, error) {
 			return nil, err
 		}
 
+		// adding 2 --mutes--> 0
+		if err := DB.client.SAdd(ctx, KeyMutes(2), 0).Err(); err != nil {
+			return nil, err
+		}
+
+		if err := DB.client.SAdd(ctx, KeyMutedBy(0), 2).Err(); err != nil {
+			return nil, err
+		}
+
+		// adding 2 --reports (spam)--> 0
+		if err := DB.client.SAdd(ctx, KeyReports(0), "spam:2").Err(); err != nil {
+			return nil, err
+		}
+
 		return DB, nil
 
 	default:
@@ -712,6 +1046,49 @@ func KeyFollowers[ID uint32 | int64 | int](nodeID ID) string {
 	return fmt.Sprintf("%v%d", KeyFollowersPrefix, nodeID)
 }
 
+// KeyMutes() returns the Redis key for the mutes of the specified nodeID
+func KeyMutes[ID uint32 | int64 | int](nodeID ID) string {
+	return fmt.Sprintf("%v%d", KeyMutesPrefix, nodeID)
+}
+
+// KeyMutedBy() returns the Redis key for the nodes that muted the specified nodeID
+func KeyMutedBy[ID uint32 | int64 | int](nodeID ID) string {
+	return fmt.Sprintf("%v%d", KeyMutedByPrefix, nodeID)
+}
+
+// KeyReports() returns the Redis key for the reports received by the specified nodeID
+func KeyReports[ID uint32 | int64 | int](nodeID ID) string {
+	return fmt.Sprintf("%v%d", KeyReportsPrefix, nodeID)
+}
+
+// KeyRelays() returns the Redis key for the write relays of the specified nodeID
+func KeyRelays[ID uint32 | int64 | int](nodeID ID) string {
+	return fmt.Sprintf("%v%d", KeyRelaysPrefix, nodeID)
+}
+
+// FormatReport() formats the report into the member of the reports set, "<type>:<reporterID>".
+func FormatReport(report models.Report) string {
+	return report.Type + ":" + redisutils.FormatID(report.Reporter)
+}
+
+// ParseReport() parses the member of the reports set into the report type and reporterID.
+func ParseReport(member string) (string, uint32, error) {
+	i := strings.LastIndex(member, ":")
+	if i == -1 {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidReport, member)
+	}
+
+	reporter, err := redisutils.ParseID(member[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidReport, member)
+	}
+
+	return member[:i], reporter, nil
+}
+
 //---------------------------------ERROR-CODES---------------------------------
 
-var ErrNilClient = errors.New("nil redis client pointer")
+var (
+	ErrNilClient     = errors.New("nil redis client pointer")
+	ErrInvalidReport = errors.New("invalid report")
+)
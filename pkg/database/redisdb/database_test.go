@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -12,6 +11,7 @@ import (
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/models/modelstest"
 	"github.com/vertex-lab/crawler/pkg/utils/redisutils"
 )
 
@@ -72,338 +72,128 @@ func TestParseNode(t *testing.T) {
 	}
 }
 
-func TestValidate(t *testing.T) {
+func TestValidateNilClient(t *testing.T) {
 	cl := redisutils.SetupTestClient()
 	defer redisutils.CleanupRedis(cl)
 
-	testCases := []struct {
-		name          string
-		DBType        string
-		expectedError error
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "nil client",
-			DBType:        "nil-client",
-			expectedError: ErrNilClient,
-		},
-		{
-			name:          "DB with node 0",
-			DBType:        "one-node0",
-			expectedError: nil,
-		},
+	DB, err := SetupDB(cl, "nil-client")
+	if err != nil {
+		t.Fatalf("SetupDB(): expected nil, got %v", err)
 	}
 
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			err = DB.Validate()
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Validate(): expected %v, got %v", test.expectedError, err)
-			}
-		})
+	if err := DB.Validate(); !errors.Is(err, ErrNilClient) {
+		t.Fatalf("Validate(): expected %v, got %v", ErrNilClient, err)
 	}
 }
 
-func TestNodeByID(t *testing.T) {
-	testCases := []struct {
-		name          string
-		DBType        string
-		nodeID        uint32
-		expectedError error
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			nodeID:        0,
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "empty DB",
-			DBType:        "empty",
-			nodeID:        0,
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:          "pubkey not found",
-			DBType:        "one-node0",
-			nodeID:        1,
-			expectedError: models.ErrNodeNotFoundDB,
-		},
+// TestAddNode checks the keys of the Redis layout, while the behaviour is covered by TestConformance.
+func TestAddNode(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	pubkey := "1"
+	expectedNode := &models.Node{
+		ID:      1,
+		Pubkey:  pubkey,
+		Status:  models.StatusInactive,
+		Records: []models.Record{{Kind: models.Added, Timestamp: time.Unix(time.Now().Unix(), 0)}},
 	}
 
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			ctx := context.Background()
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
+	DB, err := SetupDB(cl, "one-node0")
+	if err != nil {
+		t.Fatalf("SetupDB(): expected nil, got %v", err)
+	}
 
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
+	nodeID, err := DB.AddNode(ctx, pubkey)
+	if err != nil {
+		t.Fatalf("AddNode(%s): expected nil, got %v", pubkey, err)
+	}
 
-			if _, err := DB.NodeByID(ctx, test.nodeID); !errors.Is(err, test.expectedError) {
-				t.Fatalf("NodeByID(%v): expected %v, got %v", test.nodeID, test.expectedError, err)
-			}
-		})
+	// check if nodeID has been assigned correctly
+	if nodeID != expectedNode.ID {
+		t.Errorf("AddNode(%s): expected nodeID = %v, got %v", pubkey, expectedNode.ID, nodeID)
 	}
-}
 
-func TestNodeByKey(t *testing.T) {
-	testCases := []struct {
-		name          string
-		DBType        string
-		pubkey        string
-		expectedError error
-		expectedNode  *models.Node
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			pubkey:        "zero",
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "empty DB",
-			DBType:        "empty",
-			pubkey:        "zero",
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:          "pubkey not found",
-			DBType:        "one-node0",
-			pubkey:        "one",
-			expectedError: models.ErrNodeNotFoundDB,
-		},
+	// check if database HASH was updated correctly
+	cmdReturnDB := cl.HMGet(ctx, KeyDatabase, KeyLastNodeID)
+	if cmdReturnDB.Err() != nil {
+		t.Errorf("HMGet(): expected nil, got %v", err)
+	}
+	var fields DatabaseFields
+	if err := cmdReturnDB.Scan(&fields); err != nil {
+		t.Errorf("Scan(): expected nil, got %v", err)
+	}
+	if fields.LastNodeID != int(expectedNode.ID) {
+		t.Errorf("AddNode(%v): expected LastNodeID = %v, got %v", pubkey, expectedNode.ID, fields.LastNodeID)
 	}
 
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			ctx := context.Background()
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
+	// check if the node was added to the keyIndex correctly
+	strNodeID, err := cl.HGet(ctx, KeyKeyIndex, pubkey).Result()
+	if err != nil {
+		t.Errorf("HGet(): expected nil, got %v", err)
+	}
+	LoadedNodeID, err := redisutils.ParseID(strNodeID)
+	if err != nil {
+		t.Errorf("ParseID(%v): expected nil, got %v", strNodeID, err)
+	}
+	if LoadedNodeID != expectedNode.ID {
+		t.Errorf("AddNode(%s): expected nodeID = %v, got %v", pubkey, expectedNode.ID, nodeID)
+	}
 
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
+	node, err := DB.NodeByKey(ctx, pubkey)
+	if err != nil {
+		t.Fatalf("NodeByKey(%s): expected nil, got %v", pubkey, err)
+	}
 
-			if _, err := DB.NodeByKey(ctx, test.pubkey); !errors.Is(err, test.expectedError) {
-				t.Fatalf("NodeByKey(%v): expected %v, got %v", test.pubkey, test.expectedError, err)
-			}
-		})
+	if !reflect.DeepEqual(node, expectedNode) {
+		t.Errorf("AddNode(): expected node %v \n got %v", expectedNode, node)
 	}
 }
 
-func TestAddNode(t *testing.T) {
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name           string
-			DBType         string
-			pubkey         string
-			expectedNodeID uint32
-			expectedError  error
-		}{
-			{
-				name:           "nil DB",
-				DBType:         "nil",
-				pubkey:         "0",
-				expectedNodeID: math.MaxUint32,
-				expectedError:  models.ErrNilDB,
-			},
-			{
-				name:           "node already in the DB",
-				DBType:         "one-node0",
-				pubkey:         "0",
-				expectedNodeID: math.MaxUint32,
-				expectedError:  models.ErrNodeAlreadyInDB,
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				cl := redisutils.SetupTestClient()
-				defer redisutils.CleanupRedis(cl)
-
-				DB, err := SetupDB(cl, test.DBType)
-				if err != nil {
-					t.Fatalf("SetupDB(): expected nil, got %v", err)
-				}
-
-				nodeID, err := DB.AddNode(context.Background(), test.pubkey)
-				if !errors.Is(err, test.expectedError) {
-					t.Fatalf("AddNode(%v): expected %v, got %v", test.pubkey, test.expectedError, err)
-				}
-
-				// check if nodeID has been assigned correctly
-				if nodeID != test.expectedNodeID {
-					t.Errorf("AddNode(%v): expected nodeID = %v, got %v", test.pubkey, test.expectedNodeID, nodeID)
-				}
-			})
-		}
-	})
-
-	t.Run("valid", func(t *testing.T) {
-		ctx := context.Background()
-		cl := redisutils.SetupTestClient()
-		defer redisutils.CleanupRedis(cl)
-
-		pubkey := "1"
-		expectedNode := &models.Node{
-			ID:      1,
-			Pubkey:  pubkey,
-			Status:  models.StatusInactive,
-			Records: []models.Record{{Kind: models.Added, Timestamp: time.Unix(time.Now().Unix(), 0)}},
-		}
+// TestAddNodesScript checks that the nodes are added all or nothing, like when
+// one of the pubkeys is added concurrently after AddNodes() checked them.
+func TestAddNodesScript(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
 
-		DB, err := SetupDB(cl, "one-node0")
-		if err != nil {
-			t.Fatalf("SetupDB(): expected nil, got %v", err)
-		}
+	DB, err := SetupDB(cl, "one-node0")
+	if err != nil {
+		t.Fatalf("SetupDB(): expected nil, got %v", err)
+	}
 
-		nodeID, err := DB.AddNode(ctx, pubkey)
-		if err != nil {
-			t.Fatalf("AddNode(%s): expected nil, got %v", pubkey, err)
-		}
+	if _, err := DB.AddNode(ctx, "b"); err != nil {
+		t.Fatalf("AddNode(): expected nil, got %v", err)
+	}
 
-		// check if nodeID has been assigned correctly
-		if nodeID != expectedNode.ID {
-			t.Errorf("AddNode(%s): expected nodeID = %v, got %v", pubkey, expectedNode.ID, nodeID)
-		}
+	keys := []string{KeyKeyIndex, KeyNode(10), KeyNode(11)}
+	existing, err := addNodesScript.Run(ctx, cl, keys, models.StatusInactive, time.Now().Unix(), "a", "b", 10, 11).Int()
+	if err != nil {
+		t.Fatalf("addNodesScript: expected nil, got %v", err)
+	}
 
-		// check if database HASH was updated correctly
-		cmdReturnDB := cl.HMGet(ctx, KeyDatabase, KeyLastNodeID)
-		if cmdReturnDB.Err() != nil {
-			t.Errorf("HMGet(): expected nil, got %v", err)
-		}
-		var fields DatabaseFields
-		if err := cmdReturnDB.Scan(&fields); err != nil {
-			t.Errorf("Scan(): expected nil, got %v", err)
-		}
-		if fields.LastNodeID != int(expectedNode.ID) {
-			t.Errorf("AddNode(%v): expected LastNodeID = %v, got %v", pubkey, expectedNode.ID, fields.LastNodeID)
-		}
+	if existing != 2 {
+		t.Fatalf("addNodesScript: expected the pubkey in position 2, got %d", existing)
+	}
 
-		// check if the node was added to the keyIndex correctly
-		strNodeID, err := cl.HGet(ctx, KeyKeyIndex, pubkey).Result()
-		if err != nil {
-			t.Errorf("HGet(): expected nil, got %v", err)
-		}
-		LoadedNodeID, err := redisutils.ParseID(strNodeID)
-		if err != nil {
-			t.Errorf("ParseID(%v): expected nil, got %v", strNodeID, err)
-		}
-		if LoadedNodeID != expectedNode.ID {
-			t.Errorf("AddNode(%s): expected nodeID = %v, got %v", pubkey, expectedNode.ID, nodeID)
-		}
+	exists, err := cl.Exists(ctx, KeyNode(10), KeyNode(11)).Result()
+	if err != nil {
+		t.Fatalf("Exists(): expected nil, got %v", err)
+	}
 
-		node, err := DB.NodeByKey(ctx, pubkey)
-		if err != nil {
-			t.Fatalf("NodeByKey(%s): expected nil, got %v", pubkey, err)
-		}
+	added, err := cl.HExists(ctx, KeyKeyIndex, "a").Result()
+	if err != nil {
+		t.Fatalf("HExists(): expected nil, got %v", err)
+	}
 
-		if !reflect.DeepEqual(node, expectedNode) {
-			t.Errorf("AddNode(): expected node %v \n got %v", expectedNode, node)
-		}
-	})
+	if exists != 0 || added {
+		t.Errorf("addNodesScript: expected no node to be added, got %d nodes and pubkey added %v", exists, added)
+	}
 }
 
+// TestUpdate checks the keys of the Redis layout, while the behaviour is covered by TestConformance.
 func TestUpdate(t *testing.T) {
-	t.Run("simple", func(t *testing.T) {
-		testCases := []struct {
-			name          string
-			DBType        string
-			delta         *models.Delta
-			expectedNode  *models.Node
-			expectedError error
-		}{
-			{
-				name:          "nil DB",
-				DBType:        "nil",
-				expectedError: models.ErrNilDB,
-			},
-			{
-				name:          "node not found",
-				DBType:        "one-node0",
-				delta:         &models.Delta{NodeID: 1},
-				expectedError: models.ErrNodeNotFoundDB,
-			},
-			{
-				name:   "valid promotion",
-				DBType: "simple",
-				delta: &models.Delta{
-					Kind:   models.Promotion,
-					NodeID: 0,
-				},
-				expectedNode: &models.Node{
-					ID:     0,
-					Pubkey: "0",
-					Status: models.StatusActive,
-					Records: []models.Record{
-						{Kind: models.Added, Timestamp: time.Unix(time.Now().Unix(), 0)},
-						{Kind: models.Promotion, Timestamp: time.Unix(time.Now().Unix(), 0)},
-					},
-				},
-			},
-			{
-				name:   "valid demotion",
-				DBType: "simple",
-				delta: &models.Delta{
-					Kind:   models.Demotion,
-					NodeID: 0,
-				},
-				expectedNode: &models.Node{
-					ID:     0,
-					Pubkey: "0",
-					Status: models.StatusInactive,
-					Records: []models.Record{
-						{Kind: models.Added, Timestamp: time.Unix(time.Now().Unix(), 0)},
-						{Kind: models.Demotion, Timestamp: time.Unix(time.Now().Unix(), 0)},
-					},
-				},
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				ctx := context.Background()
-				cl := redisutils.SetupTestClient()
-				defer redisutils.CleanupRedis(cl)
-
-				DB, err := SetupDB(cl, test.DBType)
-				if err != nil {
-					t.Fatalf("SetupDB(): expected nil, got %v", err)
-				}
-
-				err = DB.Update(ctx, test.delta)
-				if !errors.Is(err, test.expectedError) {
-					t.Fatalf("Update(%v): expected %v, got %v", test.delta.NodeID, test.expectedError, err)
-				}
-
-				// check if node was updated correctly
-				if err == nil {
-					node, err := DB.NodeByID(ctx, test.delta.NodeID)
-					if err != nil {
-						t.Fatalf("NodeByID(%d): expected nil, got %v", test.delta.NodeID, err)
-					}
-
-					if !reflect.DeepEqual(node, test.expectedNode) {
-						t.Errorf("Update(): expected node %v \n got %v", test.expectedNode, &node)
-					}
-				}
-			})
-		}
-	})
-
 	t.Run("valid follows", func(t *testing.T) {
 		ctx := context.Background()
 		cl := redisutils.SetupTestClient()
@@ -452,579 +242,81 @@ func TestUpdate(t *testing.T) {
 			t.Fatalf("Expected follows %v, got %v", []string{"0"}, follows)
 		}
 	})
-}
-
-func TestContainsNode(t *testing.T) {
-	testCases := []struct {
-		name             string
-		DBType           string
-		nodeID           uint32
-		expectedContains bool
-	}{
-		{
-			name:             "nil DB",
-			DBType:           "nil",
-			nodeID:           0,
-			expectedContains: false,
-		},
-		{
-			name:             "empty DB",
-			DBType:           "empty",
-			nodeID:           0,
-			expectedContains: false,
-		},
-		{
-			name:             "node not found",
-			DBType:           "one-node0",
-			nodeID:           1,
-			expectedContains: false,
-		},
-		{
-			name:             "node found",
-			DBType:           "one-node0",
-			nodeID:           0,
-			expectedContains: true,
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			ctx := context.Background()
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			contains := DB.ContainsNode(ctx, test.nodeID)
-			if contains != test.expectedContains {
-				t.Errorf("ContainsNode(%d): expected %v, got %v", test.nodeID, test.expectedContains, contains)
-			}
-		})
-	}
-}
-
-func TestFollows(t *testing.T) {
-	testCases := []struct {
-		name            string
-		DBType          string
-		nodeIDs         []uint32
-		expectedError   error
-		expectedFollows [][]uint32
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "empty DB",
-			DBType:        "empty",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:          "node not found",
-			DBType:        "one-node0",
-			nodeIDs:       []uint32{69, 0},
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:            "dandling node",
-			DBType:          "one-node0",
-			nodeIDs:         []uint32{0},
-			expectedFollows: [][]uint32{{}},
-		},
-		{
-			name:            "valid",
-			DBType:          "simple",
-			nodeIDs:         []uint32{0, 1},
-			expectedFollows: [][]uint32{{1}, {}},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			follows, err := DB.Follows(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Follows(%d): expected %v, got %v", test.nodeIDs, test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(follows, test.expectedFollows) {
-				t.Errorf("Follows(%d): expected %v, got %v", test.nodeIDs, test.expectedFollows, follows)
-			}
-		})
-	}
-}
-
-func TestFollowers(t *testing.T) {
-	testCases := []struct {
-		name              string
-		DBType            string
-		nodeIDs           []uint32
-		expectedError     error
-		expectedFollowers [][]uint32
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "empty DB",
-			DBType:        "empty",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:          "node not found",
-			DBType:        "one-node0",
-			nodeIDs:       []uint32{69, 0},
-			expectedError: models.ErrNodeNotFoundDB,
-		},
-		{
-			name:              "dandling node",
-			DBType:            "one-node0",
-			nodeIDs:           []uint32{0},
-			expectedFollowers: [][]uint32{{}},
-		},
-		{
-			name:              "valid",
-			DBType:            "simple",
-			nodeIDs:           []uint32{0, 1},
-			expectedFollowers: [][]uint32{{}, {0}},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			followers, err := DB.Followers(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Follows(%d): expected %v, got %v", test.nodeIDs, test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(followers, test.expectedFollowers) {
-				t.Errorf("Follows(%d): expected %v, got %v", test.nodeIDs, test.expectedFollowers, followers)
-			}
-		})
-	}
-}
-
-func TestFollowerCounts(t *testing.T) {
-	testCases := []struct {
-		name           string
-		DBType         string
-		nodeIDs        []uint32
-		expectedError  error
-		expectedCounts []int
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:           "empty DB",
-			DBType:         "empty",
-			nodeIDs:        []uint32{0},
-			expectedCounts: []int{0},
-		},
-		{
-			name:   "empty node IDs",
-			DBType: "simple",
-		},
-		{
-			name:           "node not found",
-			DBType:         "simple",
-			nodeIDs:        []uint32{1, 69},
-			expectedCounts: []int{1, 0},
-		},
-		{
-			name:           "valid",
-			DBType:         "simple",
-			nodeIDs:        []uint32{0, 1},
-			expectedCounts: []int{0, 1},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			counts, err := DB.FollowerCounts(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("expected error %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(counts, test.expectedCounts) {
-				t.Errorf("expected counts %v, got %v", test.expectedCounts, counts)
-			}
-		})
-	}
-}
-
-func TestFollowCounts(t *testing.T) {
-	testCases := []struct {
-		name           string
-		DBType         string
-		nodeIDs        []uint32
-		expectedError  error
-		expectedCounts []int
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:           "empty DB",
-			DBType:         "empty",
-			nodeIDs:        []uint32{0},
-			expectedCounts: []int{0},
-		},
-		{
-			name:   "empty node IDs",
-			DBType: "simple",
-		},
-		{
-			name:           "node not found",
-			DBType:         "simple",
-			nodeIDs:        []uint32{0, 69},
-			expectedCounts: []int{1, 0},
-		},
-		{
-			name:           "valid",
-			DBType:         "simple",
-			nodeIDs:        []uint32{0, 1},
-			expectedCounts: []int{1, 0},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			counts, err := DB.FollowCounts(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("expected error %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(counts, test.expectedCounts) {
-				t.Errorf("expected counts %v, got %v", test.expectedCounts, counts)
-			}
-		})
-	}
-}
-
-func TestNodeIDs(t *testing.T) {
-	testCases := []struct {
-		name            string
-		DBType          string
-		pubkeys         []string
-		expectedError   error
-		expectedNodeIDs []*uint32
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:            "one pubkey not found DB",
-			DBType:          "one-node0",
-			pubkeys:         []string{"69"},
-			expectedNodeIDs: []*uint32{nil},
-		},
-		{
-			name:            "one pubkey found DB",
-			DBType:          "one-node0",
-			pubkeys:         []string{"0"},
-			expectedNodeIDs: []*uint32{new(uint32)},
-		},
-		{
-			name:            "valid",
-			DBType:          "simple",
-			pubkeys:         []string{"0", "1"},
-			expectedNodeIDs: []*uint32{&[]uint32{0}[0], &[]uint32{1}[0]},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			ctx := context.Background()
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			nodeIDs, err := DB.NodeIDs(ctx, test.pubkeys...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("NodeIDs(): expected %v, got %v", test.expectedError, err)
-			}
 
-			if !reflect.DeepEqual(nodeIDs, test.expectedNodeIDs) {
-				t.Errorf("NodeIDs(): expected %v, got %v", test.expectedNodeIDs, nodeIDs)
-			}
-		})
-	}
-}
-
-func TestPubkeys(t *testing.T) {
-	testCases := []struct {
-		name            string
-		DBType          string
-		nodeIDs         []uint32
-		expectedError   error
-		expectedPubkeys []*string
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:            "one pubkey not found DB",
-			DBType:          "one-node0",
-			nodeIDs:         []uint32{4},
-			expectedPubkeys: []*string{nil},
-		},
-		{
-			name:            "one pubkey found DB",
-			DBType:          "one-node0",
-			nodeIDs:         []uint32{0},
-			expectedError:   nil,
-			expectedPubkeys: []*string{&[]string{"0"}[0]}, // a trick to add a pointer to "zero" inline
-		},
-		{
-			name:            "valid",
-			DBType:          "simple",
-			nodeIDs:         []uint32{0, 1},
-			expectedError:   nil,
-			expectedPubkeys: []*string{&[]string{"0"}[0], &[]string{"1"}[0]}, // a trick to add a pointer to "zero" inline
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			ctx := context.Background()
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			pubkeys, err := DB.Pubkeys(ctx, test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Pubkeys(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(pubkeys, test.expectedPubkeys) {
-				t.Errorf("Pubkeys(): expected %v, got %v", test.expectedPubkeys, pubkeys)
-			}
-		})
-	}
-}
-
-func TestAllNodes(t *testing.T) {
-	cl := redisutils.SetupTestClient()
-	defer redisutils.CleanupRedis(cl)
-
-	testCases := []struct {
-		name          string
-		DBType        string
-		expectedError error
-		expectedSlice []uint32
-	}{
-		{
-			name:          "nil DB",
-			DBType:        "nil",
-			expectedError: models.ErrNilDB,
-		},
-		{
-			name:          "empty DB",
-			DBType:        "empty",
-			expectedError: models.ErrEmptyDB,
-		},
-		{
-			name:          "DB with node 0",
-			DBType:        "one-node0",
-			expectedError: nil,
-			expectedSlice: []uint32{0},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
-			}
-
-			nodeIDs, err := DB.AllNodes(context.Background())
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("AllNodes(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(nodeIDs, test.expectedSlice) {
-				t.Errorf("AllNodes(): expected %v, got %v", test.expectedSlice, nodeIDs)
-			}
-		})
-	}
-}
-
-func TestScanNodes(t *testing.T) {
-	cl := redisutils.SetupTestClient()
-	defer redisutils.CleanupRedis(cl)
-
-	type testCase struct {
-		name            string
-		DBType          string
-		limit           int
-		expectedError   error
-		expectedNodeIDs []uint32
-	}
+	t.Run("valid mutes", func(t *testing.T) {
+		ctx := context.Background()
+		cl := redisutils.SetupTestClient()
+		defer redisutils.CleanupRedis(cl)
 
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []testCase{
-			{
-				name:          "nil DB",
-				DBType:        "nil",
-				limit:         100,
-				expectedError: models.ErrNilDB,
-			},
+		DB, err := SetupDB(cl, "simple")
+		if err != nil {
+			t.Fatalf("SetupDB(): expected nil, got %v", err)
 		}
 
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				DB, err := SetupDB(cl, test.DBType)
-				if err != nil {
-					t.Fatalf("SetupDB(): expected nil, got %v", err)
-				}
-
-				_, _, err = DB.ScanNodes(context.Background(), 0, test.limit)
-				if !errors.Is(err, test.expectedError) {
-					t.Fatalf("ScanNodes(): expected %v, got %v", test.expectedError, err)
-				}
-			})
+		delta := &models.Delta{
+			Kind:    nostr.KindMuteList,
+			NodeID:  2,
+			Removed: []uint32{0},
+			Added:   []uint32{1},
 		}
-	})
 
-	t.Run("valid", func(t *testing.T) {
-
-		testCases := []testCase{
-			{
-				name:            "one batch",
-				DBType:          "one-node0",
-				limit:           100,
-				expectedNodeIDs: []uint32{0},
-			},
+		if err := DB.Update(ctx, delta); err != nil {
+			t.Fatalf("Update(%d): expected nil, got %v", delta.NodeID, err)
 		}
 
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				DB, err := SetupDB(cl, test.DBType)
-				if err != nil {
-					t.Fatalf("SetupDB(): expected nil, got %v", err)
-				}
-
-				var cursor uint64 = 0
-				nodeIDs := []uint32{}
-				for {
-
-					res, cursor, err := DB.ScanNodes(context.Background(), cursor, test.limit)
-					if err != nil {
-						t.Fatalf("ScanNodes(): expected nil, got %v", err)
-					}
-					nodeIDs = append(nodeIDs, res...)
-
-					if cursor == 0 {
-						break
-					}
-				}
+		mutes, err := DB.client.SMembers(ctx, KeyMutes(delta.NodeID)).Result()
+		if err != nil {
+			t.Fatalf("SMembers(%s) expected nil got %v", KeyMutes(delta.NodeID), err)
+		}
+		if !reflect.DeepEqual(mutes, []string{"1"}) {
+			t.Fatalf("Expected mutes %v, got %v", []string{"1"}, mutes)
+		}
 
-				if !reflect.DeepEqual(nodeIDs, test.expectedNodeIDs) {
-					t.Errorf("ScanNodes(): expected %v, got %v", test.expectedNodeIDs, nodeIDs)
-				}
-			})
+		mutedBy, err := DB.client.SMembers(ctx, KeyMutedBy(0)).Result()
+		if err != nil {
+			t.Fatalf("SMembers(%s) expected nil got %v", KeyMutedBy(0), err)
+		}
+		if !reflect.DeepEqual(mutedBy, []string{}) {
+			t.Fatalf("Expected mutedBy %v, got %v", []string{}, mutedBy)
 		}
 	})
 }
 
-func TestSize(t *testing.T) {
-	cl := redisutils.SetupTestClient()
-	defer redisutils.CleanupRedis(cl)
-
+func TestParseReport(t *testing.T) {
 	testCases := []struct {
-		name         string
-		DBType       string
-		expectedSize int
+		name             string
+		member           string
+		expectedType     string
+		expectedReporter uint32
+		expectedError    error
 	}{
 		{
-			name:         "nil DB",
-			DBType:       "nil",
-			expectedSize: 0,
+			name:          "missing separator",
+			member:        "spam",
+			expectedError: ErrInvalidReport,
 		},
 		{
-			name:         "empty DB",
-			DBType:       "empty",
-			expectedSize: 0,
+			name:          "invalid reporter",
+			member:        "spam:abc",
+			expectedError: ErrInvalidReport,
 		},
 		{
-			name:         "DB with node 0",
-			DBType:       "one-node0",
-			expectedSize: 1,
+			name:             "valid",
+			member:           "spam:69",
+			expectedType:     "spam",
+			expectedReporter: 69,
 		},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			DB, err := SetupDB(cl, test.DBType)
-			if err != nil {
-				t.Fatalf("SetupDB(): expected nil, got %v", err)
+			reportType, reporter, err := ParseReport(test.member)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("ParseReport(): expected %v, got %v", test.expectedError, err)
 			}
 
-			size := DB.Size(context.Background())
-			if size != test.expectedSize {
-				t.Errorf("Size(): expected %v, got %v", test.expectedSize, size)
+			if reportType != test.expectedType || reporter != test.expectedReporter {
+				t.Errorf("ParseReport(): expected (%s, %d), got (%s, %d)", test.expectedType, test.expectedReporter, reportType, reporter)
 			}
 		})
 	}
@@ -1101,3 +393,16 @@ func BenchmarkAllNodes(b *testing.B) {
 		})
 	}
 }
+
+func TestConformance(t *testing.T) {
+	modelstest.TestDatabase(t, func(t testing.TB, DBType string) models.Database {
+		cl := redisutils.SetupTestClient()
+		t.Cleanup(func() { redisutils.CleanupRedis(cl) })
+
+		DB, err := SetupDB(cl, DBType)
+		if err != nil {
+			t.Fatalf("SetupDB(): expected nil, got %v", err)
+		}
+		return DB
+	})
+}
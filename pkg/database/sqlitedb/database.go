@@ -0,0 +1,1012 @@
+/*
+The sqlitedb package defines an SQLite database that fulfills the Database interface in models.
+
+The nodes and their records (added, promotion, demotion) are stored in two tables,
+while each relationship (follows, mutes, reports, write relays) has its own table,
+indexed in both directions when needed.
+*/
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // the sqlite3 driver
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS nodes (
+	id INTEGER PRIMARY KEY,
+	pubkey TEXT NOT NULL UNIQUE,
+	status TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS records (
+	node_id INTEGER NOT NULL REFERENCES nodes(id),
+	kind INTEGER NOT NULL,
+	timestamp INTEGER NOT NULL,
+	PRIMARY KEY (node_id, kind)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS follows (
+	source INTEGER NOT NULL,
+	target INTEGER NOT NULL,
+	PRIMARY KEY (source, target)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS follows_target ON follows(target, source);
+
+CREATE TABLE IF NOT EXISTS mutes (
+	source INTEGER NOT NULL,
+	target INTEGER NOT NULL,
+	PRIMARY KEY (source, target)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS mutes_target ON mutes(target, source);
+
+CREATE TABLE IF NOT EXISTS reports (
+	reported INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	reporter INTEGER NOT NULL,
+	PRIMARY KEY (reported, type, reporter)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS write_relays (
+	node_id INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	PRIMARY KEY (node_id, position)
+) WITHOUT ROWID;
+`
+
+// the tables of the relationships, with the columns "source" and "target".
+const (
+	tableFollows = "follows"
+	tableMutes   = "mutes"
+)
+
+// Database fulfills the Database interface defined in models
+type Database struct {
+	db *sql.DB
+}
+
+// NewDatabase() creates the tables (if they don't exist) and returns a Database using db.
+func NewDatabase(ctx context.Context, db *sql.DB) (*Database, error) {
+	if db == nil {
+		return nil, ErrNilSQL
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create the schema: %w", err)
+	}
+
+	return &Database{db: db}, nil
+}
+
+// Open() opens (or creates) the SQLite database at path, and returns a Database using it.
+func Open(ctx context.Context, path string) (*Database, error) {
+	// immediate transactions avoid deadlocks when a read is followed by a write
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	DB, err := NewDatabase(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return DB, nil
+}
+
+// Close() closes the underlying SQL database.
+func (DB *Database) Close() error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+	return DB.db.Close()
+}
+
+// Validate() check if DB and the SQL database are nil and returns the appropriare error
+func (DB *Database) Validate() error {
+	if DB == nil {
+		return models.ErrNilDB
+	}
+
+	if DB.db == nil {
+		return ErrNilSQL
+	}
+
+	return nil
+}
+
+// NodeByID() retrieves a node by its nodeID.
+func (DB *Database) NodeByID(ctx context.Context, nodeID uint32) (*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	row := DB.db.QueryRowContext(ctx, "SELECT id, pubkey, status FROM nodes WHERE id = ?", nodeID)
+	node, err := DB.scanNode(ctx, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, nodeID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch node with ID %d: %w", nodeID, err)
+	}
+
+	return node, nil
+}
+
+// Nodes() retrieves the node of each nodeID with two queries. If a nodeID is not found, nil is returned.
+func (DB *Database) Nodes(ctx context.Context, nodeIDs ...uint32) ([]*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT id, pubkey, status FROM nodes WHERE id IN (SELECT value FROM json_each(?))", formatJSON(nodeIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %d nodes: %w", len(nodeIDs), err)
+	}
+	defer rows.Close()
+
+	index := make(map[uint32]*models.Node, len(nodeIDs))
+	for rows.Next() {
+		node := &models.Node{}
+		if err := rows.Scan(&node.ID, &node.Pubkey, &node.Status); err != nil {
+			return nil, err
+		}
+		index[node.ID] = node
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	records, err := DB.db.QueryContext(ctx, "SELECT node_id, kind, timestamp FROM records WHERE node_id IN (SELECT value FROM json_each(?)) ORDER BY node_id, kind", formatJSON(nodeIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the records of %d nodes: %w", len(nodeIDs), err)
+	}
+	defer records.Close()
+
+	for records.Next() {
+		var ID uint32
+		var kind int
+		var ts int64
+		if err := records.Scan(&ID, &kind, &ts); err != nil {
+			return nil, err
+		}
+
+		if node, exists := index[ID]; exists {
+			node.Records = append(node.Records, models.Record{Kind: kind, Timestamp: time.Unix(ts, 0)})
+		}
+	}
+
+	if err := records.Err(); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*models.Node, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		nodes[i] = index[ID]
+	}
+
+	return nodes, nil
+}
+
+// NodeByKey() retrieves a node by its pubkey.
+func (DB *Database) NodeByKey(ctx context.Context, pubkey string) (*models.Node, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	row := DB.db.QueryRowContext(ctx, "SELECT id, pubkey, status FROM nodes WHERE pubkey = ?", pubkey)
+	node, err := DB.scanNode(ctx, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w with pubkey %s", models.ErrNodeNotFoundDB, pubkey)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch node with pubkey %s: %w", pubkey, err)
+	}
+
+	return node, nil
+}
+
+// scanNode() scans the row into a node, and fetches its records ordered by kind.
+func (DB *Database) scanNode(ctx context.Context, row *sql.Row) (*models.Node, error) {
+	node := &models.Node{}
+	if err := row.Scan(&node.ID, &node.Pubkey, &node.Status); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT kind, timestamp FROM records WHERE node_id = ? ORDER BY kind", node.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind int
+		var ts int64
+		if err := rows.Scan(&kind, &ts); err != nil {
+			return nil, err
+		}
+
+		node.Records = append(node.Records, models.Record{Kind: kind, Timestamp: time.Unix(ts, 0)})
+	}
+
+	return node, rows.Err()
+}
+
+// AddNode() adds a node to the database and returns its assigned nodeID.
+func (DB *Database) AddNode(ctx context.Context, pubkey string) (uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return math.MaxUint32, err
+	}
+
+	nodeIDs, err := DB.AddNodes(ctx, pubkey)
+	if err != nil {
+		return math.MaxUint32, err
+	}
+
+	return nodeIDs[0], nil
+}
+
+// AddNodes() adds the nodes to the database in a single transaction and returns their assigned nodeIDs.
+// If any of the pubkeys is already in the database (or repeated), no node is added.
+func (DB *Database) AddNodes(ctx context.Context, pubkeys ...string) ([]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(pubkeys) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{}, len(pubkeys))
+	for _, pk := range pubkeys {
+		if _, repeated := seen[pk]; repeated {
+			return nil, fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pk)
+		}
+		seen[pk] = struct{}{}
+	}
+
+	var nodeIDs []uint32
+	err := DB.transaction(ctx, func(tx *sql.Tx) error {
+		var pubkey string
+		err := tx.QueryRowContext(ctx, "SELECT pubkey FROM nodes WHERE pubkey IN (SELECT value FROM json_each(?)) LIMIT 1", formatJSON(pubkeys)).Scan(&pubkey)
+		if err == nil {
+			return fmt.Errorf("%w with pubkey %v", models.ErrNodeAlreadyInDB, pubkey)
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check for existance of the pubkeys: %w", err)
+		}
+
+		var lastID int64
+		if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), -1) FROM nodes").Scan(&lastID); err != nil {
+			return fmt.Errorf("failed to fetch the last nodeID: %w", err)
+		}
+
+		insertNode, err := tx.PrepareContext(ctx, "INSERT INTO nodes (id, pubkey, status) VALUES (?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insertNode.Close()
+
+		insertRecord, err := tx.PrepareContext(ctx, "INSERT INTO records (node_id, kind, timestamp) VALUES (?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insertRecord.Close()
+
+		now := time.Now().Unix()
+		nodeIDs = make([]uint32, len(pubkeys))
+		for i, pk := range pubkeys {
+			nodeID := lastID + 1 + int64(i)
+			nodeIDs[i] = uint32(nodeID)
+
+			if _, err := insertNode.ExecContext(ctx, nodeID, pk, models.StatusInactive); err != nil {
+				return fmt.Errorf("failed to add %v: %w", pk, err)
+			}
+
+			if _, err := insertRecord.ExecContext(ctx, nodeID, models.Added, now); err != nil {
+				return fmt.Errorf("failed to add %v: %w", pk, err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeIDs, nil
+}
+
+// Update() applies the deltas to the database in a single transaction.
+// If any of the nodes is not found, no delta is applied.
+func (DB *Database) Update(ctx context.Context, deltas ...*models.Delta) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	nodeIDs := make([]uint32, len(deltas))
+	for i, delta := range deltas {
+		if delta == nil {
+			return models.ErrNilDelta
+		}
+		nodeIDs[i] = delta.NodeID
+	}
+
+	if err := DB.checkExist(ctx, nodeIDs...); err != nil {
+		return err
+	}
+
+	err := DB.transaction(ctx, func(tx *sql.Tx) error {
+		for _, delta := range deltas {
+			if err := update(ctx, tx, delta); err != nil {
+				return fmt.Errorf("failed to update with delta %v: %w", delta, err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to update with %d deltas: %w", len(deltas), err)
+	}
+
+	return nil
+}
+
+// update() applies the delta within the transaction.
+func update(ctx context.Context, tx *sql.Tx, delta *models.Delta) error {
+	switch delta.Kind {
+	case models.Promotion:
+		return setStatus(ctx, tx, delta.NodeID, models.StatusActive, models.Promotion)
+
+	case models.Demotion:
+		return setStatus(ctx, tx, delta.NodeID, models.StatusInactive, models.Demotion)
+
+	case nostr.KindFollowList:
+		return updateRelationship(ctx, tx, tableFollows, delta)
+
+	case nostr.KindMuteList:
+		return updateRelationship(ctx, tx, tableMutes, delta)
+	}
+
+	return nil
+}
+
+// setStatus() sets the status of nodeID, and the timestamp of the record of the specified kind.
+func setStatus(ctx context.Context, tx *sql.Tx, nodeID uint32, status string, kind int) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE nodes SET status = ? WHERE id = ?", status, nodeID); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO records (node_id, kind, timestamp) VALUES (?, ?, ?)
+		ON CONFLICT (node_id, kind) DO UPDATE SET timestamp = excluded.timestamp`,
+		nodeID, kind, time.Now().Unix())
+	return err
+}
+
+// updateRelationship() adds and removes the rows (delta.NodeID, target) of the table.
+func updateRelationship(ctx context.Context, tx *sql.Tx, table string, delta *models.Delta) error {
+	if len(delta.Added) > 0 {
+		query := fmt.Sprintf("INSERT OR IGNORE INTO %s (source, target) SELECT ?, value FROM json_each(?)", table)
+		if _, err := tx.ExecContext(ctx, query, delta.NodeID, formatJSON(delta.Added)); err != nil {
+			return err
+		}
+	}
+
+	if len(delta.Removed) > 0 {
+		query := fmt.Sprintf("DELETE FROM %s WHERE source = ? AND target IN (SELECT value FROM json_each(?))", table)
+		if _, err := tx.ExecContext(ctx, query, delta.NodeID, formatJSON(delta.Removed)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ContainsNode() returns wheter the DB contains nodeID. In case of errors returns false.
+func (DB *Database) ContainsNode(ctx context.Context, nodeID uint32) bool {
+	if err := DB.Validate(); err != nil {
+		return false
+	}
+
+	var exists bool
+	if err := DB.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM nodes WHERE id = ?)", nodeID).Scan(&exists); err != nil {
+		return false
+	}
+
+	return exists
+}
+
+// Followers() returns a slice containing the followers of each of the specified nodeIDs.
+func (DB *Database) Followers(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(ctx, tableFollows, "target", "source", nodeIDs...)
+}
+
+// Follows() returns a slice containing the follows of each of the specified nodeIDs.
+func (DB *Database) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(ctx, tableFollows, "source", "target", nodeIDs...)
+}
+
+// Mutes() returns a slice containing the mutes of each of the specified nodeIDs.
+func (DB *Database) Mutes(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(ctx, tableMutes, "source", "target", nodeIDs...)
+}
+
+// MutedBy() returns a slice containing the nodes that muted each of the specified nodeIDs.
+func (DB *Database) MutedBy(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.members(ctx, tableMutes, "target", "source", nodeIDs...)
+}
+
+// members() returns, for each nodeID, the sorted values of the column "member"
+// in the rows of the table where the column "key" equals nodeID.
+// It returns an error if any of the nodeIDs is not found.
+func (DB *Database) members(ctx context.Context, table, key, member string, nodeIDs ...uint32) ([][]uint32, error) {
+	if err := DB.checkExist(ctx, nodeIDs...); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %[2]s, %[3]s FROM %[1]s WHERE %[2]s IN (SELECT value FROM json_each(?)) ORDER BY %[2]s, %[3]s", table, key, member)
+	rows, err := DB.db.QueryContext(ctx, query, formatJSON(nodeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[uint32][]uint32, len(nodeIDs))
+	for rows.Next() {
+		var ID, memberID uint32
+		if err := rows.Scan(&ID, &memberID); err != nil {
+			return nil, err
+		}
+		index[ID] = append(index[ID], memberID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members := make([][]uint32, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		members[i] = index[ID]
+		if members[i] == nil {
+			members[i] = []uint32{}
+		}
+	}
+
+	return members, nil
+}
+
+// checkExist() returns an error if any of the nodeIDs is not found.
+func (DB *Database) checkExist(ctx context.Context, nodeIDs ...uint32) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+
+	var missing sql.NullInt64
+	err := DB.db.QueryRowContext(ctx, `
+		SELECT value FROM json_each(?)
+		WHERE value NOT IN (SELECT id FROM nodes)
+		LIMIT 1`, formatJSON(nodeIDs)).Scan(&missing)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to check for the existance of the nodeIDs: %w", err)
+	}
+
+	return fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, missing.Int64)
+}
+
+func (DB *Database) FollowerCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.counts(ctx, tableFollows, "target", nodeIDs...)
+}
+
+func (DB *Database) FollowCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.counts(ctx, tableFollows, "source", nodeIDs...)
+}
+
+func (DB *Database) MutedByCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	return DB.counts(ctx, tableMutes, "target", nodeIDs...)
+}
+
+// counts() returns, for each nodeID, the number of rows of the table where the column "key" equals nodeID.
+func (DB *Database) counts(ctx context.Context, table, key string, nodeIDs ...uint32) ([]int, error) {
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT %[2]s, COUNT(*) FROM %[1]s WHERE %[2]s IN (SELECT value FROM json_each(?)) GROUP BY %[2]s", table, key)
+	rows, err := DB.db.QueryContext(ctx, query, formatJSON(nodeIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	index := make(map[uint32]int, len(nodeIDs))
+	for rows.Next() {
+		var ID uint32
+		var count int
+		if err := rows.Scan(&ID, &count); err != nil {
+			return nil, err
+		}
+		index[ID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make([]int, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		counts[i] = index[ID]
+	}
+
+	return counts, nil
+}
+
+// AddReports() adds the reports to the database. Adding the same report twice has no effect.
+func (DB *Database) AddReports(ctx context.Context, reports ...models.Report) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	err := DB.transaction(ctx, func(tx *sql.Tx) error {
+		insert, err := tx.PrepareContext(ctx, "INSERT OR IGNORE INTO reports (reported, type, reporter) VALUES (?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+
+		for _, report := range reports {
+			if _, err := insert.ExecContext(ctx, report.Reported, report.Type, report.Reporter); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to add the reports: %w", err)
+	}
+
+	return nil
+}
+
+// Reports() returns the reports received by each nodeID, grouped by type.
+// If a node is not found or has no reports, an empty map is returned.
+func (DB *Database) Reports(ctx context.Context, nodeIDs ...uint32) ([]models.ReportMap, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := DB.db.QueryContext(ctx, `
+		SELECT reported, type, reporter FROM reports
+		WHERE reported IN (SELECT value FROM json_each(?))
+		ORDER BY reported, type, reporter`, formatJSON(nodeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[uint32]models.ReportMap, len(nodeIDs))
+	for rows.Next() {
+		var reported, reporter uint32
+		var reportType string
+		if err := rows.Scan(&reported, &reportType, &reporter); err != nil {
+			return nil, err
+		}
+
+		if index[reported] == nil {
+			index[reported] = make(models.ReportMap)
+		}
+		index[reported][reportType] = append(index[reported][reportType], reporter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	reports := make([]models.ReportMap, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		reports[i] = index[ID]
+		if reports[i] == nil {
+			reports[i] = make(models.ReportMap)
+		}
+	}
+
+	return reports, nil
+}
+
+// SetWriteRelays() replaces the write relays of nodeID, preserving their order.
+func (DB *Database) SetWriteRelays(ctx context.Context, nodeID uint32, relays []string) error {
+	if err := DB.Validate(); err != nil {
+		return err
+	}
+
+	if !DB.ContainsNode(ctx, nodeID) {
+		return fmt.Errorf("%w with ID %d", models.ErrNodeNotFoundDB, nodeID)
+	}
+
+	err := DB.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM write_relays WHERE node_id = ?", nodeID); err != nil {
+			return err
+		}
+
+		for i, relay := range relays {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO write_relays (node_id, position, url) VALUES (?, ?, ?)", nodeID, i, relay); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to set the write relays of %d: %w", nodeID, err)
+	}
+
+	return nil
+}
+
+// WriteRelays() returns the write relays of each nodeID. If a node is not found, an empty slice is returned.
+func (DB *Database) WriteRelays(ctx context.Context, nodeIDs ...uint32) ([][]string, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := DB.db.QueryContext(ctx, `
+		SELECT node_id, url FROM write_relays
+		WHERE node_id IN (SELECT value FROM json_each(?))
+		ORDER BY node_id, position`, formatJSON(nodeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[uint32][]string, len(nodeIDs))
+	for rows.Next() {
+		var ID uint32
+		var url string
+		if err := rows.Scan(&ID, &url); err != nil {
+			return nil, err
+		}
+		index[ID] = append(index[ID], url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	relays := make([][]string, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		relays[i] = index[ID]
+		if relays[i] == nil {
+			relays[i] = []string{}
+		}
+	}
+
+	return relays, nil
+}
+
+// NodeIDs() returns a slice of nodeIDs that correspond with the given slice of pubkeys.
+// If a pubkey is not found, nil is returned
+func (DB *Database) NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(pubkeys) == 0 {
+		return nil, nil
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT pubkey, id FROM nodes WHERE pubkey IN (SELECT value FROM json_each(?))", formatJSON(pubkeys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[string]uint32, len(pubkeys))
+	for rows.Next() {
+		var pubkey string
+		var ID uint32
+		if err := rows.Scan(&pubkey, &ID); err != nil {
+			return nil, err
+		}
+		index[pubkey] = ID
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	nodeIDs := make([]*uint32, len(pubkeys))
+	for i, pk := range pubkeys {
+		if ID, found := index[pk]; found {
+			nodeIDs[i] = &ID
+		}
+	}
+
+	return nodeIDs, nil
+}
+
+// Pubkeys() returns a slice of pubkeys that correspond with the given slice of nodeIDs.
+// If a nodeID is not found, nil is returned
+func (DB *Database) Pubkeys(ctx context.Context, nodeIDs ...uint32) ([]*string, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT id, pubkey FROM nodes WHERE id IN (SELECT value FROM json_each(?))", formatJSON(nodeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[uint32]string, len(nodeIDs))
+	for rows.Next() {
+		var ID uint32
+		var pubkey string
+		if err := rows.Scan(&ID, &pubkey); err != nil {
+			return nil, err
+		}
+		index[ID] = pubkey
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pubkeys := make([]*string, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if pk, found := index[ID]; found {
+			pubkeys[i] = &pk
+		}
+	}
+
+	return pubkeys, nil
+}
+
+// ScanNodes() scans over the nodes in ascending order of nodeID, and returns a batch of at most limit nodeIDs.
+// The cursor is the next nodeID to scan from, and it's 0 when the scan is complete.
+func (DB *Database) ScanNodes(ctx context.Context, cursor uint64, limit int) ([]uint32, uint64, error) {
+	if err := DB.Validate(); err != nil {
+		return []uint32{}, 0, err
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT id FROM nodes WHERE id >= ? ORDER BY id LIMIT ?", cursor, limit)
+	if err != nil {
+		return []uint32{}, 0, err
+	}
+	defer rows.Close()
+
+	nodeIDs := make([]uint32, 0, limit)
+	for rows.Next() {
+		var ID uint32
+		if err := rows.Scan(&ID); err != nil {
+			return []uint32{}, 0, err
+		}
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []uint32{}, 0, err
+	}
+
+	if len(nodeIDs) < limit {
+		return nodeIDs, 0, nil
+	}
+
+	return nodeIDs, uint64(nodeIDs[len(nodeIDs)-1]) + 1, nil
+}
+
+// AllNodes() returns a slice with the IDs of all nodes in the DB
+func (DB *Database) AllNodes(ctx context.Context) ([]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.db.QueryContext(ctx, "SELECT id FROM nodes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("AllNodes(): %w", err)
+	}
+	defer rows.Close()
+
+	var nodeIDs []uint32
+	for rows.Next() {
+		var ID uint32
+		if err := rows.Scan(&ID); err != nil {
+			return nil, err
+		}
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, fmt.Errorf("AllNodes(): %w", models.ErrEmptyDB)
+	}
+
+	return nodeIDs, nil
+}
+
+// Size() returns the number of nodes in the DB. In case of errors, it returns 0.
+func (DB *Database) Size(ctx context.Context) int {
+	if err := DB.Validate(); err != nil {
+		return 0
+	}
+
+	var size int
+	if err := DB.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM nodes").Scan(&size); err != nil {
+		return 0
+	}
+
+	return size
+}
+
+// --------------------------------------HELPERS--------------------------------
+
+// transaction() runs fn inside a transaction, which is committed only if fn returns nil.
+func (DB *Database) transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin the transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// formatJSON() formats the values as a JSON array, to be expanded by json_each in the queries.
+// This avoids the limit on the number of parameters of SQLite.
+func formatJSON[T uint32 | string](values []T) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// function that returns a DB setup based on the DBType
+func SetupDB(path string, DBType string) (*Database, error) {
+	ctx := context.Background()
+
+	switch DBType {
+	case "nil":
+		return nil, nil
+
+	case "nil-sql":
+		return &Database{db: nil}, nil
+
+	case "empty":
+		return Open(ctx, path)
+
+	case "one-node0":
+		DB, err := Open(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := DB.AddNode(ctx, "0"); err != nil {
+			return nil, err
+		}
+
+		return DB, nil
+
+	case "simple":
+		DB, err := Open(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := DB.AddNodes(ctx, "0", "1", "2"); err != nil {
+			return nil, err
+		}
+
+		// promoting node1, without adding the record
+		if _, err := DB.db.ExecContext(ctx, "UPDATE nodes SET status = ? WHERE id = 1", models.StatusActive); err != nil {
+			return nil, err
+		}
+
+		// adding 0 --follows--> 1 and 2 --mutes--> 0
+		if err := DB.Update(ctx, &models.Delta{Kind: nostr.KindFollowList, NodeID: 0, Added: []uint32{1}}); err != nil {
+			return nil, err
+		}
+
+		if err := DB.Update(ctx, &models.Delta{Kind: nostr.KindMuteList, NodeID: 2, Added: []uint32{0}}); err != nil {
+			return nil, err
+		}
+
+		// adding 2 --reports (spam)--> 0
+		if err := DB.AddReports(ctx, models.Report{Reporter: 2, Reported: 0, Type: "spam"}); err != nil {
+			return nil, err
+		}
+
+		return DB, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+//---------------------------------ERROR-CODES---------------------------------
+
+var (
+	ErrNilSQL = errors.New("nil sql database pointer")
+)
@@ -0,0 +1,162 @@
+package sqlitedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/models/modelstest"
+)
+
+// setupDB() returns the DB of the specified type, stored in a temporary directory.
+func setupDB(t testing.TB, DBType string) *Database {
+	t.Helper()
+	DB, err := SetupDB(filepath.Join(t.TempDir(), "graph.sqlite"), DBType)
+	if err != nil {
+		t.Fatalf("SetupDB(): expected nil, got %v", err)
+	}
+
+	if DB != nil && DB.db != nil {
+		t.Cleanup(func() { DB.Close() })
+	}
+	return DB
+}
+
+func TestValidateNilSQL(t *testing.T) {
+	if err := setupDB(t, "nil-sql").Validate(); !errors.Is(err, ErrNilSQL) {
+		t.Fatalf("Validate(): expected %v, got %v", ErrNilSQL, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "graph.sqlite")
+
+	DB, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Open(): expected nil, got %v", err)
+	}
+
+	if _, err := DB.AddNodes(ctx, "0", "1"); err != nil {
+		t.Fatalf("AddNodes(): expected nil, got %v", err)
+	}
+	DB.Close()
+
+	// reopening the same file must preserve the data
+	DB, err = Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Open(): expected nil, got %v", err)
+	}
+	defer DB.Close()
+
+	if size := DB.Size(ctx); size != 2 {
+		t.Errorf("Open(): expected size 2, got %d", size)
+	}
+}
+
+func TestScanNodes(t *testing.T) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		limit           int
+		expectedNodeIDs []uint32
+	}{
+		{
+			name:            "empty DB",
+			DBType:          "empty",
+			limit:           100,
+			expectedNodeIDs: []uint32{},
+		},
+		{
+			name:            "one batch",
+			DBType:          "simple",
+			limit:           100,
+			expectedNodeIDs: []uint32{0, 1, 2},
+		},
+		{
+			name:            "multiple batches",
+			DBType:          "simple",
+			limit:           1,
+			expectedNodeIDs: []uint32{0, 1, 2},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setupDB(t, test.DBType)
+
+			var cursor uint64
+			nodeIDs := []uint32{}
+			for {
+				res, newCursor, err := DB.ScanNodes(context.Background(), cursor, test.limit)
+				if err != nil {
+					t.Fatalf("ScanNodes(): expected nil, got %v", err)
+				}
+
+				if len(res) > test.limit {
+					t.Fatalf("ScanNodes(): expected at most %d nodes, got %v", test.limit, res)
+				}
+
+				nodeIDs = append(nodeIDs, res...)
+				cursor = newCursor
+				if cursor == 0 {
+					break
+				}
+			}
+
+			if !reflect.DeepEqual(nodeIDs, test.expectedNodeIDs) {
+				t.Errorf("ScanNodes(): expected %v, got %v", test.expectedNodeIDs, nodeIDs)
+			}
+		})
+	}
+}
+
+func TestInterface(t *testing.T) {
+	var _ models.Database = &Database{}
+}
+
+// ------------------------------------BENCHMARKS------------------------------
+
+func BenchmarkFollows(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("DBSize=%d", size), func(b *testing.B) {
+			DB := setupDB(b, "empty")
+
+			pubkeys := make([]string, size)
+			for i := range pubkeys {
+				pubkeys[i] = fmt.Sprint(i)
+			}
+
+			nodeIDs, err := DB.AddNodes(ctx, pubkeys...)
+			if err != nil {
+				b.Fatalf("AddNodes(): expected nil, got %v", err)
+			}
+
+			for i, ID := range nodeIDs {
+				delta := &models.Delta{Kind: nostr.KindFollowList, NodeID: ID, Added: nodeIDs[i+1 : min(i+101, size)]}
+				if err := DB.Update(ctx, delta); err != nil {
+					b.Fatalf("Update(): expected nil, got %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := DB.Follows(ctx, nodeIDs[:100]...); err != nil {
+					b.Fatalf("benchmark failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	modelstest.TestDatabase(t, func(t testing.TB, DBType string) models.Database {
+		return setupDB(t, DBType)
+	})
+}
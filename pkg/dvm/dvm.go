@@ -0,0 +1,464 @@
+/*
+The dvm package implements a NIP-90 Data Vending Machine that answers reputation
+queries over Nostr. It listens for job requests, computes the rankings using the
+pagerank package, and publishes signed job results (or error feedbacks).
+
+Supported jobs:
+
+- [KindRankProfiles]: ranks the "target" pubkeys, relative to the "source" if
+specified (personalized pagerank), otherwise using the global pagerank.
+
+- [KindRecommendFollows]: recommends pubkeys that the "source" doesn't already follow.
+
+# REFERENCES
+
+[1] NIP-90; URL: https://github.com/nostr-protocol/nips/blob/master/90.md
+*/
+package dvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/crawler"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/pagerank"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+)
+
+const (
+	// job request kinds. The corresponding results have kind + 1000
+	KindRecommendFollows int = 5313
+	KindRankProfiles     int = 5314
+	KindJobFeedback      int = 7000
+
+	resultOffset int = 1000
+)
+
+// Publisher abstracts the sending of events to relays, which allows tests to use an in-process relay.
+type Publisher interface {
+	Publish(ctx context.Context, event *nostr.Event) error
+}
+
+// PoolPublisher publishes events to a list of relays using a nostr.SimplePool.
+type PoolPublisher struct {
+	Pool   *nostr.SimplePool
+	Relays []string
+}
+
+// Publish() sends the event to all the relays, and returns an error only if none accepted it.
+func (p PoolPublisher) Publish(ctx context.Context, event *nostr.Event) error {
+	var accepted int
+	var err error
+
+	for res := range p.Pool.PublishMany(ctx, p.Relays, *event) {
+		if res.Error != nil {
+			err = fmt.Errorf("%s: %w", res.RelayURL, res.Error)
+			continue
+		}
+		accepted++
+	}
+
+	if accepted == 0 {
+		return fmt.Errorf("event %s rejected by all relays: %w", event.ID, err)
+	}
+
+	return nil
+}
+
+type Config struct {
+	Log          *logger.Aggregate
+	Relays       []string
+	PrivateKey   string // used to sign the results. If empty, the DVM is not started
+	DefaultLimit int
+	MaxLimit     int
+	TopK         uint16            // the precision used when computing personalized pageranks
+	Rand         *randutils.Source // if nil, the pageranks are computed with time-seeded generators
+}
+
+func NewConfig() Config {
+	return Config{
+		Log: logger.New(os.Stdout),
+		Relays: []string{
+			"wss://relay.damus.io",
+			"wss://relay.primal.net",
+			"wss://nos.lol",
+			"wss://relay.nostr.band",
+		},
+		DefaultLimit: 5,
+		MaxLimit:     100,
+		TopK:         100,
+	}
+}
+
+func (c Config) Print() {
+	fmt.Printf("DVM\n")
+	fmt.Printf("  Relays: %v\n", c.Relays)
+	fmt.Printf("  DefaultLimit: %d\n", c.DefaultLimit)
+	fmt.Printf("  MaxLimit: %d\n", c.MaxLimit)
+	fmt.Printf("  TopK: %d\n", c.TopK)
+}
+
+// DVM() connects to config.Relays, listens for job requests and publishes the
+// results to the same relays.
+func DVM(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore) {
+
+	pool := nostr.NewSimplePool(ctx)
+	defer crawler.CloseRelays(config.Log, pool, "DVM")
+
+	publisher := PoolPublisher{Pool: pool, Relays: config.Relays}
+	requests := make(chan *nostr.Event, 100)
+
+	go func() {
+		defer close(requests)
+
+		ts := nostr.Now()
+		filters := nostr.Filters{{
+			Kinds: []int{KindRecommendFollows, KindRankProfiles},
+			Since: &ts,
+		}}
+
+		for event := range pool.SubMany(ctx, config.Relays, filters) {
+			select {
+			case requests <- event.Event:
+			default:
+				config.Log.Warn("DVM: Channel is full, dropping job request %v by %v", event.ID, event.PubKey)
+			}
+		}
+	}()
+
+	Serve(ctx, config, DB, RWS, requests, publisher)
+}
+
+// Serve() answers the job requests from the channel, and publishes the results
+// using the publisher. It returns when the context is cancelled or the channel is closed.
+func Serve(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	requests <-chan *nostr.Event,
+	publisher Publisher) {
+
+	pubkey, err := nostr.GetPublicKey(config.PrivateKey)
+	if err != nil {
+		config.Log.Error("DVM: invalid private key: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			config.Log.Info("  > Stopping the DVM... ")
+			return
+
+		case request, ok := <-requests:
+			if !ok {
+				config.Log.Warn("DVM: request queue closed, stopped processing.")
+				return
+			}
+
+			if request == nil || !isAddressedTo(request, pubkey) {
+				continue
+			}
+
+			response, err := Respond(ctx, config, DB, RWS, request)
+			if err != nil {
+				config.Log.Error("DVM: failed to respond to %s: %v", request.ID, err)
+				continue
+			}
+
+			if err := publisher.Publish(ctx, response); err != nil {
+				config.Log.Error("DVM: failed to publish the response to %s: %v", request.ID, err)
+			}
+		}
+	}
+}
+
+// Respond() computes the result of the job request, and returns the signed result
+// event. If the job fails, it returns a signed feedback event with status "error".
+func Respond(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	request *nostr.Event) (*nostr.Event, error) {
+
+	var ranks []Rank
+	var err error
+
+	switch request.Kind {
+	case KindRankProfiles:
+		ranks, err = RankProfiles(ctx, config, DB, RWS, ParseParams(request))
+
+	case KindRecommendFollows:
+		ranks, err = RecommendFollows(ctx, config, DB, RWS, ParseParams(request))
+
+	default:
+		err = fmt.Errorf("%w: %d", ErrUnsupportedKind, request.Kind)
+	}
+
+	if err != nil {
+		return Feedback(config, request, err)
+	}
+
+	return Result(config, request, ranks)
+}
+
+// Rank associates a pubkey with its pagerank score. It's the unit of the result content.
+type Rank struct {
+	Pubkey string  `json:"pubkey"`
+	Rank   float64 `json:"rank"`
+}
+
+// Params are the parameters of a job request, specified in tags of the form ["param", <key>, <value>].
+type Params map[string][]string
+
+// Get() returns the first value of the key, or "" if not present.
+func (p Params) Get(key string) string {
+	if len(p[key]) == 0 {
+		return ""
+	}
+	return p[key][0]
+}
+
+// Limit() returns the "limit" param, defaulting to config.DefaultLimit and bounded by config.MaxLimit.
+func (p Params) Limit(config Config) (int, error) {
+	val := p.Get("limit")
+	if val == "" {
+		return config.DefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(val)
+	if err != nil || limit <= 0 || limit > config.MaxLimit {
+		return 0, fmt.Errorf("%w: must be in [1, %d]", ErrInvalidLimit, config.MaxLimit)
+	}
+
+	return limit, nil
+}
+
+// ParseParams() returns the params of the job request. Badly formatted tags are ignored.
+func ParseParams(request *nostr.Event) Params {
+	params := make(Params)
+	for _, tag := range request.Tags {
+		if len(tag) < 3 || tag[0] != "param" {
+			continue
+		}
+
+		params[tag[1]] = append(params[tag[1]], tag[2])
+	}
+
+	return params
+}
+
+// RankProfiles() ranks the targets by their personalized pagerank relative to
+// the source. If the source is not specified, the global pagerank is used.
+// Unknown targets have a rank of 0. The result is sorted in descending order.
+func RankProfiles(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	params Params) ([]Rank, error) {
+
+	targets := params["target"]
+	if len(targets) == 0 {
+		return nil, ErrMissingTarget
+	}
+
+	if len(targets) > config.MaxLimit {
+		return nil, fmt.Errorf("%w: max is %d", ErrTooManyTargets, config.MaxLimit)
+	}
+
+	IDs, err := DB.NodeIDs(ctx, targets...)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIDs := make([]uint32, 0, len(IDs))
+	for _, ID := range IDs {
+		if ID != nil {
+			nodeIDs = append(nodeIDs, *ID)
+		}
+	}
+
+	var scores models.PagerankMap
+	if source := params.Get("source"); source == "" {
+		scores, err = pagerank.Global(ctx, RWS, nodeIDs...)
+		if err != nil && !errors.Is(err, models.ErrEmptyRWS) {
+			return nil, err
+		}
+
+	} else {
+		sourceID, err := resolve(ctx, DB, source)
+		if err != nil {
+			return nil, err
+		}
+
+		scores, err = pagerank.Personalized(ctx, config.Rand, DB, RWS, sourceID, config.TopK)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ranks := make([]Rank, len(targets))
+	for i, ID := range IDs {
+		ranks[i] = Rank{Pubkey: targets[i]}
+		if ID != nil {
+			ranks[i].Rank = scores[*ID]
+		}
+	}
+
+	slices.SortStableFunc(ranks, func(r1, r2 Rank) int {
+		switch {
+		case r1.Rank > r2.Rank:
+			return -1
+		case r1.Rank < r2.Rank:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return ranks, nil
+}
+
+// RecommendFollows() returns up to limit pubkeys with the highest personalized
+// pagerank relative to the source, excluding the source and its follows.
+func RecommendFollows(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	params Params) ([]Rank, error) {
+
+	limit, err := params.Limit(config)
+	if err != nil {
+		return nil, err
+	}
+
+	source := params.Get("source")
+	if source == "" {
+		return nil, ErrMissingSource
+	}
+
+	recs, err := pagerank.Recommend(ctx, config.Rand, DB, RWS, source, config.TopK)
+	if err != nil {
+		return nil, err
+	}
+
+	ranks := make([]Rank, 0, min(len(recs), limit))
+	for _, rec := range recs[:min(len(recs), limit)] {
+		ranks = append(ranks, Rank{Pubkey: rec.Pubkey, Rank: rec.Score})
+	}
+
+	return ranks, nil
+}
+
+// Result() returns the signed job result event, whose content is the JSON encoded ranks.
+func Result(config Config, request *nostr.Event, ranks []Rank) (*nostr.Event, error) {
+	content, err := json.Marshal(ranks)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &nostr.Event{
+		Kind:      request.Kind + resultOffset,
+		CreatedAt: nostr.Now(),
+		Content:   string(content),
+		Tags: nostr.Tags{
+			{"e", request.ID},
+			{"p", request.PubKey},
+			{"request", string(jsonRequest)},
+		},
+	}
+
+	if err := result.Sign(config.PrivateKey); err != nil {
+		return nil, fmt.Errorf("failed to sign the result: %w", err)
+	}
+
+	return result, nil
+}
+
+// Feedback() returns the signed job feedback event with status "error", containing the cause.
+func Feedback(config Config, request *nostr.Event, cause error) (*nostr.Event, error) {
+	feedback := &nostr.Event{
+		Kind:      KindJobFeedback,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"status", "error", cause.Error()},
+			{"e", request.ID},
+			{"p", request.PubKey},
+		},
+	}
+
+	if err := feedback.Sign(config.PrivateKey); err != nil {
+		return nil, fmt.Errorf("failed to sign the feedback: %w", err)
+	}
+
+	return feedback, nil
+}
+
+// ------------------------------------HELPERS----------------------------------
+
+// isAddressedTo() returns whether the request is addressed to the pubkey.
+// Requests that don't specify any service provider ("p" tag) are addressed to everyone.
+func isAddressedTo(request *nostr.Event, pubkey string) bool {
+	var providers int
+	for _, tag := range request.Tags {
+		if len(tag) < 2 || tag[0] != "p" {
+			continue
+		}
+
+		if tag[1] == pubkey {
+			return true
+		}
+		providers++
+	}
+
+	return providers == 0
+}
+
+// resolve() returns the nodeID of the pubkey, or an error if not found.
+func resolve(ctx context.Context, DB models.Database, pubkey string) (uint32, error) {
+	if pubkey == "" {
+		return 0, ErrMissingSource
+	}
+
+	IDs, err := DB.NodeIDs(ctx, pubkey)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(IDs) != 1 || IDs[0] == nil {
+		return 0, fmt.Errorf("%w: %s", models.ErrNodeNotFoundDB, pubkey)
+	}
+
+	return *IDs[0], nil
+}
+
+//---------------------------------ERROR-CODES---------------------------------
+
+var (
+	ErrUnsupportedKind = errors.New("unsupported job kind")
+	ErrMissingSource   = errors.New("missing source param")
+	ErrMissingTarget   = errors.New("missing target param")
+	ErrTooManyTargets  = errors.New("too many targets")
+	ErrInvalidLimit    = errors.New("invalid limit param")
+)
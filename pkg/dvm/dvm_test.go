@@ -0,0 +1,263 @@
+package dvm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+// relay is an in-process stand-in relay that stores the published events.
+type relay struct {
+	mu     sync.Mutex
+	events []*nostr.Event
+}
+
+func (r *relay) Publish(ctx context.Context, event *nostr.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *relay) Events() []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events
+}
+
+func setupConfig() Config {
+	config := NewConfig()
+	config.Log = logger.New(os.Stdout)
+	config.PrivateKey = nostr.GeneratePrivateKey()
+	return config
+}
+
+func jobRequest(kind int, tags ...nostr.Tag) *nostr.Event {
+	request := &nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+	}
+	request.Sign(nostr.GeneratePrivateKey())
+	return request
+}
+
+func TestParseParams(t *testing.T) {
+	request := &nostr.Event{
+		Tags: nostr.Tags{
+			{"param", "source", "0"},
+			{"param", "target", "1"},
+			{"param", "target", "2"},
+			{"param", "limit"},
+			{"p", "0"},
+		},
+	}
+
+	expected := Params{
+		"source": {"0"},
+		"target": {"1", "2"},
+	}
+
+	params := ParseParams(request)
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("ParseParams(): expected %v, got %v", expected, params)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        Params
+		expectedLimit int
+		expectedError error
+	}{
+		{
+			name:          "default",
+			params:        Params{},
+			expectedLimit: 5,
+		},
+		{
+			name:          "invalid",
+			params:        Params{"limit": {"abc"}},
+			expectedError: ErrInvalidLimit,
+		},
+		{
+			name:          "too big",
+			params:        Params{"limit": {"1000"}},
+			expectedError: ErrInvalidLimit,
+		},
+		{
+			name:          "valid",
+			params:        Params{"limit": {"10"}},
+			expectedLimit: 10,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			limit, err := test.params.Limit(NewConfig())
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Limit(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if limit != test.expectedLimit {
+				t.Errorf("Limit(): expected %d, got %d", test.expectedLimit, limit)
+			}
+		})
+	}
+}
+
+func TestRankProfiles(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        Params
+		expectedRanks []Rank
+		expectedError error
+	}{
+		{
+			name:          "missing target",
+			params:        Params{},
+			expectedError: ErrMissingTarget,
+		},
+		{
+			name:   "global",
+			params: Params{"target": {"69", "1"}},
+			expectedRanks: []Rank{
+				{Pubkey: "1", Rank: 1.0 / 3.0},
+				{Pubkey: "69", Rank: 0},
+			},
+		},
+		{
+			name:          "source not found",
+			params:        Params{"target": {"1"}, "source": {"69"}},
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := mockdb.SetupDB("triangle")
+			RWS := mockstore.SetupRWS("triangle")
+
+			ranks, err := RankProfiles(ctx, setupConfig(), DB, RWS, test.params)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("RankProfiles(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if !reflect.DeepEqual(ranks, test.expectedRanks) {
+				t.Errorf("RankProfiles(): expected %v, got %v", test.expectedRanks, ranks)
+			}
+		})
+	}
+}
+
+func TestRecommendFollows(t *testing.T) {
+	testCases := []struct {
+		name            string
+		params          Params
+		expectedPubkeys []string
+		expectedError   error
+	}{
+		{
+			name:          "missing source",
+			params:        Params{},
+			expectedError: ErrMissingSource,
+		},
+		{
+			name:          "source not found",
+			params:        Params{"source": {"69"}},
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:            "valid",
+			params:          Params{"source": {"0"}},
+			expectedPubkeys: []string{"2"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := mockdb.SetupDB("triangle")
+			RWS := mockstore.SetupRWS("triangle")
+
+			ranks, err := RecommendFollows(ctx, setupConfig(), DB, RWS, test.params)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("RecommendFollows(): expected %v, got %v", test.expectedError, err)
+			}
+
+			var pubkeys []string
+			for _, rank := range ranks {
+				pubkeys = append(pubkeys, rank.Pubkey)
+			}
+
+			if !reflect.DeepEqual(pubkeys, test.expectedPubkeys) {
+				t.Errorf("RecommendFollows(): expected %v, got %v", test.expectedPubkeys, pubkeys)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	config := setupConfig()
+	DB := mockdb.SetupDB("triangle")
+	RWS := mockstore.SetupRWS("triangle")
+	relay := &relay{}
+
+	pubkey, err := nostr.GetPublicKey(config.PrivateKey)
+	if err != nil {
+		t.Fatalf("GetPublicKey(): %v", err)
+	}
+
+	requests := make(chan *nostr.Event, 10)
+	requests <- jobRequest(KindRankProfiles, nostr.Tag{"param", "target", "0"})
+	requests <- jobRequest(KindRankProfiles, nostr.Tag{"p", "someone-else"}, nostr.Tag{"param", "target", "0"})
+	requests <- jobRequest(KindRecommendFollows, nostr.Tag{"p", pubkey})
+	close(requests)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	Serve(ctx, config, DB, RWS, requests, relay)
+
+	events := relay.Events()
+	if len(events) != 2 {
+		t.Fatalf("Serve(): expected 2 events, got %d", len(events))
+	}
+
+	expectedKinds := []int{KindRankProfiles + 1000, KindJobFeedback}
+	for i, event := range events {
+		if event.Kind != expectedKinds[i] {
+			t.Errorf("Serve(): expected kind %d, got %d", expectedKinds[i], event.Kind)
+		}
+
+		if event.PubKey != pubkey {
+			t.Errorf("Serve(): expected pubkey %s, got %s", pubkey, event.PubKey)
+		}
+
+		if ok, err := event.CheckSignature(); !ok || err != nil {
+			t.Errorf("Serve(): invalid signature: %v", err)
+		}
+	}
+
+	var ranks []Rank
+	if err := json.Unmarshal([]byte(events[0].Content), &ranks); err != nil {
+		t.Fatalf("failed to decode the result: %v", err)
+	}
+
+	expected := []Rank{{Pubkey: "0", Rank: 1.0 / 3.0}}
+	if !reflect.DeepEqual(ranks, expected) {
+		t.Errorf("Serve(): expected %v, got %v", expected, ranks)
+	}
+}
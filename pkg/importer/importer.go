@@ -0,0 +1,395 @@
+/*
+The importer package seeds the database and the random walk store from a dump
+of follow-lists (kind:3), without relying on the network.
+
+The dump is newline-delimited, and each line is either a raw event in JSON, or
+a NIP-01 relay message like ["EVENT", <subscription_id>, <event>].
+Only events with a valid signature are considered, and for each author only the
+newest follow-list is kept.
+*/
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/crawler"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/sliceutils"
+	"github.com/vertex-lab/crawler/pkg/walks"
+)
+
+type Config struct {
+	Log         *logger.Aggregate
+	BatchSize   int // the number of pubkeys resolved or added to the database at once
+	MaxLineSize int // in bytes. Longer lines are counted as malformed
+	PrintEvery  int // the number of lines (or authors) after which the progress is logged
+	Generate    walks.GenerateConfig
+}
+
+func NewConfig() Config {
+	log := logger.New(os.Stdout)
+	generate := walks.NewGenerateConfig()
+	generate.Log = log
+
+	return Config{
+		Log:         log,
+		BatchSize:   10000,
+		MaxLineSize: 16 * 1024 * 1024,
+		PrintEvery:  100000,
+		Generate:    generate,
+	}
+}
+
+func (c Config) Print() {
+	fmt.Printf("Import\n")
+	fmt.Printf("  BatchSize: %d\n", c.BatchSize)
+	fmt.Printf("  MaxLineSize: %d\n", c.MaxLineSize)
+	fmt.Printf("  PrintEvery: %d\n", c.PrintEvery)
+	c.Generate.Print()
+}
+
+// Stats summarizes what happened during an import.
+type Stats struct {
+	Lines      int // total lines read, including the empty ones
+	Malformed  int // lines that couldn't be parsed into an event
+	Skipped    int // events that are not follow-lists
+	Invalid    int // follow-lists with an invalid ID or signature
+	Superseded int // follow-lists replaced by a newer one from the same author
+	Authors    int // authors with a valid follow-list
+	Nodes      int // nodes added to the database
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("lines %d, malformed %d, skipped %d, invalid %d, superseded %d, authors %d, nodes added %d",
+		s.Lines, s.Malformed, s.Skipped, s.Invalid, s.Superseded, s.Authors, s.Nodes)
+}
+
+/*
+Import() reads the dump of follow-lists and builds the whole graph in the database.
+Then, the authors of the follow-lists are promoted and their random walks are generated with [walks.GenerateAll].
+The NodeArbiter will later promote the followed pubkeys whose pagerank is high enough,
+and demote the authors whose pagerank is too low.
+
+The RWS must be empty, otherwise the generated walks would duplicate the existing ones.
+*/
+func Import(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	dump io.Reader) (Stats, error) {
+
+	if err := DB.Validate(); err != nil {
+		return Stats{}, fmt.Errorf("Import(): DB validation failed: %w", err)
+	}
+
+	if err := RWS.Validate(); err != nil {
+		return Stats{}, fmt.Errorf("Import(): RWS validation failed: %w", err)
+	}
+
+	if RWS.TotalVisits(ctx) > 0 {
+		return Stats{}, fmt.Errorf("Import(): %w", models.ErrNonEmptyRWS)
+	}
+
+	followLists, stats, err := Read(config, dump)
+	if err != nil {
+		return stats, fmt.Errorf("Import(): %w", err)
+	}
+	config.Log.Info("read the dump: %v", stats)
+
+	authors, added, err := Build(ctx, config, DB, followLists)
+	stats.Nodes = added
+	if err != nil {
+		return stats, fmt.Errorf("Import(): %w", err)
+	}
+	config.Log.Info("built the graph: %d nodes added", stats.Nodes)
+
+	if err := Promote(ctx, config, DB, authors); err != nil {
+		return stats, fmt.Errorf("Import(): %w", err)
+	}
+
+	if err := walks.GenerateAll(ctx, config.Generate, DB, RWS); err != nil {
+		return stats, fmt.Errorf("Import(): %w", err)
+	}
+	config.Log.Info("generated the random walks")
+
+	return stats, nil
+}
+
+// Read() parses the dump and returns a map that associates each author with
+// its newest valid follow-list.
+func Read(config Config, dump io.Reader) (map[string]*nostr.Event, Stats, error) {
+	var stats Stats
+	followLists := make(map[string]*nostr.Event)
+
+	scanner := bufio.NewScanner(dump)
+	scanner.Buffer(make([]byte, 0, 64*1024), config.MaxLineSize)
+
+	for scanner.Scan() {
+		stats.Lines++
+		if config.PrintEvery > 0 && stats.Lines%config.PrintEvery == 0 {
+			config.Log.Info("read %d lines", stats.Lines)
+		}
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		event, err := ParseLine(line)
+		if err != nil {
+			stats.Malformed++
+			continue
+		}
+
+		if event.Kind != nostr.KindFollowList {
+			stats.Skipped++
+			continue
+		}
+
+		if !IsValid(event) {
+			stats.Invalid++
+			continue
+		}
+
+		old, exists := followLists[event.PubKey]
+		switch {
+		case !exists:
+			followLists[event.PubKey] = event
+
+		case IsNewer(event, old):
+			followLists[event.PubKey] = event
+			stats.Superseded++
+
+		default:
+			stats.Superseded++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, stats, fmt.Errorf("failed to read line %d: %w", stats.Lines+1, err)
+	}
+
+	stats.Authors = len(followLists)
+	return followLists, stats, nil
+}
+
+// ParseLine() parses a line of the dump, which is either a raw event or a
+// NIP-01 relay message ["EVENT", <subscription_id>, <event>].
+func ParseLine(line []byte) (*nostr.Event, error) {
+	var raw json.RawMessage = line
+	if line[0] == '[' {
+		var message []json.RawMessage
+		if err := json.Unmarshal(line, &message); err != nil {
+			return nil, err
+		}
+
+		if len(message) < 2 || string(message[0]) != `"EVENT"` {
+			return nil, ErrNotAnEvent
+		}
+
+		raw = message[len(message)-1]
+	}
+
+	event := &nostr.Event{}
+	if err := json.Unmarshal(raw, event); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// IsValid() returns whether the event ID and signature are valid.
+func IsValid(event *nostr.Event) bool {
+	if !event.CheckID() {
+		return false
+	}
+
+	valid, err := event.CheckSignature()
+	return err == nil && valid
+}
+
+// IsNewer() returns whether event1 replaces event2, following NIP-01:
+// the newest wins, and in case of ties the one with the lowest ID.
+func IsNewer(event1, event2 *nostr.Event) bool {
+	if event1.CreatedAt != event2.CreatedAt {
+		return event1.CreatedAt > event2.CreatedAt
+	}
+	return event1.ID < event2.ID
+}
+
+/*
+Build() adds the authors and their follows to the database, and then updates the
+follow relationships of the authors. Both are done in batches of config.BatchSize.
+It returns the nodeIDs of the authors, and the number of nodes added.
+*/
+func Build(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	followLists map[string]*nostr.Event) ([]uint32, int, error) {
+
+	// all the unique and valid pubkeys that appear in the dump
+	pubkeys := make([]string, 0, len(followLists))
+	authors := make([]string, 0, len(followLists))
+	follows := make(map[string][]string, len(followLists))
+	seen := make(map[string]struct{}, len(followLists))
+
+	add := func(pk string) {
+		if _, ok := seen[pk]; !ok {
+			seen[pk] = struct{}{}
+			pubkeys = append(pubkeys, pk)
+		}
+	}
+
+	for author, event := range followLists {
+		add(author)
+		authors = append(authors, author)
+		for _, pk := range crawler.ParsePubkeys(event) {
+			if !nostr.IsValidPublicKey(pk) {
+				continue
+			}
+
+			add(pk)
+			follows[author] = append(follows[author], pk)
+		}
+	}
+
+	IDs, added, err := resolve(ctx, config, DB, pubkeys)
+	if err != nil {
+		return nil, added, err
+	}
+
+	authorIDs := make([]uint32, len(authors))
+	for i, author := range authors {
+		authorIDs[i] = IDs[author]
+	}
+
+	batchSize := max(config.BatchSize, 1)
+	for start := 0; start < len(authors); start += batchSize {
+		end := min(start+batchSize, len(authors))
+
+		oldFollows, err := DB.Follows(ctx, authorIDs[start:end]...)
+		if err != nil {
+			return nil, added, fmt.Errorf("failed to fetch the follows of %d authors: %w", end-start, err)
+		}
+
+		deltas := make([]*models.Delta, 0, end-start)
+		for i, author := range authors[start:end] {
+			newFollows := make([]uint32, 0, len(follows[author]))
+			for _, pk := range follows[author] {
+				newFollows = append(newFollows, IDs[pk])
+			}
+
+			removed, _, inserted := sliceutils.Partition(oldFollows[i], sliceutils.Unique(newFollows))
+			if len(removed) == 0 && len(inserted) == 0 {
+				continue
+			}
+
+			deltas = append(deltas, &models.Delta{
+				Kind:    nostr.KindFollowList,
+				NodeID:  IDs[author],
+				Added:   inserted,
+				Removed: removed,
+			})
+		}
+
+		if err := DB.Update(ctx, deltas...); err != nil {
+			return nil, added, fmt.Errorf("failed to update the follows of %d authors: %w", len(deltas), err)
+		}
+
+		if config.PrintEvery > 0 && start/config.PrintEvery != end/config.PrintEvery {
+			config.Log.Info("updated the follows of %d/%d authors", end, len(authors))
+		}
+	}
+
+	return authorIDs, added, nil
+}
+
+// resolve() returns a map that associates each pubkey with its nodeID, adding
+// to the database in batches the pubkeys that are not found. It also returns the number of nodes added.
+func resolve(
+	ctx context.Context,
+	config Config,
+	DB models.Database,
+	pubkeys []string) (map[string]uint32, int, error) {
+
+	batchSize := max(config.BatchSize, 1)
+	IDs := make(map[string]uint32, len(pubkeys))
+	var added int
+
+	for start := 0; start < len(pubkeys); start += batchSize {
+		batch := pubkeys[start:min(start+batchSize, len(pubkeys))]
+
+		found, err := DB.NodeIDs(ctx, batch...)
+		if err != nil {
+			return nil, added, fmt.Errorf("failed to fetch the IDs: %w", err)
+		}
+
+		missing := make([]string, 0, len(batch))
+		for i, ID := range found {
+			if ID == nil {
+				missing = append(missing, batch[i])
+				continue
+			}
+			IDs[batch[i]] = *ID
+		}
+
+		newIDs, err := DB.AddNodes(ctx, missing...)
+		if err != nil {
+			return nil, added, fmt.Errorf("failed to add %d nodes: %w", len(missing), err)
+		}
+
+		for i, ID := range newIDs {
+			IDs[missing[i]] = ID
+		}
+		added += len(newIDs)
+	}
+
+	return IDs, added, nil
+}
+
+// Promote() promotes the inactive nodes among the nodeIDs, without generating their walks.
+// Their statuses are fetched and updated in batches of config.BatchSize.
+func Promote(ctx context.Context, config Config, DB models.Database, nodeIDs []uint32) error {
+	batchSize := max(config.BatchSize, 1)
+	for start := 0; start < len(nodeIDs); start += batchSize {
+		batch := nodeIDs[start:min(start+batchSize, len(nodeIDs))]
+
+		nodes, err := DB.Nodes(ctx, batch...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %d nodes: %w", len(batch), err)
+		}
+
+		deltas := make([]*models.Delta, 0, len(batch))
+		for i, node := range nodes {
+			if node == nil {
+				return fmt.Errorf("failed to fetch node %d: %w", batch[i], models.ErrNodeNotFoundDB)
+			}
+
+			if node.Status == models.StatusActive {
+				continue
+			}
+
+			deltas = append(deltas, &models.Delta{Kind: models.Promotion, NodeID: node.ID})
+		}
+
+		if err := DB.Update(ctx, deltas...); err != nil {
+			return fmt.Errorf("failed to promote %d nodes: %w", len(deltas), err)
+		}
+	}
+
+	return nil
+}
+
+//--------------------------------ERROR-CODES-----------------------------------
+
+var ErrNotAnEvent = errors.New("the relay message is not an EVENT")
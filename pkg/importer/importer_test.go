@@ -0,0 +1,267 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+)
+
+// signedFollowList() returns a valid follow-list signed by sk.
+func signedFollowList(t *testing.T, sk string, createdAt nostr.Timestamp, follows ...string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: nostr.KindFollowList, CreatedAt: createdAt, Tags: nostr.Tags{}}
+	for _, pk := range follows {
+		event.Tags = append(event.Tags, nostr.Tag{"p", pk})
+	}
+
+	if err := event.Sign(sk); err != nil {
+		t.Fatalf("Sign(): expected nil, got %v", err)
+	}
+	return event
+}
+
+func pubkey(t *testing.T, sk string) string {
+	t.Helper()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatalf("GetPublicKey(): expected nil, got %v", err)
+	}
+	return pk
+}
+
+func testConfig() Config {
+	config := NewConfig()
+	config.Log = logger.New(os.Stdout)
+	config.BatchSize = 2
+	return config
+}
+
+func TestParseLine(t *testing.T) {
+	testCases := []struct {
+		name          string
+		line          string
+		expectedID    string
+		expectedError bool
+	}{
+		{
+			name:          "invalid json",
+			line:          "{not json",
+			expectedError: true,
+		},
+		{
+			name:          "not an EVENT message",
+			line:          `["EOSE","sub"]`,
+			expectedError: true,
+		},
+		{
+			name:       "raw event",
+			line:       `{"id":"abc","kind":3}`,
+			expectedID: "abc",
+		},
+		{
+			name:       "relay message",
+			line:       `["EVENT","sub",{"id":"abc","kind":3}]`,
+			expectedID: "abc",
+		},
+		{
+			name:       "relay message without subscription",
+			line:       `["EVENT",{"id":"abc","kind":3}]`,
+			expectedID: "abc",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := ParseLine([]byte(test.line))
+			if (err != nil) != test.expectedError {
+				t.Fatalf("ParseLine(): expected error %v, got %v", test.expectedError, err)
+			}
+
+			if err == nil && event.ID != test.expectedID {
+				t.Errorf("ParseLine(): expected ID %v, got %v", test.expectedID, event.ID)
+			}
+		})
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	testCases := []struct {
+		name     string
+		event1   *nostr.Event
+		event2   *nostr.Event
+		expected bool
+	}{
+		{
+			name:     "older",
+			event1:   &nostr.Event{ID: "a", CreatedAt: 1},
+			event2:   &nostr.Event{ID: "b", CreatedAt: 2},
+			expected: false,
+		},
+		{
+			name:     "newer",
+			event1:   &nostr.Event{ID: "b", CreatedAt: 2},
+			event2:   &nostr.Event{ID: "a", CreatedAt: 1},
+			expected: true,
+		},
+		{
+			name:     "tie, lower ID",
+			event1:   &nostr.Event{ID: "a", CreatedAt: 1},
+			event2:   &nostr.Event{ID: "b", CreatedAt: 1},
+			expected: true,
+		},
+		{
+			name:     "tie, higher ID",
+			event1:   &nostr.Event{ID: "b", CreatedAt: 1},
+			event2:   &nostr.Event{ID: "a", CreatedAt: 1},
+			expected: false,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if newer := IsNewer(test.event1, test.event2); newer != test.expected {
+				t.Errorf("IsNewer(): expected %v, got %v", test.expected, newer)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	sk0, sk1 := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	pk0, pk1 := pubkey(t, sk0), pubkey(t, sk1)
+
+	old := signedFollowList(t, sk0, 1, pk1)
+	newest := signedFollowList(t, sk0, 2)
+	valid := signedFollowList(t, sk1, 1, pk0)
+
+	tampered := signedFollowList(t, sk1, 3)
+	tampered.Tags = nostr.Tags{{"p", pk1}}
+
+	metadata := &nostr.Event{Kind: nostr.KindProfileMetadata, CreatedAt: 1}
+	if err := metadata.Sign(sk0); err != nil {
+		t.Fatalf("Sign(): expected nil, got %v", err)
+	}
+
+	lines := []string{
+		old.String(),
+		"",
+		`["EVENT","sub",` + newest.String() + `]`,
+		"garbage",
+		valid.String(),
+		tampered.String(),
+		metadata.String(),
+	}
+
+	followLists, stats, err := Read(testConfig(), strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("Read(): expected nil, got %v", err)
+	}
+
+	expectedStats := Stats{Lines: 7, Malformed: 1, Skipped: 1, Invalid: 1, Superseded: 1, Authors: 2}
+	if stats != expectedStats {
+		t.Errorf("Read(): expected stats %v, got %v", expectedStats, stats)
+	}
+
+	if followLists[pk0].ID != newest.ID {
+		t.Errorf("Read(): expected the newest follow-list %v, got %v", newest.ID, followLists[pk0].ID)
+	}
+
+	if followLists[pk1].ID != valid.ID {
+		t.Errorf("Read(): expected follow-list %v, got %v", valid.ID, followLists[pk1].ID)
+	}
+}
+
+func TestImport(t *testing.T) {
+	t.Run("non-empty RWS", func(t *testing.T) {
+		_, err := Import(context.Background(), testConfig(), mockdb.SetupDB("one-node0"), mockstore.SetupRWS("one-node0"), strings.NewReader(""))
+		if !errors.Is(err, models.ErrNonEmptyRWS) {
+			t.Fatalf("Import(): expected %v, got %v", models.ErrNonEmptyRWS, err)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		ctx := context.Background()
+		sk0, sk1, sk2 := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+		pk0, pk1, pk2 := pubkey(t, sk0), pubkey(t, sk1), pubkey(t, sk2)
+		pk3 := pubkey(t, nostr.GeneratePrivateKey()) // followed, but not an author
+
+		// 0 --> 1 <--> 2
+		// 0 --> 3
+		lines := []string{
+			signedFollowList(t, sk0, 1, pk1, pk1, pk0, pk3, "invalid").String(),
+			signedFollowList(t, sk1, 1, pk2).String(),
+			signedFollowList(t, sk2, 1, pk1).String(),
+		}
+
+		DB := mockdb.SetupDB("empty")
+		RWS := mockstore.SetupRWS("empty")
+
+		stats, err := Import(ctx, testConfig(), DB, RWS, strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			t.Fatalf("Import(): expected nil, got %v", err)
+		}
+
+		if stats.Authors != 3 || stats.Nodes != 4 {
+			t.Errorf("Import(): expected 3 authors and 4 nodes, got %v", stats)
+		}
+
+		IDs, err := DB.NodeIDs(ctx, pk0, pk1, pk2, pk3)
+		if err != nil {
+			t.Fatalf("NodeIDs(): expected nil, got %v", err)
+		}
+
+		// only the authors are promoted
+		expectedStatus := []string{models.StatusActive, models.StatusActive, models.StatusActive, models.StatusInactive}
+		for i, ID := range IDs {
+			if ID == nil {
+				t.Fatalf("Import(): expected all pubkeys in the DB, got %v", IDs)
+			}
+
+			node, err := DB.NodeByID(ctx, *ID)
+			if err != nil {
+				t.Fatalf("NodeByID(): expected nil, got %v", err)
+			}
+
+			if node.Status != expectedStatus[i] {
+				t.Errorf("Import(): expected node %d to be %v, got %v", *ID, expectedStatus[i], node.Status)
+			}
+		}
+
+		follows, err := DB.Follows(ctx, *IDs[0], *IDs[1], *IDs[2])
+		if err != nil {
+			t.Fatalf("Follows(): expected nil, got %v", err)
+		}
+
+		for i := range follows {
+			slices.Sort(follows[i])
+		}
+
+		expectedFollows := [][]uint32{{*IDs[1], *IDs[3]}, {*IDs[2]}, {*IDs[1]}}
+		slices.Sort(expectedFollows[0])
+		if !reflect.DeepEqual(follows, expectedFollows) {
+			t.Errorf("Import(): expected follows %v, got %v", expectedFollows, follows)
+		}
+
+		// each node has at least the visits of its own walks
+		visits, err := RWS.VisitCounts(ctx, *IDs[0], *IDs[1], *IDs[2])
+		if err != nil {
+			t.Fatalf("VisitCounts(): expected nil, got %v", err)
+		}
+
+		for i, v := range visits {
+			if v < int(RWS.WalksPerNode(ctx)) {
+				t.Errorf("Import(): expected at least %d visits for node %d, got %d", RWS.WalksPerNode(ctx), *IDs[i], v)
+			}
+		}
+	})
+}
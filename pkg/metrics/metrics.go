@@ -0,0 +1,413 @@
+/*
+The metrics package implements counters, gauges and histograms that can be
+exposed over HTTP in the Prometheus text format, using only the standard library.
+
+Metrics are created through a Registry, which panics if a name is invalid or
+already in use, similarly to http.ServeMux.Handle.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The default buckets of histograms, in seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// family is a group of metrics with the same name, help and type.
+type family struct {
+	name  string
+	help  string
+	typ   string
+	write func(w *bufio.Writer, name string)
+}
+
+// Registry holds a set of metrics, and writes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry() returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+func (r *Registry) register(f *family) {
+	if !validName.MatchString(f.name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", f.name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.families[f.name]; exists {
+		panic(fmt.Sprintf("metrics: metric %q is already registered", f.name))
+	}
+	r.families[f.name] = f
+}
+
+func validateLabel(label string) {
+	if !validName.MatchString(label) || strings.Contains(label, ":") || label == "le" {
+		panic(fmt.Sprintf("metrics: invalid label name %q", label))
+	}
+}
+
+// NewCounter() registers and returns a new counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeCounter,
+		write: func(w *bufio.Writer, name string) {
+			writeSample(w, name, "", c.Value())
+		},
+	})
+	return c
+}
+
+// NewCounterVec() registers and returns a new set of counters, partitioned by the values of label.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	validateLabel(label)
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeCounter,
+		write: func(w *bufio.Writer, name string) {
+			v.mu.RLock()
+			defer v.mu.RUnlock()
+
+			for _, value := range sortedKeys(v.counters) {
+				writeSample(w, name, formatLabel(label, value), v.counters[value].Value())
+			}
+		},
+	})
+	return v
+}
+
+// NewGauge() registers and returns a new gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeGauge,
+		write: func(w *bufio.Writer, name string) {
+			writeSample(w, name, "", g.Value())
+		},
+	})
+	return g
+}
+
+// NewGaugeFunc() registers a gauge whose value is computed by calling fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeGauge,
+		write: func(w *bufio.Writer, name string) {
+			writeSample(w, name, "", fn())
+		},
+	})
+}
+
+// NewHistogram() registers and returns a new histogram with the specified upper bounds.
+// If buckets is empty, DefaultBuckets are used.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(buckets)
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeHistogram,
+		write: func(w *bufio.Writer, name string) {
+			h.write(w, name, "")
+		},
+	})
+	return h
+}
+
+// NewHistogramVec() registers and returns a new set of histograms, partitioned by the values of label.
+// If buckets is empty, DefaultBuckets are used.
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	validateLabel(label)
+	v := &HistogramVec{label: label, buckets: buckets, histograms: make(map[string]*Histogram)}
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typeHistogram,
+		write: func(w *bufio.Writer, name string) {
+			v.mu.RLock()
+			defer v.mu.RUnlock()
+
+			for _, value := range sortedKeys(v.histograms) {
+				v.histograms[value].write(w, name, formatLabel(label, value))
+			}
+		},
+	})
+	return v
+}
+
+// WriteTo() writes all the metrics to w in the Prometheus text format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: w}
+	buf := bufio.NewWriter(cw)
+	for _, f := range families {
+		fmt.Fprintf(buf, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.typ)
+		f.write(buf, f.name)
+	}
+
+	err := buf.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP() writes all the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	value atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() float64 {
+	return float64(c.value.Load())
+}
+
+// CounterVec is a set of counters, partitioned by the values of a label.
+type CounterVec struct {
+	label    string
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// With() returns the counter for the specified label value, creating it if needed.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, exists := v.counters[value]
+	v.mu.RUnlock()
+	if exists {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if c, exists = v.counters[value]; !exists {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+}
+
+func (g *Gauge) Add(delta float64) {
+	addFloat(&g.bits, delta)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts the observed values in cumulative buckets.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // counts[i] is the number of values in (bounds[i-1], bounds[i]]
+	count  atomic.Uint64
+	sum    atomic.Uint64 // the bits of a float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	if math.IsInf(bounds[len(bounds)-1], +1) {
+		bounds = bounds[:len(bounds)-1]
+	}
+
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	i, _ := slices.BinarySearch(h.bounds, value)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sum, value)
+}
+
+// Count() returns the number of observed values.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum() returns the sum of the observed values.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sum.Load())
+}
+
+func (h *Histogram) write(w *bufio.Writer, name, labels string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		writeSample(w, name+"_bucket", joinLabels(labels, formatLabel("le", formatFloat(bound))), float64(cumulative))
+	}
+
+	cumulative += h.counts[len(h.bounds)].Load()
+	writeSample(w, name+"_bucket", joinLabels(labels, formatLabel("le", "+Inf")), float64(cumulative))
+	writeSample(w, name+"_sum", labels, h.Sum())
+	writeSample(w, name+"_count", labels, float64(cumulative))
+}
+
+// HistogramVec is a set of histograms, partitioned by the values of a label.
+type HistogramVec struct {
+	label      string
+	buckets    []float64
+	mu         sync.RWMutex
+	histograms map[string]*Histogram
+}
+
+// With() returns the histogram for the specified label value, creating it if needed.
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.RLock()
+	h, exists := v.histograms[value]
+	v.mu.RUnlock()
+	if exists {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if h, exists = v.histograms[value]; !exists {
+		h = newHistogram(v.buckets)
+		v.histograms[value] = h
+	}
+	return h
+}
+
+// -----------------------------------HELPERS----------------------------------
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, +1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatLabel(label, value string) string {
+	return label + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func joinLabels(labels, other string) string {
+	if labels == "" {
+		return other
+	}
+	return labels + "," + other
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	counter := r.NewCounter("events_total", "The number of events.")
+	counter.Add(2)
+	counter.Inc()
+
+	vec := r.NewCounterVec("dropped_total", "The number of dropped events.", "producer")
+	vec.With("query").Inc()
+	vec.With("firehose").Add(5)
+	vec.With(`we"ird\`).Inc()
+
+	gauge := r.NewGauge("temperature", "The temperature\nin celsius.")
+	gauge.Set(1.5)
+	gauge.Add(-3)
+
+	r.NewGaugeFunc("queue_length", "The length of the queue.", func() float64 { return 7 })
+
+	histogram := r.NewHistogram("scan_seconds", "The duration of the scans.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.1)
+	histogram.Observe(2)
+
+	latency := r.NewHistogramVec("latency_seconds", "The latency.", "command", []float64{1})
+	latency.With("get").Observe(0.5)
+
+	expected := `# HELP dropped_total The number of dropped events.
+# TYPE dropped_total counter
+dropped_total{producer="firehose"} 5
+dropped_total{producer="query"} 1
+dropped_total{producer="we\"ird\\"} 1
+# HELP events_total The number of events.
+# TYPE events_total counter
+events_total 3
+# HELP latency_seconds The latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{command="get",le="1"} 1
+latency_seconds_bucket{command="get",le="+Inf"} 1
+latency_seconds_sum{command="get"} 0.5
+latency_seconds_count{command="get"} 1
+# HELP queue_length The length of the queue.
+# TYPE queue_length gauge
+queue_length 7
+# HELP scan_seconds The duration of the scans.
+# TYPE scan_seconds histogram
+scan_seconds_bucket{le="0.1"} 2
+scan_seconds_bucket{le="1"} 2
+scan_seconds_bucket{le="+Inf"} 3
+scan_seconds_sum 2.15
+scan_seconds_count 3
+# HELP temperature The temperature\nin celsius.
+# TYPE temperature gauge
+temperature -1.5
+`
+
+	builder := &strings.Builder{}
+	n, err := r.WriteTo(builder)
+	if err != nil {
+		t.Fatalf("WriteTo(): expected nil, got %v", err)
+	}
+
+	if builder.String() != expected {
+		t.Errorf("WriteTo(): expected\n%s\ngot\n%s", expected, builder.String())
+	}
+
+	if n != int64(len(expected)) {
+		t.Errorf("WriteTo(): expected %d bytes written, got %d", len(expected), n)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("events_total", "The number of events.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP(): expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("ServeHTTP(): expected Prometheus content type, got %q", ct)
+	}
+
+	if !strings.Contains(rec.Body.String(), "events_total 1\n") {
+		t.Errorf("ServeHTTP(): expected the counter in the body, got %q", rec.Body.String())
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		register func(r *Registry)
+	}{
+		{
+			name:     "invalid name",
+			register: func(r *Registry) { r.NewCounter("invalid-name", "") },
+		},
+		{
+			name:     "invalid label",
+			register: func(r *Registry) { r.NewCounterVec("valid", "", "le") },
+		},
+		{
+			name: "duplicate",
+			register: func(r *Registry) {
+				r.NewCounter("events_total", "")
+				r.NewGauge("events_total", "")
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic, got none")
+				}
+			}()
+
+			test.register(NewRegistry())
+		})
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	vec := r.NewCounterVec("events_total", "", "kind")
+	histogram := r.NewHistogram("latency_seconds", "", nil)
+	gauge := r.NewGauge("level", "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				vec.With("3").Inc()
+				histogram.Observe(1)
+				gauge.Add(1)
+			}
+			r.WriteTo(&strings.Builder{})
+		}()
+	}
+	wg.Wait()
+
+	if value := vec.With("3").Value(); value != 10000 {
+		t.Errorf("Counter: expected 10000, got %v", value)
+	}
+
+	if count, sum := histogram.Count(), histogram.Sum(); count != 10000 || sum != 10000 {
+		t.Errorf("Histogram: expected count and sum 10000, got %v and %v", count, sum)
+	}
+
+	if value := gauge.Value(); value != 10000 {
+		t.Errorf("Gauge: expected 10000, got %v", value)
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisHook is a redis.Hook that records the latency and the errors of the
+// commands sent to Redis. Pipelines are recorded as a single "pipeline" command.
+type RedisHook struct {
+	latency *HistogramVec
+	errors  *CounterVec
+}
+
+// NewRedisHook() registers the redis metrics and returns the hook that records them.
+// Add it to a client with client.AddHook(hook).
+func NewRedisHook(r *Registry) *RedisHook {
+	return &RedisHook{
+		latency: r.NewHistogramVec("redis_command_duration_seconds", "The latency of the Redis commands.", "command", nil),
+		errors:  r.NewCounterVec("redis_command_errors_total", "The number of failed Redis commands, excluding nil replies.", "command"),
+	}
+}
+
+func (h *RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.record(cmd.Name(), time.Since(start), err)
+		return err
+	}
+}
+
+func (h *RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.record("pipeline", time.Since(start), err)
+		return err
+	}
+}
+
+func (h *RedisHook) record(command string, latency time.Duration, err error) {
+	h.latency.With(command).Observe(latency.Seconds())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		h.errors.With(command).Inc()
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisHook(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	hook := NewRedisHook(r)
+
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{name: "success", err: nil},
+		{name: "nil reply", err: redis.Nil},
+		{name: "failure", err: errors.New("connection refused")},
+	}
+
+	for _, test := range testCases {
+		process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return test.err })
+		if err := process(ctx, redis.NewStringCmd(ctx, "get", "key")); !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error { return nil })
+	if err := pipeline(ctx, []redis.Cmder{redis.NewStringCmd(ctx, "get", "key")}); err != nil {
+		t.Fatalf("pipeline: expected nil, got %v", err)
+	}
+
+	if count := hook.latency.With("get").Count(); count != 3 {
+		t.Errorf("RedisHook: expected 3 get latencies, got %d", count)
+	}
+
+	if count := hook.latency.With("pipeline").Count(); count != 1 {
+		t.Errorf("RedisHook: expected 1 pipeline latency, got %d", count)
+	}
+
+	if errors := hook.errors.With("get").Value(); errors != 1 {
+		t.Errorf("RedisHook: expected 1 error, got %v", errors)
+	}
+}
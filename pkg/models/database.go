@@ -88,6 +88,16 @@ type Delta struct {
 	Added   []uint32
 }
 
+// Report represents a NIP-56 report (kind:1984) of a node by another node.
+type Report struct {
+	Reporter uint32
+	Reported uint32
+	Type     string // e.g. "spam", "impersonation", "nudity" ...
+}
+
+// ReportMap associates each report type with the nodeIDs of the reporters.
+type ReportMap map[string][]uint32
+
 type Database interface {
 	// Size() returns the number of nodes in the DB (ignores errors).
 	Size(ctx context.Context) int
@@ -101,14 +111,22 @@ type Database interface {
 	// NodeByID() retrieves a node by its nodeID.
 	NodeByID(ctx context.Context, nodeID uint32) (*Node, error)
 
+	// Nodes() retrieves the node of each nodeID in a single batch. If a nodeID is not found, nil is returned.
+	Nodes(ctx context.Context, nodeIDs ...uint32) ([]*Node, error)
+
 	// NodeByKey() retrieves a node by its pubkey.
 	NodeByKey(ctx context.Context, pubkey string) (*Node, error)
 
 	// AddNode() adds a node to the database and returns its assigned nodeID
 	AddNode(ctx context.Context, pubkey string) (uint32, error)
 
-	// Update() applies the delta to the database.
-	Update(ctx context.Context, delta *Delta) error
+	// AddNodes() adds the nodes to the database in a single batch and returns their assigned nodeIDs.
+	// If any of the pubkeys is already in the database (or repeated), no node is added.
+	AddNodes(ctx context.Context, pubkeys ...string) ([]uint32, error)
+
+	// Update() applies the deltas to the database, in order and in a single batch.
+	// If any of the nodes is not found, no delta is applied.
+	Update(ctx context.Context, deltas ...*Delta) error
 
 	// Followers() returns a slice that contains the followers of each nodeID.
 	Followers(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error)
@@ -122,6 +140,27 @@ type Database interface {
 	// FollowCounts of the provided nodeIDs. If a node is not found, it returns the value 0.
 	FollowCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error)
 
+	// Mutes() returns a slice that contains the nodes muted by each nodeID.
+	Mutes(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error)
+
+	// MutedBy() returns a slice that contains the nodes that muted each nodeID.
+	MutedBy(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error)
+
+	// MutedByCounts of the provided nodeIDs. If a node is not found, it returns the value 0.
+	MutedByCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error)
+
+	// AddReports() adds the reports to the database. Adding the same report twice has no effect.
+	AddReports(ctx context.Context, reports ...Report) error
+
+	// Reports() returns the reports received by each nodeID, grouped by type.
+	Reports(ctx context.Context, nodeIDs ...uint32) ([]ReportMap, error)
+
+	// SetWriteRelays() replaces the write relays (NIP-65) of nodeID.
+	SetWriteRelays(ctx context.Context, nodeID uint32, relays []string) error
+
+	// WriteRelays() returns the write relays of each nodeID. If a node is not found, an empty slice is returned.
+	WriteRelays(ctx context.Context, nodeIDs ...uint32) ([][]string, error)
+
 	// NodeIDs() returns a slice of nodeIDs that correspond with the given slice of pubkeys.
 	// If a pubkey is not found, nil is returned
 	NodeIDs(ctx context.Context, pubkeys ...string) ([]*uint32, error)
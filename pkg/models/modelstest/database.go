@@ -0,0 +1,935 @@
+/*
+The modelstest package implements a conformance suite for the interfaces defined
+in the models package. Every implementation of [models.Database] and
+[models.RandomWalkStore] should pass it, which guarantees that backends can be
+swapped without changing the behaviour of the crawler or of the pagerank package.
+
+Usage, in the test file of the implementation:
+
+	func TestConformance(t *testing.T) {
+		modelstest.TestDatabase(t, func(t testing.TB, DBType string) models.Database {
+			return SetupDB(DBType)
+		})
+	}
+
+The suite only relies on the public methods of the interfaces, and it never
+assumes that the implementation returns IDs in any particular order.
+*/
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+/*
+DatabaseFactory returns a new, isolated Database of the specified type.
+The suite requires the following types:
+
+  - "nil": a nil pointer of the implementation (e.g. (*mock.Database)(nil))
+  - "empty": a database without nodes
+  - "one-node0": a database containing only node 0, with pubkey "0"
+  - "simple": nodes 0, 1, 2 with pubkeys "0", "1", "2", where node 1 is active,
+    0 --follows--> 1, 2 --mutes--> 0 and 2 --reports (spam)--> 0
+
+The factory should use t to fail the test and to register any cleanup.
+*/
+type DatabaseFactory func(t testing.TB, DBType string) models.Database
+
+// TestDatabase() runs the full Database contract against the implementation returned by setup.
+func TestDatabase(t *testing.T, setup DatabaseFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, setup DatabaseFactory)
+	}{
+		{name: "Validate", test: testValidate},
+		{name: "Size", test: testSize},
+		{name: "ContainsNode", test: testContainsNode},
+		{name: "NodeByID", test: testNodeByID},
+		{name: "Nodes", test: testNodes},
+		{name: "NodeByKey", test: testNodeByKey},
+		{name: "AddNode", test: testAddNode},
+		{name: "AddNodes", test: testAddNodes},
+		{name: "Update", test: testUpdate},
+		{name: "Relationships", test: testRelationships},
+		{name: "Counts", test: testCounts},
+		{name: "Reports", test: testReports},
+		{name: "WriteRelays", test: testWriteRelays},
+		{name: "NodeIDs", test: testNodeIDs},
+		{name: "Pubkeys", test: testPubkeys},
+		{name: "ScanNodes", test: testScanNodes},
+		{name: "AllNodes", test: testAllNodes},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, setup)
+		})
+	}
+}
+
+func testValidate(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", expectedError: models.ErrNilDB},
+		{name: "empty DB", DBType: "empty", expectedError: nil},
+		{name: "valid DB", DBType: "simple", expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			if err := DB.Validate(); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Validate(): expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func testSize(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name         string
+		DBType       string
+		expectedSize int
+	}{
+		{name: "nil DB", DBType: "nil", expectedSize: 0},
+		{name: "empty DB", DBType: "empty", expectedSize: 0},
+		{name: "DB with node 0", DBType: "one-node0", expectedSize: 1},
+		{name: "valid DB", DBType: "simple", expectedSize: 3},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			if size := DB.Size(context.Background()); size != test.expectedSize {
+				t.Fatalf("Size(): expected %v, got %v", test.expectedSize, size)
+			}
+		})
+	}
+}
+
+func testContainsNode(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name     string
+		DBType   string
+		nodeID   uint32
+		expected bool
+	}{
+		{name: "nil DB", DBType: "nil", nodeID: 0, expected: false},
+		{name: "empty DB", DBType: "empty", nodeID: 0, expected: false},
+		{name: "node not found", DBType: "simple", nodeID: 69, expected: false},
+		{name: "node found", DBType: "simple", nodeID: 2, expected: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			if contains := DB.ContainsNode(context.Background(), test.nodeID); contains != test.expected {
+				t.Fatalf("ContainsNode(%d): expected %v, got %v", test.nodeID, test.expected, contains)
+			}
+		})
+	}
+}
+
+func testNodeByID(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		nodeID        uint32
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", nodeID: 0, expectedError: models.ErrNilDB},
+		{name: "empty DB", DBType: "empty", nodeID: 0, expectedError: models.ErrNodeNotFoundDB},
+		{name: "node not found", DBType: "simple", nodeID: 69, expectedError: models.ErrNodeNotFoundDB},
+		{name: "node found", DBType: "simple", nodeID: 1, expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			node, err := DB.NodeByID(context.Background(), test.nodeID)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("NodeByID(%d): expected %v, got %v", test.nodeID, test.expectedError, err)
+			}
+
+			if err == nil {
+				checkNode(t, node, 1, "1", models.StatusActive)
+			}
+		})
+	}
+}
+
+func testNodes(t *testing.T, setup DatabaseFactory) {
+	t.Run("nil DB", func(t *testing.T) {
+		DB := setup(t, "nil")
+		if _, err := DB.Nodes(context.Background(), 0); !errors.Is(err, models.ErrNilDB) {
+			t.Fatalf("Nodes(): expected %v, got %v", models.ErrNilDB, err)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		DB := setup(t, "simple")
+		nodes, err := DB.Nodes(context.Background(), 1, 69, 0)
+		if err != nil {
+			t.Fatalf("Nodes(): expected nil, got %v", err)
+		}
+
+		if len(nodes) != 3 {
+			t.Fatalf("Nodes(): expected 3 nodes, got %v", nodes)
+		}
+
+		if nodes[1] != nil {
+			t.Errorf("Nodes(): expected nil for node 69, got %v", nodes[1])
+		}
+
+		checkNode(t, nodes[0], 1, "1", models.StatusActive)
+		checkNode(t, nodes[2], 0, "0", models.StatusInactive)
+	})
+}
+
+func testNodeByKey(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		pubkey        string
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", pubkey: "0", expectedError: models.ErrNilDB},
+		{name: "empty DB", DBType: "empty", pubkey: "0", expectedError: models.ErrNodeNotFoundDB},
+		{name: "node not found", DBType: "simple", pubkey: "69", expectedError: models.ErrNodeNotFoundDB},
+		{name: "node found", DBType: "simple", pubkey: "1", expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			node, err := DB.NodeByKey(context.Background(), test.pubkey)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("NodeByKey(%v): expected %v, got %v", test.pubkey, test.expectedError, err)
+			}
+
+			if err == nil {
+				checkNode(t, node, 1, "1", models.StatusActive)
+			}
+		})
+	}
+}
+
+func testAddNode(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		pubkey        string
+		expectedID    uint32
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", pubkey: "0", expectedID: math.MaxUint32, expectedError: models.ErrNilDB},
+		{name: "node already in DB", DBType: "simple", pubkey: "0", expectedID: math.MaxUint32, expectedError: models.ErrNodeAlreadyInDB},
+		{name: "first node", DBType: "empty", pubkey: "0", expectedID: 0, expectedError: nil},
+		{name: "valid", DBType: "simple", pubkey: "3", expectedID: 3, expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := setup(t, test.DBType)
+			size := DB.Size(ctx)
+
+			nodeID, err := DB.AddNode(ctx, test.pubkey)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("AddNode(%v): expected %v, got %v", test.pubkey, test.expectedError, err)
+			}
+
+			if nodeID != test.expectedID {
+				t.Fatalf("AddNode(%v): expected ID %d, got %d", test.pubkey, test.expectedID, nodeID)
+			}
+
+			if err != nil {
+				if newSize := DB.Size(ctx); newSize != size {
+					t.Fatalf("AddNode(%v): expected size %d after failure, got %d", test.pubkey, size, newSize)
+				}
+				return
+			}
+
+			node, err := DB.NodeByKey(ctx, test.pubkey)
+			if err != nil {
+				t.Fatalf("NodeByKey(%v): expected nil, got %v", test.pubkey, err)
+			}
+
+			checkNode(t, node, test.expectedID, test.pubkey, models.StatusInactive)
+			if node.Added() == nil {
+				t.Errorf("AddNode(%v): expected an Added record, got %v", test.pubkey, node.Records)
+			}
+
+			if newSize := DB.Size(ctx); newSize != size+1 {
+				t.Errorf("AddNode(%v): expected size %d, got %d", test.pubkey, size+1, newSize)
+			}
+		})
+	}
+}
+
+func testAddNodes(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		pubkeys       []string
+		expectedIDs   []uint32
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", pubkeys: []string{"3"}, expectedError: models.ErrNilDB},
+		{name: "no pubkeys", DBType: "simple", pubkeys: nil, expectedError: nil},
+		{name: "one pubkey already in DB", DBType: "simple", pubkeys: []string{"3", "1"}, expectedError: models.ErrNodeAlreadyInDB},
+		{name: "repeated pubkeys", DBType: "simple", pubkeys: []string{"3", "4", "3"}, expectedError: models.ErrNodeAlreadyInDB},
+		{name: "valid", DBType: "simple", pubkeys: []string{"3", "4"}, expectedIDs: []uint32{3, 4}, expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := setup(t, test.DBType)
+			size := DB.Size(ctx)
+
+			nodeIDs, err := DB.AddNodes(ctx, test.pubkeys...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("AddNodes(%v): expected %v, got %v", test.pubkeys, test.expectedError, err)
+			}
+
+			if !equalIDs(nodeIDs, test.expectedIDs) {
+				t.Fatalf("AddNodes(%v): expected %v, got %v", test.pubkeys, test.expectedIDs, nodeIDs)
+			}
+
+			// the batch is atomic: either all nodes are added, or none is
+			if newSize := DB.Size(ctx); newSize != size+len(test.expectedIDs) {
+				t.Errorf("AddNodes(%v): expected size %d, got %d", test.pubkeys, size+len(test.expectedIDs), newSize)
+			}
+
+			for i, ID := range test.expectedIDs {
+				node, err := DB.NodeByID(ctx, ID)
+				if err != nil {
+					t.Fatalf("NodeByID(%d): expected nil, got %v", ID, err)
+				}
+				checkNode(t, node, ID, test.pubkeys[i], models.StatusInactive)
+			}
+		})
+	}
+}
+
+func testUpdate(t *testing.T, setup DatabaseFactory) {
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			DBType        string
+			delta         *models.Delta
+			expectedError error
+		}{
+			{name: "nil DB", DBType: "nil", delta: &models.Delta{Kind: models.Promotion, NodeID: 0}, expectedError: models.ErrNilDB},
+			{name: "nil delta", DBType: "simple", delta: nil, expectedError: models.ErrNilDelta},
+			{name: "node not found", DBType: "simple", delta: &models.Delta{Kind: models.Promotion, NodeID: 69}, expectedError: models.ErrNodeNotFoundDB},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				DB := setup(t, test.DBType)
+				if err := DB.Update(context.Background(), test.delta); !errors.Is(err, test.expectedError) {
+					t.Fatalf("Update(%v): expected %v, got %v", test.delta, test.expectedError, err)
+				}
+			})
+		}
+	})
+
+	t.Run("promotion and demotion", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		if err := DB.Update(ctx, &models.Delta{Kind: models.Promotion, NodeID: 0}); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+
+		node, err := DB.NodeByID(ctx, 0)
+		if err != nil {
+			t.Fatalf("NodeByID(0): expected nil, got %v", err)
+		}
+
+		checkNode(t, node, 0, "0", models.StatusActive)
+		if node.Promoted() == nil {
+			t.Errorf("Update(): expected a Promotion record, got %v", node.Records)
+		}
+
+		if err := DB.Update(ctx, &models.Delta{Kind: models.Demotion, NodeID: 1}); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+
+		node, err = DB.NodeByID(ctx, 1)
+		if err != nil {
+			t.Fatalf("NodeByID(1): expected nil, got %v", err)
+		}
+
+		checkNode(t, node, 1, "1", models.StatusInactive)
+		if node.Demoted() == nil {
+			t.Errorf("Update(): expected a Demotion record, got %v", node.Records)
+		}
+	})
+
+	t.Run("follow list", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		delta := &models.Delta{Kind: nostr.KindFollowList, NodeID: 0, Removed: []uint32{1}, Added: []uint32{2}}
+		if err := DB.Update(ctx, delta); err != nil {
+			t.Fatalf("Update(%v): expected nil, got %v", delta, err)
+		}
+
+		checkMembers(t, "Follows", DB.Follows, []uint32{0, 1, 2}, [][]uint32{{2}, {}, {}})
+		checkMembers(t, "Followers", DB.Followers, []uint32{0, 1, 2}, [][]uint32{{}, {}, {0}})
+	})
+
+	t.Run("mute list", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		delta := &models.Delta{Kind: nostr.KindMuteList, NodeID: 2, Removed: []uint32{0}, Added: []uint32{1}}
+		if err := DB.Update(ctx, delta); err != nil {
+			t.Fatalf("Update(%v): expected nil, got %v", delta, err)
+		}
+
+		checkMembers(t, "Mutes", DB.Mutes, []uint32{0, 1, 2}, [][]uint32{{}, {}, {1}})
+		checkMembers(t, "MutedBy", DB.MutedBy, []uint32{0, 1, 2}, [][]uint32{{}, {2}, {}})
+	})
+
+	t.Run("many deltas", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		deltas := []*models.Delta{
+			{Kind: nostr.KindFollowList, NodeID: 1, Added: []uint32{0, 2}},
+			{Kind: nostr.KindFollowList, NodeID: 2, Added: []uint32{1}},
+			{Kind: models.Promotion, NodeID: 2},
+		}
+
+		if err := DB.Update(ctx, deltas...); err != nil {
+			t.Fatalf("Update(): expected nil, got %v", err)
+		}
+
+		checkMembers(t, "Follows", DB.Follows, []uint32{0, 1, 2}, [][]uint32{{1}, {0, 2}, {1}})
+
+		node, err := DB.NodeByID(ctx, 2)
+		if err != nil {
+			t.Fatalf("NodeByID(2): expected nil, got %v", err)
+		}
+		checkNode(t, node, 2, "2", models.StatusActive)
+	})
+
+	t.Run("many deltas, one node not found", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		deltas := []*models.Delta{
+			{Kind: nostr.KindFollowList, NodeID: 1, Added: []uint32{0, 2}},
+			{Kind: nostr.KindFollowList, NodeID: 69, Added: []uint32{1}},
+		}
+
+		if err := DB.Update(ctx, deltas...); !errors.Is(err, models.ErrNodeNotFoundDB) {
+			t.Fatalf("Update(): expected %v, got %v", models.ErrNodeNotFoundDB, err)
+		}
+
+		// no delta has been applied
+		checkMembers(t, "Follows", DB.Follows, []uint32{0, 1, 2}, [][]uint32{{1}, {}, {}})
+	})
+}
+
+func testRelationships(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		nodeIDs       []uint32
+		expectedError error
+		expected      map[string][][]uint32 // by method name
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			nodeIDs:       []uint32{0},
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "no nodeIDs",
+			DBType:        "simple",
+			nodeIDs:       nil,
+			expectedError: nil,
+		},
+		{
+			name:          "one node not found",
+			DBType:        "simple",
+			nodeIDs:       []uint32{0, 69},
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:          "valid",
+			DBType:        "simple",
+			nodeIDs:       []uint32{0, 1, 2},
+			expectedError: nil,
+			expected: map[string][][]uint32{
+				"Follows":   {{1}, {}, {}},
+				"Followers": {{}, {0}, {}},
+				"Mutes":     {{}, {}, {0}},
+				"MutedBy":   {{2}, {}, {}},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			methods := map[string]func(context.Context, ...uint32) ([][]uint32, error){
+				"Follows":   DB.Follows,
+				"Followers": DB.Followers,
+				"Mutes":     DB.Mutes,
+				"MutedBy":   DB.MutedBy,
+			}
+
+			for name, method := range methods {
+				members, err := method(context.Background(), test.nodeIDs...)
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("%v(%v): expected %v, got %v", name, test.nodeIDs, test.expectedError, err)
+				}
+
+				if !equalMembers(members, test.expected[name]) {
+					t.Errorf("%v(%v): expected %v, got %v", name, test.nodeIDs, test.expected[name], members)
+				}
+			}
+		})
+	}
+}
+
+func testCounts(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		nodeIDs       []uint32
+		expectedError error
+		expected      map[string][]int // by method name
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			nodeIDs:       []uint32{0},
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "no nodeIDs",
+			DBType:        "simple",
+			nodeIDs:       nil,
+			expectedError: nil,
+		},
+		{
+			name:          "valid",
+			DBType:        "simple",
+			nodeIDs:       []uint32{0, 1, 2, 69},
+			expectedError: nil,
+			expected: map[string][]int{
+				"FollowCounts":   {1, 0, 0, 0},
+				"FollowerCounts": {0, 1, 0, 0},
+				"MutedByCounts":  {1, 0, 0, 0},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			methods := map[string]func(context.Context, ...uint32) ([]int, error){
+				"FollowCounts":   DB.FollowCounts,
+				"FollowerCounts": DB.FollowerCounts,
+				"MutedByCounts":  DB.MutedByCounts,
+			}
+
+			for name, method := range methods {
+				counts, err := method(context.Background(), test.nodeIDs...)
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("%v(%v): expected %v, got %v", name, test.nodeIDs, test.expectedError, err)
+				}
+
+				if len(counts) != len(test.expected[name]) || (len(counts) > 0 && !reflect.DeepEqual(counts, test.expected[name])) {
+					t.Errorf("%v(%v): expected %v, got %v", name, test.nodeIDs, test.expected[name], counts)
+				}
+			}
+		})
+	}
+}
+
+func testReports(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		reports         []models.Report
+		nodeIDs         []uint32
+		expectedError   error
+		expectedReports []models.ReportMap
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			reports:       []models.Report{{Reporter: 1, Reported: 0, Type: "spam"}},
+			nodeIDs:       []uint32{0},
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "no nodeIDs",
+			DBType:        "simple",
+			nodeIDs:       nil,
+			expectedError: nil,
+		},
+		{
+			name:            "node not found",
+			DBType:          "simple",
+			nodeIDs:         []uint32{69},
+			expectedError:   nil,
+			expectedReports: []models.ReportMap{{}},
+		},
+		{
+			name:            "existing reports",
+			DBType:          "simple",
+			nodeIDs:         []uint32{0, 1},
+			expectedError:   nil,
+			expectedReports: []models.ReportMap{{"spam": {2}}, {}},
+		},
+		{
+			name:   "added reports",
+			DBType: "simple",
+			reports: []models.Report{
+				{Reporter: 1, Reported: 0, Type: "spam"},
+				{Reporter: 2, Reported: 0, Type: "spam"}, // already present
+				{Reporter: 0, Reported: 1, Type: "impersonation"},
+				{Reporter: 0, Reported: 1, Type: "impersonation"}, // repeated
+			},
+			nodeIDs:         []uint32{0, 1, 2},
+			expectedError:   nil,
+			expectedReports: []models.ReportMap{{"spam": {1, 2}}, {"impersonation": {0}}, {}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := setup(t, test.DBType)
+
+			if len(test.reports) > 0 {
+				if err := DB.AddReports(ctx, test.reports...); !errors.Is(err, test.expectedError) {
+					t.Fatalf("AddReports(%v): expected %v, got %v", test.reports, test.expectedError, err)
+				}
+			}
+
+			reports, err := DB.Reports(ctx, test.nodeIDs...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Reports(%v): expected %v, got %v", test.nodeIDs, test.expectedError, err)
+			}
+
+			if len(reports) != len(test.expectedReports) {
+				t.Fatalf("Reports(%v): expected %v, got %v", test.nodeIDs, test.expectedReports, reports)
+			}
+
+			for i, report := range reports {
+				if len(report) != len(test.expectedReports[i]) {
+					t.Fatalf("Reports(%v): expected %v, got %v", test.nodeIDs, test.expectedReports, reports)
+				}
+
+				for reportType, reporters := range test.expectedReports[i] {
+					if !equalIDs(report[reportType], reporters) {
+						t.Errorf("Reports(%v): expected %v, got %v", test.nodeIDs, test.expectedReports, reports)
+					}
+				}
+			}
+		})
+	}
+}
+
+func testWriteRelays(t *testing.T, setup DatabaseFactory) {
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			DBType        string
+			nodeID        uint32
+			expectedError error
+		}{
+			{name: "nil DB", DBType: "nil", nodeID: 0, expectedError: models.ErrNilDB},
+			{name: "node not found", DBType: "simple", nodeID: 69, expectedError: models.ErrNodeNotFoundDB},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				DB := setup(t, test.DBType)
+				err := DB.SetWriteRelays(context.Background(), test.nodeID, []string{"wss://relay.example.com"})
+				if !errors.Is(err, test.expectedError) {
+					t.Fatalf("SetWriteRelays(%d): expected %v, got %v", test.nodeID, test.expectedError, err)
+				}
+			})
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		relays, err := DB.WriteRelays(ctx)
+		if err != nil || len(relays) != 0 {
+			t.Fatalf("WriteRelays(): expected no relays and nil, got %v and %v", relays, err)
+		}
+
+		first := []string{"wss://b.example.com", "wss://a.example.com"}
+		second := []string{"wss://c.example.com"}
+
+		if err := DB.SetWriteRelays(ctx, 0, first); err != nil {
+			t.Fatalf("SetWriteRelays(0): expected nil, got %v", err)
+		}
+
+		if err := DB.SetWriteRelays(ctx, 1, first); err != nil {
+			t.Fatalf("SetWriteRelays(1): expected nil, got %v", err)
+		}
+
+		// the second call replaces the relays of node 1
+		if err := DB.SetWriteRelays(ctx, 1, second); err != nil {
+			t.Fatalf("SetWriteRelays(1): expected nil, got %v", err)
+		}
+
+		relays, err = DB.WriteRelays(ctx, 0, 1, 2, 69)
+		if err != nil {
+			t.Fatalf("WriteRelays(): expected nil, got %v", err)
+		}
+
+		// the order of the relays must be preserved
+		expected := [][]string{first, second, {}, {}}
+		if !reflect.DeepEqual(relays, expected) {
+			t.Errorf("WriteRelays(): expected %v, got %v", expected, relays)
+		}
+	})
+}
+
+func testNodeIDs(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		pubkeys       []string
+		expectedIDs   []*uint32
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", pubkeys: []string{"0"}, expectedError: models.ErrNilDB},
+		{name: "no pubkeys", DBType: "simple", pubkeys: nil, expectedError: nil},
+		{name: "valid", DBType: "simple", pubkeys: []string{"2", "69", "0"}, expectedIDs: []*uint32{ptr[uint32](2), nil, ptr[uint32](0)}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			nodeIDs, err := DB.NodeIDs(context.Background(), test.pubkeys...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("NodeIDs(%v): expected %v, got %v", test.pubkeys, test.expectedError, err)
+			}
+
+			if len(nodeIDs) != len(test.expectedIDs) || (len(nodeIDs) > 0 && !reflect.DeepEqual(nodeIDs, test.expectedIDs)) {
+				t.Errorf("NodeIDs(%v): expected %v, got %v", test.pubkeys, test.expectedIDs, nodeIDs)
+			}
+		})
+	}
+}
+
+func testPubkeys(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name            string
+		DBType          string
+		nodeIDs         []uint32
+		expectedPubkeys []*string
+		expectedError   error
+	}{
+		{name: "nil DB", DBType: "nil", nodeIDs: []uint32{0}, expectedError: models.ErrNilDB},
+		{name: "no nodeIDs", DBType: "simple", nodeIDs: nil, expectedError: nil},
+		{name: "valid", DBType: "simple", nodeIDs: []uint32{2, 69, 0}, expectedPubkeys: []*string{ptr("2"), nil, ptr("0")}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			pubkeys, err := DB.Pubkeys(context.Background(), test.nodeIDs...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Pubkeys(%v): expected %v, got %v", test.nodeIDs, test.expectedError, err)
+			}
+
+			if len(pubkeys) != len(test.expectedPubkeys) || (len(pubkeys) > 0 && !reflect.DeepEqual(pubkeys, test.expectedPubkeys)) {
+				t.Errorf("Pubkeys(%v): expected %v, got %v", test.nodeIDs, test.expectedPubkeys, pubkeys)
+			}
+		})
+	}
+}
+
+func testScanNodes(t *testing.T, setup DatabaseFactory) {
+	t.Run("nil DB", func(t *testing.T) {
+		DB := setup(t, "nil")
+		if _, _, err := DB.ScanNodes(context.Background(), 0, 10); !errors.Is(err, models.ErrNilDB) {
+			t.Fatalf("ScanNodes(): expected %v, got %v", models.ErrNilDB, err)
+		}
+	})
+
+	t.Run("empty DB", func(t *testing.T) {
+		DB := setup(t, "empty")
+		nodeIDs, cursor, err := DB.ScanNodes(context.Background(), 0, 10)
+		if err != nil || len(nodeIDs) != 0 || cursor != 0 {
+			t.Fatalf("ScanNodes(): expected no nodes, cursor 0 and nil, got %v, %d and %v", nodeIDs, cursor, err)
+		}
+	})
+
+	t.Run("coverage", func(t *testing.T) {
+		ctx := context.Background()
+		DB := setup(t, "simple")
+
+		pubkeys := make([]string, 100)
+		for i := range pubkeys {
+			pubkeys[i] = fmt.Sprintf("pk%d", i)
+		}
+
+		if _, err := DB.AddNodes(ctx, pubkeys...); err != nil {
+			t.Fatalf("AddNodes(): expected nil, got %v", err)
+		}
+
+		// a scan must return every node at least once, using any limit
+		for _, limit := range []int{1, 7, 1000} {
+			var cursor uint64
+			seen := make(map[uint32]struct{}, 103)
+
+			for i := 0; ; i++ {
+				if i > 10000 {
+					t.Fatalf("ScanNodes(limit=%d): the cursor never returned to 0", limit)
+				}
+
+				var nodeIDs []uint32
+				var err error
+				nodeIDs, cursor, err = DB.ScanNodes(ctx, cursor, limit)
+				if err != nil {
+					t.Fatalf("ScanNodes(limit=%d): expected nil, got %v", limit, err)
+				}
+
+				for _, ID := range nodeIDs {
+					seen[ID] = struct{}{}
+				}
+
+				if cursor == 0 {
+					break
+				}
+			}
+
+			if len(seen) != 103 {
+				t.Fatalf("ScanNodes(limit=%d): expected 103 nodes, got %d", limit, len(seen))
+			}
+
+			for ID := range uint32(103) {
+				if _, ok := seen[ID]; !ok {
+					t.Errorf("ScanNodes(limit=%d): node %d was never returned", limit, ID)
+				}
+			}
+		}
+	})
+}
+
+func testAllNodes(t *testing.T, setup DatabaseFactory) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		expectedIDs   []uint32
+		expectedError error
+	}{
+		{name: "nil DB", DBType: "nil", expectedError: models.ErrNilDB},
+		{name: "empty DB", DBType: "empty", expectedError: models.ErrEmptyDB},
+		{name: "DB with node 0", DBType: "one-node0", expectedIDs: []uint32{0}},
+		{name: "valid DB", DBType: "simple", expectedIDs: []uint32{0, 1, 2}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := setup(t, test.DBType)
+			nodeIDs, err := DB.AllNodes(context.Background())
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("AllNodes(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if !equalIDs(nodeIDs, test.expectedIDs) {
+				t.Errorf("AllNodes(): expected %v, got %v", test.expectedIDs, nodeIDs)
+			}
+		})
+	}
+}
+
+// ------------------------------------HELPERS----------------------------------
+
+// checkNode() checks the ID, pubkey and status of the node.
+func checkNode(t *testing.T, node *models.Node, ID uint32, pubkey, status string) {
+	t.Helper()
+	if node == nil {
+		t.Fatalf("expected node %d, got nil", ID)
+	}
+
+	if node.ID != ID || node.Pubkey != pubkey || node.Status != status {
+		t.Errorf("expected node {ID: %d, Pubkey: %v, Status: %v}, got {ID: %d, Pubkey: %v, Status: %v}",
+			ID, pubkey, status, node.ID, node.Pubkey, node.Status)
+	}
+}
+
+// checkMembers() checks that the method returns the expected members for the nodeIDs.
+func checkMembers(
+	t *testing.T,
+	name string,
+	method func(context.Context, ...uint32) ([][]uint32, error),
+	nodeIDs []uint32,
+	expected [][]uint32) {
+
+	t.Helper()
+	members, err := method(context.Background(), nodeIDs...)
+	if err != nil {
+		t.Fatalf("%v(%v): expected nil, got %v", name, nodeIDs, err)
+	}
+
+	if !equalMembers(members, expected) {
+		t.Errorf("%v(%v): expected %v, got %v", name, nodeIDs, expected, members)
+	}
+}
+
+// equalIDs() returns whether the two slices contain the same IDs, ignoring their order.
+// Nil and empty slices are considered equal.
+func equalIDs(IDs1, IDs2 []uint32) bool {
+	if len(IDs1) != len(IDs2) {
+		return false
+	}
+
+	sorted1, sorted2 := slices.Clone(IDs1), slices.Clone(IDs2)
+	slices.Sort(sorted1)
+	slices.Sort(sorted2)
+	return slices.Equal(sorted1, sorted2)
+}
+
+// equalMembers() returns whether the two slices of members are equal, ignoring
+// the order inside each of the members.
+func equalMembers(members1, members2 [][]uint32) bool {
+	if len(members1) != len(members2) {
+		return false
+	}
+
+	for i := range members1 {
+		if !equalIDs(members1[i], members2[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
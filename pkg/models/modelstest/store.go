@@ -0,0 +1,763 @@
+package modelstest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+/*
+RandomWalkStoreFactory returns a new, isolated RandomWalkStore of the specified type.
+The suite requires the following types:
+
+  - "nil": a nil pointer of the implementation (e.g. (*mock.RandomWalkStore)(nil))
+  - "empty": a RWS without walks
+  - "one-node0": a RWS containing only the walk {0}
+  - "triangle": a RWS containing only the walks {0,1,2}, {1,2,0} and {2,0,1}
+
+Every RWS must use a valid alpha and walksPerNode. The factory should use t
+to fail the test and to register any cleanup.
+*/
+type RandomWalkStoreFactory func(t testing.TB, RWSType string) models.RandomWalkStore
+
+// TestRandomWalkStore() runs the full RandomWalkStore contract against the implementation returned by setup.
+func TestRandomWalkStore(t *testing.T, setup RandomWalkStoreFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, setup RandomWalkStoreFactory)
+	}{
+		{name: "Validate", test: testValidateRWS},
+		{name: "Parameters", test: testParameters},
+		{name: "TotalVisits", test: testTotalVisits},
+		{name: "VisitCounts", test: testVisitCounts},
+		{name: "Walks", test: testWalks},
+		{name: "WalksVisiting", test: testWalksVisiting},
+		{name: "TopNodes", test: testTopNodes},
+		{name: "Rank", test: testRank},
+		{name: "WalksVisitingAll", test: testWalksVisitingAll},
+		{name: "AddWalks", test: testAddWalks},
+		{name: "Generated", test: testGenerated},
+		{name: "RemoveWalks", test: testRemoveWalks},
+		{name: "PruneGraftWalk", test: testPruneGraftWalk},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, setup)
+		})
+	}
+}
+
+func testValidateRWS(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", expectedError: models.ErrNilRWS},
+		{name: "empty RWS", RWSType: "empty", expectedError: nil},
+		{name: "valid RWS", RWSType: "triangle", expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, test.RWSType)
+			if err := RWS.Validate(); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Validate(): expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func testParameters(t *testing.T, setup RandomWalkStoreFactory) {
+	ctx := context.Background()
+	RWS := setup(t, "triangle")
+
+	if alpha := RWS.Alpha(ctx); alpha <= 0 || alpha >= 1 {
+		t.Errorf("Alpha(): expected a value between 0 and 1 (excluded), got %v", alpha)
+	}
+
+	if walksPerNode := RWS.WalksPerNode(ctx); walksPerNode <= 0 {
+		t.Errorf("WalksPerNode(): expected a value greater than zero, got %v", walksPerNode)
+	}
+}
+
+func testTotalVisits(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name           string
+		RWSType        string
+		expectedVisits int
+	}{
+		{name: "nil RWS", RWSType: "nil", expectedVisits: 0},
+		{name: "empty RWS", RWSType: "empty", expectedVisits: 0},
+		{name: "one walk", RWSType: "one-node0", expectedVisits: 1},
+		{name: "triangle", RWSType: "triangle", expectedVisits: 9},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, test.RWSType)
+			if visits := RWS.TotalVisits(context.Background()); visits != test.expectedVisits {
+				t.Fatalf("TotalVisits(): expected %v, got %v", test.expectedVisits, visits)
+			}
+		})
+	}
+}
+
+func testVisitCounts(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name           string
+		RWSType        string
+		nodeIDs        []uint32
+		expectedVisits []int
+		expectedError  error
+	}{
+		{name: "nil RWS", RWSType: "nil", nodeIDs: []uint32{0}, expectedError: models.ErrNilRWS},
+		{name: "no nodeIDs", RWSType: "triangle", nodeIDs: nil, expectedError: nil},
+		{name: "node not found", RWSType: "empty", nodeIDs: []uint32{0}, expectedVisits: []int{0}},
+		{name: "valid", RWSType: "triangle", nodeIDs: []uint32{0, 69, 2}, expectedVisits: []int{3, 0, 3}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, test.RWSType)
+			visits, err := RWS.VisitCounts(context.Background(), test.nodeIDs...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("VisitCounts(%v): expected %v, got %v", test.nodeIDs, test.expectedError, err)
+			}
+
+			if len(visits) != len(test.expectedVisits) || (len(visits) > 0 && !reflect.DeepEqual(visits, test.expectedVisits)) {
+				t.Errorf("VisitCounts(%v): expected %v, got %v", test.nodeIDs, test.expectedVisits, visits)
+			}
+		})
+	}
+}
+
+func testWalks(t *testing.T, setup RandomWalkStoreFactory) {
+	t.Run("nil RWS", func(t *testing.T) {
+		RWS := setup(t, "nil")
+		if _, err := RWS.Walks(context.Background(), 0); !errors.Is(err, models.ErrNilRWS) {
+			t.Fatalf("Walks(): expected %v, got %v", models.ErrNilRWS, err)
+		}
+	})
+
+	t.Run("walk not found", func(t *testing.T) {
+		RWS := setup(t, "triangle")
+		walkIDs := append(walkIDsVisiting(t, RWS, 0), 69)
+		if _, err := RWS.Walks(context.Background(), walkIDs...); !errors.Is(err, models.ErrWalkNotFound) {
+			t.Fatalf("Walks(%v): expected %v, got %v", walkIDs, models.ErrWalkNotFound, err)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		RWS := setup(t, "triangle")
+		walkIDs := walkIDsVisiting(t, RWS, 0)
+
+		walks, err := RWS.Walks(context.Background(), walkIDs...)
+		if err != nil {
+			t.Fatalf("Walks(%v): expected nil, got %v", walkIDs, err)
+		}
+
+		expected := []models.RandomWalk{{0, 1, 2}, {1, 2, 0}, {2, 0, 1}}
+		if !equalWalks(walks, expected) {
+			t.Errorf("Walks(%v): expected %v, got %v", walkIDs, expected, walks)
+		}
+	})
+}
+
+func testWalksVisiting(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		limit         int
+		nodeIDs       []uint32
+		expectedLen   int
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", limit: -1, nodeIDs: []uint32{0}, expectedError: models.ErrNilRWS},
+		{name: "no nodeIDs", RWSType: "triangle", limit: -1, nodeIDs: nil, expectedLen: 0},
+		{name: "node not found", RWSType: "triangle", limit: -1, nodeIDs: []uint32{69}, expectedLen: 0},
+		{name: "zero limit", RWSType: "triangle", limit: 0, nodeIDs: []uint32{0}, expectedLen: 0},
+		{name: "limit smaller than nodeIDs", RWSType: "triangle", limit: 1, nodeIDs: []uint32{0, 1}, expectedLen: 0},
+		{name: "limit", RWSType: "triangle", limit: 2, nodeIDs: []uint32{0}, expectedLen: 2},
+		{name: "all walks", RWSType: "triangle", limit: -1, nodeIDs: []uint32{0, 1, 2}, expectedLen: 3},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, test.RWSType)
+			walkIDs, err := RWS.WalksVisiting(context.Background(), test.limit, test.nodeIDs...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("WalksVisiting(%d, %v): expected %v, got %v", test.limit, test.nodeIDs, test.expectedError, err)
+			}
+
+			if len(walkIDs) != test.expectedLen {
+				t.Fatalf("WalksVisiting(%d, %v): expected %d walkIDs, got %v", test.limit, test.nodeIDs, test.expectedLen, walkIDs)
+			}
+
+			if len(walkIDs) != len(unique(walkIDs)) {
+				t.Errorf("WalksVisiting(%d, %v): expected unique walkIDs, got %v", test.limit, test.nodeIDs, walkIDs)
+			}
+		})
+	}
+}
+
+func testTopNodes(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		k             int
+		offset        int
+		expectedNodes []uint32
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", k: 1, expectedError: models.ErrNilRWS},
+		{name: "empty RWS", RWSType: "empty", k: 3, expectedNodes: nil},
+		{name: "zero k", RWSType: "leaderboard", k: 0, expectedNodes: nil},
+		{name: "all nodes", RWSType: "leaderboard", k: 10, expectedNodes: []uint32{0, 1, 2}},
+		{name: "first", RWSType: "leaderboard", k: 1, expectedNodes: []uint32{0}},
+		{name: "offset", RWSType: "leaderboard", k: 1, offset: 1, expectedNodes: []uint32{1}},
+		{name: "negative offset", RWSType: "leaderboard", k: 2, offset: -1, expectedNodes: []uint32{0, 1}},
+		{name: "offset too big", RWSType: "leaderboard", k: 1, offset: 3, expectedNodes: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setupLeaderboard(t, setup, test.RWSType)
+			nodeIDs, err := RWS.TopNodes(context.Background(), test.k, test.offset)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("TopNodes(%d, %d): expected %v, got %v", test.k, test.offset, test.expectedError, err)
+			}
+
+			if len(nodeIDs) != len(test.expectedNodes) || (len(nodeIDs) > 0 && !reflect.DeepEqual(nodeIDs, test.expectedNodes)) {
+				t.Errorf("TopNodes(%d, %d): expected %v, got %v", test.k, test.offset, test.expectedNodes, nodeIDs)
+			}
+		})
+	}
+
+	t.Run("after removal", func(t *testing.T) {
+		ctx := context.Background()
+		RWS := setupLeaderboard(t, setup, "leaderboard")
+
+		// removing {0,1,2}, so that node 2 is no longer visited
+		removed := walkIDsVisiting(t, RWS, 2)
+		if err := RWS.RemoveWalks(ctx, removed...); err != nil {
+			t.Fatalf("RemoveWalks(%v): expected nil, got %v", removed, err)
+		}
+
+		nodeIDs, err := RWS.TopNodes(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("TopNodes(): expected nil, got %v", err)
+		}
+
+		expected := []uint32{0, 1}
+		if !reflect.DeepEqual(nodeIDs, expected) {
+			t.Errorf("TopNodes(): expected %v, got %v", expected, nodeIDs)
+		}
+	})
+
+	t.Run("after prune and graft", func(t *testing.T) {
+		ctx := context.Background()
+		RWS := setupLeaderboard(t, setup, "leaderboard")
+
+		// {0,1,2} --> {0,3,4}, and {0,1} --> {0,3}
+		walkIDs := walkIDsVisiting(t, RWS, 1)
+		walks, err := RWS.Walks(ctx, walkIDs...)
+		if err != nil {
+			t.Fatalf("Walks(%v): expected nil, got %v", walkIDs, err)
+		}
+
+		for i, walk := range walks {
+			segment := models.RandomWalk{3, 4}[:len(walk)-1]
+			if err := RWS.PruneGraftWalk(ctx, walkIDs[i], 1, segment); err != nil {
+				t.Fatalf("PruneGraftWalk(%d): expected nil, got %v", walkIDs[i], err)
+			}
+		}
+
+		nodeIDs, err := RWS.TopNodes(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("TopNodes(): expected nil, got %v", err)
+		}
+
+		expected := []uint32{0, 3, 4}
+		if !reflect.DeepEqual(nodeIDs, expected) {
+			t.Errorf("TopNodes(): expected %v, got %v", expected, nodeIDs)
+		}
+	})
+}
+
+func testRank(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		nodeID        uint32
+		expectedRank  int
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", nodeID: 0, expectedRank: -1, expectedError: models.ErrNilRWS},
+		{name: "node not found", RWSType: "leaderboard", nodeID: 69, expectedRank: -1, expectedError: models.ErrNodeNotFoundRWS},
+		{name: "first", RWSType: "leaderboard", nodeID: 0, expectedRank: 0},
+		{name: "last", RWSType: "leaderboard", nodeID: 2, expectedRank: 2},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setupLeaderboard(t, setup, test.RWSType)
+			rank, err := RWS.Rank(context.Background(), test.nodeID)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Rank(%d): expected %v, got %v", test.nodeID, test.expectedError, err)
+			}
+
+			if rank != test.expectedRank {
+				t.Errorf("Rank(%d): expected %d, got %d", test.nodeID, test.expectedRank, rank)
+			}
+		})
+	}
+
+	t.Run("consistent with TopNodes", func(t *testing.T) {
+		ctx := context.Background()
+		RWS := setup(t, "triangle")
+
+		// all nodes have the same visits, so the order depends on the implementation
+		nodeIDs, err := RWS.TopNodes(ctx, 3, 0)
+		if err != nil {
+			t.Fatalf("TopNodes(): expected nil, got %v", err)
+		}
+
+		if len(nodeIDs) != 3 {
+			t.Fatalf("TopNodes(): expected 3 nodes, got %v", nodeIDs)
+		}
+
+		for i, ID := range nodeIDs {
+			rank, err := RWS.Rank(ctx, ID)
+			if err != nil {
+				t.Fatalf("Rank(%d): expected nil, got %v", ID, err)
+			}
+
+			if rank != i {
+				t.Errorf("Rank(%d): expected %d, got %d", ID, i, rank)
+			}
+		}
+	})
+}
+
+func testWalksVisitingAll(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		nodeIDs       []uint32
+		expectedLen   int
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", nodeIDs: []uint32{0}, expectedError: models.ErrNilRWS},
+		{name: "no nodeIDs", RWSType: "triangle", nodeIDs: nil, expectedLen: 0},
+		{name: "node not found", RWSType: "triangle", nodeIDs: []uint32{0, 69}, expectedLen: 0},
+		{name: "no common walks", RWSType: "one-node0", nodeIDs: []uint32{0, 1}, expectedLen: 0},
+		{name: "valid", RWSType: "triangle", nodeIDs: []uint32{0, 1, 2}, expectedLen: 3},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, test.RWSType)
+			walkIDs, err := RWS.WalksVisitingAll(context.Background(), test.nodeIDs...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("WalksVisitingAll(%v): expected %v, got %v", test.nodeIDs, test.expectedError, err)
+			}
+
+			if len(walkIDs) != test.expectedLen {
+				t.Errorf("WalksVisitingAll(%v): expected %d walkIDs, got %v", test.nodeIDs, test.expectedLen, walkIDs)
+			}
+		})
+	}
+}
+
+func testAddWalks(t *testing.T, setup RandomWalkStoreFactory) {
+	testCases := []struct {
+		name          string
+		RWSType       string
+		walks         []models.RandomWalk
+		expectedError error
+	}{
+		{name: "nil RWS", RWSType: "nil", walks: []models.RandomWalk{{0}}, expectedError: models.ErrNilRWS},
+		{name: "no walks", RWSType: "one-node0", walks: nil, expectedError: nil},
+		{name: "one nil walk", RWSType: "one-node0", walks: []models.RandomWalk{{0, 1}, nil}, expectedError: models.ErrNilWalk},
+		{name: "one empty walk", RWSType: "one-node0", walks: []models.RandomWalk{{0, 1}, {}}, expectedError: models.ErrEmptyWalk},
+		{name: "valid", RWSType: "one-node0", walks: []models.RandomWalk{{0, 1}, {1, 2, 3}}, expectedError: nil},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			RWS := setup(t, test.RWSType)
+			before := snapshotRWS(t, RWS)
+
+			err := RWS.AddWalks(ctx, test.walks...)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("AddWalks(%v): expected %v, got %v", test.walks, test.expectedError, err)
+			}
+
+			if err != nil || len(test.walks) == 0 {
+				// if one walk is invalid, no walk gets added
+				checkUnchanged(t, "AddWalks", RWS, before)
+				return
+			}
+
+			expectedWalks := append(slices.Clone(before.walks), test.walks...)
+			after := snapshotRWS(t, RWS)
+			if !equalWalks(after.walks, expectedWalks) {
+				t.Errorf("AddWalks(%v): expected walks %v, got %v", test.walks, expectedWalks, after.walks)
+			}
+
+			expectedVisits := before.totalVisits
+			for _, walk := range test.walks {
+				expectedVisits += len(walk)
+			}
+
+			if after.totalVisits != expectedVisits {
+				t.Errorf("AddWalks(%v): expected total visits %d, got %d", test.walks, expectedVisits, after.totalVisits)
+			}
+
+			expectedCounts := []int{2, 2, 1, 1, 0}
+			if !reflect.DeepEqual(after.visitCounts, expectedCounts) {
+				t.Errorf("AddWalks(%v): expected visit counts %v, got %v", test.walks, expectedCounts, after.visitCounts)
+			}
+		})
+	}
+}
+
+func testGenerated(t *testing.T, setup RandomWalkStoreFactory) {
+	t.Run("nil RWS", func(t *testing.T) {
+		RWS := setup(t, "nil")
+		if _, err := RWS.Generated(context.Background(), 0); !errors.Is(err, models.ErrNilRWS) {
+			t.Fatalf("Generated(): expected %v, got %v", models.ErrNilRWS, err)
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		ctx := context.Background()
+		RWS := setup(t, "empty")
+
+		walks := []models.RandomWalk{{0, 1}, {1, 2}}
+		if err := RWS.AddGeneratedWalks(ctx, []uint32{0, 1}, walks...); err != nil {
+			t.Fatalf("AddGeneratedWalks(): expected nil, got %v", err)
+		}
+
+		if after := snapshotRWS(t, RWS); !equalWalks(after.walks, walks) {
+			t.Errorf("AddGeneratedWalks(): expected walks %v, got %v", walks, after.walks)
+		}
+
+		generated, err := RWS.Generated(ctx, 0, 2, 1)
+		if err != nil {
+			t.Fatalf("Generated(): expected nil, got %v", err)
+		}
+
+		if expected := []bool{true, false, true}; !reflect.DeepEqual(generated, expected) {
+			t.Errorf("Generated(): expected %v, got %v", expected, generated)
+		}
+
+		if err := RWS.ClearGenerated(ctx); err != nil {
+			t.Fatalf("ClearGenerated(): expected nil, got %v", err)
+		}
+
+		generated, err = RWS.Generated(ctx, 0, 2, 1)
+		if err != nil {
+			t.Fatalf("Generated(): expected nil, got %v", err)
+		}
+
+		if expected := []bool{false, false, false}; !reflect.DeepEqual(generated, expected) {
+			t.Errorf("Generated(): expected %v after ClearGenerated(), got %v", expected, generated)
+		}
+	})
+}
+
+func testRemoveWalks(t *testing.T, setup RandomWalkStoreFactory) {
+	t.Run("nil RWS", func(t *testing.T) {
+		RWS := setup(t, "nil")
+		if err := RWS.RemoveWalks(context.Background(), 0); !errors.Is(err, models.ErrNilRWS) {
+			t.Fatalf("RemoveWalks(): expected %v, got %v", models.ErrNilRWS, err)
+		}
+	})
+
+	t.Run("no walkIDs", func(t *testing.T) {
+		RWS := setup(t, "triangle")
+		before := snapshotRWS(t, RWS)
+
+		if err := RWS.RemoveWalks(context.Background()); err != nil {
+			t.Fatalf("RemoveWalks(): expected nil, got %v", err)
+		}
+		checkUnchanged(t, "RemoveWalks", RWS, before)
+	})
+
+	t.Run("one walk not found", func(t *testing.T) {
+		RWS := setup(t, "triangle")
+		before := snapshotRWS(t, RWS)
+
+		walkIDs := append(slices.Clone(before.walkIDs[:1]), 69)
+		if err := RWS.RemoveWalks(context.Background(), walkIDs...); !errors.Is(err, models.ErrWalkNotFound) {
+			t.Fatalf("RemoveWalks(%v): expected %v, got %v", walkIDs, models.ErrWalkNotFound, err)
+		}
+
+		// if one walkID is not found, no walk gets removed
+		checkUnchanged(t, "RemoveWalks", RWS, before)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		ctx := context.Background()
+		RWS := setup(t, "triangle")
+		before := snapshotRWS(t, RWS)
+
+		removed, kept := before.walkIDs[:2], before.walkIDs[2:]
+		if err := RWS.RemoveWalks(ctx, removed...); err != nil {
+			t.Fatalf("RemoveWalks(%v): expected nil, got %v", removed, err)
+		}
+
+		for _, ID := range removed {
+			if _, err := RWS.Walks(ctx, ID); !errors.Is(err, models.ErrWalkNotFound) {
+				t.Errorf("Walks(%d): expected %v, got %v", ID, models.ErrWalkNotFound, err)
+			}
+		}
+
+		after := snapshotRWS(t, RWS)
+		if !equalIDs(after.walkIDs, kept) {
+			t.Errorf("RemoveWalks(%v): expected remaining walkIDs %v, got %v", removed, kept, after.walkIDs)
+		}
+
+		if after.totalVisits != 3 {
+			t.Errorf("RemoveWalks(%v): expected total visits 3, got %d", removed, after.totalVisits)
+		}
+
+		expectedCounts := []int{1, 1, 1, 0, 0}
+		if !reflect.DeepEqual(after.visitCounts, expectedCounts) {
+			t.Errorf("RemoveWalks(%v): expected visit counts %v, got %v", removed, expectedCounts, after.visitCounts)
+		}
+	})
+}
+
+func testPruneGraftWalk(t *testing.T, setup RandomWalkStoreFactory) {
+	t.Run("nil RWS", func(t *testing.T) {
+		RWS := setup(t, "nil")
+		if err := RWS.PruneGraftWalk(context.Background(), 0, 1, models.RandomWalk{1}); !errors.Is(err, models.ErrNilRWS) {
+			t.Fatalf("PruneGraftWalk(): expected %v, got %v", models.ErrNilRWS, err)
+		}
+	})
+
+	testCases := []struct {
+		name          string
+		walkID        *uint32 // nil means the ID of the walk {0,1,2}
+		cutIndex      int
+		walkSegment   models.RandomWalk
+		expectedError error
+	}{
+		{name: "walk not found", walkID: ptr[uint32](69), cutIndex: 1, walkSegment: models.RandomWalk{3}, expectedError: models.ErrWalkNotFound},
+		{name: "negative cutIndex", cutIndex: -1, walkSegment: models.RandomWalk{3}, expectedError: models.ErrInvalidWalkIndex},
+		{name: "cutIndex too big", cutIndex: 4, walkSegment: models.RandomWalk{3}, expectedError: models.ErrInvalidWalkIndex},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := setup(t, "triangle")
+			before := snapshotRWS(t, RWS)
+
+			walkID := walkIDOf(t, before, models.RandomWalk{0, 1, 2})
+			if test.walkID != nil {
+				walkID = *test.walkID
+			}
+
+			err := RWS.PruneGraftWalk(context.Background(), walkID, test.cutIndex, test.walkSegment)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("PruneGraftWalk(%d, %d, %v): expected %v, got %v", walkID, test.cutIndex, test.walkSegment, test.expectedError, err)
+			}
+
+			// a failed operation must not change the RWS
+			checkUnchanged(t, "PruneGraftWalk", RWS, before)
+		})
+	}
+
+	validCases := []struct {
+		name           string
+		cutIndex       int
+		walkSegment    models.RandomWalk
+		expectedWalk   models.RandomWalk
+		expectedCounts []int
+	}{
+		{
+			name:           "prune only",
+			cutIndex:       1,
+			walkSegment:    models.RandomWalk{},
+			expectedWalk:   models.RandomWalk{0},
+			expectedCounts: []int{3, 2, 2, 0, 0},
+		},
+		{
+			name:           "graft only",
+			cutIndex:       3,
+			walkSegment:    models.RandomWalk{3, 4},
+			expectedWalk:   models.RandomWalk{0, 1, 2, 3, 4},
+			expectedCounts: []int{3, 3, 3, 1, 1},
+		},
+		{
+			name:           "prune and graft",
+			cutIndex:       1,
+			walkSegment:    models.RandomWalk{3},
+			expectedWalk:   models.RandomWalk{0, 3},
+			expectedCounts: []int{3, 2, 2, 1, 0},
+		},
+	}
+
+	for _, test := range validCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			RWS := setup(t, "triangle")
+			before := snapshotRWS(t, RWS)
+			walkID := walkIDOf(t, before, models.RandomWalk{0, 1, 2})
+
+			if err := RWS.PruneGraftWalk(ctx, walkID, test.cutIndex, test.walkSegment); err != nil {
+				t.Fatalf("PruneGraftWalk(%d, %d, %v): expected nil, got %v", walkID, test.cutIndex, test.walkSegment, err)
+			}
+
+			walks, err := RWS.Walks(ctx, walkID)
+			if err != nil {
+				t.Fatalf("Walks(%d): expected nil, got %v", walkID, err)
+			}
+
+			if !reflect.DeepEqual(walks, []models.RandomWalk{test.expectedWalk}) {
+				t.Errorf("PruneGraftWalk(): expected walk %v, got %v", test.expectedWalk, walks)
+			}
+
+			after := snapshotRWS(t, RWS)
+			expectedVisits := before.totalVisits - 3 + len(test.expectedWalk)
+			if after.totalVisits != expectedVisits {
+				t.Errorf("PruneGraftWalk(): expected total visits %d, got %d", expectedVisits, after.totalVisits)
+			}
+
+			if !reflect.DeepEqual(after.visitCounts, test.expectedCounts) {
+				t.Errorf("PruneGraftWalk(): expected visit counts %v, got %v", test.expectedCounts, after.visitCounts)
+			}
+		})
+	}
+}
+
+// ------------------------------------HELPERS----------------------------------
+
+// the nodes whose visit counts are tracked by the snapshot.
+var snapshotNodes = []uint32{0, 1, 2, 3, 4}
+
+// rwsSnapshot is the observable state of a RWS, used to check that failed operations have no effect.
+type rwsSnapshot struct {
+	totalVisits int
+	visitCounts []int
+	walkIDs     []uint32
+	walks       []models.RandomWalk // walks[i] is the walk with ID walkIDs[i]
+}
+
+// snapshotRWS() returns the state of the RWS restricted to the snapshotNodes.
+// An invalid RWS has no state, hence its snapshot is empty.
+func snapshotRWS(t *testing.T, RWS models.RandomWalkStore) rwsSnapshot {
+	t.Helper()
+	ctx := context.Background()
+	if RWS.Validate() != nil {
+		return rwsSnapshot{}
+	}
+
+	visitCounts, err := RWS.VisitCounts(ctx, snapshotNodes...)
+	if err != nil {
+		t.Fatalf("VisitCounts(): expected nil, got %v", err)
+	}
+
+	walkIDs := walkIDsVisiting(t, RWS, snapshotNodes...)
+	walks, err := RWS.Walks(ctx, walkIDs...)
+	if err != nil {
+		t.Fatalf("Walks(%v): expected nil, got %v", walkIDs, err)
+	}
+
+	return rwsSnapshot{
+		totalVisits: RWS.TotalVisits(ctx),
+		visitCounts: visitCounts,
+		walkIDs:     walkIDs,
+		walks:       walks,
+	}
+}
+
+// checkUnchanged() checks that the state of the RWS is still equal to before.
+func checkUnchanged(t *testing.T, name string, RWS models.RandomWalkStore, before rwsSnapshot) {
+	t.Helper()
+	if RWS.Validate() != nil {
+		return
+	}
+
+	after := snapshotRWS(t, RWS)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("%v(): expected the RWS to be unchanged %+v, got %+v", name, before, after)
+	}
+}
+
+// walkIDsVisiting() returns all the walkIDs visiting the nodes, sorted.
+func walkIDsVisiting(t *testing.T, RWS models.RandomWalkStore, nodeIDs ...uint32) []uint32 {
+	t.Helper()
+	walkIDs, err := RWS.WalksVisiting(context.Background(), -1, nodeIDs...)
+	if err != nil {
+		t.Fatalf("WalksVisiting(%v): expected nil, got %v", nodeIDs, err)
+	}
+
+	walkIDs = unique(walkIDs)
+	slices.Sort(walkIDs)
+	return walkIDs
+}
+
+// walkIDOf() returns the ID of the walk in the snapshot.
+func walkIDOf(t *testing.T, snapshot rwsSnapshot, walk models.RandomWalk) uint32 {
+	t.Helper()
+	for i, w := range snapshot.walks {
+		if slices.Equal(w, walk) {
+			return snapshot.walkIDs[i]
+		}
+	}
+
+	t.Fatalf("walk %v not found in %v", walk, snapshot.walks)
+	return 0
+}
+
+// setupLeaderboard() returns the RWS of the specified type, where "leaderboard" is a RWS
+// containing only the walks {0,1,2}, {0,1} and {0}, so that nodes 0, 1 and 2 have 3, 2 and 1 visits.
+func setupLeaderboard(t *testing.T, setup RandomWalkStoreFactory, RWSType string) models.RandomWalkStore {
+	t.Helper()
+	if RWSType != "leaderboard" {
+		return setup(t, RWSType)
+	}
+
+	RWS := setup(t, "empty")
+	walks := []models.RandomWalk{{0, 1, 2}, {0, 1}, {0}}
+	if err := RWS.AddWalks(context.Background(), walks...); err != nil {
+		t.Fatalf("AddWalks(%v): expected nil, got %v", walks, err)
+	}
+
+	return RWS
+}
+
+// equalWalks() returns whether the two slices contain the same walks, ignoring their order.
+func equalWalks(walks1, walks2 []models.RandomWalk) bool {
+	if len(walks1) != len(walks2) {
+		return false
+	}
+
+	sorted1, sorted2 := slices.Clone(walks1), slices.Clone(walks2)
+	slices.SortFunc(sorted1, slices.Compare)
+	slices.SortFunc(sorted2, slices.Compare)
+	return slices.EqualFunc(sorted1, sorted2, slices.Equal)
+}
+
+func unique(IDs []uint32) []uint32 {
+	seen := make(map[uint32]struct{}, len(IDs))
+	uniqueIDs := make([]uint32, 0, len(IDs))
+	for _, ID := range IDs {
+		if _, ok := seen[ID]; !ok {
+			seen[ID] = struct{}{}
+			uniqueIDs = append(uniqueIDs, ID)
+		}
+	}
+
+	return uniqueIDs
+}
@@ -45,6 +45,19 @@ type RandomWalkStore interface {
 	*/
 	WalksVisiting(ctx context.Context, limit int, nodeIDs ...uint32) ([]uint32, error)
 
+	/*TopNodes() returns up to k nodeIDs with the most visits, in descending order of visits,
+	skipping the first offset. Nodes with the same visits are returned in an order that
+	depends on the implementation, but is consistent with Rank().
+
+	Note:
+	- If k <= 0, no node is returned
+	- A negative offset is treated as 0*/
+	TopNodes(ctx context.Context, k, offset int) ([]uint32, error)
+
+	// Rank() returns the position of nodeID in the ranking of TopNodes(), starting from 0.
+	// If nodeID has no visits, ErrNodeNotFoundRWS is returned.
+	Rank(ctx context.Context, nodeID uint32) (int, error)
+
 	// WalksVisitingAll() returns all the IDs of the walk that visit ALL specified nodes.
 	WalksVisitingAll(ctx context.Context, nodeIDs ...uint32) ([]uint32, error)
 
@@ -54,6 +67,16 @@ type RandomWalkStore interface {
 	// AddWalks() adds all the walks to the RandomWalkStore.
 	AddWalks(ctx context.Context, walks ...RandomWalk) error
 
+	// AddGeneratedWalks() adds all the walks to the RandomWalkStore like AddWalks(), and atomically
+	// marks the nodeIDs as generated, so that an interrupted generation can be resumed.
+	AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...RandomWalk) error
+
+	// Generated() returns whether each nodeID has been marked as generated by AddGeneratedWalks().
+	Generated(ctx context.Context, nodeIDs ...uint32) ([]bool, error)
+
+	// ClearGenerated() removes the marks of all the nodes, once the generation has completed.
+	ClearGenerated(ctx context.Context) error
+
 	// RemoveWalks() removes all the walks associated with the walkIDs.
 	RemoveWalks(ctx context.Context, walkIDs ...uint32) error
 
@@ -0,0 +1,411 @@
+package pagerank
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+	"github.com/vertex-lab/crawler/pkg/walks"
+)
+
+// BatchConfig holds the parameters of [PersonalizedBatch].
+type BatchConfig struct {
+	Workers   int               // the number of personalized walks computed concurrently
+	BatchSize int               // the number of sources whose follows and walks are fetched at once
+	Rand      *randutils.Source // the source of randomness, which can be nil
+}
+
+func NewBatchConfig() BatchConfig {
+	return BatchConfig{
+		Workers:   runtime.NumCPU(),
+		BatchSize: 100,
+	}
+}
+
+// BatchResult contains the personalized pagerank of Source restricted to the
+// topK nodes, or the error that prevented computing it.
+type BatchResult struct {
+	Source   uint32
+	Pagerank models.PagerankMap
+	Err      error
+}
+
+/*
+PersonalizedBatch() computes the personalized pagerank of each source, restricted
+to its topK nodes. The results are in the same order as the sources.
+
+Compared to calling [Personalized] for each source, it:
+  - shares a single FollowCache between all sources
+  - fetches the follows and the walks of config.BatchSize sources at once
+  - computes config.Workers personalized walks concurrently
+
+Each source draws from its own random generator, taken from config.Rand in the
+order of the sources, so the results are reproducible regardless of the number of workers.
+If config.Rand is seeded, each source also samples its walks with its generator, and walks the follows in ascending order.
+Errors that concern a single source (e.g. it's not in the DB) are reported in
+its BatchResult, while all other errors stop the computation.
+*/
+func PersonalizedBatch(
+	ctx context.Context,
+	config BatchConfig,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	sources []uint32,
+	topK uint16) ([]BatchResult, error) {
+
+	if err := DB.Validate(); err != nil {
+		return nil, fmt.Errorf("PersonalizedBatch(): %w", err)
+	}
+
+	if err := RWS.Validate(); err != nil {
+		return nil, fmt.Errorf("PersonalizedBatch(): %w", err)
+	}
+
+	if topK <= 0 {
+		return nil, fmt.Errorf("PersonalizedBatch(): %w", ErrInvalidTopN)
+	}
+
+	results := make([]BatchResult, len(sources))
+	for i, ID := range sources {
+		results[i].Source = ID
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan batchJob, max(config.BatchSize, 1))
+	alpha := RWS.Alpha(ctx)
+	length := requiredLenght(topK, alpha)
+	if config.Rand.Seeded() {
+		DB = walks.SortedFollows(DB)
+	}
+	FC := NewFollowCache(DB, len(sources))
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(config.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					// draining the jobs
+					continue
+				}
+
+				result := &results[job.index]
+				if job.dandling {
+					result.Pagerank = models.PagerankMap{result.Source: 1.0}
+					continue
+				}
+
+				walk, err := personalizedWalk(ctx, job.rng, FC, job.WC, result.Source, length, alpha)
+				if err != nil {
+					result.Err = err
+					continue
+				}
+
+				result.Pagerank = topPagerank(countAndNormalize(walk), int(topK))
+			}
+		}()
+	}
+
+	err := prepareJobs(ctx, config, RWS, FC, sources, results, walksNeeded(length, alpha), jobs)
+	if err != nil {
+		cancel()
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return nil, fmt.Errorf("PersonalizedBatch(): %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("PersonalizedBatch(): %w", err)
+	}
+
+	return results, nil
+}
+
+// batchJob is the personalized walk of sources[index], ready to be computed.
+type batchJob struct {
+	index    int
+	rng      *rand.Rand
+	WC       *WalkCache
+	dandling bool
+}
+
+// prepareJobs() loads the follows and the walks of the sources in batches,
+// and sends a job for each source, in order.
+func prepareJobs(
+	ctx context.Context,
+	config BatchConfig,
+	RWS models.RandomWalkStore,
+	FC *FollowCache,
+	sources []uint32,
+	results []BatchResult,
+	limit int,
+	jobs chan<- batchJob) error {
+
+	batchSize := max(config.BatchSize, 1)
+	for start := 0; start < len(sources); start += batchSize {
+		end := min(start+batchSize, len(sources))
+
+		// each source samples its walks with its own generator, like in Personalized()
+		rngs := make([]*rand.Rand, end-start)
+		samplers := make([]*rand.Rand, end-start)
+		for i := range rngs {
+			rngs[i] = config.Rand.Rand()
+			if config.Rand.Seeded() {
+				samplers[i] = rngs[i]
+			}
+		}
+
+		WCs, err := loadBatch(ctx, RWS, FC, samplers, sources[start:end], results[start:end], limit)
+		if err != nil {
+			return err
+		}
+
+		for i := start; i < end; i++ {
+			if results[i].Err != nil {
+				continue
+			}
+
+			job := batchJob{index: i, rng: rngs[i-start], WC: WCs[i-start], dandling: WCs[i-start] == nil}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case jobs <- job:
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+loadBatch() loads in the FollowCache the follows of the sources and of their follows,
+and returns a WalkCache for each source. The walks are shared by the WalkCaches.
+
+The walks of each source are sampled with its sampler (see [walks.SampleVisiting]), or, if the
+samplers are nil, by the RWS with a single call for all the sources (see [sampleBatch]).
+The WalkCache of a dandling source is nil, and sources not in the DB get an error in their result.
+*/
+func loadBatch(
+	ctx context.Context,
+	RWS models.RandomWalkStore,
+	FC *FollowCache,
+	samplers []*rand.Rand,
+	sources []uint32,
+	results []BatchResult,
+	limit int) ([]*WalkCache, error) {
+
+	pubkeys, err := FC.DB.Pubkeys(ctx, sources...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the pubkeys: %w", err)
+	}
+
+	found := make([]uint32, 0, len(sources))
+	for i, ID := range sources {
+		if pubkeys[i] == nil {
+			results[i].Err = fmt.Errorf("%w: nodeID %d", models.ErrNodeNotFoundDB, ID)
+			continue
+		}
+		found = append(found, ID)
+	}
+
+	if err := loadMissing(ctx, FC, found...); err != nil {
+		return nil, err
+	}
+
+	// the nodes whose walks are used by each source: its follows and itself.
+	nodeIDs := make([][]uint32, len(sources))
+	next := make([]uint32, 0)
+	for i, ID := range sources {
+		if results[i].Err != nil {
+			continue
+		}
+
+		follows, _ := FC.Follows(ctx, ID)
+		if len(follows) > 0 {
+			next = append(next, follows...)
+			nodeIDs[i] = append(slices.Clone(follows), ID)
+		}
+	}
+
+	if err := loadMissing(ctx, FC, next...); err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(samplers, func(rng *rand.Rand) bool { return rng != nil }) {
+		return sampleBatch(ctx, RWS, nodeIDs, limit)
+	}
+
+	walkIDs := make([][]uint32, len(sources))
+	unique := make(map[uint32]struct{})
+	for i := range sources {
+		if len(nodeIDs[i]) == 0 {
+			continue
+		}
+
+		// the walkIDs are sorted, because their order determines which walks are used
+		IDs, err := walks.SampleVisiting(ctx, samplers[i], RWS, limit, nodeIDs[i]...)
+		if err != nil {
+			return nil, err
+		}
+
+		walkIDs[i] = IDs
+		for _, walkID := range IDs {
+			unique[walkID] = struct{}{}
+		}
+	}
+
+	allIDs := make([]uint32, 0, len(unique))
+	for walkID := range unique {
+		allIDs = append(allIDs, walkID)
+	}
+
+	randomWalks, err := RWS.Walks(ctx, allIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	walkByID := make(map[uint32]models.RandomWalk, len(allIDs))
+	for i, walkID := range allIDs {
+		walkByID[walkID] = randomWalks[i]
+	}
+
+	WCs := make([]*WalkCache, len(sources))
+	for i := range sources {
+		if len(nodeIDs[i]) == 0 {
+			continue
+		}
+
+		WCs[i] = NewWalkCache(len(walkIDs[i]))
+		for _, walkID := range walkIDs[i] {
+			WCs[i].Add(walkByID[walkID])
+		}
+	}
+
+	return WCs, nil
+}
+
+/*
+sampleBatch() returns a WalkCache for each group of nodeIDs (nil if the group is empty),
+with up to limit walks evenly distributed among its nodes, like [models.RandomWalkStore.WalksVisiting].
+
+The walkIDs of all the groups are sampled by the RWS with a single call, whose limit is
+limit times the number of groups, evenly distributed among all their nodes. Each group then takes,
+for each of its nodes, up to limit/len(group) of the walks visiting it, in ascending order of walkID.
+Groups with fewer nodes than the average might get fewer walks, and their personalized walks
+take more steps using the follows.
+*/
+func sampleBatch(
+	ctx context.Context,
+	RWS models.RandomWalkStore,
+	nodeIDs [][]uint32,
+	limit int) ([]*WalkCache, error) {
+
+	var groups int
+	unique := make(map[uint32]struct{})
+	for _, group := range nodeIDs {
+		if len(group) > 0 {
+			groups++
+		}
+
+		for _, ID := range group {
+			unique[ID] = struct{}{}
+		}
+	}
+
+	WCs := make([]*WalkCache, len(nodeIDs))
+	if groups == 0 {
+		return WCs, nil
+	}
+
+	allNodes := make([]uint32, 0, len(unique))
+	for ID := range unique {
+		allNodes = append(allNodes, ID)
+	}
+
+	walkIDs, err := RWS.WalksVisiting(ctx, limit*groups, allNodes...)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(walkIDs)
+
+	randomWalks, err := RWS.Walks(ctx, walkIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the positions in randomWalks of the walks visiting each node, in ascending order of walkID
+	visiting := make(map[uint32][]int, len(allNodes))
+	for pos, walk := range randomWalks {
+		for _, ID := range walk {
+			if _, exists := unique[ID]; exists {
+				visiting[ID] = append(visiting[ID], pos)
+			}
+		}
+	}
+
+	for i, group := range nodeIDs {
+		if len(group) == 0 {
+			continue
+		}
+
+		limitPerNode := limit / len(group)
+		WCs[i] = NewWalkCache(limit)
+		added := make(map[int]struct{}, limit)
+
+		for _, ID := range group {
+			var taken int
+			for _, pos := range visiting[ID] {
+				if taken >= limitPerNode {
+					break
+				}
+
+				if _, exists := added[pos]; exists {
+					continue
+				}
+
+				WCs[i].Add(randomWalks[pos])
+				added[pos] = struct{}{}
+				taken++
+			}
+		}
+	}
+
+	return WCs, nil
+}
+
+// loadMissing() loads in the FollowCache the follows of the nodeIDs that are not already there.
+func loadMissing(ctx context.Context, FC *FollowCache, nodeIDs ...uint32) error {
+	missing := FC.Missing(nodeIDs...)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := FC.Load(ctx, missing...); err != nil {
+		return fmt.Errorf("failed to load the follows: %w", err)
+	}
+
+	return nil
+}
+
+// topPagerank() returns the pagerank restricted to its top k nodes.
+func topPagerank(pagerank models.PagerankMap, k int) models.PagerankMap {
+	top := TopNodes(pagerank, k)
+	result := make(models.PagerankMap, len(top))
+	for _, ID := range top {
+		result[ID] = pagerank[ID]
+	}
+
+	return result
+}
@@ -0,0 +1,218 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+	"github.com/vertex-lab/crawler/pkg/walks"
+)
+
+func TestPersonalizedBatch(t *testing.T) {
+	t.Run("simple errors", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			DBType        string
+			RWSType       string
+			topK          uint16
+			expectedError error
+		}{
+			{name: "nil DB", DBType: "nil", RWSType: "triangle", topK: 5, expectedError: models.ErrNilDB},
+			{name: "nil RWS", DBType: "triangle", RWSType: "nil", topK: 5, expectedError: models.ErrNilRWS},
+			{name: "invalid topK", DBType: "triangle", RWSType: "triangle", topK: 0, expectedError: ErrInvalidTopN},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				DB := mockdb.SetupDB(test.DBType)
+				RWS := mockstore.SetupRWS(test.RWSType)
+
+				_, err := PersonalizedBatch(context.Background(), NewBatchConfig(), DB, RWS, []uint32{0}, test.topK)
+				if !errors.Is(err, test.expectedError) {
+					t.Errorf("PersonalizedBatch(): expected %v, got %v", test.expectedError, err)
+				}
+			})
+		}
+	})
+
+	t.Run("per source results", func(t *testing.T) {
+		// 0 --> 1, and 69 is not in the DB
+		DB := mockdb.SetupDB("simple")
+		RWS := mockstore.SetupRWS("one-node0")
+		sources := []uint32{69, 1, 0}
+
+		results, err := PersonalizedBatch(context.Background(), NewBatchConfig(), DB, RWS, sources, 5)
+		if err != nil {
+			t.Fatalf("PersonalizedBatch(): expected nil, got %v", err)
+		}
+
+		if len(results) != len(sources) {
+			t.Fatalf("PersonalizedBatch(): expected %d results, got %v", len(sources), results)
+		}
+
+		for i, result := range results {
+			if result.Source != sources[i] {
+				t.Errorf("PersonalizedBatch(): expected source %d, got %d", sources[i], result.Source)
+			}
+		}
+
+		if !errors.Is(results[0].Err, models.ErrNodeNotFoundDB) {
+			t.Errorf("PersonalizedBatch(): expected %v, got %v", models.ErrNodeNotFoundDB, results[0].Err)
+		}
+
+		// 1 is a dandling node
+		if expected := (models.PagerankMap{1: 1.0}); !reflect.DeepEqual(results[1].Pagerank, expected) {
+			t.Errorf("PersonalizedBatch(): expected %v, got %v", expected, results[1].Pagerank)
+		}
+
+		if results[2].Err != nil || len(results[2].Pagerank) != 2 {
+			t.Errorf("PersonalizedBatch(): expected the pagerank of nodes 0 and 1, got %v", results[2])
+		}
+	})
+
+	t.Run("same as personalized", func(t *testing.T) {
+		ctx := context.Background()
+		DB, RWS := setupBatch(t, 200, 20)
+
+		pp, err := Personalized(ctx, randutils.NewSource(69), DB, RWS, 0, 50)
+		if err != nil {
+			t.Fatalf("Personalized(): expected nil, got %v", err)
+		}
+
+		config := NewBatchConfig()
+		config.Rand = randutils.NewSource(69)
+		results, err := PersonalizedBatch(ctx, config, DB, RWS, []uint32{0}, 50)
+		if err != nil {
+			t.Fatalf("PersonalizedBatch(): expected nil, got %v", err)
+		}
+
+		if expected := topPagerank(pp, 50); !reflect.DeepEqual(results[0].Pagerank, expected) {
+			t.Errorf("PersonalizedBatch(): expected %v, got %v", expected, results[0].Pagerank)
+		}
+	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		ctx := context.Background()
+		DB, RWS := setupBatch(t, 200, 20)
+		sources := make([]uint32, 50)
+		for i := range sources {
+			sources[i] = uint32(i)
+		}
+
+		compute := func(workers, batchSize int) []BatchResult {
+			config := BatchConfig{Workers: workers, BatchSize: batchSize, Rand: randutils.NewSource(42)}
+			results, err := PersonalizedBatch(ctx, config, DB, RWS, sources, 20)
+			if err != nil {
+				t.Fatalf("PersonalizedBatch(): expected nil, got %v", err)
+			}
+			return results
+		}
+
+		results1 := compute(1, 50)
+		results2 := compute(8, 7)
+		if !reflect.DeepEqual(results1, results2) {
+			t.Errorf("PersonalizedBatch(): expected the same results with the same seed, got %v and %v", results1, results2)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		DB, RWS := setupBatch(t, 50, 5)
+		if _, err := PersonalizedBatch(ctx, NewBatchConfig(), DB, RWS, []uint32{0, 1, 2}, 5); !errors.Is(err, context.Canceled) {
+			t.Errorf("PersonalizedBatch(): expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestSampleBatch(t *testing.T) {
+	ctx := context.Background()
+	DB, RWS := setupBatch(t, 200, 20)
+
+	follows, err := DB.Follows(ctx, 0, 1)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	const limit = 100
+	nodeIDs := [][]uint32{append(slices.Clone(follows[0]), 0), nil, append(slices.Clone(follows[1]), 1)}
+	WCs, err := sampleBatch(ctx, RWS, nodeIDs, limit)
+	if err != nil {
+		t.Fatalf("sampleBatch(): expected nil, got %v", err)
+	}
+
+	if WCs[1] != nil {
+		t.Errorf("sampleBatch(): expected nil for the empty group, got %v", WCs[1])
+	}
+
+	for _, i := range []int{0, 2} {
+		if len(WCs[i].walks) == 0 || len(WCs[i].walks) > limit {
+			t.Fatalf("sampleBatch(): expected between 1 and %d walks, got %d", limit, len(WCs[i].walks))
+		}
+
+		// each walk visits one of the nodes of the group
+		for _, walk := range WCs[i].walks {
+			if !slices.ContainsFunc(walk, func(ID uint32) bool { return slices.Contains(nodeIDs[i], ID) }) {
+				t.Errorf("sampleBatch(): walk %v doesn't visit any of %v", walk, nodeIDs[i])
+			}
+		}
+	}
+}
+
+// setupBatch() returns a random DB and a RWS with the walks of all its nodes.
+func setupBatch(t testing.TB, nodesNum, edgesPerNode int) (models.Database, models.RandomWalkStore) {
+	t.Helper()
+	DB := mockdb.GenerateDB(nodesNum, edgesPerNode, rand.New(rand.NewSource(42)))
+	RWS, _ := mockstore.NewRWS(0.85, 10)
+
+	config := walks.NewGenerateConfig()
+	config.Seed = 42
+	if err := walks.GenerateAll(context.Background(), config, DB, RWS); err != nil {
+		t.Fatalf("GenerateAll(): expected nil, got %v", err)
+	}
+
+	return DB, RWS
+}
+
+func BenchmarkPersonalizedBatch(b *testing.B) {
+	ctx := context.Background()
+	DB, RWS := setupBatch(b, 2000, 50)
+
+	const sourcesNum = 100
+	sources := make([]uint32, sourcesNum)
+	for i := range sources {
+		sources[i] = uint32(i)
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, ID := range sources {
+				if _, err := Personalized(ctx, nil, DB, RWS, ID, 100); err != nil {
+					b.Fatalf("Personalized(): benchmark failed: %v", err)
+				}
+			}
+		}
+	})
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			config := NewBatchConfig()
+			config.Workers = workers
+
+			for i := 0; i < b.N; i++ {
+				if _, err := PersonalizedBatch(ctx, config, DB, RWS, sources, 100); err != nil {
+					b.Fatalf("PersonalizedBatch(): benchmark failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,18 @@ package pagerank
 import (
 	"context"
 	"errors"
+	"math/rand"
+	"sync"
 
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/walks"
 )
 
 // FollowCache contains a map nodeID --> follows, and the DB as a fallback mechanism.
+// When the DB is an in-memory snapshot (see csrdb), the fallback costs no round trip.
+// It's safe for concurrent use, so that it can be shared by many personalized walks.
 type FollowCache struct {
+	mu      sync.RWMutex
 	follows map[uint32][]uint32
 	DB      models.Database // used as a fallback
 }
@@ -28,7 +34,10 @@ func (FC *FollowCache) Follows(ctx context.Context, nodeID uint32) ([]uint32, er
 		return []uint32{}, ErrNilFCPointer
 	}
 
+	FC.mu.RLock()
 	follows, exists := FC.follows[nodeID]
+	FC.mu.RUnlock()
+
 	if !exists {
 		followsByNode, err := FC.DB.Follows(ctx, nodeID)
 		if err != nil {
@@ -36,12 +45,39 @@ func (FC *FollowCache) Follows(ctx context.Context, nodeID uint32) ([]uint32, er
 		}
 
 		follows = followsByNode[0]
+		FC.mu.Lock()
 		FC.follows[nodeID] = follows
+		FC.mu.Unlock()
 	}
 
 	return follows, nil
 }
 
+// Missing() returns the nodeIDs whose follows are not in the cache, without duplicates.
+func (FC *FollowCache) Missing(nodeIDs ...uint32) []uint32 {
+	if FC == nil {
+		return nodeIDs
+	}
+
+	FC.mu.RLock()
+	defer FC.mu.RUnlock()
+
+	missing := make([]uint32, 0, len(nodeIDs))
+	seen := make(map[uint32]struct{}, len(nodeIDs))
+	for _, ID := range nodeIDs {
+		if _, exists := FC.follows[ID]; exists {
+			continue
+		}
+
+		if _, exists := seen[ID]; !exists {
+			seen[ID] = struct{}{}
+			missing = append(missing, ID)
+		}
+	}
+
+	return missing
+}
+
 // Load() loads the follows of a slice of nodeIDs from the DB.
 func (FC *FollowCache) Load(ctx context.Context, nodeIDs ...uint32) error {
 	if FC == nil {
@@ -53,6 +89,9 @@ func (FC *FollowCache) Load(ctx context.Context, nodeIDs ...uint32) error {
 		return err
 	}
 
+	FC.mu.Lock()
+	defer FC.mu.Unlock()
+
 	for i, follows := range followsByNode {
 		ID := nodeIDs[i]
 		FC.follows[ID] = follows
@@ -106,9 +145,11 @@ func (WC *WalkCache) Next(nodeID uint32) (models.RandomWalk, bool) {
 }
 
 // Load() fetches up to `limit` walks from the RWS and adds them to the cache.
+// The walks are sampled with the rng, or by the RWS if it's nil (see [walks.SampleVisiting]).
 func (WC *WalkCache) Load(
 	ctx context.Context,
 	RWS models.RandomWalkStore,
+	rng *rand.Rand,
 	limit int,
 	nodeIDs ...uint32) error {
 
@@ -116,30 +157,42 @@ func (WC *WalkCache) Load(
 		return ErrNilWCPointer
 	}
 
-	walkIDs, err := RWS.WalksVisiting(ctx, limit, nodeIDs...)
+	// the walkIDs are sorted, because their order determines which walks are used
+	walkIDs, err := walks.SampleVisiting(ctx, rng, RWS, limit, nodeIDs...)
 	if err != nil {
 		return err
 	}
 
-	WC.walks, err = RWS.Walks(ctx, walkIDs...)
+	randomWalks, err := RWS.Walks(ctx, walkIDs...)
 	if err != nil {
 		return err
 	}
 
+	WC.Add(randomWalks...)
+	return nil
+}
+
+// Add() adds the walks to the cache. The walks are not modified, so they can be
+// shared by more caches.
+func (WC *WalkCache) Add(walks ...models.RandomWalk) {
+	if WC == nil {
+		return
+	}
+
 	// add the position of the walk in walks to each node visited by it,
 	// excluding the last one (which will be cropped out anyway)
-	for i, walk := range WC.walks {
-		for _, ID := range walk[:len(walk)-1] {
-			positions, exists := WC.positions[ID]
-			if !exists {
-				WC.positions[ID] = []int{}
-			}
+	for _, walk := range walks {
+		pos := len(WC.walks)
+		WC.walks = append(WC.walks, walk)
 
-			WC.positions[ID] = append(positions, i)
+		if len(walk) == 0 {
+			continue
 		}
-	}
 
-	return nil
+		for _, ID := range walk[:len(walk)-1] {
+			WC.positions[ID] = append(WC.positions[ID], pos)
+		}
+	}
 }
 
 // SetupFC() sets up a FollowCache based on the provided type.
@@ -146,6 +146,16 @@ func TestFCLoad(t *testing.T) {
 	})
 }
 
+func TestMissing(t *testing.T) {
+	FC := SetupFC(mock.SetupDB("one-node0"), "one-node0")
+	expected := []uint32{1, 2}
+
+	missing := FC.Missing(0, 1, 2, 1)
+	if !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Missing(): expected %v, got %v", expected, missing)
+	}
+}
+
 func TestNext(t *testing.T) {
 	testCases := []struct {
 		name            string
@@ -245,7 +255,7 @@ func TestWCLoad(t *testing.T) {
 				RWS := mockstore.SetupRWS(test.RWSType)
 				WC := NewWalkCache(1)
 
-				err := WC.Load(context.Background(), RWS, test.limit, test.nodeIDs...)
+				err := WC.Load(context.Background(), RWS, nil, test.limit, test.nodeIDs...)
 				if !errors.Is(err, test.expectedError) {
 					t.Fatalf("Load(): expected %v, got %v", test.expectedError, err)
 				}
@@ -258,7 +268,7 @@ func TestWCLoad(t *testing.T) {
 		WC := NewWalkCache(1)
 		nodeIDs := []uint32{0, 3}
 
-		err := WC.Load(context.Background(), RWS, 100, nodeIDs...)
+		err := WC.Load(context.Background(), RWS, nil, 100, nodeIDs...)
 		if err != nil {
 			t.Fatalf("Load(): expected nil, got %v", err)
 		}
@@ -283,6 +293,27 @@ func TestWCLoad(t *testing.T) {
 	})
 }
 
+func TestWCAdd(t *testing.T) {
+	WC := NewWalkCache(1)
+	WC.Add(models.RandomWalk{0, 1, 2}, models.RandomWalk{}, models.RandomWalk{1, 0})
+
+	expectedPos := map[uint32][]int{
+		0: {0},
+		1: {0, 2},
+		2: nil, // the last node of a walk is excluded
+	}
+
+	for ID, expected := range expectedPos {
+		if pos := WC.positions[ID]; !reflect.DeepEqual(pos, expected) {
+			t.Errorf("positions(%d): expected %v, got %v", ID, expected, pos)
+		}
+	}
+
+	if len(WC.walks) != 3 {
+		t.Errorf("Add(): expected 3 walks, got %v", WC.walks)
+	}
+}
+
 func TestCropWalk(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -5,9 +5,10 @@ import (
 	"errors"
 	"math"
 	"math/rand"
-	"time"
+	"sort"
 
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/utils/sliceutils"
 	"github.com/vertex-lab/crawler/pkg/walks"
 )
@@ -98,6 +99,7 @@ func (p *PersonalizedWalk) Append(walk models.RandomWalk) {
 Personalized() computes the personalized pagerank of nodeID by simulating a
 long random walk starting at and resetting to itself. This long walk is generated
 from the random walks stored in the RandomWalkStore.
+The random numbers are drawn from src, which can be nil.
 
 # REFERENCES
 
@@ -106,6 +108,7 @@ URL: http://snap.stanford.edu/class/cs224w-readings/bahmani10pagerank.pdf
 */
 func Personalized(
 	ctx context.Context,
+	src *randutils.Source,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32,
@@ -115,18 +118,138 @@ func Personalized(
 		return nil, err
 	}
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return personalized(ctx, rng, DB, RWS, nodeID, topK)
+	pp, _, err := personalized(ctx, src, DB, RWS, nodeID, topK)
+	return pp, err
 }
 
-// The personalized() function implements the internal logic of the Personalized Pagerank algorithm
+// ScoredNode is a node with its personalized pagerank, and the bounds of the
+// confidence interval of the score.
+type ScoredNode struct {
+	ID     uint32  `json:"id"`
+	Pubkey string  `json:"pubkey"`
+	Score  float64 `json:"score"`
+	Lower  float64 `json:"lower"`
+	Upper  float64 `json:"upper"`
+}
+
+/*
+PersonalizedTopK() returns up to topK nodes with the highest personalized pagerank
+of nodeID, sorted by score in descending order, with their pubkeys.
+If excludeFollows is true, nodeID and the nodes it follows are excluded, and the
+scores are not normalized again.
+
+Each score comes with a 95% confidence interval that shrinks with the length of
+the personalized walk (see [ConfidenceInterval]).
+*/
+func PersonalizedTopK(
+	ctx context.Context,
+	src *randutils.Source,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	nodeID uint32,
+	topK uint16,
+	excludeFollows bool) ([]ScoredNode, error) {
+
+	if err := checkInputs(DB, RWS, nodeID, topK); err != nil {
+		return nil, err
+	}
+
+	pp, length, err := personalized(ctx, src, DB, RWS, nodeID, topK)
+	if err != nil {
+		return nil, err
+	}
+
+	if excludeFollows {
+		follows, err := DB.Follows(ctx, nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		delete(pp, nodeID)
+		for _, ID := range follows[0] {
+			delete(pp, ID)
+		}
+	}
+
+	nodeIDs := TopNodes(pp, int(topK))
+	pubkeys, err := DB.Pubkeys(ctx, nodeIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	alpha := RWS.Alpha(ctx)
+	nodes := make([]ScoredNode, 0, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if pubkeys[i] == nil {
+			continue
+		}
+
+		lower, upper := ConfidenceInterval(pp[ID], length, alpha)
+		nodes = append(nodes, ScoredNode{ID: ID, Pubkey: *pubkeys[i], Score: pp[ID], Lower: lower, Upper: upper})
+	}
+
+	return nodes, nil
+}
+
+/*
+ConfidenceInterval() returns the bounds of the 95% confidence interval of a
+score estimated from a personalized walk of the specified length.
+
+The walk is made of segments that start from the source, with an average length of 1/(1-alpha).
+Since visits within the same segment are correlated, the segments are treated
+as the independent samples, and the interval is the normal approximation of the
+binomial one with n = length * (1-alpha). The bounds are clipped to [0,1].
+A length of 0 means the score is exact (e.g. the source is a dandling node).
+*/
+func ConfidenceInterval(score float64, length int, alpha float32) (float64, float64) {
+	if length <= 0 {
+		return score, score
+	}
+
+	const z = 1.96
+	samples := math.Max(float64(length)*(1-float64(alpha)), 1)
+	margin := z * math.Sqrt(score*(1-score)/samples)
+	return math.Max(score-margin, 0), math.Min(score+margin, 1)
+}
+
+// The personalized() function implements the internal logic of the Personalized Pagerank algorithm.
+// It also returns the length of the personalized walk, which is 0 if nodeID is a dandling node.
 func personalized(
 	ctx context.Context,
-	rng *rand.Rand,
+	src *randutils.Source,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32,
-	topK uint16) (models.PagerankMap, error) {
+	topK uint16) (models.PagerankMap, int, error) {
+
+	walk, err := sourceWalk(ctx, src, DB, RWS, nodeID, topK)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// if it's a dandling node, return this special case distribution
+	if walk == nil {
+		return models.PagerankMap{nodeID: 1.0}, 0, nil
+	}
+
+	return countAndNormalize(walk), len(walk), nil
+}
+
+// sourceWalk() loads the caches and returns the personalized walk of nodeID,
+// long enough for the precision required by topK. It returns nil if nodeID is a dandling node.
+// If src is seeded, the walks of the cache are sampled with its generator, and the follows
+// are walked in ascending order, to make the result reproducible.
+func sourceWalk(
+	ctx context.Context,
+	src *randutils.Source,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	nodeID uint32,
+	topK uint16) (models.RandomWalk, error) {
+
+	if src.Seeded() {
+		DB = walks.SortedFollows(DB)
+	}
 
 	followSlice, err := DB.Follows(ctx, nodeID)
 	if err != nil {
@@ -134,9 +257,8 @@ func personalized(
 	}
 	follows := followSlice[0]
 
-	// if it's a dandling node, return this special case distribution
 	if len(follows) == 0 {
-		return models.PagerankMap{nodeID: 1.0}, nil
+		return nil, nil
 	}
 
 	FC := NewFollowCache(DB, len(follows)+1)
@@ -147,17 +269,18 @@ func personalized(
 
 	alpha := RWS.Alpha(ctx)
 	lenght := requiredLenght(topK, alpha)
-	WC := NewWalkCache(1)
-	if err := WC.Load(ctx, RWS, walksNeeded(lenght, alpha), append(follows, nodeID)...); err != nil {
-		return nil, err
+	rng := src.Rand()
+	var sampler *rand.Rand
+	if src.Seeded() {
+		sampler = rng
 	}
 
-	walk, err := personalizedWalk(ctx, rng, FC, WC, nodeID, lenght, alpha)
-	if err != nil {
+	WC := NewWalkCache(1)
+	if err := WC.Load(ctx, RWS, sampler, walksNeeded(lenght, alpha), append(follows, nodeID)...); err != nil {
 		return nil, err
 	}
 
-	return countAndNormalize(walk), nil
+	return personalizedWalk(ctx, rng, FC, WC, nodeID, lenght, alpha)
 }
 
 // The personalizedWalk() function simulates a long personalized random walk
@@ -256,6 +379,28 @@ func requiredLenght(topK uint16, alpha float32) int {
 	return int(math.Round(res))
 }
 
+// TopNodes() returns up to k nodeIDs with the highest pagerank, sorted in descending order.
+// Ties are broken by the lowest nodeID first, to make the result deterministic.
+func TopNodes(pagerank models.PagerankMap, k int) []uint32 {
+	nodeIDs := make([]uint32, 0, len(pagerank))
+	for ID := range pagerank {
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	sort.Slice(nodeIDs, func(i, j int) bool {
+		if pagerank[nodeIDs[i]] != pagerank[nodeIDs[j]] {
+			return pagerank[nodeIDs[i]] > pagerank[nodeIDs[j]]
+		}
+		return nodeIDs[i] < nodeIDs[j]
+	})
+
+	if k >= 0 && len(nodeIDs) > k {
+		nodeIDs = nodeIDs[:k]
+	}
+
+	return nodeIDs
+}
+
 // Distance() returns the L1 distance between two maps, that are supposed to have the same lenght.
 func Distance(map1, map2 models.PagerankMap) float64 {
 	var distance float64
@@ -265,6 +410,35 @@ func Distance(map1, map2 models.PagerankMap) float64 {
 	return distance
 }
 
+/*
+RankCorrelation() returns the Spearman's rank correlation between the rankings of
+the top k nodes of reference, and the ranking of the same nodes in estimate.
+It's 1 when the two rankings are the same, and -1 when one is the reverse of the other.
+Ties are broken by the lowest nodeID first, like in [TopNodes].
+*/
+func RankCorrelation(reference, estimate models.PagerankMap, k int) float64 {
+	top := TopNodes(reference, k)
+	n := len(top)
+	if n < 2 {
+		return 1
+	}
+
+	position := make(map[uint32]int, n)
+	topEstimate := make(models.PagerankMap, n)
+	for i, ID := range top {
+		position[ID] = i
+		topEstimate[ID] = estimate[ID]
+	}
+
+	var squaredDiff float64
+	for i, ID := range TopNodes(topEstimate, n) {
+		d := float64(i - position[ID])
+		squaredDiff += d * d
+	}
+
+	return 1 - 6*squaredDiff/float64(n*(n*n-1))
+}
+
 // function that checks the inputs of Personalized Pagerank;
 func checkInputs(DB models.Database, RWS models.RandomWalkStore,
 	nodeID uint32, topK uint16) error {
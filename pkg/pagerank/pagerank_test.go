@@ -3,6 +3,8 @@ package pagerank
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -11,6 +13,7 @@ import (
 	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
 	"github.com/vertex-lab/crawler/pkg/models"
 	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/walks"
 )
 
@@ -432,7 +435,7 @@ func TestPersonalizedPagerank(t *testing.T) {
 				DB := mockdb.SetupDB(test.DBType)
 				RWS := mockstore.SetupRWS(test.RWSType)
 
-				_, err := Personalized(ctx, DB, RWS, test.nodeID, test.topK)
+				_, err := Personalized(ctx, nil, DB, RWS, test.nodeID, test.topK)
 				if !errors.Is(err, test.expectedError) {
 					t.Errorf("Personalized(): expected %v, got %v", test.expectedError, err)
 				}
@@ -449,19 +452,241 @@ func TestPersonalizedPagerank(t *testing.T) {
 		DB := mockdb.GenerateDB(nodesNum, edgesPerNode, rng)
 		RWS, _ := mockstore.NewRWS(0.85, 10)
 
-		if err := walks.GenerateAll(ctx, DB, RWS); err != nil {
+		if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
 			t.Fatalf("GenerateAll(): expected nil, got %v", err)
 		}
 
-		if _, err := Personalized(ctx, DB, RWS, 0, 5); err != nil {
+		if _, err := Personalized(ctx, nil, DB, RWS, 0, 5); err != nil {
 			t.Fatalf("Personalized() expected nil, got %v", err)
 		}
 
 		// doing it two times to check that it donesn't change the DB or RWS
-		if _, err := Personalized(ctx, DB, RWS, 0, 5); err != nil {
+		if _, err := Personalized(ctx, nil, DB, RWS, 0, 5); err != nil {
 			t.Errorf("Personalized() expected nil, got %v", err)
 		}
 	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		ctx := context.Background()
+		DB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(42)))
+		RWS, _ := mockstore.NewRWS(0.85, 10)
+
+		if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		pp1, err := Personalized(ctx, randutils.NewSource(69), DB, RWS, 0, 50)
+		if err != nil {
+			t.Fatalf("Personalized() expected nil, got %v", err)
+		}
+
+		pp2, err := Personalized(ctx, randutils.NewSource(69), DB, RWS, 0, 50)
+		if err != nil {
+			t.Fatalf("Personalized() expected nil, got %v", err)
+		}
+
+		if !reflect.DeepEqual(pp1, pp2) {
+			t.Errorf("Personalized(): expected the same pagerank with the same seed, got %v and %v", pp1, pp2)
+		}
+	})
+}
+
+func TestPersonalizedTopK(t *testing.T) {
+	t.Run("simple errors", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			DBType        string
+			nodeID        uint32
+			topK          uint16
+			expectedError error
+		}{
+			{name: "nil DB", DBType: "nil", nodeID: 0, topK: 5, expectedError: models.ErrNilDB},
+			{name: "node not found", DBType: "triangle", nodeID: 69, topK: 5, expectedError: models.ErrNodeNotFoundDB},
+			{name: "invalid topK", DBType: "triangle", nodeID: 0, topK: 0, expectedError: ErrInvalidTopN},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				DB := mockdb.SetupDB(test.DBType)
+				RWS := mockstore.SetupRWS("triangle")
+
+				_, err := PersonalizedTopK(context.Background(), nil, DB, RWS, test.nodeID, test.topK, false)
+				if !errors.Is(err, test.expectedError) {
+					t.Errorf("PersonalizedTopK(): expected %v, got %v", test.expectedError, err)
+				}
+			})
+		}
+	})
+
+	t.Run("dandling node", func(t *testing.T) {
+		DB := mockdb.SetupDB("simple")
+		RWS := mockstore.SetupRWS("one-node0")
+
+		nodes, err := PersonalizedTopK(context.Background(), nil, DB, RWS, 1, 5, false)
+		if err != nil {
+			t.Fatalf("PersonalizedTopK(): expected nil, got %v", err)
+		}
+
+		expected := []ScoredNode{{ID: 1, Pubkey: "1", Score: 1, Lower: 1, Upper: 1}}
+		if !reflect.DeepEqual(nodes, expected) {
+			t.Errorf("PersonalizedTopK(): expected %v, got %v", expected, nodes)
+		}
+	})
+
+	testCases := []struct {
+		name           string
+		topK           uint16
+		excludeFollows bool
+		expectedIDs    []uint32
+	}{
+		{name: "truncated", topK: 2, expectedIDs: []uint32{0, 1}},
+		{name: "all nodes", topK: 5, expectedIDs: []uint32{0, 1, 2}},
+		{name: "exclude follows", topK: 5, excludeFollows: true, expectedIDs: []uint32{2}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			// 0 --> 1 --> 2 --> 0, so the scores decrease along the cycle
+			DB := mockdb.SetupDB("triangle")
+			RWS := mockstore.SetupRWS("triangle")
+
+			nodes, err := PersonalizedTopK(context.Background(), randutils.NewSource(69), DB, RWS, 0, test.topK, test.excludeFollows)
+			if err != nil {
+				t.Fatalf("PersonalizedTopK(): expected nil, got %v", err)
+			}
+
+			IDs := make([]uint32, len(nodes))
+			for i, node := range nodes {
+				IDs[i] = node.ID
+				if node.Pubkey != fmt.Sprint(node.ID) {
+					t.Errorf("PersonalizedTopK(): expected pubkey %d, got %v", node.ID, node.Pubkey)
+				}
+
+				if node.Lower > node.Score || node.Score > node.Upper || node.Lower == node.Upper {
+					t.Errorf("PersonalizedTopK(): invalid confidence interval %v", node)
+				}
+			}
+
+			if !reflect.DeepEqual(IDs, test.expectedIDs) {
+				t.Errorf("PersonalizedTopK(): expected %v, got %v", test.expectedIDs, IDs)
+			}
+		})
+	}
+}
+
+func TestConfidenceInterval(t *testing.T) {
+	testCases := []struct {
+		name          string
+		score         float64
+		length        int
+		expectedLower float64
+		expectedUpper float64
+	}{
+		{name: "exact score", score: 0.3, length: 0, expectedLower: 0.3, expectedUpper: 0.3},
+		{name: "valid", score: 0.5, length: 10000, expectedLower: 0.4747, expectedUpper: 0.5253},
+		{name: "clipped", score: 0.01, length: 100, expectedLower: 0, expectedUpper: 0.0604},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			lower, upper := ConfidenceInterval(test.score, test.length, 0.85)
+			if math.Abs(lower-test.expectedLower) > 1e-4 || math.Abs(upper-test.expectedUpper) > 1e-4 {
+				t.Errorf("ConfidenceInterval(): expected (%v, %v), got (%v, %v)", test.expectedLower, test.expectedUpper, lower, upper)
+			}
+		})
+	}
+}
+
+func TestTopNodes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		pagerank    models.PagerankMap
+		k           int
+		expectedIDs []uint32
+	}{
+		{
+			name:        "nil pagerank",
+			pagerank:    nil,
+			k:           3,
+			expectedIDs: []uint32{},
+		},
+		{
+			name:        "k bigger than size",
+			pagerank:    models.PagerankMap{0: 0.1, 1: 0.6, 2: 0.3},
+			k:           5,
+			expectedIDs: []uint32{1, 2, 0},
+		},
+		{
+			name:        "ties",
+			pagerank:    models.PagerankMap{0: 0.2, 1: 0.4, 2: 0.2, 3: 0.2},
+			k:           3,
+			expectedIDs: []uint32{1, 0, 2},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			nodeIDs := TopNodes(test.pagerank, test.k)
+			if !reflect.DeepEqual(nodeIDs, test.expectedIDs) {
+				t.Errorf("TopNodes(): expected %v, got %v", test.expectedIDs, nodeIDs)
+			}
+		})
+	}
+}
+
+func TestRankCorrelation(t *testing.T) {
+	reference := models.PagerankMap{0: 0.4, 1: 0.3, 2: 0.2, 3: 0.1}
+	testCases := []struct {
+		name     string
+		estimate models.PagerankMap
+		k        int
+		expected float64
+	}{
+		{
+			name:     "same ranking",
+			estimate: models.PagerankMap{0: 0.7, 1: 0.2, 2: 0.07, 3: 0.03},
+			k:        4,
+			expected: 1,
+		},
+		{
+			name:     "reversed ranking",
+			estimate: models.PagerankMap{0: 0.1, 1: 0.2, 2: 0.3, 3: 0.4},
+			k:        4,
+			expected: -1,
+		},
+		{
+			name:     "one swap",
+			estimate: models.PagerankMap{0: 0.3, 1: 0.4, 2: 0.2, 3: 0.1},
+			k:        4,
+			expected: 0.8,
+		},
+		{
+			name:     "only the top k",
+			estimate: models.PagerankMap{0: 0.4, 1: 0.3, 2: 0.1, 3: 0.2},
+			k:        2,
+			expected: 1,
+		},
+		{
+			name:     "missing nodes",
+			estimate: models.PagerankMap{},
+			k:        3,
+			expected: 1, // all ties, broken by nodeID like in the reference
+		},
+		{
+			name:     "single node",
+			estimate: models.PagerankMap{3: 1},
+			k:        1,
+			expected: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if rho := RankCorrelation(reference, test.estimate, test.k); math.Abs(rho-test.expected) > 1e-10 {
+				t.Errorf("RankCorrelation(): expected %v, got %v", test.expected, rho)
+			}
+		})
+	}
 }
 
 // ----------------------------------BENCHMARKS--------------------------------
@@ -0,0 +1,191 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+const (
+	// the number of nodes whose follows are fetched at once
+	powerBatchSize int = 10000
+
+	// the maximum number of iterations before giving up on the tolerance
+	maxIterations int = 1000
+)
+
+/*
+PowerIteration() computes the exact global pagerank of all the nodes in the DB
+with the power iteration method, stopping when the L1 distance between two
+consecutive iterations is below tolerance.
+
+The result is the distribution that the Monte-Carlo estimate of [Global] converges to:
+walks start from each active node, continue with probability alpha to a random follow,
+and stop at dandling nodes. The pagerank of a node is its share of all the visits.
+In formula, the visits are the solution of x = v + alpha * x * P, where v is uniform
+over the active nodes and P is the transition matrix, whose rows of dandling nodes are zero.
+
+The only difference is that the random walks break when they encounter a cycle,
+which can't be expressed as a matrix. Hence the two distributions are identical
+only on acyclic graphs, and very close when cycles are rare (see [walks.Generate]).
+
+The whole graph is loaded in memory, so this is meant for audits and tests.
+*/
+func PowerIteration(
+	ctx context.Context,
+	DB models.Database,
+	alpha float32,
+	tolerance float64) (models.PagerankMap, error) {
+
+	if err := DB.Validate(); err != nil {
+		return nil, fmt.Errorf("PowerIteration(): %w", err)
+	}
+
+	if alpha <= 0 || alpha >= 1 {
+		return nil, fmt.Errorf("PowerIteration(): %w", models.ErrInvalidAlpha)
+	}
+
+	if tolerance <= 0 {
+		return nil, fmt.Errorf("PowerIteration(): %w", ErrInvalidTolerance)
+	}
+
+	G, err := loadGraph(ctx, DB)
+	if err != nil {
+		return nil, fmt.Errorf("PowerIteration(): %w", err)
+	}
+
+	if len(G.sources) == 0 {
+		return nil, fmt.Errorf("PowerIteration(): %w", ErrNoActiveNodes)
+	}
+
+	// the expected visits of each node, starting from the first step of the walks
+	start := 1.0 / float64(len(G.sources))
+	visits := make([]float64, len(G.nodeIDs))
+	next := make([]float64, len(G.nodeIDs))
+	for _, i := range G.sources {
+		visits[i] = start
+	}
+
+	converged := false
+	for iter := 0; iter < maxIterations; iter++ {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("PowerIteration(): %w", err)
+		}
+
+		clear(next)
+		for _, i := range G.sources {
+			next[i] = start
+		}
+
+		for i := range G.nodeIDs {
+			follows := G.follows[G.offsets[i]:G.offsets[i+1]]
+			if len(follows) == 0 {
+				continue
+			}
+
+			share := float64(alpha) * visits[i] / float64(len(follows))
+			for _, j := range follows {
+				next[j] += share
+			}
+		}
+
+		var distance float64
+		for i := range visits {
+			distance += math.Abs(next[i] - visits[i])
+		}
+
+		visits, next = next, visits
+		if distance < tolerance {
+			converged = true
+			break
+		}
+	}
+
+	if !converged {
+		return nil, fmt.Errorf("PowerIteration(): %w after %d iterations", ErrNotConverged, maxIterations)
+	}
+
+	var totalVisits float64
+	for _, v := range visits {
+		totalVisits += v
+	}
+
+	pagerank := make(models.PagerankMap, len(G.nodeIDs))
+	for i, ID := range G.nodeIDs {
+		pagerank[ID] = visits[i] / totalVisits
+	}
+
+	return pagerank, nil
+}
+
+// graph is the follow graph in compressed sparse row form, where nodes are
+// identified by their position in nodeIDs.
+type graph struct {
+	nodeIDs []uint32
+	offsets []int // the follows of node i are follows[offsets[i]:offsets[i+1]]
+	follows []int
+	sources []int // the active nodes, where the walks start
+}
+
+// loadGraph() fetches all the nodes and their follows from the DB, in batches of powerBatchSize.
+func loadGraph(ctx context.Context, DB models.Database) (*graph, error) {
+	nodeIDs, err := DB.AllNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(nodeIDs)
+
+	index := make(map[uint32]int, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		index[ID] = i
+	}
+
+	G := &graph{
+		nodeIDs: nodeIDs,
+		offsets: make([]int, 1, len(nodeIDs)+1),
+	}
+
+	for start := 0; start < len(nodeIDs); start += powerBatchSize {
+		batch := nodeIDs[start:min(start+powerBatchSize, len(nodeIDs))]
+		followsByNode, err := DB.Follows(ctx, batch...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the follows: %w", err)
+		}
+
+		for _, follows := range followsByNode {
+			for _, ID := range follows {
+				if j, exists := index[ID]; exists {
+					G.follows = append(G.follows, j)
+				}
+			}
+			G.offsets = append(G.offsets, len(G.follows))
+		}
+
+		nodes, err := DB.Nodes(ctx, batch...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the nodes: %w", err)
+		}
+
+		for i, node := range nodes {
+			if node == nil {
+				return nil, fmt.Errorf("failed to fetch nodeID %d: %w", batch[i], models.ErrNodeNotFoundDB)
+			}
+
+			if node.Status == models.StatusActive {
+				G.sources = append(G.sources, start+i)
+			}
+		}
+	}
+
+	return G, nil
+}
+
+var (
+	ErrInvalidTolerance = errors.New("tolerance should be greater than 0")
+	ErrNoActiveNodes    = errors.New("there are no active nodes")
+	ErrNotConverged     = errors.New("power iteration did not converge")
+)
@@ -0,0 +1,168 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	mapset "github.com/deckarep/golang-set/v2"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/walks"
+)
+
+// chainDB() returns a database with the chain 0 --> 1 --> 2, where only the specified nodes are active.
+func chainDB(active ...uint32) *mockdb.Database {
+	DB := mockdb.NewDatabase()
+	for ID := uint32(0); ID < 3; ID++ {
+		DB.NodeIndex[ID] = &models.Node{ID: ID, Status: models.StatusInactive}
+	}
+	for _, ID := range active {
+		DB.NodeIndex[ID].Status = models.StatusActive
+	}
+
+	DB.Follow[0] = mapset.NewSet[uint32](1)
+	DB.Follow[1] = mapset.NewSet[uint32](2)
+	DB.Follow[2] = mapset.NewSet[uint32]()
+	return DB
+}
+
+// activate() makes all the nodes of DB active.
+func activate(DB *mockdb.Database) *mockdb.Database {
+	for _, node := range DB.NodeIndex {
+		node.Status = models.StatusActive
+	}
+	return DB
+}
+
+func TestPowerIteration(t *testing.T) {
+	const a = 0.85
+	t.Run("simple errors", func(t *testing.T) {
+		testCases := []struct {
+			name          string
+			DB            models.Database
+			alpha         float32
+			tolerance     float64
+			expectedError error
+		}{
+			{
+				name:          "nil DB",
+				DB:            mockdb.SetupDB("nil"),
+				alpha:         a,
+				tolerance:     1e-10,
+				expectedError: models.ErrNilDB,
+			},
+			{
+				name:          "empty DB",
+				DB:            mockdb.SetupDB("empty"),
+				alpha:         a,
+				tolerance:     1e-10,
+				expectedError: models.ErrEmptyDB,
+			},
+			{
+				name:          "invalid alpha",
+				DB:            chainDB(0),
+				alpha:         1,
+				tolerance:     1e-10,
+				expectedError: models.ErrInvalidAlpha,
+			},
+			{
+				name:          "invalid tolerance",
+				DB:            chainDB(0),
+				alpha:         a,
+				tolerance:     0,
+				expectedError: ErrInvalidTolerance,
+			},
+			{
+				name:          "no active nodes",
+				DB:            chainDB(),
+				alpha:         a,
+				tolerance:     1e-10,
+				expectedError: ErrNoActiveNodes,
+			},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				_, err := PowerIteration(context.Background(), test.DB, test.alpha, test.tolerance)
+				if !errors.Is(err, test.expectedError) {
+					t.Errorf("PowerIteration(): expected %v, got %v", test.expectedError, err)
+				}
+			})
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		alpha := float64(float32(a))
+		testCases := []struct {
+			name             string
+			DB               models.Database
+			expectedPagerank models.PagerankMap
+		}{
+			{
+				name: "chain, all active",
+				DB:   chainDB(0, 1, 2),
+				expectedPagerank: models.PagerankMap{
+					0: 1 / (3 + 2*alpha + alpha*alpha),
+					1: (1 + alpha) / (3 + 2*alpha + alpha*alpha),
+					2: (1 + alpha + alpha*alpha) / (3 + 2*alpha + alpha*alpha),
+				},
+			},
+			{
+				name: "chain, only node0 active",
+				DB:   chainDB(0),
+				expectedPagerank: models.PagerankMap{
+					0: 1 / (1 + alpha + alpha*alpha),
+					1: alpha / (1 + alpha + alpha*alpha),
+					2: alpha * alpha / (1 + alpha + alpha*alpha),
+				},
+			},
+			{
+				name:             "triangle",
+				DB:               activate(mockdb.SetupDB("triangle")),
+				expectedPagerank: models.PagerankMap{0: 1.0 / 3, 1: 1.0 / 3, 2: 1.0 / 3},
+			},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				pagerank, err := PowerIteration(context.Background(), test.DB, a, 1e-12)
+				if err != nil {
+					t.Fatalf("PowerIteration(): expected nil, got %v", err)
+				}
+
+				if Distance(pagerank, test.expectedPagerank) > 1e-9 {
+					t.Errorf("PowerIteration(): expected %v, got %v", test.expectedPagerank, pagerank)
+				}
+			})
+		}
+	})
+
+	t.Run("monte carlo", func(t *testing.T) {
+		ctx := context.Background()
+		DB := activate(mockdb.GenerateDB(100, 5, rand.New(rand.NewSource(42))))
+
+		RWS, _ := mockstore.NewRWS(0.85, 1000)
+		if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		exact, err := PowerIteration(ctx, DB, 0.85, 1e-10)
+		if err != nil {
+			t.Fatalf("PowerIteration(): expected nil, got %v", err)
+		}
+
+		nodeIDs, _ := DB.AllNodes(ctx)
+		estimate, err := Global(ctx, RWS, nodeIDs...)
+		if err != nil {
+			t.Fatalf("Global(): expected nil, got %v", err)
+		}
+
+		// the walks break on cycles, so the two are close but not identical
+		if distance := Distance(exact, estimate); distance > 0.1 {
+			t.Errorf("PowerIteration(): expected distance from the estimate below 0.1, got %v", distance)
+		}
+	})
+}
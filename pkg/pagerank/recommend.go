@@ -0,0 +1,214 @@
+package pagerank
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
+)
+
+// the maximum number of follows listed in Recommendation.Via
+const maxVia int = 3
+
+// Recommendation is a node that the source doesn't follow yet, together with
+// the data that explains why it was recommended.
+type Recommendation struct {
+	Pubkey string  `json:"pubkey"`
+	Score  float64 `json:"score"` // the personalized pagerank relative to the source
+
+	// the pubkeys of the source's follows through which the personalized walk
+	// reached the node most often, sorted by the number of visits
+	Via []string `json:"via"`
+
+	// the number of the source's follows that follow the node
+	Mutuals int `json:"mutuals"`
+}
+
+/*
+Recommend() returns up to topK nodes that the source doesn't follow, sorted by
+their personalized pagerank relative to the source, in descending order.
+
+Each recommendation is explained by:
+  - the follows of the source that lead to the node, found by looking at which
+    follow every segment of the personalized walk went through
+  - the number of follows of the source that also follow the node (mutuals)
+*/
+func Recommend(
+	ctx context.Context,
+	src *randutils.Source,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	source string,
+	topK uint16) ([]Recommendation, error) {
+
+	if err := DB.Validate(); err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	IDs, err := DB.NodeIDs(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	if len(IDs) != 1 || IDs[0] == nil {
+		return nil, fmt.Errorf("Recommend(): %w: %s", models.ErrNodeNotFoundDB, source)
+	}
+	sourceID := *IDs[0]
+
+	if err := checkInputs(DB, RWS, sourceID, topK); err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	walk, err := sourceWalk(ctx, src, DB, RWS, sourceID, topK)
+	if err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	if walk == nil {
+		// a dandling node follows nobody, so there are no follows to explain the recommendations
+		return []Recommendation{}, nil
+	}
+
+	follows, err := DB.Follows(ctx, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	scores := countAndNormalize(walk)
+	delete(scores, sourceID)
+	for _, ID := range follows[0] {
+		delete(scores, ID)
+	}
+
+	candidates := TopNodes(scores, int(topK))
+	recs, err := explain(ctx, DB, follows[0], candidates, viaCounts(walk, sourceID))
+	if err != nil {
+		return nil, fmt.Errorf("Recommend(): %w", err)
+	}
+
+	for i := range recs {
+		recs[i].Score = scores[candidates[i]]
+	}
+
+	return slices.DeleteFunc(recs, func(r Recommendation) bool { return r.Pubkey == "" }), nil
+}
+
+/*
+viaCounts() returns, for each node visited by the personalized walk of sourceID,
+how many times it was reached through each follow of the source.
+
+The personalized walk is a sequence of segments that start from the source, whose
+second node is the follow that the segment went through. Because cycles are trimmed,
+the source only appears at the start of a segment.
+*/
+func viaCounts(walk models.RandomWalk, sourceID uint32) map[uint32]map[uint32]int {
+	counts := make(map[uint32]map[uint32]int)
+	var via uint32
+	for i, ID := range walk {
+		if ID == sourceID {
+			continue
+		}
+
+		if walk[i-1] == sourceID {
+			via = ID
+		}
+
+		if counts[ID] == nil {
+			counts[ID] = make(map[uint32]int)
+		}
+		counts[ID][via]++
+	}
+
+	return counts
+}
+
+// explain() returns the recommendations of the candidates, without their score.
+// The pubkey of a candidate that is not in the DB is empty.
+func explain(
+	ctx context.Context,
+	DB models.Database,
+	follows []uint32,
+	candidates []uint32,
+	via map[uint32]map[uint32]int) ([]Recommendation, error) {
+
+	if len(candidates) == 0 {
+		return []Recommendation{}, nil
+	}
+
+	followers, err := DB.Followers(ctx, candidates...)
+	if err != nil {
+		return nil, err
+	}
+
+	isFollow := make(map[uint32]struct{}, len(follows))
+	for _, ID := range follows {
+		isFollow[ID] = struct{}{}
+	}
+
+	// the IDs of all the follows that appear in the explanations, to fetch their pubkeys at once
+	viaIDs := make([][]uint32, len(candidates))
+	unique := make(map[uint32]struct{})
+	for i, ID := range candidates {
+		viaIDs[i] = topVia(via[ID])
+		for _, f := range viaIDs[i] {
+			unique[f] = struct{}{}
+		}
+	}
+
+	nodeIDs := make([]uint32, 0, len(candidates)+len(unique))
+	nodeIDs = append(nodeIDs, candidates...)
+	for ID := range unique {
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	pubkeys, err := DB.Pubkeys(ctx, nodeIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	pubkeyOf := make(map[uint32]string, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		if pubkeys[i] != nil {
+			pubkeyOf[ID] = *pubkeys[i]
+		}
+	}
+
+	recs := make([]Recommendation, len(candidates))
+	for i, ID := range candidates {
+		recs[i].Pubkey = pubkeyOf[ID]
+		recs[i].Via = make([]string, 0, len(viaIDs[i]))
+		for _, f := range viaIDs[i] {
+			if pk, exists := pubkeyOf[f]; exists {
+				recs[i].Via = append(recs[i].Via, pk)
+			}
+		}
+
+		for _, f := range followers[i] {
+			if _, exists := isFollow[f]; exists {
+				recs[i].Mutuals++
+			}
+		}
+	}
+
+	return recs, nil
+}
+
+// topVia() returns up to maxVia follows with the most visits, breaking ties by the lowest ID.
+func topVia(counts map[uint32]int) []uint32 {
+	IDs := make([]uint32, 0, len(counts))
+	for ID := range counts {
+		IDs = append(IDs, ID)
+	}
+
+	slices.SortFunc(IDs, func(ID1, ID2 uint32) int {
+		if counts[ID1] != counts[ID2] {
+			return cmp.Compare(counts[ID2], counts[ID1])
+		}
+		return cmp.Compare(ID1, ID2)
+	})
+
+	return IDs[:min(len(IDs), maxVia)]
+}
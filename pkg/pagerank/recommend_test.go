@@ -0,0 +1,117 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+)
+
+func TestRecommend(t *testing.T) {
+	testCases := []struct {
+		name          string
+		DBType        string
+		source        string
+		topK          uint16
+		expectedRecs  []Recommendation
+		expectedError error
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			source:        "0",
+			topK:          5,
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "source not found",
+			DBType:        "triangle",
+			source:        "69",
+			topK:          5,
+			expectedError: models.ErrNodeNotFoundDB,
+		},
+		{
+			name:          "invalid topK",
+			DBType:        "triangle",
+			source:        "0",
+			topK:          0,
+			expectedError: ErrInvalidTopN,
+		},
+		{
+			name:         "dandling source",
+			DBType:       "simple",
+			source:       "1",
+			topK:         5,
+			expectedRecs: []Recommendation{},
+		},
+		{
+			// 0 --> 1 --> 2 --> 0
+			name:         "valid",
+			DBType:       "triangle",
+			source:       "0",
+			topK:         5,
+			expectedRecs: []Recommendation{{Pubkey: "2", Via: []string{"1"}, Mutuals: 1}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			DB := mockdb.SetupDB(test.DBType)
+			RWS := mockstore.SetupRWS("triangle")
+
+			recs, err := Recommend(context.Background(), nil, DB, RWS, test.source, test.topK)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Recommend(): expected %v, got %v", test.expectedError, err)
+			}
+
+			for i := range recs {
+				if recs[i].Score <= 0 || recs[i].Score >= 1 {
+					t.Errorf("Recommend(): expected a score in (0,1), got %v", recs[i])
+				}
+				recs[i].Score = 0 // the score is random
+			}
+
+			if !reflect.DeepEqual(recs, test.expectedRecs) {
+				t.Errorf("Recommend(): expected %v, got %v", test.expectedRecs, recs)
+			}
+		})
+	}
+}
+
+func TestViaCounts(t *testing.T) {
+	// segments {0,1,2}, {0,3} and {0,1}
+	walk := models.RandomWalk{0, 1, 2, 0, 3, 0, 1}
+	expected := map[uint32]map[uint32]int{
+		1: {1: 2},
+		2: {1: 1},
+		3: {3: 1},
+	}
+
+	if counts := viaCounts(walk, 0); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("viaCounts(): expected %v, got %v", expected, counts)
+	}
+}
+
+func TestTopVia(t *testing.T) {
+	testCases := []struct {
+		name     string
+		counts   map[uint32]int
+		expected []uint32
+	}{
+		{name: "empty", counts: nil, expected: []uint32{}},
+		{name: "ties", counts: map[uint32]int{3: 1, 1: 1, 2: 5}, expected: []uint32{2, 1, 3}},
+		{name: "truncated", counts: map[uint32]int{0: 1, 1: 2, 2: 3, 3: 4}, expected: []uint32{3, 2, 1}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if IDs := topVia(test.counts); !reflect.DeepEqual(IDs, test.expected) {
+				t.Errorf("topVia(): expected %v, got %v", test.expected, IDs)
+			}
+		})
+	}
+}
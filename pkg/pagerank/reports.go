@@ -0,0 +1,79 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+// ReportSummary aggregates the reports of one type received by a node.
+type ReportSummary struct {
+	Type      string  `json:"type"`
+	Reporters int     `json:"reporters"` // the raw number of reporters, trivially sybil-able
+	Reputable int     `json:"reputable"` // the number of reporters whose pagerank is above the threshold
+	Weight    float64 `json:"weight"`    // the sum of the pageranks of the reporters
+}
+
+// ReputableThreshold() returns the pagerank of a node that is visited by
+// multiplier * walksPerNode walks. It's the same criterion used for promotions.
+func ReputableThreshold(ctx context.Context, RWS models.RandomWalkStore, multiplier float64) float64 {
+	totalVisits := RWS.TotalVisits(ctx)
+	if totalVisits == 0 {
+		return 0
+	}
+
+	return multiplier * float64(RWS.WalksPerNode(ctx)) / float64(totalVisits)
+}
+
+// WeightReports() weights each report by the global pagerank of the reporter.
+// It returns a summary for each report type, sorted by weight in descending order.
+func WeightReports(
+	ctx context.Context,
+	RWS models.RandomWalkStore,
+	reports models.ReportMap,
+	threshold float64) ([]ReportSummary, error) {
+
+	if len(reports) == 0 {
+		return []ReportSummary{}, nil
+	}
+
+	reporters := make([]uint32, 0, len(reports))
+	for _, IDs := range reports {
+		reporters = append(reporters, IDs...)
+	}
+
+	pagerank, err := Global(ctx, RWS, reporters...)
+	if err != nil && !errors.Is(err, models.ErrEmptyRWS) {
+		return nil, err
+	}
+
+	summaries := make([]ReportSummary, 0, len(reports))
+	for reportType, IDs := range reports {
+		summary := ReportSummary{Type: reportType, Reporters: len(IDs)}
+		for _, ID := range IDs {
+			rank := pagerank[ID]
+			summary.Weight += rank
+			if rank > 0 && rank >= threshold {
+				summary.Reputable++
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	slices.SortFunc(summaries, func(s1, s2 ReportSummary) int {
+		switch {
+		case s1.Weight > s2.Weight:
+			return -1
+		case s1.Weight < s2.Weight:
+			return 1
+		default:
+			return strings.Compare(s1.Type, s2.Type)
+		}
+	})
+
+	return summaries, nil
+}
@@ -0,0 +1,99 @@
+package pagerank
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+)
+
+func TestReputableThreshold(t *testing.T) {
+	testCases := []struct {
+		name              string
+		RWSType           string
+		multiplier        float64
+		expectedThreshold float64
+	}{
+		{
+			name:              "empty RWS",
+			RWSType:           "empty",
+			multiplier:        1,
+			expectedThreshold: 0,
+		},
+		{
+			name:              "valid",
+			RWSType:           "triangle",
+			multiplier:        1,
+			expectedThreshold: 1.0 / 9.0,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := mockstore.SetupRWS(test.RWSType)
+			threshold := ReputableThreshold(context.Background(), RWS, test.multiplier)
+			if threshold != test.expectedThreshold {
+				t.Errorf("ReputableThreshold(): expected %v, got %v", test.expectedThreshold, threshold)
+			}
+		})
+	}
+}
+
+func TestWeightReports(t *testing.T) {
+	testCases := []struct {
+		name              string
+		RWSType           string
+		reports           models.ReportMap
+		threshold         float64
+		expectedSummaries []ReportSummary
+		expectedError     error
+	}{
+		{
+			name:              "no reports",
+			RWSType:           "triangle",
+			reports:           models.ReportMap{},
+			expectedSummaries: []ReportSummary{},
+		},
+		{
+			name:          "nil RWS",
+			RWSType:       "nil",
+			reports:       models.ReportMap{"spam": {0}},
+			expectedError: models.ErrNilRWS,
+		},
+		{
+			name:    "empty RWS",
+			RWSType: "empty",
+			reports: models.ReportMap{"spam": {0, 1}},
+			expectedSummaries: []ReportSummary{
+				{Type: "spam", Reporters: 2, Reputable: 0, Weight: 0},
+			},
+		},
+		{
+			name:      "valid",
+			RWSType:   "triangle",
+			reports:   models.ReportMap{"spam": {0, 1, 69}, "nudity": {2}},
+			threshold: 0.2,
+			expectedSummaries: []ReportSummary{
+				{Type: "spam", Reporters: 3, Reputable: 2, Weight: 2.0 / 3.0},
+				{Type: "nudity", Reporters: 1, Reputable: 1, Weight: 1.0 / 3.0},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := mockstore.SetupRWS(test.RWSType)
+			summaries, err := WeightReports(context.Background(), RWS, test.reports, test.threshold)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("WeightReports(): expected %v, got %v", test.expectedError, err)
+			}
+
+			if !reflect.DeepEqual(summaries, test.expectedSummaries) {
+				t.Errorf("WeightReports(): expected %v, got %v", test.expectedSummaries, summaries)
+			}
+		})
+	}
+}
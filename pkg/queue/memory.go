@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MemoryQueue is an in-memory implementation of the Queue interface, which behaves
+// like the RedisQueue but loses its content when the process exits. Meant for tests.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	capacity int
+	seq      uint64
+
+	undelivered []entry
+	pending     []entry             // sorted by seq
+	dead        []entry             // the dead-letters, at most capacity
+	eventIDs    map[string]struct{} // the IDs of the events in the queue, for dedup
+
+	notify chan struct{} // signals that a message has been pushed
+}
+
+type entry struct {
+	seq   uint64
+	event *nostr.Event
+}
+
+func (e entry) message() Message {
+	return Message{ID: formatID(e.seq), Event: e.event}
+}
+
+// NewMemoryQueue() returns an empty MemoryQueue with the specified capacity.
+func NewMemoryQueue(capacity int) (*MemoryQueue, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("NewMemoryQueue(): %w", ErrInvalidCap)
+	}
+
+	return &MemoryQueue{
+		capacity: capacity,
+		eventIDs: make(map[string]struct{}),
+		notify:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Push() adds the event to the queue, unless an event with the same ID is already there.
+func (q *MemoryQueue) Push(ctx context.Context, event *nostr.Event) (bool, error) {
+	if event == nil {
+		return false, fmt.Errorf("Push(): %w", ErrNilEvent)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.eventIDs[event.ID]; exists {
+		return false, nil
+	}
+
+	if len(q.undelivered)+len(q.pending) >= q.capacity {
+		return false, fmt.Errorf("Push(): %w", ErrFull)
+	}
+
+	q.seq++
+	q.undelivered = append(q.undelivered, entry{seq: q.seq, event: event})
+	q.eventIDs[event.ID] = struct{}{}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return true, nil
+}
+
+// Read() returns up to count undelivered messages, waiting up to block if there are none.
+func (q *MemoryQueue) Read(ctx context.Context, count int, block time.Duration) ([]Message, error) {
+	if count <= 0 {
+		return []Message{}, nil
+	}
+
+	if msgs := q.deliver(count); len(msgs) > 0 || block <= 0 {
+		return msgs, nil
+	}
+
+	timer := time.NewTimer(block)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Read(): %w", ctx.Err())
+
+		case <-timer.C:
+			return q.deliver(count), nil
+
+		case <-q.notify:
+			if msgs := q.deliver(count); len(msgs) > 0 {
+				return msgs, nil
+			}
+		}
+	}
+}
+
+// deliver() moves up to count messages from undelivered to pending, and returns them.
+func (q *MemoryQueue) deliver(count int) []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(count, len(q.undelivered))
+	msgs := make([]Message, n)
+	for i, e := range q.undelivered[:n] {
+		msgs[i] = e.message()
+	}
+
+	q.pending = append(q.pending, q.undelivered[:n]...)
+	q.undelivered = slices.Delete(q.undelivered, 0, n)
+	return msgs
+}
+
+// Pending() returns up to count delivered but unacked messages whose ID comes after the specified one.
+func (q *MemoryQueue) Pending(ctx context.Context, after string, count int) ([]Message, error) {
+	seq, err := parseID(after)
+	if err != nil {
+		return nil, fmt.Errorf("Pending(): %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	start, _ := slices.BinarySearchFunc(q.pending, seq+1, func(e entry, seq uint64) int {
+		return cmp.Compare(e.seq, seq)
+	})
+
+	end := min(start+max(count, 0), len(q.pending))
+	msgs := make([]Message, 0, end-start)
+	for _, e := range q.pending[start:end] {
+		msgs = append(msgs, e.message())
+	}
+
+	return msgs, nil
+}
+
+// Ack() removes the messages from the queue. Unknown IDs are ignored.
+func (q *MemoryQueue) Ack(ctx context.Context, IDs ...string) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+
+	acked := make(map[uint64]struct{}, len(IDs))
+	for _, ID := range IDs {
+		seq, err := parseID(ID)
+		if err != nil {
+			return fmt.Errorf("Ack(): %w", err)
+		}
+		acked[seq] = struct{}{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	remove := func(e entry) bool {
+		if _, exists := acked[e.seq]; exists {
+			delete(q.eventIDs, e.event.ID)
+			return true
+		}
+		return false
+	}
+
+	q.pending = slices.DeleteFunc(q.pending, remove)
+	q.undelivered = slices.DeleteFunc(q.undelivered, remove)
+	return nil
+}
+
+// Requeue() moves the pending message to the end of the undelivered messages, with a new ID.
+func (q *MemoryQueue) Requeue(ctx context.Context, ID string) error {
+	seq, err := parseID(ID)
+	if err != nil {
+		return fmt.Errorf("Requeue(): %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, found := slices.BinarySearchFunc(q.pending, seq, func(e entry, seq uint64) int {
+		return cmp.Compare(e.seq, seq)
+	})
+
+	if !found {
+		return fmt.Errorf("Requeue(): %w: %s", ErrNotPending, ID)
+	}
+
+	event := q.pending[i].event
+	q.pending = slices.Delete(q.pending, i, i+1)
+
+	q.seq++
+	q.undelivered = append(q.undelivered, entry{seq: q.seq, event: event})
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// DeadLetter() moves the pending message to the dead-letters, dropping the oldest if they exceed the capacity.
+func (q *MemoryQueue) DeadLetter(ctx context.Context, ID string) error {
+	seq, err := parseID(ID)
+	if err != nil {
+		return fmt.Errorf("DeadLetter(): %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i, found := slices.BinarySearchFunc(q.pending, seq, func(e entry, seq uint64) int {
+		return cmp.Compare(e.seq, seq)
+	})
+
+	if !found {
+		return fmt.Errorf("DeadLetter(): %w: %s", ErrNotPending, ID)
+	}
+
+	e := q.pending[i]
+	q.pending = slices.Delete(q.pending, i, i+1)
+	delete(q.eventIDs, e.event.ID)
+
+	q.dead = append(q.dead, e)
+	if len(q.dead) > q.capacity {
+		q.dead = slices.Delete(q.dead, 0, len(q.dead)-q.capacity)
+	}
+	return nil
+}
+
+// DeadLetters() returns up to count dead-letters, oldest first.
+func (q *MemoryQueue) DeadLetters(ctx context.Context, count int) ([]Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(max(count, 0), len(q.dead))
+	msgs := make([]Message, n)
+	for i, e := range q.dead[:n] {
+		msgs[i] = e.message()
+	}
+	return msgs, nil
+}
+
+// Len() returns the number of messages in the queue, delivered or not.
+func (q *MemoryQueue) Len(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.undelivered) + len(q.pending), nil
+}
+
+// Capacity() returns the maximum number of messages in the queue.
+func (q *MemoryQueue) Capacity() int {
+	return q.capacity
+}
+
+// formatID() returns the message ID of the sequence number, in the same format of Redis Streams.
+func formatID(seq uint64) string {
+	return strconv.FormatUint(seq, 10) + "-0"
+}
+
+// parseID() returns the sequence number of the message ID.
+func parseID(ID string) (uint64, error) {
+	seq, _, _ := strings.Cut(ID, "-")
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid message ID %q: %w", ID, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	testQueue(t, func(t *testing.T, capacity int) Queue {
+		q, err := NewMemoryQueue(capacity)
+		if err != nil {
+			t.Fatalf("NewMemoryQueue(): expected nil, got %v", err)
+		}
+		return q
+	})
+}
+
+func TestNewMemoryQueue(t *testing.T) {
+	if _, err := NewMemoryQueue(0); !errors.Is(err, ErrInvalidCap) {
+		t.Errorf("NewMemoryQueue(): expected %v, got %v", ErrInvalidCap, err)
+	}
+}
+
+func TestMemoryRead(t *testing.T) {
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		q, _ := NewMemoryQueue(10)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+
+		if _, err := q.Read(ctx, 10, time.Second); !errors.Is(err, context.Canceled) {
+			t.Errorf("Read(): expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestParseID(t *testing.T) {
+	testCases := []struct {
+		ID            string
+		expectedSeq   uint64
+		expectedError bool
+	}{
+		{ID: "0", expectedSeq: 0},
+		{ID: "69-0", expectedSeq: 69},
+		{ID: "", expectedError: true},
+		{ID: "abc-0", expectedError: true},
+	}
+
+	for _, test := range testCases {
+		seq, err := parseID(test.ID)
+		if (err != nil) != test.expectedError {
+			t.Fatalf("parseID(%q): expected error %v, got %v", test.ID, test.expectedError, err)
+		}
+
+		if seq != test.expectedSeq {
+			t.Errorf("parseID(%q): expected %d, got %d", test.ID, test.expectedSeq, seq)
+		}
+
+		if err == nil && test.ID != "0" && formatID(seq) != test.ID {
+			t.Errorf("formatID(%d): expected %s, got %s", seq, test.ID, formatID(seq))
+		}
+	}
+}
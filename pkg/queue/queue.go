@@ -0,0 +1,78 @@
+/*
+The queue package defines the durable queue that connects the producers of events
+(Firehose, QueryPubkeys) with their consumer (ProcessEvents).
+
+The queue delivers each event at least once:
+  - Push() is idempotent, as events already in the queue are recognized by their ID.
+  - Read() hands over the events that were never delivered.
+  - Ack() removes the events once they have been processed.
+  - Pending() returns the events that were delivered but not acked, for example because
+    the consumer crashed, so that they can be replayed on restart.
+  - Requeue() hands over again an event that the consumer wants to process later.
+  - DeadLetter() sets aside an event that the consumer failed to process too many times,
+    so that it stops taking space in the queue.
+
+The queue is bounded: when it's full Push() returns [ErrFull], and it's up to the
+producer to wait or to give up.
+*/
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Message is an event in the queue, identified by the ID assigned by the queue.
+// The Event is nil if it couldn't be parsed, in which case the message should be acked and skipped.
+type Message struct {
+	ID    string
+	Event *nostr.Event
+}
+
+// Queue is a bounded queue of events with at-least-once delivery.
+type Queue interface {
+	// Push() adds the event to the queue. It returns false if the event was
+	// already pushed (dedup by event ID), and ErrFull if the queue is full.
+	Push(ctx context.Context, event *nostr.Event) (bool, error)
+
+	// Read() returns up to count messages that were never delivered, waiting up
+	// to block if there are none. A non-positive block returns immediately.
+	Read(ctx context.Context, count int, block time.Duration) ([]Message, error)
+
+	// Pending() returns up to count messages that were delivered but not acked,
+	// whose ID comes after the specified one. Use "0" to start from the beginning.
+	Pending(ctx context.Context, after string, count int) ([]Message, error)
+
+	// Ack() removes the messages from the queue.
+	Ack(ctx context.Context, IDs ...string) error
+
+	// Requeue() moves a message that was delivered but not acked to the end of the queue,
+	// as if it was never delivered. The message gets a new ID, and the event is not deduplicated.
+	Requeue(ctx context.Context, ID string) error
+
+	// DeadLetter() removes a message that was delivered but not acked from the queue, and
+	// moves it to the dead-letter queue, which is bounded and only kept for inspection.
+	DeadLetter(ctx context.Context, ID string) error
+
+	// DeadLetters() returns up to count messages of the dead-letter queue, oldest first.
+	DeadLetters(ctx context.Context, count int) ([]Message, error)
+
+	// Len() returns the number of messages in the queue, delivered or not.
+	Len(ctx context.Context) (int, error)
+
+	// Capacity() returns the maximum number of messages in the queue.
+	Capacity() int
+}
+
+//---------------------------------ERROR-CODES---------------------------------
+
+var (
+	ErrFull       = errors.New("the queue is full")
+	ErrNilEvent   = errors.New("event is nil")
+	ErrNilClient  = errors.New("redis client is nil")
+	ErrInvalidCap = errors.New("capacity should be greater than 0")
+	ErrNotPending = errors.New("message is not pending")
+)
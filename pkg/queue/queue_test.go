@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testQueue() runs the tests that every implementation of the Queue interface should pass.
+// The setup function returns an empty queue with the specified capacity.
+func testQueue(t *testing.T, setup func(t *testing.T, capacity int) Queue) {
+	t.Run("Push", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 2)
+
+		testCases := []struct {
+			name          string
+			event         *nostr.Event
+			expectedAdded bool
+			expectedError error
+		}{
+			{name: "nil event", event: nil, expectedError: ErrNilEvent},
+			{name: "first event", event: testEvent(0), expectedAdded: true},
+			{name: "duplicate", event: testEvent(0), expectedAdded: false},
+			{name: "second event", event: testEvent(1), expectedAdded: true},
+			{name: "full", event: testEvent(2), expectedError: ErrFull},
+			{name: "duplicate when full", event: testEvent(1), expectedAdded: false},
+		}
+
+		for _, test := range testCases {
+			added, err := q.Push(ctx, test.event)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("%s: Push(): expected %v, got %v", test.name, test.expectedError, err)
+			}
+
+			if added != test.expectedAdded {
+				t.Errorf("%s: Push(): expected %v, got %v", test.name, test.expectedAdded, added)
+			}
+		}
+
+		length, err := q.Len(ctx)
+		if err != nil {
+			t.Fatalf("Len(): expected nil, got %v", err)
+		}
+
+		if length != 2 {
+			t.Errorf("Len(): expected 2, got %d", length)
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 10)
+		push(t, q, 0, 1, 2)
+
+		msgs, err := q.Read(ctx, 2, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs, 0, 1)
+
+		// only the messages never delivered are returned
+		msgs, err = q.Read(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs, 2)
+
+		msgs, err = q.Read(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs)
+	})
+
+	t.Run("Read blocking", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 10)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			push(t, q, 0)
+		}()
+
+		msgs, err := q.Read(ctx, 10, time.Second)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs, 0)
+
+		start := time.Now()
+		msgs, err = q.Read(ctx, 10, 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs)
+
+		if time.Since(start) < 100*time.Millisecond {
+			t.Errorf("Read(): expected to block for 100ms, returned after %v", time.Since(start))
+		}
+	})
+
+	t.Run("Pending and Ack", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 3)
+		push(t, q, 0, 1, 2)
+
+		msgs, err := q.Read(ctx, 2, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+
+		pending, err := q.Pending(ctx, "0", 10)
+		if err != nil {
+			t.Fatalf("Pending(): expected nil, got %v", err)
+		}
+
+		if !reflect.DeepEqual(messageIDs(pending), messageIDs(msgs)) {
+			t.Fatalf("Pending(): expected %v, got %v", messageIDs(msgs), messageIDs(pending))
+		}
+		assertEvents(t, pending, 0, 1)
+
+		// paginating after the first pending message
+		pending, err = q.Pending(ctx, msgs[0].ID, 10)
+		if err != nil {
+			t.Fatalf("Pending(): expected nil, got %v", err)
+		}
+		assertEvents(t, pending, 1)
+
+		if err := q.Ack(ctx, msgs[0].ID); err != nil {
+			t.Fatalf("Ack(): expected nil, got %v", err)
+		}
+
+		pending, err = q.Pending(ctx, "0", 10)
+		if err != nil {
+			t.Fatalf("Pending(): expected nil, got %v", err)
+		}
+		assertEvents(t, pending, 1)
+
+		// acking frees space in the queue
+		length, err := q.Len(ctx)
+		if err != nil {
+			t.Fatalf("Len(): expected nil, got %v", err)
+		}
+
+		if length != 2 {
+			t.Errorf("Len(): expected 2, got %d", length)
+		}
+
+		if _, err := q.Push(ctx, testEvent(3)); err != nil {
+			t.Errorf("Push(): expected nil, got %v", err)
+		}
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 3)
+		push(t, q, 0, 1)
+
+		msgs, err := q.Read(ctx, 1, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+
+		if err := q.Requeue(ctx, msgs[0].ID); err != nil {
+			t.Fatalf("Requeue(): expected nil, got %v", err)
+		}
+
+		// the message is not pending anymore, so it can't be requeued twice
+		if err := q.Requeue(ctx, msgs[0].ID); !errors.Is(err, ErrNotPending) {
+			t.Fatalf("Requeue(): expected %v, got %v", ErrNotPending, err)
+		}
+
+		pending, err := q.Pending(ctx, "0", 10)
+		if err != nil {
+			t.Fatalf("Pending(): expected nil, got %v", err)
+		}
+		assertEvents(t, pending)
+
+		// the requeued event is delivered again, after the others
+		msgs, err = q.Read(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+		assertEvents(t, msgs, 1, 0)
+
+		length, err := q.Len(ctx)
+		if err != nil {
+			t.Fatalf("Len(): expected nil, got %v", err)
+		}
+
+		if length != 2 {
+			t.Errorf("Len(): expected 2, got %d", length)
+		}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		ctx := context.Background()
+		q := setup(t, 2)
+		push(t, q, 0, 1)
+
+		msgs, err := q.Read(ctx, 1, 0)
+		if err != nil {
+			t.Fatalf("Read(): expected nil, got %v", err)
+		}
+
+		if err := q.DeadLetter(ctx, msgs[0].ID); err != nil {
+			t.Fatalf("DeadLetter(): expected nil, got %v", err)
+		}
+
+		// the message is not pending anymore, so it can't be moved twice
+		if err := q.DeadLetter(ctx, msgs[0].ID); !errors.Is(err, ErrNotPending) {
+			t.Fatalf("DeadLetter(): expected %v, got %v", ErrNotPending, err)
+		}
+
+		dead, err := q.DeadLetters(ctx, 10)
+		if err != nil {
+			t.Fatalf("DeadLetters(): expected nil, got %v", err)
+		}
+		assertEvents(t, dead, 0)
+
+		pending, err := q.Pending(ctx, "0", 10)
+		if err != nil {
+			t.Fatalf("Pending(): expected nil, got %v", err)
+		}
+		assertEvents(t, pending)
+
+		// the dead-letter frees space in the queue
+		length, err := q.Len(ctx)
+		if err != nil {
+			t.Fatalf("Len(): expected nil, got %v", err)
+		}
+
+		if length != 1 {
+			t.Errorf("Len(): expected 1, got %d", length)
+		}
+
+		if _, err := q.Push(ctx, testEvent(2)); err != nil {
+			t.Errorf("Push(): expected nil, got %v", err)
+		}
+	})
+}
+
+// testEvent() returns a follow-list whose ID depends on i.
+func testEvent(i int) *nostr.Event {
+	return &nostr.Event{
+		ID:     fmt.Sprintf("%064d", i),
+		PubKey: fmt.Sprintf("%064d", 0),
+		Kind:   nostr.KindFollowList,
+		Tags:   nostr.Tags{{"p", fmt.Sprintf("%064d", i+1)}},
+	}
+}
+
+// push() adds the test events to the queue.
+func push(t *testing.T, q Queue, events ...int) {
+	t.Helper()
+	for _, i := range events {
+		if _, err := q.Push(context.Background(), testEvent(i)); err != nil {
+			t.Errorf("Push(): expected nil, got %v", err)
+		}
+	}
+}
+
+// messageIDs() returns the IDs of the messages.
+func messageIDs(msgs []Message) []string {
+	IDs := make([]string, len(msgs))
+	for i, msg := range msgs {
+		IDs[i] = msg.ID
+	}
+	return IDs
+}
+
+// assertEvents() checks that the messages contain the test events, in order.
+func assertEvents(t *testing.T, msgs []Message, events ...int) {
+	t.Helper()
+	if len(msgs) != len(events) {
+		t.Fatalf("expected %d messages, got %d", len(events), len(msgs))
+	}
+
+	for i, msg := range msgs {
+		if !reflect.DeepEqual(msg.Event, testEvent(events[i])) {
+			t.Errorf("message %d: expected %v, got %v", i, testEvent(events[i]), msg.Event)
+		}
+	}
+}
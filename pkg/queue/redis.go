@@ -0,0 +1,313 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisConfig struct {
+	Stream     string        // the key of the Redis Stream
+	DeadStream string        // the key of the Redis Stream of the dead-letters
+	Group      string        // the consumer group that reads the stream
+	Consumer   string        // the name of the consumer within the group
+	Capacity   int           // the maximum length of the stream, and approximately of the dead-letter stream
+	DedupTTL   time.Duration // how long an event ID is remembered after being pushed
+}
+
+func NewRedisConfig() RedisConfig {
+	return RedisConfig{
+		Stream:     "queue:events",
+		DeadStream: "queue:events:dead",
+		Group:      "crawler",
+		Consumer:   "process",
+		Capacity:   100000,
+		DedupTTL:   time.Hour,
+	}
+}
+
+func (c RedisConfig) Print() {
+	fmt.Printf("Queue\n")
+	fmt.Printf("  Stream: %s\n", c.Stream)
+	fmt.Printf("  DeadStream: %s\n", c.DeadStream)
+	fmt.Printf("  Group: %s\n", c.Group)
+	fmt.Printf("  Consumer: %s\n", c.Consumer)
+	fmt.Printf("  Capacity: %d\n", c.Capacity)
+	fmt.Printf("  DedupTTL: %v\n", c.DedupTTL)
+}
+
+// KeySeen() returns the Redis key that marks the event ID as pushed.
+func (c RedisConfig) KeySeen(eventID string) string {
+	return c.Stream + ":seen:" + eventID
+}
+
+// RedisQueue implements the Queue interface with a Redis Stream read by a consumer group.
+// Messages are removed from the stream once acked, so its length is the number of unacked messages.
+type RedisQueue struct {
+	client *redis.Client
+	config RedisConfig
+}
+
+// NewRedisQueue() returns a RedisQueue, creating the stream and the consumer group if they don't exist.
+// Messages already in the stream are preserved, so that they can be replayed.
+func NewRedisQueue(ctx context.Context, client *redis.Client, config RedisConfig) (*RedisQueue, error) {
+	if client == nil {
+		return nil, fmt.Errorf("NewRedisQueue(): %w", ErrNilClient)
+	}
+
+	if config.Capacity <= 0 {
+		return nil, fmt.Errorf("NewRedisQueue(): %w", ErrInvalidCap)
+	}
+
+	err := client.XGroupCreateMkStream(ctx, config.Stream, config.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("NewRedisQueue(): failed to create the consumer group: %w", err)
+	}
+
+	return &RedisQueue{client: client, config: config}, nil
+}
+
+/*
+pushScript atomically checks that the event has not been pushed already (the dedup key
+doesn't exist), and that the stream is not full, before adding it.
+
+KEYS = [stream, seen key]
+ARGV = [capacity, dedup TTL in milliseconds, event JSON]
+
+Returns 1 if added, 0 if duplicate, -1 if the stream is full.
+*/
+var pushScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+if redis.call('XLEN', KEYS[1]) >= tonumber(ARGV[1]) then
+	return -1
+end
+redis.call('SET', KEYS[2], 1, 'PX', ARGV[2])
+redis.call('XADD', KEYS[1], '*', 'event', ARGV[3])
+return 1
+`)
+
+// Push() adds the event to the stream, unless it was pushed in the last config.DedupTTL.
+func (q *RedisQueue) Push(ctx context.Context, event *nostr.Event) (bool, error) {
+	if event == nil {
+		return false, fmt.Errorf("Push(): %w", ErrNilEvent)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false, fmt.Errorf("Push(): failed to marshal eventID %s: %w", event.ID, err)
+	}
+
+	keys := []string{q.config.Stream, q.config.KeySeen(event.ID)}
+	res, err := pushScript.Run(ctx, q.client, keys, q.config.Capacity, q.config.DedupTTL.Milliseconds(), data).Int()
+	if err != nil {
+		return false, fmt.Errorf("Push(): %w", err)
+	}
+
+	switch res {
+	case 1:
+		return true, nil
+	case 0:
+		return false, nil
+	default:
+		return false, fmt.Errorf("Push(): %w", ErrFull)
+	}
+}
+
+// Read() returns up to count messages that were never delivered to the consumer group.
+func (q *RedisQueue) Read(ctx context.Context, count int, block time.Duration) ([]Message, error) {
+	switch {
+	case block <= 0:
+		block = -1 // the BLOCK option is omitted
+
+	case block < time.Millisecond:
+		block = time.Millisecond // BLOCK 0 would wait forever
+	}
+
+	msgs, err := q.read(ctx, ">", count, block)
+	if err != nil {
+		return nil, fmt.Errorf("Read(): %w", err)
+	}
+	return msgs, nil
+}
+
+// Pending() returns up to count messages delivered to the consumer but not acked, whose ID comes after the specified one.
+func (q *RedisQueue) Pending(ctx context.Context, after string, count int) ([]Message, error) {
+	msgs, err := q.read(ctx, after, count, -1)
+	if err != nil {
+		return nil, fmt.Errorf("Pending(): %w", err)
+	}
+	return msgs, nil
+}
+
+func (q *RedisQueue) read(ctx context.Context, ID string, count int, block time.Duration) ([]Message, error) {
+	if count <= 0 {
+		return []Message{}, nil
+	}
+
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.config.Group,
+		Consumer: q.config.Consumer,
+		Streams:  []string{q.config.Stream, ID},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+
+	if errors.Is(err, redis.Nil) {
+		// the block timed out without new messages
+		return []Message{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]Message, 0, count)
+	for _, stream := range streams {
+		for _, m := range stream.Messages {
+			msgs = append(msgs, Message{ID: m.ID, Event: parseEvent(m.Values)})
+		}
+	}
+
+	return msgs, nil
+}
+
+// parseEvent() returns the event stored in the message values, or nil if it can't be parsed.
+func parseEvent(values map[string]any) *nostr.Event {
+	data, ok := values["event"].(string)
+	if !ok {
+		return nil
+	}
+
+	event := &nostr.Event{}
+	if err := json.Unmarshal([]byte(data), event); err != nil {
+		return nil
+	}
+	return event
+}
+
+// Ack() acknowledges the messages and deletes them from the stream.
+func (q *RedisQueue) Ack(ctx context.Context, IDs ...string) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.XAck(ctx, q.config.Stream, q.config.Group, IDs...)
+	pipe.XDel(ctx, q.config.Stream, IDs...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("Ack(): %w", err)
+	}
+
+	return nil
+}
+
+/*
+requeueScript atomically adds a copy of the pending message at the end of the stream,
+and acknowledges and deletes the original.
+
+KEYS = [stream]
+ARGV = [group, message ID]
+
+Returns 1 if requeued, 0 if the message is not pending.
+*/
+var requeueScript = redis.NewScript(`
+local entries = redis.call('XRANGE', KEYS[1], ARGV[2], ARGV[2])
+if #entries == 0 then
+	return 0
+end
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XADD', KEYS[1], '*', unpack(entries[1][2]))
+redis.call('XDEL', KEYS[1], ARGV[2])
+return 1
+`)
+
+// Requeue() moves the pending message to the end of the stream, where it will be read again by the consumer group.
+func (q *RedisQueue) Requeue(ctx context.Context, ID string) error {
+	res, err := requeueScript.Run(ctx, q.client, []string{q.config.Stream}, q.config.Group, ID).Int()
+	if err != nil {
+		return fmt.Errorf("Requeue(): %w", err)
+	}
+
+	if res == 0 {
+		return fmt.Errorf("Requeue(): %w: %s", ErrNotPending, ID)
+	}
+	return nil
+}
+
+/*
+deadLetterScript atomically adds a copy of the pending message to the dead-letter stream,
+trimmed to approximately the capacity, and acknowledges and deletes the original.
+
+KEYS = [stream, dead-letter stream]
+ARGV = [group, message ID, capacity]
+
+Returns 1 if moved, 0 if the message is not pending.
+*/
+var deadLetterScript = redis.NewScript(`
+local entries = redis.call('XRANGE', KEYS[1], ARGV[2], ARGV[2])
+if #entries == 0 then
+	return 0
+end
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', unpack(entries[1][2]))
+redis.call('XDEL', KEYS[1], ARGV[2])
+return 1
+`)
+
+// DeadLetter() moves the pending message to the dead-letter stream.
+func (q *RedisQueue) DeadLetter(ctx context.Context, ID string) error {
+	keys := []string{q.config.Stream, q.config.DeadStream}
+	res, err := deadLetterScript.Run(ctx, q.client, keys, q.config.Group, ID, q.config.Capacity).Int()
+	if err != nil {
+		return fmt.Errorf("DeadLetter(): %w", err)
+	}
+
+	if res == 0 {
+		return fmt.Errorf("DeadLetter(): %w: %s", ErrNotPending, ID)
+	}
+	return nil
+}
+
+// DeadLetters() returns up to count messages of the dead-letter stream, oldest first.
+func (q *RedisQueue) DeadLetters(ctx context.Context, count int) ([]Message, error) {
+	if count <= 0 {
+		return []Message{}, nil
+	}
+
+	entries, err := q.client.XRangeN(ctx, q.config.DeadStream, "-", "+", int64(count)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("DeadLetters(): %w", err)
+	}
+
+	msgs := make([]Message, len(entries))
+	for i, m := range entries {
+		msgs[i] = Message{ID: m.ID, Event: parseEvent(m.Values)}
+	}
+	return msgs, nil
+}
+
+// Len() returns the length of the stream, which is the number of unacked messages.
+func (q *RedisQueue) Len(ctx context.Context) (int, error) {
+	length, err := q.client.XLen(ctx, q.config.Stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("Len(): %w", err)
+	}
+	return int(length), nil
+}
+
+// Capacity() returns the maximum length of the stream.
+func (q *RedisQueue) Capacity() int {
+	return q.config.Capacity
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vertex-lab/crawler/pkg/utils/redisutils"
+)
+
+func TestRedisQueue(t *testing.T) {
+	testQueue(t, func(t *testing.T, capacity int) Queue {
+		cl := redisutils.SetupTestClient()
+		redisutils.CleanupRedis(cl)
+		t.Cleanup(func() { redisutils.CleanupRedis(cl) })
+
+		config := NewRedisConfig()
+		config.Capacity = capacity
+
+		q, err := NewRedisQueue(context.Background(), cl, config)
+		if err != nil {
+			t.Fatalf("NewRedisQueue(): expected nil, got %v", err)
+		}
+		return q
+	})
+}
+
+func TestNewRedisQueue(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	if _, err := NewRedisQueue(ctx, nil, NewRedisConfig()); !errors.Is(err, ErrNilClient) {
+		t.Fatalf("NewRedisQueue(): expected %v, got %v", ErrNilClient, err)
+	}
+
+	q, err := NewRedisQueue(ctx, cl, NewRedisConfig())
+	if err != nil {
+		t.Fatalf("NewRedisQueue(): expected nil, got %v", err)
+	}
+
+	push(t, q, 0, 1)
+	if _, err := q.Read(ctx, 10, 0); err != nil {
+		t.Fatalf("Read(): expected nil, got %v", err)
+	}
+
+	// reconnecting to an existing stream preserves the pending messages
+	q, err = NewRedisQueue(ctx, cl, NewRedisConfig())
+	if err != nil {
+		t.Fatalf("NewRedisQueue(): expected nil, got %v", err)
+	}
+
+	pending, err := q.Pending(ctx, "0", 10)
+	if err != nil {
+		t.Fatalf("Pending(): expected nil, got %v", err)
+	}
+	assertEvents(t, pending, 0, 1)
+}
+
+func TestRedisDedupAfterAck(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	q, err := NewRedisQueue(ctx, cl, NewRedisConfig())
+	if err != nil {
+		t.Fatalf("NewRedisQueue(): expected nil, got %v", err)
+	}
+
+	push(t, q, 0)
+	msgs, err := q.Read(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("Read(): expected nil, got %v", err)
+	}
+
+	if err := q.Ack(ctx, messageIDs(msgs)...); err != nil {
+		t.Fatalf("Ack(): expected nil, got %v", err)
+	}
+
+	// the event ID is remembered for DedupTTL, even after the message is acked
+	added, err := q.Push(ctx, testEvent(0))
+	if err != nil {
+		t.Fatalf("Push(): expected nil, got %v", err)
+	}
+
+	if added {
+		t.Errorf("Push(): expected false, got true")
+	}
+}
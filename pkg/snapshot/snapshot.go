@@ -0,0 +1,656 @@
+/*
+The snapshot package exports the content of a [models.Database] and a
+[models.RandomWalkStore] into a compact binary snapshot, and restores it into
+any implementation of the two interfaces (e.g. from Redis to the mock ones).
+
+# Format (version 1)
+
+All integers are unsigned varints, unless specified otherwise. Strings are
+encoded as their length followed by their bytes.
+
+	magic        "VXSNAP" (6 bytes)
+	version      1
+	alpha        float32 bits (4 bytes, little-endian)
+	walksPerNode
+	nodes        count, followed by count nodes:
+	  ID, pubkey, status (1 = active)
+	  follows    count, followed by count nodeIDs
+	  mutes      count, followed by count nodeIDs
+	  relays     count, followed by count strings
+	  reports    count, followed by count (type, count, reporterIDs)
+	walks        count, followed by count walks:
+	  length, followed by length nodeIDs
+	checksum     CRC-32 (IEEE) of all the previous bytes (4 bytes, big-endian)
+
+Node records (e.g. the promotion timestamps) are not part of the snapshot,
+because the Database interface has no way of restoring them.
+Restored nodes are assigned new IDs by the destination database, and all
+the references (follows, mutes, reports, walks) are remapped accordingly.
+*/
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+const (
+	Magic   string = "VXSNAP"
+	Version uint64 = 1
+
+	// the number of nodes or walks fetched (or restored) at once
+	batchSize int = 1000
+
+	// the maximum length of a string or slice, to avoid huge allocations when decoding corrupted snapshots
+	maxLength uint64 = 1 << 24
+)
+
+// Header contains the parameters of the RWS the snapshot was taken from.
+type Header struct {
+	Version      uint64
+	Alpha        float32
+	WalksPerNode uint16
+}
+
+// Node contains everything the snapshot stores about a node.
+type Node struct {
+	ID      uint32
+	Pubkey  string
+	Active  bool
+	Follows []uint32
+	Mutes   []uint32
+	Relays  []string
+	Reports models.ReportMap
+}
+
+// Snapshot is the decoded content of a snapshot.
+type Snapshot struct {
+	Header
+	Nodes []Node
+	Walks []models.RandomWalk
+}
+
+// Export() writes the snapshot of the DB and RWS to w.
+func Export(ctx context.Context, DB models.Database, RWS models.RandomWalkStore, w io.Writer) error {
+	if err := DB.Validate(); err != nil {
+		return fmt.Errorf("Export(): DB validation failed: %w", err)
+	}
+
+	if err := RWS.Validate(); err != nil {
+		return fmt.Errorf("Export(): RWS validation failed: %w", err)
+	}
+
+	nodeIDs, err := DB.AllNodes(ctx)
+	if err != nil {
+		return fmt.Errorf("Export(): failed to fetch all nodes: %w", err)
+	}
+	slices.Sort(nodeIDs)
+
+	enc := newEncoder(w)
+	enc.header(Header{Version: Version, Alpha: RWS.Alpha(ctx), WalksPerNode: RWS.WalksPerNode(ctx)})
+
+	enc.uvarint(uint64(len(nodeIDs)))
+	for _, batch := range batches(nodeIDs) {
+		nodes, err := fetchNodes(ctx, DB, batch)
+		if err != nil {
+			return fmt.Errorf("Export(): %w", err)
+		}
+
+		for _, node := range nodes {
+			enc.node(node)
+		}
+	}
+
+	walkIDs, err := allWalkIDs(ctx, RWS, nodeIDs)
+	if err != nil {
+		return fmt.Errorf("Export(): %w", err)
+	}
+
+	enc.uvarint(uint64(len(walkIDs)))
+	for _, batch := range batches(walkIDs) {
+		walks, err := RWS.Walks(ctx, batch...)
+		if err != nil {
+			return fmt.Errorf("Export(): failed to fetch the walks: %w", err)
+		}
+
+		for _, walk := range walks {
+			enc.IDs(walk)
+		}
+	}
+
+	if err := enc.close(); err != nil {
+		return fmt.Errorf("Export(): failed to write the snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// fetchNodes() returns the nodes of the batch, with all their relationships.
+func fetchNodes(ctx context.Context, DB models.Database, nodeIDs []uint32) ([]Node, error) {
+	follows, err := DB.Follows(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the follows: %w", err)
+	}
+
+	mutes, err := DB.Mutes(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the mutes: %w", err)
+	}
+
+	relays, err := DB.WriteRelays(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the write relays: %w", err)
+	}
+
+	reports, err := DB.Reports(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the reports: %w", err)
+	}
+
+	stored, err := DB.Nodes(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the nodes: %w", err)
+	}
+
+	nodes := make([]Node, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		node := stored[i]
+		if node == nil {
+			return nil, fmt.Errorf("failed to fetch node by ID %d: %w", ID, models.ErrNodeNotFoundDB)
+		}
+
+		// sort the relationships to make the snapshot deterministic
+		slices.Sort(follows[i])
+		slices.Sort(mutes[i])
+		for _, reporters := range reports[i] {
+			slices.Sort(reporters)
+		}
+
+		nodes[i] = Node{
+			ID:      ID,
+			Pubkey:  node.Pubkey,
+			Active:  node.Status == models.StatusActive,
+			Follows: follows[i],
+			Mutes:   mutes[i],
+			Relays:  relays[i],
+			Reports: reports[i],
+		}
+	}
+
+	return nodes, nil
+}
+
+// allWalkIDs() returns the sorted IDs of all the walks that visit the nodes.
+func allWalkIDs(ctx context.Context, RWS models.RandomWalkStore, nodeIDs []uint32) ([]uint32, error) {
+	unique := make(map[uint32]struct{})
+	for _, batch := range batches(nodeIDs) {
+		walkIDs, err := RWS.WalksVisiting(ctx, -1, batch...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the walks visiting: %w", err)
+		}
+
+		for _, ID := range walkIDs {
+			unique[ID] = struct{}{}
+		}
+	}
+
+	walkIDs := make([]uint32, 0, len(unique))
+	for ID := range unique {
+		walkIDs = append(walkIDs, ID)
+	}
+	slices.Sort(walkIDs)
+	return walkIDs, nil
+}
+
+// Import() decodes the snapshot from r, and restores it into the DB and RWS, which must be empty.
+// The RWS must have the same alpha and walksPerNode of the snapshot.
+// It returns a map that associates the nodeIDs of the snapshot with the new ones.
+func Import(ctx context.Context, DB models.Database, RWS models.RandomWalkStore, r io.Reader) (map[uint32]uint32, error) {
+	snap, err := Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("Import(): %w", err)
+	}
+
+	remap, err := snap.Restore(ctx, DB, RWS)
+	if err != nil {
+		return nil, fmt.Errorf("Import(): %w", err)
+	}
+
+	return remap, nil
+}
+
+// Restore() writes the snapshot into the DB and RWS, which must be empty.
+// It returns a map that associates the nodeIDs of the snapshot with the new ones.
+func (s *Snapshot) Restore(ctx context.Context, DB models.Database, RWS models.RandomWalkStore) (map[uint32]uint32, error) {
+	if err := DB.Validate(); err != nil {
+		return nil, fmt.Errorf("DB validation failed: %w", err)
+	}
+
+	if err := RWS.Validate(); err != nil {
+		return nil, fmt.Errorf("RWS validation failed: %w", err)
+	}
+
+	if DB.Size(ctx) > 0 {
+		return nil, models.ErrNonEmptyDB
+	}
+
+	if RWS.TotalVisits(ctx) > 0 {
+		return nil, models.ErrNonEmptyRWS
+	}
+
+	if RWS.Alpha(ctx) != s.Alpha || RWS.WalksPerNode(ctx) != s.WalksPerNode {
+		return nil, fmt.Errorf("%w: snapshot has alpha %v and walksPerNode %d, RWS has %v and %d",
+			ErrParametersMismatch, s.Alpha, s.WalksPerNode, RWS.Alpha(ctx), RWS.WalksPerNode(ctx))
+	}
+
+	remap := make(map[uint32]uint32, len(s.Nodes))
+	for _, batch := range batches(s.Nodes) {
+		pubkeys := make([]string, len(batch))
+		for i, node := range batch {
+			pubkeys[i] = node.Pubkey
+		}
+
+		IDs, err := DB.AddNodes(ctx, pubkeys...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add the nodes: %w", err)
+		}
+
+		for i, node := range batch {
+			remap[node.ID] = IDs[i]
+		}
+	}
+
+	for _, node := range s.Nodes {
+		if err := restoreNode(ctx, DB, node, remap); err != nil {
+			return nil, fmt.Errorf("failed to restore node %d: %w", node.ID, err)
+		}
+	}
+
+	for _, batch := range batches(s.Walks) {
+		walks := make([]models.RandomWalk, len(batch))
+		for i, walk := range batch {
+			walks[i] = make(models.RandomWalk, len(walk))
+			for j, ID := range walk {
+				newID, ok := remap[ID]
+				if !ok {
+					return nil, fmt.Errorf("%w: walk visits unknown node %d", ErrCorrupted, ID)
+				}
+				walks[i][j] = newID
+			}
+		}
+
+		if err := RWS.AddWalks(ctx, walks...); err != nil {
+			return nil, fmt.Errorf("failed to add the walks: %w", err)
+		}
+	}
+
+	return remap, nil
+}
+
+// restoreNode() restores the status and the relationships of the node, using the new IDs.
+func restoreNode(ctx context.Context, DB models.Database, node Node, remap map[uint32]uint32) error {
+	ID := remap[node.ID]
+	follows, err := remapIDs(node.Follows, remap)
+	if err != nil {
+		return err
+	}
+
+	mutes, err := remapIDs(node.Mutes, remap)
+	if err != nil {
+		return err
+	}
+
+	deltas := []*models.Delta{}
+	if node.Active {
+		deltas = append(deltas, &models.Delta{Kind: models.Promotion, NodeID: ID})
+	}
+
+	if len(follows) > 0 {
+		deltas = append(deltas, &models.Delta{Kind: nostr.KindFollowList, NodeID: ID, Added: follows})
+	}
+
+	if len(mutes) > 0 {
+		deltas = append(deltas, &models.Delta{Kind: nostr.KindMuteList, NodeID: ID, Added: mutes})
+	}
+
+	for _, delta := range deltas {
+		if err := DB.Update(ctx, delta); err != nil {
+			return err
+		}
+	}
+
+	if len(node.Relays) > 0 {
+		if err := DB.SetWriteRelays(ctx, ID, node.Relays); err != nil {
+			return err
+		}
+	}
+
+	var reports []models.Report
+	for reportType, reporters := range node.Reports {
+		reporterIDs, err := remapIDs(reporters, remap)
+		if err != nil {
+			return err
+		}
+
+		for _, reporter := range reporterIDs {
+			reports = append(reports, models.Report{Reporter: reporter, Reported: ID, Type: reportType})
+		}
+	}
+
+	return DB.AddReports(ctx, reports...)
+}
+
+func remapIDs(IDs []uint32, remap map[uint32]uint32) ([]uint32, error) {
+	if len(IDs) == 0 {
+		return nil, nil
+	}
+
+	newIDs := make([]uint32, len(IDs))
+	for i, ID := range IDs {
+		newID, ok := remap[ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: reference to unknown node %d", ErrCorrupted, ID)
+		}
+		newIDs[i] = newID
+	}
+	return newIDs, nil
+}
+
+// batches() splits the slice into consecutive batches of size batchSize.
+func batches[S ~[]E, E any](slice S) []S {
+	var result []S
+	for start := 0; start < len(slice); start += batchSize {
+		result = append(result, slice[start:min(start+batchSize, len(slice))])
+	}
+	return result
+}
+
+// ---------------------------------ENCODING-----------------------------------
+
+// encoder writes the snapshot, while computing its checksum. The first error is kept and returned by close().
+type encoder struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newEncoder(w io.Writer) *encoder {
+	crc := crc32.NewIEEE()
+	return &encoder{w: bufio.NewWriter(io.MultiWriter(w, crc)), crc: crc}
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uvarint(x uint64) {
+	n := binary.PutUvarint(e.buf[:], x)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *encoder) IDs(IDs []uint32) {
+	e.uvarint(uint64(len(IDs)))
+	for _, ID := range IDs {
+		e.uvarint(uint64(ID))
+	}
+}
+
+func (e *encoder) header(h Header) {
+	e.write([]byte(Magic))
+	e.uvarint(h.Version)
+	e.write(binary.LittleEndian.AppendUint32(nil, math.Float32bits(h.Alpha)))
+	e.uvarint(uint64(h.WalksPerNode))
+}
+
+func (e *encoder) node(node Node) {
+	e.uvarint(uint64(node.ID))
+	e.string(node.Pubkey)
+	if node.Active {
+		e.uvarint(1)
+	} else {
+		e.uvarint(0)
+	}
+
+	e.IDs(node.Follows)
+	e.IDs(node.Mutes)
+
+	e.uvarint(uint64(len(node.Relays)))
+	for _, relay := range node.Relays {
+		e.string(relay)
+	}
+
+	// sort the types to make the snapshot deterministic
+	types := make([]string, 0, len(node.Reports))
+	for reportType := range node.Reports {
+		types = append(types, reportType)
+	}
+	slices.Sort(types)
+
+	e.uvarint(uint64(len(types)))
+	for _, reportType := range types {
+		e.string(reportType)
+		e.IDs(node.Reports[reportType])
+	}
+}
+
+// close() flushes the buffer and writes the checksum (which is not part of the checksum itself).
+func (e *encoder) close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+
+	sum := e.crc.Sum32()
+	e.write(binary.BigEndian.AppendUint32(nil, sum))
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// Decode() reads and validates the whole snapshot from r.
+func Decode(r io.Reader) (*Snapshot, error) {
+	d := &decoder{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	header, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+
+	// the number of nodes and walks is not capped by maxLength, since nothing is preallocated
+	snap := &Snapshot{Header: header}
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		snap.Nodes = append(snap.Nodes, d.node())
+	}
+
+	count = d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		snap.Walks = append(snap.Walks, d.IDs())
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, d.err)
+	}
+
+	expected := d.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(d.r, sum[:]); err != nil {
+		return nil, fmt.Errorf("%w: missing checksum: %v", ErrCorrupted, err)
+	}
+
+	if binary.BigEndian.Uint32(sum[:]) != expected {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+
+	return snap, nil
+}
+
+// ReadHeader() reads only the header of the snapshot, which is useful to
+// create an RWS with the right parameters before calling Import().
+func ReadHeader(r io.Reader) (Header, error) {
+	d := &decoder{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	return d.header()
+}
+
+// decoder reads the snapshot, while computing its checksum. After the first error, it reads only zeros.
+type decoder struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (d *decoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	d.crc.Write([]byte{b})
+	return b, nil
+}
+
+func (d *decoder) read(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+	if _, d.err = io.ReadFull(d.r, b); d.err != nil {
+		return nil
+	}
+
+	d.crc.Write(b)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var x uint64
+	x, d.err = binary.ReadUvarint(d)
+	return x
+}
+
+// length() reads a length, failing if it is unreasonably big.
+func (d *decoder) length() uint64 {
+	n := d.uvarint()
+	if n > maxLength && d.err == nil {
+		d.err = fmt.Errorf("length %d exceeds the maximum %d", n, maxLength)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) ID() uint32 {
+	x := d.uvarint()
+	if x > math.MaxUint32 && d.err == nil {
+		d.err = fmt.Errorf("nodeID %d overflows uint32", x)
+		return 0
+	}
+	return uint32(x)
+}
+
+func (d *decoder) string() string {
+	return string(d.read(d.length()))
+}
+
+func (d *decoder) IDs() []uint32 {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	IDs := make([]uint32, 0, min(n, uint64(batchSize)))
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		IDs = append(IDs, d.ID())
+	}
+	return IDs
+}
+
+func (d *decoder) header() (Header, error) {
+	magic := d.read(uint64(len(Magic)))
+	if d.err != nil || string(magic) != Magic {
+		return Header{}, ErrInvalidMagic
+	}
+
+	var h Header
+	if h.Version = d.uvarint(); d.err == nil && h.Version != Version {
+		return Header{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+
+	alpha := d.read(4)
+	walksPerNode := d.uvarint()
+	if d.err != nil {
+		return Header{}, fmt.Errorf("%w: %v", ErrCorrupted, d.err)
+	}
+
+	if walksPerNode > math.MaxUint16 {
+		return Header{}, fmt.Errorf("%w: walksPerNode %d overflows uint16", ErrCorrupted, walksPerNode)
+	}
+
+	h.Alpha = math.Float32frombits(binary.LittleEndian.Uint32(alpha))
+	h.WalksPerNode = uint16(walksPerNode)
+	return h, nil
+}
+
+func (d *decoder) node() Node {
+	node := Node{
+		ID:     d.ID(),
+		Pubkey: d.string(),
+		Active: d.uvarint() == 1,
+	}
+
+	node.Follows = d.IDs()
+	node.Mutes = d.IDs()
+
+	count := d.length()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		node.Relays = append(node.Relays, d.string())
+	}
+
+	count = d.length()
+	if count > 0 {
+		node.Reports = make(models.ReportMap, count)
+	}
+
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		reportType := d.string()
+		node.Reports[reportType] = d.IDs()
+	}
+
+	return node
+}
+
+//--------------------------------ERROR-CODES-----------------------------------
+
+var (
+	ErrInvalidMagic       = errors.New("not a snapshot: invalid magic bytes")
+	ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+	ErrCorrupted          = errors.New("corrupted snapshot")
+	ErrParametersMismatch = errors.New("the RWS parameters don't match the snapshot")
+)
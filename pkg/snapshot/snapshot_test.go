@@ -0,0 +1,282 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+)
+
+// export() returns the snapshot of the "simple" DB and RWS, with some write relays.
+func export(t *testing.T) []byte {
+	t.Helper()
+	ctx := context.Background()
+	DB := mockdb.SetupDB("simple")
+	RWS := mockstore.SetupRWS("simple")
+
+	if err := DB.SetWriteRelays(ctx, 1, []string{"wss://one", "wss://two"}); err != nil {
+		t.Fatalf("SetWriteRelays(): expected nil, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Export(ctx, DB, RWS, buf); err != nil {
+		t.Fatalf("Export(): expected nil, got %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	data := export(t)
+
+	DB := mockdb.SetupDB("empty")
+	RWS, _ := mockstore.NewRWS(0.85, 1)
+
+	remap, err := Import(ctx, DB, RWS, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Import(): expected nil, got %v", err)
+	}
+
+	expectedRemap := map[uint32]uint32{0: 0, 1: 1, 2: 2}
+	if !reflect.DeepEqual(remap, expectedRemap) {
+		t.Errorf("Import(): expected remap %v, got %v", expectedRemap, remap)
+	}
+
+	node, err := DB.NodeByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("NodeByID(): expected nil, got %v", err)
+	}
+
+	if node.Pubkey != "1" || node.Status != models.StatusActive {
+		t.Errorf("Import(): expected active node with pubkey 1, got %v", node)
+	}
+
+	follows, err := DB.Follows(ctx, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	if expected := [][]uint32{{1}, {}, {}}; !reflect.DeepEqual(follows, expected) {
+		t.Errorf("Import(): expected follows %v, got %v", expected, follows)
+	}
+
+	reports, err := DB.Reports(ctx, 0)
+	if err != nil {
+		t.Fatalf("Reports(): expected nil, got %v", err)
+	}
+
+	if expected := (models.ReportMap{"spam": {2}}); !reflect.DeepEqual(reports[0], expected) {
+		t.Errorf("Import(): expected reports %v, got %v", expected, reports[0])
+	}
+
+	walks, err := RWS.Walks(ctx, 0)
+	if err != nil {
+		t.Fatalf("Walks(): expected nil, got %v", err)
+	}
+
+	if expected := []models.RandomWalk{{0, 1}}; !reflect.DeepEqual(walks, expected) {
+		t.Errorf("Import(): expected walks %v, got %v", expected, walks)
+	}
+
+	// exporting the restored state must produce the same snapshot
+	buf := &bytes.Buffer{}
+	if err := Export(ctx, DB, RWS, buf); err != nil {
+		t.Fatalf("Export(): expected nil, got %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Export(): the snapshot of the restored state differs from the original")
+	}
+}
+
+func TestRemap(t *testing.T) {
+	ctx := context.Background()
+	data := export(t)
+
+	// the destination assigns different IDs, so every reference must be remapped
+	DB := mockdb.SetupDB("empty")
+	DB.LastNodeID = 9
+	RWS, _ := mockstore.NewRWS(0.85, 1)
+
+	remap, err := Import(ctx, DB, RWS, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Import(): expected nil, got %v", err)
+	}
+
+	expectedRemap := map[uint32]uint32{0: 10, 1: 11, 2: 12}
+	if !reflect.DeepEqual(remap, expectedRemap) {
+		t.Fatalf("Import(): expected remap %v, got %v", expectedRemap, remap)
+	}
+
+	mutes, err := DB.Mutes(ctx, 12)
+	if err != nil {
+		t.Fatalf("Mutes(): expected nil, got %v", err)
+	}
+
+	if expected := [][]uint32{{10}}; !reflect.DeepEqual(mutes, expected) {
+		t.Errorf("Import(): expected mutes %v, got %v", expected, mutes)
+	}
+
+	relays, err := DB.WriteRelays(ctx, 11)
+	if err != nil {
+		t.Fatalf("WriteRelays(): expected nil, got %v", err)
+	}
+
+	if expected := [][]string{{"wss://one", "wss://two"}}; !reflect.DeepEqual(relays, expected) {
+		t.Errorf("Import(): expected relays %v, got %v", expected, relays)
+	}
+
+	walks, err := RWS.Walks(ctx, 0)
+	if err != nil {
+		t.Fatalf("Walks(): expected nil, got %v", err)
+	}
+
+	if expected := []models.RandomWalk{{10, 11}}; !reflect.DeepEqual(walks, expected) {
+		t.Errorf("Import(): expected walks %v, got %v", expected, walks)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data := export(t)
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(Magic)+10] ^= 0xFF
+
+	newVersion := bytes.Clone(data)
+	newVersion[len(Magic)] = 2
+
+	testCases := []struct {
+		name          string
+		data          []byte
+		expectedError error
+	}{
+		{
+			name:          "empty",
+			data:          []byte{},
+			expectedError: ErrInvalidMagic,
+		},
+		{
+			name:          "invalid magic",
+			data:          append([]byte("NOTSNAP"), data[len(Magic):]...),
+			expectedError: ErrInvalidMagic,
+		},
+		{
+			name:          "unsupported version",
+			data:          newVersion,
+			expectedError: ErrUnsupportedVersion,
+		},
+		{
+			name:          "truncated",
+			data:          data[:len(data)-10],
+			expectedError: ErrCorrupted,
+		},
+		{
+			name:          "missing checksum",
+			data:          data[:len(data)-4],
+			expectedError: ErrCorrupted,
+		},
+		{
+			name:          "flipped byte",
+			data:          corrupted,
+			expectedError: ErrCorrupted,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Decode(bytes.NewReader(test.data)); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Decode(): expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		snap, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Decode(): expected nil, got %v", err)
+		}
+
+		expected := Header{Version: Version, Alpha: 0.85, WalksPerNode: 1}
+		if snap.Header != expected {
+			t.Errorf("Decode(): expected header %v, got %v", expected, snap.Header)
+		}
+
+		if len(snap.Nodes) != 3 || len(snap.Walks) != 1 {
+			t.Errorf("Decode(): expected 3 nodes and 1 walk, got %d and %d", len(snap.Nodes), len(snap.Walks))
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	snap, err := Decode(bytes.NewReader(export(t)))
+	if err != nil {
+		t.Fatalf("Decode(): expected nil, got %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		DBType        string
+		RWSType       string
+		alpha         float32
+		expectedError error
+	}{
+		{
+			name:          "nil DB",
+			DBType:        "nil",
+			RWSType:       "empty",
+			alpha:         0.85,
+			expectedError: models.ErrNilDB,
+		},
+		{
+			name:          "non-empty DB",
+			DBType:        "one-node0",
+			RWSType:       "empty",
+			alpha:         0.85,
+			expectedError: models.ErrNonEmptyDB,
+		},
+		{
+			name:          "non-empty RWS",
+			DBType:        "empty",
+			RWSType:       "one-node0",
+			alpha:         0.85,
+			expectedError: models.ErrNonEmptyRWS,
+		},
+		{
+			name:          "different alpha",
+			DBType:        "empty",
+			RWSType:       "empty",
+			alpha:         0.5,
+			expectedError: ErrParametersMismatch,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			RWS := mockstore.SetupRWS(test.RWSType)
+			if test.alpha != 0.85 {
+				RWS, _ = mockstore.NewRWS(test.alpha, 1)
+			}
+
+			if _, err := snap.Restore(context.Background(), mockdb.SetupDB(test.DBType), RWS); !errors.Is(err, test.expectedError) {
+				t.Fatalf("Restore(): expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	header, err := ReadHeader(bytes.NewReader(export(t)))
+	if err != nil {
+		t.Fatalf("ReadHeader(): expected nil, got %v", err)
+	}
+
+	expected := Header{Version: Version, Alpha: 0.85, WalksPerNode: 1}
+	if header != expected {
+		t.Errorf("ReadHeader(): expected %v, got %v", expected, header)
+	}
+}
@@ -3,7 +3,9 @@
 package mock
 
 import (
+	"cmp"
 	"context"
+	"slices"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/vertex-lab/crawler/pkg/models"
@@ -31,6 +33,9 @@ type RandomWalkStore struct {
 	// The total number of visits, meaning the sum of how many times each node
 	// was visited by a walk
 	totalVisits int
+
+	// The nodes marked as generated by AddGeneratedWalks()
+	generated mapset.Set[uint32]
 }
 
 // Creates a new RandomWalkStore.
@@ -50,6 +55,7 @@ func NewRWS(alpha float32, walksPerNode uint16) (*RandomWalkStore, error) {
 		alpha:         alpha,
 		walksPerNode:  walksPerNode,
 		totalVisits:   0,
+		generated:     mapset.NewSet[uint32](),
 	}
 	return RWS, nil
 }
@@ -67,8 +73,13 @@ func (RWS *RandomWalkStore) WalksPerNode(ctx context.Context) uint16 {
 }
 
 // TotalVisits() returns the total number of visits.
+// In case of any error, the default value 0 is returned.
 func (RWS *RandomWalkStore) TotalVisits(ctx context.Context) int {
 	_ = ctx
+	if err := RWS.Validate(); err != nil {
+		return 0
+	}
+
 	var visits int
 	for _, walkSet := range RWS.walksVisiting {
 		visits += walkSet.Cardinality()
@@ -184,6 +195,7 @@ func (RWS *RandomWalkStore) WalksVisiting(ctx context.Context, limit int, nodeID
 		}
 
 		IDs := walkSet.ToSlice()
+		slices.Sort(IDs) // so that the limited walks are always the same
 		switch {
 		case limitPerNode > int64(len(IDs)):
 			walkIDs = append(walkIDs, IDs...)
@@ -196,6 +208,71 @@ func (RWS *RandomWalkStore) WalksVisiting(ctx context.Context, limit int, nodeID
 	return sliceutils.Unique(walkIDs), nil
 }
 
+/*
+TopNodes() returns up to k nodeIDs with the most visits, in descending order of visits,
+skipping the first offset. Ties are broken by the lowest nodeID first.
+
+Note:
+- If k <= 0, no node is returned
+- A negative offset is treated as 0
+*/
+func (RWS *RandomWalkStore) TopNodes(ctx context.Context, k, offset int) ([]uint32, error) {
+	_ = ctx
+	if err := RWS.Validate(); err != nil {
+		return nil, err
+	}
+
+	if k <= 0 {
+		return nil, nil
+	}
+
+	ranking := RWS.ranking()
+	offset = max(offset, 0)
+	if offset >= len(ranking) {
+		return nil, nil
+	}
+
+	return ranking[offset:min(offset+k, len(ranking))], nil
+}
+
+// Rank() returns the position of nodeID in the ranking of TopNodes(), starting from 0.
+// If nodeID has no visits, ErrNodeNotFoundRWS is returned.
+func (RWS *RandomWalkStore) Rank(ctx context.Context, nodeID uint32) (int, error) {
+	_ = ctx
+	if err := RWS.Validate(); err != nil {
+		return -1, err
+	}
+
+	rank := slices.Index(RWS.ranking(), nodeID)
+	if rank == -1 {
+		return -1, models.ErrNodeNotFoundRWS
+	}
+
+	return rank, nil
+}
+
+// ranking() returns the nodeIDs with at least one visit, sorted by visits in
+// descending order. Instead of keeping a leaderboard, the mock computes it every time.
+func (RWS *RandomWalkStore) ranking() []uint32 {
+	nodeIDs := make([]uint32, 0, len(RWS.walksVisiting))
+	for ID, walkSet := range RWS.walksVisiting {
+		if walkSet.Cardinality() > 0 {
+			nodeIDs = append(nodeIDs, ID)
+		}
+	}
+
+	slices.SortFunc(nodeIDs, func(ID1, ID2 uint32) int {
+		visits1 := RWS.walksVisiting[ID1].Cardinality()
+		visits2 := RWS.walksVisiting[ID2].Cardinality()
+		if visits1 != visits2 {
+			return cmp.Compare(visits2, visits1)
+		}
+		return cmp.Compare(ID1, ID2)
+	})
+
+	return nodeIDs
+}
+
 // WalksVisitingAll() returns all the IDs of the walk that visit ALL specified nodes.
 func (RWS *RandomWalkStore) WalksVisitingAll(ctx context.Context, nodeIDs ...uint32) ([]uint32, error) {
 	_ = ctx
@@ -203,6 +280,10 @@ func (RWS *RandomWalkStore) WalksVisitingAll(ctx context.Context, nodeIDs ...uin
 		return nil, err
 	}
 
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
 	intersection, exists := RWS.walksVisiting[nodeIDs[0]]
 	if !exists {
 		return nil, nil
@@ -211,7 +292,8 @@ func (RWS *RandomWalkStore) WalksVisitingAll(ctx context.Context, nodeIDs ...uin
 	for _, ID := range nodeIDs[1:] {
 		walkSet, exists := RWS.walksVisiting[ID]
 		if !exists {
-			continue
+			// no walk can visit a node that was never visited
+			return nil, nil
 		}
 		intersection = intersection.Intersect(walkSet)
 	}
@@ -256,6 +338,42 @@ func (RWS *RandomWalkStore) AddWalks(ctx context.Context, walks ...models.Random
 	return nil
 }
 
+// AddGeneratedWalks() adds the walks to the RWS, and marks the nodeIDs as generated.
+func (RWS *RandomWalkStore) AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
+	if err := RWS.AddWalks(ctx, walks...); err != nil {
+		return err
+	}
+
+	RWS.generated.Append(nodeIDs...)
+	return nil
+}
+
+// Generated() returns whether each nodeID has been marked as generated.
+func (RWS *RandomWalkStore) Generated(ctx context.Context, nodeIDs ...uint32) ([]bool, error) {
+	_ = ctx
+	if err := RWS.Validate(); err != nil {
+		return nil, err
+	}
+
+	generated := make([]bool, len(nodeIDs))
+	for i, ID := range nodeIDs {
+		generated[i] = RWS.generated.Contains(ID)
+	}
+
+	return generated, nil
+}
+
+// ClearGenerated() removes the marks of all the nodes.
+func (RWS *RandomWalkStore) ClearGenerated(ctx context.Context) error {
+	_ = ctx
+	if err := RWS.Validate(); err != nil {
+		return err
+	}
+
+	RWS.generated.Clear()
+	return nil
+}
+
 // RemoveWalks() removes the all the specified walks from the RWS. If one walkID
 // is not found, no walk gets removed.
 func (RWS *RandomWalkStore) RemoveWalks(ctx context.Context, walkIDs ...uint32) error {
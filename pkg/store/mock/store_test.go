@@ -8,6 +8,7 @@ import (
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/models/modelstest"
 )
 
 func TestNewRWS(t *testing.T) {
@@ -64,15 +65,6 @@ func TestNewRWS(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
-	t.Run("nil RWS", func(t *testing.T) {
-		RWS := SetupRWS("nil")
-		err := RWS.Validate()
-
-		if !errors.Is(err, models.ErrNilRWS) {
-			t.Errorf("Validate(): expected %v, got %v", models.ErrNilRWS, err)
-		}
-	})
-
 	t.Run("invalid walksPerNode", func(t *testing.T) {
 		RWS, _ := NewRWS(0.85, 1)
 		RWS.walksPerNode = 0
@@ -98,290 +90,8 @@ func TestValidate(t *testing.T) {
 	})
 }
 
-func TestVisitCounts(t *testing.T) {
-	testCases := []struct {
-		name           string
-		RWSType        string
-		nodeIDs        []uint32
-		expectedVisits []int
-		expectedError  error
-	}{
-		{
-			name:           "nil RWS",
-			RWSType:        "nil",
-			nodeIDs:        []uint32{0},
-			expectedVisits: []int{},
-			expectedError:  models.ErrNilRWS,
-		},
-		{
-			name:           "empty RWS",
-			RWSType:        "empty",
-			nodeIDs:        []uint32{0},
-			expectedVisits: []int{0},
-			expectedError:  nil,
-		},
-		{
-			name:           "empty nodeIDs",
-			RWSType:        "one-node0",
-			nodeIDs:        []uint32{},
-			expectedVisits: []int{},
-			expectedError:  nil,
-		},
-		{
-			name:           "one node RWS",
-			RWSType:        "one-node0",
-			nodeIDs:        []uint32{0},
-			expectedVisits: []int{1},
-			expectedError:  nil,
-		},
-		{
-			name:           "triangle RWS, one node not in the RWS",
-			RWSType:        "triangle",
-			nodeIDs:        []uint32{0, 1, 2, 99},
-			expectedVisits: []int{3, 3, 3, 0},
-			expectedError:  nil,
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS := SetupRWS(test.RWSType)
-			visits, err := RWS.VisitCounts(context.Background(), test.nodeIDs...)
-
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("VisitCounts(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(visits, test.expectedVisits) {
-				t.Errorf("VisitCounts(): expected %v, got %v", test.expectedVisits, visits)
-			}
-		})
-	}
-}
-
-func TestWalks(t *testing.T) {
-	testCases := []struct {
-		name          string
-		RWSType       string
-		walkIDs       []uint32
-		expectedWalks []models.RandomWalk
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			walkIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:          "empty RWS",
-			RWSType:       "empty",
-			walkIDs:       []uint32{0},
-			expectedError: models.ErrWalkNotFound,
-		},
-		{
-			name:          "walkID not found in RWS",
-			RWSType:       "one-node0",
-			walkIDs:       []uint32{1},
-			expectedError: models.ErrWalkNotFound,
-		},
-		{
-			name:          "one walkID",
-			RWSType:       "triangle",
-			walkIDs:       []uint32{0},
-			expectedWalks: []models.RandomWalk{{0, 1, 2}},
-		},
-		{
-			name:          "multiple walkID",
-			RWSType:       "triangle",
-			walkIDs:       []uint32{0, 2},
-			expectedWalks: []models.RandomWalk{{0, 1, 2}, {2, 0, 1}},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS := SetupRWS(test.RWSType)
-			walks, err := RWS.Walks(context.Background(), test.walkIDs...)
-
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Walks(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walks, test.expectedWalks) {
-				t.Errorf("Walks(): expected %v, got %v", test.expectedWalks, walks)
-			}
-		})
-	}
-}
-
-func TestWalksVisiting(t *testing.T) {
-	testCases := []struct {
-		name          string
-		RWSType       string
-		limit         int
-		nodeIDs       []uint32
-		expectedIDs   []uint32
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			limit:         1,
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:    "empty RWS",
-			RWSType: "empty",
-			limit:   1,
-			nodeIDs: []uint32{0},
-		},
-		{
-			name:    "nodeID not found in RWS",
-			RWSType: "one-node0",
-			limit:   1,
-			nodeIDs: []uint32{1},
-		},
-		{
-			name:        "one nodeID",
-			RWSType:     "complex",
-			limit:       1,
-			nodeIDs:     []uint32{3},
-			expectedIDs: []uint32{1},
-		},
-		{
-			name:        "multiple nodeIDs",
-			RWSType:     "triangle",
-			limit:       6,
-			nodeIDs:     []uint32{0, 1},
-			expectedIDs: []uint32{0, 1, 2},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS := SetupRWS(test.RWSType)
-			walkIDs, err := RWS.WalksVisiting(context.Background(), test.limit, test.nodeIDs...)
-
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("WalksVisiting(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walkIDs, test.expectedIDs) {
-				t.Errorf("WalksVisiting(): expected %v, got %v", test.expectedIDs, walkIDs)
-			}
-		})
-	}
-}
-
-func TestWalksVisitingAll(t *testing.T) {
-	testCases := []struct {
-		name          string
-		RWSType       string
-		nodeIDs       []uint32
-		expectedIDs   []uint32
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:          "empty RWS",
-			RWSType:       "empty",
-			nodeIDs:       []uint32{0},
-			expectedError: nil,
-		},
-		{
-			name:          "nodeID not found in RWS",
-			RWSType:       "one-node0",
-			nodeIDs:       []uint32{1},
-			expectedError: nil,
-		},
-		{
-			name:        "one nodeID",
-			RWSType:     "complex",
-			nodeIDs:     []uint32{3},
-			expectedIDs: []uint32{1},
-		},
-		{
-			name:        "multiple nodeIDs",
-			RWSType:     "complex",
-			nodeIDs:     []uint32{0, 2},
-			expectedIDs: []uint32{0},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS := SetupRWS(test.RWSType)
-
-			walkIDs, err := RWS.WalksVisitingAll(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("WalksVisitingAll(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walkIDs, test.expectedIDs) {
-				t.Errorf("WalksVisitingAll(): expected %v, got %v", test.expectedIDs, walkIDs)
-			}
-		})
-	}
-}
-
+// TestAddWalks checks the internals of the mock, while the behaviour is covered by TestConformance.
 func TestAddWalks(t *testing.T) {
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name          string
-			RWSType       string
-			walks         []models.RandomWalk
-			expectedError error
-		}{
-			{
-				name:          "nil RWS",
-				RWSType:       "nil",
-				expectedError: models.ErrNilRWS,
-			},
-			{
-				name:          "nil walks",
-				RWSType:       "empty",
-				walks:         nil,
-				expectedError: nil,
-			},
-			{
-				name:          "empty walks",
-				RWSType:       "empty",
-				walks:         []models.RandomWalk{},
-				expectedError: nil,
-			},
-			{
-				name:          "one nil walk",
-				RWSType:       "empty",
-				walks:         []models.RandomWalk{{0, 1}, nil},
-				expectedError: models.ErrNilWalk,
-			},
-			{
-				name:          "one empty walk",
-				RWSType:       "empty",
-				walks:         []models.RandomWalk{{0, 1}, {}},
-				expectedError: models.ErrEmptyWalk,
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				RWS := SetupRWS(test.RWSType)
-
-				err := RWS.AddWalks(context.Background(), test.walks...)
-				if !errors.Is(err, test.expectedError) {
-					t.Errorf("AddWalk(): expected %v, got %v", test.expectedError, err)
-				}
-			})
-		}
-	})
-
 	t.Run("valid", func(t *testing.T) {
 		RWS := SetupRWS("empty")
 		walks := []models.RandomWalk{{1, 2, 3}, {4, 5}}
@@ -414,37 +124,9 @@ func TestAddWalks(t *testing.T) {
 		}
 	})
 }
-func TestRemoveWalks(t *testing.T) {
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name          string
-			RWSType       string
-			expectedError error
-		}{
-			{
-				name:          "nil RWS",
-				RWSType:       "nil",
-				expectedError: models.ErrNilRWS,
-			},
-			{
-				name:          "walk node found",
-				RWSType:       "simple",
-				expectedError: models.ErrWalkNotFound,
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				RWS := SetupRWS(test.RWSType)
-
-				err := RWS.RemoveWalks(context.Background(), 0, 69)
-				if !errors.Is(err, test.expectedError) {
-					t.Errorf("RemoveWalk(): expected %v, got %v", test.expectedError, err)
-				}
-			})
-		}
-	})
 
+// TestRemoveWalks checks the internals of the mock, while the behaviour is covered by TestConformance.
+func TestRemoveWalks(t *testing.T) {
 	t.Run("valid", func(t *testing.T) {
 		RWS := SetupRWS("triangle")
 		nodeIDs := []uint32{0, 1, 2}
@@ -636,4 +318,17 @@ func TestGraftWalk(t *testing.T) {
 
 func TestInterface(t *testing.T) {
 	var _ models.RandomWalkStore = &RandomWalkStore{}
+	var _ models.RandomWalkStore = &SyncRWS{}
+}
+
+func TestConformance(t *testing.T) {
+	modelstest.TestRandomWalkStore(t, func(t testing.TB, RWSType string) models.RandomWalkStore {
+		return SetupRWS(RWSType)
+	})
+}
+
+func TestSyncConformance(t *testing.T) {
+	modelstest.TestRandomWalkStore(t, func(t testing.TB, RWSType string) models.RandomWalkStore {
+		return NewSyncRWS(SetupRWS(RWSType))
+	})
 }
@@ -0,0 +1,127 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+// SyncRWS wraps a mock RandomWalkStore to make it safe for concurrent use.
+// Like Redis, each method is atomic, but a sequence of calls is not.
+type SyncRWS struct {
+	mu  sync.Mutex
+	RWS *RandomWalkStore
+}
+
+// NewSyncRWS() returns a SyncRWS that wraps the RWS.
+func NewSyncRWS(RWS *RandomWalkStore) *SyncRWS {
+	return &SyncRWS{RWS: RWS}
+}
+
+func (s *SyncRWS) Validate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.Validate()
+}
+
+func (s *SyncRWS) Alpha(ctx context.Context) float32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.Alpha(ctx)
+}
+
+func (s *SyncRWS) WalksPerNode(ctx context.Context) uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.WalksPerNode(ctx)
+}
+
+func (s *SyncRWS) TotalVisits(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.TotalVisits(ctx)
+}
+
+func (s *SyncRWS) VisitCounts(ctx context.Context, nodeIDs ...uint32) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.VisitCounts(ctx, nodeIDs...)
+}
+
+func (s *SyncRWS) WalksVisiting(ctx context.Context, limit int, nodeIDs ...uint32) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.WalksVisiting(ctx, limit, nodeIDs...)
+}
+
+func (s *SyncRWS) TopNodes(ctx context.Context, k, offset int) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.TopNodes(ctx, k, offset)
+}
+
+func (s *SyncRWS) Rank(ctx context.Context, nodeID uint32) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.Rank(ctx, nodeID)
+}
+
+func (s *SyncRWS) WalksVisitingAll(ctx context.Context, nodeIDs ...uint32) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.WalksVisitingAll(ctx, nodeIDs...)
+}
+
+// Walks() returns copies of the walks, so that they can be read while the RWS is modified.
+func (s *SyncRWS) Walks(ctx context.Context, walkIDs ...uint32) ([]models.RandomWalk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	walks, err := s.RWS.Walks(ctx, walkIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make([]models.RandomWalk, len(walks))
+	for i, walk := range walks {
+		copies[i] = append(models.RandomWalk{}, walk...)
+	}
+	return copies, nil
+}
+
+func (s *SyncRWS) AddWalks(ctx context.Context, walks ...models.RandomWalk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.AddWalks(ctx, walks...)
+}
+
+func (s *SyncRWS) RemoveWalks(ctx context.Context, walkIDs ...uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.RemoveWalks(ctx, walkIDs...)
+}
+
+func (s *SyncRWS) PruneGraftWalk(ctx context.Context, walkID uint32, cutIndex int, walkSegment models.RandomWalk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.PruneGraftWalk(ctx, walkID, cutIndex, walkSegment)
+}
+
+func (s *SyncRWS) AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.AddGeneratedWalks(ctx, nodeIDs, walks...)
+}
+
+func (s *SyncRWS) Generated(ctx context.Context, nodeIDs ...uint32) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.Generated(ctx, nodeIDs...)
+}
+
+func (s *SyncRWS) ClearGenerated(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RWS.ClearGenerated(ctx)
+}
@@ -0,0 +1,556 @@
+package redistore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/redisutils"
+)
+
+// Visit represents the walk with WalkID visiting the node with NodeID.
+type Visit struct {
+	WalkID uint32
+	NodeID uint32
+}
+
+// BadStep represents the first invalid position of a walk. The walk is
+// considered valid up to (excluding) Index, which is where it gets truncated by Repair().
+type BadStep struct {
+	WalkID uint32
+	Index  int
+	NodeID uint32
+}
+
+// Kinds of bad steps
+const (
+	UnknownNode string = "unknown node" // the node is not in the database
+	Cycle       string = "cycle"        // the node was already visited by the walk
+	InvalidStep string = "invalid step" // the node is not followed by the previous node in the walk
+)
+
+// CheckReport contains the inconsistencies found by Check().
+type CheckReport struct {
+	WalksScanned int
+
+	// the walk visits the node, but the walkID is not in walksVisiting:<nodeID>
+	MissingVisits []Visit
+
+	// the walkID is in walksVisiting:<nodeID>, but the walk doesn't exist or doesn't visit the node
+	OrphanedVisits []Visit
+
+	// walks that need to be truncated, grouped by the kind of bad step
+	BadSteps map[string][]BadStep
+
+	// the totalVisits stored in the RWS, and the sum of the lengths of all walks
+	TotalVisits    int
+	ExpectedVisits int
+
+	// nodes whose score in the leaderboard differs from their visits, or that
+	// are in the leaderboard without being visited
+	DriftedRanks int
+
+	// the walks to truncate, used by Repair()
+	truncate map[uint32]models.RandomWalk
+
+	// the walkIDs already checked, as HSCAN can return the same field more than once
+	scanned map[uint32]struct{}
+}
+
+// OK() returns whether no inconsistency was found.
+func (r *CheckReport) OK() bool {
+	return len(r.MissingVisits) == 0 &&
+		len(r.OrphanedVisits) == 0 &&
+		len(r.truncate) == 0 &&
+		r.TotalVisits == r.ExpectedVisits &&
+		r.DriftedRanks == 0
+}
+
+func (r *CheckReport) String() string {
+	return fmt.Sprintf("walks scanned %d, missing visits %d, orphaned visits %d, unknown nodes %d, cycles %d, invalid steps %d, totalVisits %d (expected %d), drifted ranks %d",
+		r.WalksScanned, len(r.MissingVisits), len(r.OrphanedVisits), len(r.BadSteps[UnknownNode]),
+		len(r.BadSteps[Cycle]), len(r.BadSteps[InvalidStep]), r.TotalVisits, r.ExpectedVisits, r.DriftedRanks)
+}
+
+/*
+Check() scans all the walks in batches of roughly batchSize, and verifies that:
+  - each node visited by a walk contains the walkID in walksVisiting:<nodeID>
+  - each walkID in walksVisiting:<nodeID> belongs to a walk that visits nodeID
+  - each walk only visits nodes in the database, without cycles and following the follows of the DB
+  - totalVisits is equal to the sum of the lengths of all walks
+  - the score of each node in the leaderboard is equal to its visits
+
+The scan is not atomic, so it should be run while the crawler is stopped.
+*/
+func Check(ctx context.Context, RWS *RandomWalkStore, DB models.Database, batchSize int) (*CheckReport, error) {
+	if err := RWS.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &CheckReport{
+		BadSteps:    make(map[string][]BadStep),
+		TotalVisits: RWS.TotalVisits(ctx),
+		truncate:    make(map[uint32]models.RandomWalk),
+		scanned:     make(map[uint32]struct{}),
+	}
+
+	// the number of walkIDs in walksVisiting:<nodeID> that belong to a walk visiting nodeID.
+	present := make(map[uint32]int)
+
+	var cursor uint64
+	for {
+		res, next, err := RWS.client.HScan(ctx, KeyWalks, cursor, "", int64(batchSize)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("Check(): failed to scan the walks: %w", err)
+		}
+
+		if err := report.checkWalks(ctx, RWS, DB, res, present); err != nil {
+			return nil, fmt.Errorf("Check(): %w", err)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if err := report.checkOrphans(ctx, RWS, present, batchSize); err != nil {
+		return nil, fmt.Errorf("Check(): %w", err)
+	}
+
+	return report, nil
+}
+
+// checkWalks() checks a batch of walks returned by HSCAN, which alternates walkIDs and walks.
+// The walks already checked in a previous batch are skipped.
+func (r *CheckReport) checkWalks(
+	ctx context.Context,
+	RWS *RandomWalkStore,
+	DB models.Database,
+	res []string,
+	present map[uint32]int) error {
+
+	walkIDs := make([]uint32, 0, len(res)/2)
+	walks := make([]models.RandomWalk, 0, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		ID, err := redisutils.ParseID(res[i])
+		if err != nil {
+			return err
+		}
+
+		if _, seen := r.scanned[ID]; seen {
+			continue
+		}
+		r.scanned[ID] = struct{}{}
+
+		walk, err := redisutils.ParseWalk(res[i+1])
+		if err != nil {
+			return err
+		}
+
+		walkIDs = append(walkIDs, ID)
+		walks = append(walks, walk)
+	}
+
+	follows, err := fetchFollows(ctx, DB, walks)
+	if err != nil {
+		return err
+	}
+
+	pipe := RWS.client.Pipeline()
+	cmds := make([][]*redis.BoolCmd, len(walks))
+	for i, walk := range walks {
+		cmds[i] = make([]*redis.BoolCmd, len(walk))
+		for j, nodeID := range walk {
+			cmds[i][j] = pipe.SIsMember(ctx, KeyWalksVisiting(nodeID), walkIDs[i])
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to check the walksVisiting: %w", err)
+	}
+
+	for i, walk := range walks {
+		r.WalksScanned++
+		r.ExpectedVisits += len(walk)
+
+		index, kind := FirstBadStep(walk, follows)
+		if kind != "" {
+			r.BadSteps[kind] = append(r.BadSteps[kind], BadStep{WalkID: walkIDs[i], Index: index, NodeID: walk[index]})
+			r.truncate[walkIDs[i]] = walk
+		}
+
+		for j, nodeID := range walk {
+			switch {
+			case slices.Contains(walk[:j], nodeID):
+				// the node was already counted for this walk (cycle)
+				continue
+
+			case cmds[i][j].Val():
+				present[nodeID]++
+
+			case j < index:
+				// only the visits that survive the truncation are missing
+				r.MissingVisits = append(r.MissingVisits, Visit{WalkID: walkIDs[i], NodeID: nodeID})
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchFollows() returns the follows of all the nodes visited by the walks.
+// Nodes that are not in the database are not in the map.
+func fetchFollows(ctx context.Context, DB models.Database, walks []models.RandomWalk) (map[uint32][]uint32, error) {
+	unique := make(map[uint32]struct{})
+	for _, walk := range walks {
+		for _, ID := range walk {
+			unique[ID] = struct{}{}
+		}
+	}
+
+	nodeIDs := make([]uint32, 0, len(unique))
+	for ID := range unique {
+		nodeIDs = append(nodeIDs, ID)
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	pubkeys, err := DB.Pubkeys(ctx, nodeIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the pubkeys: %w", err)
+	}
+
+	known := make([]uint32, 0, len(nodeIDs))
+	for i, pk := range pubkeys {
+		if pk != nil {
+			known = append(known, nodeIDs[i])
+		}
+	}
+
+	follows, err := DB.Follows(ctx, known...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the follows: %w", err)
+	}
+
+	followMap := make(map[uint32][]uint32, len(known))
+	for i, ID := range known {
+		followMap[ID] = follows[i]
+	}
+
+	return followMap, nil
+}
+
+// FirstBadStep() returns the index and the kind of the first bad step of the walk,
+// or an empty kind if the walk is valid. Nodes not in the follows map are unknown.
+func FirstBadStep(walk models.RandomWalk, follows map[uint32][]uint32) (int, string) {
+	for i, ID := range walk {
+		if _, known := follows[ID]; !known {
+			return i, UnknownNode
+		}
+
+		if slices.Contains(walk[:i], ID) {
+			return i, Cycle
+		}
+
+		if i > 0 && !slices.Contains(follows[walk[i-1]], ID) {
+			return i, InvalidStep
+		}
+	}
+
+	return len(walk), ""
+}
+
+// checkOrphans() scans all the walksVisiting keys, looking for walkIDs of walks that don't visit the node.
+// Only the keys whose cardinality differs from the visits present are inspected.
+// It also compares the leaderboard with the cardinality of the keys.
+func (r *CheckReport) checkOrphans(ctx context.Context, RWS *RandomWalkStore, present map[uint32]int, batchSize int) error {
+	var cursor uint64
+	var ranked int64 // the scanned nodes that are in the leaderboard
+	for {
+		keys, next, err := RWS.client.Scan(ctx, cursor, KeyWalksVisitingPrefix+"*", int64(batchSize)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan the walksVisiting: %w", err)
+		}
+
+		nodeIDs := make([]uint32, len(keys))
+		for i, key := range keys {
+			nodeIDs[i], err = redisutils.ParseID(strings.TrimPrefix(key, KeyWalksVisitingPrefix))
+			if err != nil {
+				return err
+			}
+		}
+
+		visits, err := RWS.VisitCounts(ctx, nodeIDs...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch the visit counts: %w", err)
+		}
+
+		scores, err := leaderboardScores(ctx, RWS, nodeIDs)
+		if err != nil {
+			return fmt.Errorf("failed to fetch the leaderboard: %w", err)
+		}
+
+		for i, ID := range nodeIDs {
+			if scores[i] > 0 {
+				ranked++
+			}
+
+			if int(scores[i]) != visits[i] {
+				r.DriftedRanks++
+			}
+
+			if visits[i] == present[ID] {
+				continue
+			}
+
+			if err := r.findOrphans(ctx, RWS, ID); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// nodes that are in the leaderboard without a walksVisiting key
+	size, err := RWS.client.ZCard(ctx, KeyLeaderboard).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch the leaderboard size: %w", err)
+	}
+
+	if size > ranked {
+		r.DriftedRanks += int(size - ranked)
+	}
+
+	return nil
+}
+
+// leaderboardScores() returns the scores of the nodes in the leaderboard, which are 0 for missing nodes.
+func leaderboardScores(ctx context.Context, RWS *RandomWalkStore, nodeIDs []uint32) ([]float64, error) {
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	return RWS.client.ZMScore(ctx, KeyLeaderboard, redisutils.FormatIDs(nodeIDs)...).Result()
+}
+
+// findOrphans() adds to the report the walkIDs in walksVisiting:<nodeID> whose walk doesn't exist or doesn't visit nodeID.
+func (r *CheckReport) findOrphans(ctx context.Context, RWS *RandomWalkStore, nodeID uint32) error {
+	strIDs, err := RWS.client.SMembers(ctx, KeyWalksVisiting(nodeID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch the walks visiting %d: %w", nodeID, err)
+	}
+
+	res, err := RWS.client.HMGet(ctx, KeyWalks, strIDs...).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch the walks visiting %d: %w", nodeID, err)
+	}
+
+	for i, val := range res {
+		walkID, err := redisutils.ParseID(strIDs[i])
+		if err != nil {
+			return err
+		}
+
+		strWalk, ok := val.(string)
+		if !ok {
+			// the walk doesn't exist
+			r.OrphanedVisits = append(r.OrphanedVisits, Visit{WalkID: walkID, NodeID: nodeID})
+			continue
+		}
+
+		walk, err := redisutils.ParseWalk(strWalk)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(walk, nodeID) {
+			r.OrphanedVisits = append(r.OrphanedVisits, Visit{WalkID: walkID, NodeID: nodeID})
+		}
+	}
+
+	return nil
+}
+
+/*
+Repair() fixes the inconsistencies found by Check(), applying the changes in batches of batchSize:
+  - walks with a bad step are truncated before it (or removed if the first node is unknown)
+  - missing visits are added, and orphaned visits removed
+  - totalVisits is set to the sum of the lengths of all walks
+  - the leaderboard is rebuilt from the walksVisiting keys
+
+Like Check(), it should be run while the crawler is stopped.
+*/
+func Repair(ctx context.Context, RWS *RandomWalkStore, report *CheckReport, batchSize int) error {
+	if err := RWS.Validate(); err != nil {
+		return err
+	}
+
+	if report == nil {
+		return ErrNilReport
+	}
+
+	batchSize = max(batchSize, 1)
+	removedVisits := 0
+
+	walkIDs := make([]uint32, 0, len(report.truncate))
+	for ID := range report.truncate {
+		walkIDs = append(walkIDs, ID)
+	}
+	slices.Sort(walkIDs)
+
+	cuts := make(map[uint32]int, len(walkIDs))
+	for _, steps := range report.BadSteps {
+		for _, step := range steps {
+			cuts[step.WalkID] = step.Index
+		}
+	}
+
+	err := inBatches(ctx, RWS, walkIDs, batchSize, func(pipe redis.Pipeliner, walkID uint32) {
+		walk, cut := report.truncate[walkID], cuts[walkID]
+		strID := redisutils.FormatID(walkID)
+
+		if cut == 0 {
+			pipe.HDel(ctx, KeyWalks, strID)
+		} else {
+			pipe.HSet(ctx, KeyWalks, strID, redisutils.FormatWalk(walk[:cut]))
+		}
+
+		for _, nodeID := range walk[cut:] {
+			// in case of cycles, the node is still visited by the truncated walk
+			if !slices.Contains(walk[:cut], nodeID) {
+				pipe.SRem(ctx, KeyWalksVisiting(nodeID), walkID)
+			}
+		}
+
+		removedVisits += len(walk) - cut
+	})
+
+	if err != nil {
+		return fmt.Errorf("Repair(): failed to truncate the walks: %w", err)
+	}
+
+	err = inBatches(ctx, RWS, report.MissingVisits, batchSize, func(pipe redis.Pipeliner, visit Visit) {
+		pipe.SAdd(ctx, KeyWalksVisiting(visit.NodeID), visit.WalkID)
+	})
+
+	if err != nil {
+		return fmt.Errorf("Repair(): failed to add the missing visits: %w", err)
+	}
+
+	err = inBatches(ctx, RWS, report.OrphanedVisits, batchSize, func(pipe redis.Pipeliner, visit Visit) {
+		pipe.SRem(ctx, KeyWalksVisiting(visit.NodeID), visit.WalkID)
+	})
+
+	if err != nil {
+		return fmt.Errorf("Repair(): failed to remove the orphaned visits: %w", err)
+	}
+
+	totalVisits := report.ExpectedVisits - removedVisits
+	if err := RWS.client.HSet(ctx, KeyRWS, KeyTotalVisits, totalVisits).Err(); err != nil {
+		return fmt.Errorf("Repair(): failed to set the totalVisits: %w", err)
+	}
+
+	if err := RebuildLeaderboard(ctx, RWS, batchSize); err != nil {
+		return fmt.Errorf("Repair(): %w", err)
+	}
+
+	return nil
+}
+
+/*
+RebuildLeaderboard() recomputes the leaderboard from the cardinality of all the
+walksVisiting keys, scanned in batches of roughly batchSize. The new leaderboard is
+built in a temporary key, and then atomically replaces the old one.
+
+It's used by Repair(), and by NewRWSConnection() to create the leaderboard of a RWS populated before it existed.
+*/
+func RebuildLeaderboard(ctx context.Context, RWS *RandomWalkStore, batchSize int) error {
+	if err := RWS.Validate(); err != nil {
+		return err
+	}
+
+	tempKey := KeyLeaderboard + ":rebuild"
+	if err := RWS.client.Del(ctx, tempKey).Err(); err != nil {
+		return fmt.Errorf("failed to clear the temporary leaderboard: %w", err)
+	}
+
+	var cursor uint64
+	var ranked int
+	for {
+		keys, next, err := RWS.client.Scan(ctx, cursor, KeyWalksVisitingPrefix+"*", int64(batchSize)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan the walksVisiting: %w", err)
+		}
+
+		pipe := RWS.client.Pipeline()
+		cmds := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.SCard(ctx, key)
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to fetch the visit counts: %w", err)
+		}
+
+		members := make([]redis.Z, 0, len(keys))
+		for i, key := range keys {
+			if visits := cmds[i].Val(); visits > 0 {
+				members = append(members, redis.Z{Score: float64(visits), Member: strings.TrimPrefix(key, KeyWalksVisitingPrefix)})
+			}
+		}
+
+		if len(members) > 0 {
+			if err := RWS.client.ZAdd(ctx, tempKey, members...).Err(); err != nil {
+				return fmt.Errorf("failed to add to the temporary leaderboard: %w", err)
+			}
+			ranked += len(members)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if ranked == 0 {
+		// RENAME fails if the temporary key doesn't exist
+		return RWS.client.Del(ctx, KeyLeaderboard).Err()
+	}
+
+	return RWS.client.Rename(ctx, tempKey, KeyLeaderboard).Err()
+}
+
+// inBatches() applies the operation to all items, executing a pipeline every batchSize items.
+func inBatches[T any](
+	ctx context.Context,
+	RWS *RandomWalkStore,
+	items []T,
+	batchSize int,
+	operation func(pipe redis.Pipeliner, item T)) error {
+
+	for start := 0; start < len(items); start += batchSize {
+		pipe := RWS.client.TxPipeline()
+		for _, item := range items[start:min(start+batchSize, len(items))] {
+			operation(pipe, item)
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package redistore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
+	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/redisutils"
+)
+
+func TestFirstBadStep(t *testing.T) {
+	// 0 --> 1 --> 2 --> 0
+	follows := map[uint32][]uint32{0: {1}, 1: {2}, 2: {0}}
+
+	testCases := []struct {
+		name          string
+		walk          models.RandomWalk
+		expectedIndex int
+		expectedKind  string
+	}{
+		{
+			name:          "empty walk",
+			walk:          models.RandomWalk{},
+			expectedIndex: 0,
+		},
+		{
+			name:          "valid walk",
+			walk:          models.RandomWalk{0, 1, 2},
+			expectedIndex: 3,
+		},
+		{
+			name:          "unknown first node",
+			walk:          models.RandomWalk{7, 0},
+			expectedIndex: 0,
+			expectedKind:  UnknownNode,
+		},
+		{
+			name:          "cycle",
+			walk:          models.RandomWalk{0, 1, 2, 0},
+			expectedIndex: 3,
+			expectedKind:  Cycle,
+		},
+		{
+			name:          "invalid step",
+			walk:          models.RandomWalk{0, 2},
+			expectedIndex: 1,
+			expectedKind:  InvalidStep,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			index, kind := FirstBadStep(test.walk, follows)
+			if index != test.expectedIndex || kind != test.expectedKind {
+				t.Errorf("FirstBadStep(): expected (%d, %q), got (%d, %q)", test.expectedIndex, test.expectedKind, index, kind)
+			}
+		})
+	}
+}
+
+func TestCheckRepair(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	DB := mockdb.SetupDB("triangle")
+	RWS, err := SetupRWS(cl, "triangle")
+	if err != nil {
+		t.Fatalf("SetupRWS(): expected nil, got %v", err)
+	}
+
+	// add inconsistent walks, keeping walksVisiting and totalVisits in sync
+	badWalks := map[string]models.RandomWalk{
+		"3": {0, 1, 2, 0}, // cycle
+		"4": {1, 0},       // invalid step
+		"5": {9, 0},       // unknown node
+	}
+
+	for ID, walk := range badWalks {
+		cl.HSet(ctx, KeyWalks, ID, redisutils.FormatWalk(walk))
+		for _, nodeID := range walk {
+			cl.SAdd(ctx, KeyWalksVisiting(nodeID), ID)
+		}
+		cl.HIncrBy(ctx, KeyRWS, KeyTotalVisits, int64(len(walk)))
+	}
+
+	cl.SRem(ctx, KeyWalksVisiting(1), 0)       // missing visit
+	cl.SAdd(ctx, KeyWalksVisiting(7), 2)       // orphan, node never visited
+	cl.SAdd(ctx, KeyWalksVisiting(0), 99)      // orphan, walk doesn't exist
+	cl.HIncrBy(ctx, KeyRWS, KeyTotalVisits, 1) // drift
+
+	report, err := Check(ctx, RWS, DB, 2)
+	if err != nil {
+		t.Fatalf("Check(): expected nil, got %v", err)
+	}
+
+	if report.OK() {
+		t.Fatalf("Check(): expected inconsistencies, got none")
+	}
+
+	if report.WalksScanned != 6 || report.TotalVisits != 18 || report.ExpectedVisits != 17 {
+		t.Errorf("Check(): expected 6 walks, 18 total visits and 17 expected, got %v", report)
+	}
+
+	if report.DriftedRanks == 0 {
+		t.Errorf("Check(): expected drifted ranks, got %v", report)
+	}
+
+	if expected := []Visit{{WalkID: 0, NodeID: 1}}; !reflect.DeepEqual(report.MissingVisits, expected) {
+		t.Errorf("Check(): expected missing visits %v, got %v", expected, report.MissingVisits)
+	}
+
+	slices.SortFunc(report.OrphanedVisits, func(a, b Visit) int { return int(a.NodeID) - int(b.NodeID) })
+	expectedOrphans := []Visit{{WalkID: 99, NodeID: 0}, {WalkID: 2, NodeID: 7}}
+	if !reflect.DeepEqual(report.OrphanedVisits, expectedOrphans) {
+		t.Errorf("Check(): expected orphaned visits %v, got %v", expectedOrphans, report.OrphanedVisits)
+	}
+
+	expectedSteps := map[string][]BadStep{
+		Cycle:       {{WalkID: 3, Index: 3, NodeID: 0}},
+		InvalidStep: {{WalkID: 4, Index: 1, NodeID: 0}},
+		UnknownNode: {{WalkID: 5, Index: 0, NodeID: 9}},
+	}
+	if !reflect.DeepEqual(report.BadSteps, expectedSteps) {
+		t.Errorf("Check(): expected bad steps %v, got %v", expectedSteps, report.BadSteps)
+	}
+
+	if err := Repair(ctx, RWS, report, 2); err != nil {
+		t.Fatalf("Repair(): expected nil, got %v", err)
+	}
+
+	report, err = Check(ctx, RWS, DB, 2)
+	if err != nil {
+		t.Fatalf("Check(): expected nil, got %v", err)
+	}
+
+	if !report.OK() {
+		t.Errorf("Check(): expected no inconsistencies after Repair(), got %v", report)
+	}
+
+	walks, err := RWS.Walks(ctx, 3, 4)
+	if err != nil {
+		t.Fatalf("Walks(): expected nil, got %v", err)
+	}
+
+	if expected := []models.RandomWalk{{0, 1, 2}, {1}}; !reflect.DeepEqual(walks, expected) {
+		t.Errorf("Repair(): expected truncated walks %v, got %v", expected, walks)
+	}
+
+	if _, err := RWS.Walks(ctx, 5); !errors.Is(err, models.ErrWalkNotFound) {
+		t.Errorf("Repair(): expected walk 5 to be removed, got %v", err)
+	}
+}
+
+// TestCheckDuplicateFields checks that the walks returned more than once by HSCAN are counted once.
+func TestCheckDuplicateFields(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	DB := mockdb.SetupDB("triangle")
+	RWS, err := SetupRWS(cl, "triangle")
+	if err != nil {
+		t.Fatalf("SetupRWS(): expected nil, got %v", err)
+	}
+
+	res, err := cl.HGetAll(ctx, KeyWalks).Result()
+	if err != nil {
+		t.Fatalf("HGetAll(): expected nil, got %v", err)
+	}
+
+	var fields []string
+	for ID, walk := range res {
+		fields = append(fields, ID, walk)
+	}
+
+	report := &CheckReport{
+		BadSteps:    make(map[string][]BadStep),
+		TotalVisits: RWS.TotalVisits(ctx),
+		truncate:    make(map[uint32]models.RandomWalk),
+		scanned:     make(map[uint32]struct{}),
+	}
+
+	// the same fields in two batches
+	present := make(map[uint32]int)
+	for range 2 {
+		if err := report.checkWalks(ctx, RWS, DB, fields, present); err != nil {
+			t.Fatalf("checkWalks(): expected nil, got %v", err)
+		}
+	}
+
+	if err := report.checkOrphans(ctx, RWS, present, 10); err != nil {
+		t.Fatalf("checkOrphans(): expected nil, got %v", err)
+	}
+
+	if report.WalksScanned != len(res) || !report.OK() {
+		t.Errorf("checkWalks(): expected %d walks and no inconsistencies, got %v", len(res), report)
+	}
+}
+
+func TestRepairNilReport(t *testing.T) {
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	RWS, err := SetupRWS(cl, "triangle")
+	if err != nil {
+		t.Fatalf("SetupRWS(): expected nil, got %v", err)
+	}
+
+	if err := Repair(context.Background(), RWS, nil, 10); !errors.Is(err, ErrNilReport) {
+		t.Fatalf("Repair(): expected %v, got %v", ErrNilReport, err)
+	}
+}
+
+func TestRebuildLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	cl := redisutils.SetupTestClient()
+	defer redisutils.CleanupRedis(cl)
+
+	DB := mockdb.SetupDB("triangle")
+	RWS, err := SetupRWS(cl, "triangle")
+	if err != nil {
+		t.Fatalf("SetupRWS(): expected nil, got %v", err)
+	}
+
+	// simulating a RWS populated before the leaderboard existed
+	cl.Del(ctx, KeyLeaderboard)
+	cl.ZAdd(ctx, KeyLeaderboard, redis.Z{Score: 5, Member: "7"})
+
+	report, err := Check(ctx, RWS, DB, 2)
+	if err != nil {
+		t.Fatalf("Check(): expected nil, got %v", err)
+	}
+
+	if report.DriftedRanks != 4 {
+		t.Fatalf("Check(): expected 4 drifted ranks, got %v", report)
+	}
+
+	if err := RebuildLeaderboard(ctx, RWS, 2); err != nil {
+		t.Fatalf("RebuildLeaderboard(): expected nil, got %v", err)
+	}
+
+	nodeIDs, err := RWS.TopNodes(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("TopNodes(): expected nil, got %v", err)
+	}
+
+	slices.Sort(nodeIDs)
+	if expected := []uint32{0, 1, 2}; !reflect.DeepEqual(nodeIDs, expected) {
+		t.Errorf("TopNodes(): expected %v, got %v", expected, nodeIDs)
+	}
+
+	report, err = Check(ctx, RWS, DB, 2)
+	if err != nil {
+		t.Fatalf("Check(): expected nil, got %v", err)
+	}
+
+	if !report.OK() {
+		t.Errorf("Check(): expected no inconsistencies after RebuildLeaderboard(), got %v", report)
+	}
+}
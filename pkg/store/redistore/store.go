@@ -22,6 +22,8 @@ const (
 	KeyTotalVisits         string = "totalVisits"
 	KeyWalks               string = "walks"
 	KeyWalksVisitingPrefix string = "walksVisiting:"
+	KeyLeaderboard         string = "leaderboard"
+	KeyGenerated           string = "generated"
 )
 
 // KeyWalksVisiting() returns the Redis key for the nodeWalkIDs with specified nodeID
@@ -74,13 +76,14 @@ func NewRWS(ctx context.Context, cl *redis.Client, alpha float32, walksPerNode u
 	return RWS, nil
 }
 
-// NewRWSConnection() loads the instance of RandomWalkStore using the provided Redis client
+// NewRWSConnection() loads the instance of RandomWalkStore using the provided Redis client.
+// If the RWS was populated before the leaderboard existed, the leaderboard is built from the walksVisiting.
 func NewRWSConnection(ctx context.Context, cl *redis.Client) (*RandomWalkStore, error) {
 	if cl == nil {
 		return nil, ErrNilClient
 	}
 
-	cmdReturn := cl.HMGet(ctx, KeyRWS, KeyAlpha, KeyWalksPerNode)
+	cmdReturn := cl.HMGet(ctx, KeyRWS, KeyAlpha, KeyWalksPerNode, KeyTotalVisits)
 	if cmdReturn.Err() != nil {
 		return nil, cmdReturn.Err()
 	}
@@ -109,6 +112,21 @@ func NewRWSConnection(ctx context.Context, cl *redis.Client) (*RandomWalkStore,
 		alpha:        fields.Alpha,
 		walksPerNode: fields.WalksPerNode,
 	}
+
+	if fields.TotalVisits > 0 {
+		// otherwise TopNodes and Rank would miss the nodes, and the decrements would drift it further
+		exists, err := cl.Exists(ctx, KeyLeaderboard).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the leaderboard: %w", err)
+		}
+
+		if exists == 0 {
+			if err := RebuildLeaderboard(ctx, RWS, 10000); err != nil {
+				return nil, fmt.Errorf("failed to build the leaderboard: %w", err)
+			}
+		}
+	}
+
 	return RWS, nil
 }
 
@@ -287,6 +305,51 @@ func (RWS *RandomWalkStore) WalksVisiting(ctx context.Context, limit int, nodeID
 	}
 }
 
+/*
+TopNodes() returns up to k nodeIDs with the most visits, in descending order of visits,
+skipping the first offset. Ties are broken by the reverse lexicographic order of the
+nodeIDs, which is how Redis sorts the members of a sorted set with the same score.
+
+Note:
+- If k <= 0, no node is returned
+- A negative offset is treated as 0
+*/
+func (RWS *RandomWalkStore) TopNodes(ctx context.Context, k, offset int) ([]uint32, error) {
+	if err := RWS.Validate(); err != nil {
+		return nil, err
+	}
+
+	if k <= 0 {
+		return nil, nil
+	}
+
+	offset = max(offset, 0)
+	strIDs, err := RWS.client.ZRevRange(ctx, KeyLeaderboard, int64(offset), int64(offset+k-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return redisutils.ParseIDs(strIDs)
+}
+
+// Rank() returns the position of nodeID in the ranking of TopNodes(), starting from 0.
+// If nodeID has no visits, ErrNodeNotFoundRWS is returned.
+func (RWS *RandomWalkStore) Rank(ctx context.Context, nodeID uint32) (int, error) {
+	if err := RWS.Validate(); err != nil {
+		return -1, err
+	}
+
+	rank, err := RWS.client.ZRevRank(ctx, KeyLeaderboard, redisutils.FormatID(nodeID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return -1, fmt.Errorf("%w: nodeID %d", models.ErrNodeNotFoundRWS, nodeID)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	return int(rank), nil
+}
+
 // WalksVisitingAll() returns all the IDs of the walk that visit ALL specified nodes.
 func (RWS *RandomWalkStore) WalksVisitingAll(ctx context.Context, nodeIDs ...uint32) ([]uint32, error) {
 	if err := RWS.Validate(); err != nil {
@@ -313,6 +376,17 @@ func (RWS *RandomWalkStore) WalksVisitingAll(ctx context.Context, nodeIDs ...uin
 // AddWalks() adds all the specified walks to the RWS. If at least one of the walks
 // is invalid, no walk gets added.
 func (RWS *RandomWalkStore) AddWalks(ctx context.Context, walks ...models.RandomWalk) error {
+	return RWS.addWalks(ctx, nil, walks...)
+}
+
+// AddGeneratedWalks() adds all the walks to the RWS, and marks the nodeIDs as generated
+// in the same transaction.
+func (RWS *RandomWalkStore) AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
+	return RWS.addWalks(ctx, nodeIDs, walks...)
+}
+
+// addWalks() adds the walks and marks the nodeIDs (if any) as generated, in a single transaction.
+func (RWS *RandomWalkStore) addWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
 	if err := RWS.Validate(); err != nil {
 		return err
 	}
@@ -344,12 +418,17 @@ func (RWS *RandomWalkStore) AddWalks(ctx context.Context, walks ...models.Random
 		// add the walkID to each node
 		for _, nodeID := range walk {
 			pipe.SAdd(ctx, KeyWalksVisiting(nodeID), walkID)
+			pipe.ZIncrBy(ctx, KeyLeaderboard, 1, redisutils.FormatID(nodeID))
 		}
 
 		newVisits += int64(len(walk))
 	}
 	pipe.HIncrBy(ctx, KeyRWS, KeyTotalVisits, newVisits)
 
+	if len(nodeIDs) > 0 {
+		pipe.SAdd(ctx, KeyGenerated, redisutils.FormatIDs(nodeIDs))
+	}
+
 	if _, err = pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("AddWalk(%v) failed to execute: %v", walks, err)
 	}
@@ -357,6 +436,33 @@ func (RWS *RandomWalkStore) AddWalks(ctx context.Context, walks ...models.Random
 	return nil
 }
 
+// Generated() returns whether each nodeID has been marked as generated.
+func (RWS *RandomWalkStore) Generated(ctx context.Context, nodeIDs ...uint32) ([]bool, error) {
+	if err := RWS.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(nodeIDs) == 0 {
+		return []bool{}, nil
+	}
+
+	generated, err := RWS.client.SMIsMember(ctx, KeyGenerated, redisutils.FormatIDs(nodeIDs)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the generated nodes: %w", err)
+	}
+
+	return generated, nil
+}
+
+// ClearGenerated() removes the marks of all the nodes.
+func (RWS *RandomWalkStore) ClearGenerated(ctx context.Context) error {
+	if err := RWS.Validate(); err != nil {
+		return err
+	}
+
+	return RWS.client.Del(ctx, KeyGenerated).Err()
+}
+
 // RemoveWalks() removes all the specified walks from the RWS. If one walkID
 // is not found, no walk gets removed.
 func (RWS *RandomWalkStore) RemoveWalks(ctx context.Context, walkIDs ...uint32) error {
@@ -397,11 +503,13 @@ func (RWS *RandomWalkStore) RemoveWalks(ctx context.Context, walkIDs ...uint32)
 
 		for _, nodeID := range walks[i] {
 			pipe.SRem(ctx, KeyWalksVisiting(nodeID), strID)
+			pipe.ZIncrBy(ctx, KeyLeaderboard, -1, redisutils.FormatID(nodeID))
 		}
 
 		removedVisits += int64(len(walks[i]))
 	}
 	pipe.HIncrBy(ctx, KeyRWS, KeyTotalVisits, -removedVisits)
+	pipe.ZRemRangeByScore(ctx, KeyLeaderboard, "-inf", "0")
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		return err
@@ -426,6 +534,9 @@ func (RWS *RandomWalkStore) PruneGraftWalk(ctx context.Context, walkID uint32, c
 	// fetch and parse the walk by the walkID
 	walkIDKey := redisutils.FormatID(walkID)
 	strWalk, err := RWS.client.HGet(ctx, KeyWalks, walkIDKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: walkID %v", models.ErrWalkNotFound, walkID)
+	}
 	if err != nil {
 		return err
 	}
@@ -442,13 +553,18 @@ func (RWS *RandomWalkStore) PruneGraftWalk(ctx context.Context, walkID uint32, c
 	pipe := RWS.client.TxPipeline()
 	for _, prunedNodeID := range walk[cutIndex:] {
 		pipe.SRem(ctx, KeyWalksVisiting(prunedNodeID), walkID)
+		pipe.ZIncrBy(ctx, KeyLeaderboard, -1, redisutils.FormatID(prunedNodeID))
 	}
 
 	// add the walkID to each grafted node
 	for _, graftedNodeID := range walkSegment {
 		pipe.SAdd(ctx, KeyWalksVisiting(graftedNodeID), walkID)
+		pipe.ZIncrBy(ctx, KeyLeaderboard, 1, redisutils.FormatID(graftedNodeID))
 	}
 
+	// nodes that are no longer visited leave the leaderboard
+	pipe.ZRemRangeByScore(ctx, KeyLeaderboard, "-inf", "0")
+
 	// update the totalVisits
 	diff := len(walkSegment) - (len(walk) - cutIndex)
 	pipe.HIncrBy(ctx, KeyRWS, KeyTotalVisits, int64(diff))
@@ -497,6 +613,10 @@ func SetupRWS(cl *redis.Client, RWSType string) (*RandomWalkStore, error) {
 			return nil, err
 		}
 
+		if err := cl.ZIncrBy(ctx, KeyLeaderboard, 1, "0").Err(); err != nil {
+			return nil, err
+		}
+
 		if err := RWS.client.HIncrBy(ctx, KeyRWS, KeyLastWalkID, 1).Err(); err != nil {
 			return nil, err
 		}
@@ -523,6 +643,10 @@ func SetupRWS(cl *redis.Client, RWSType string) (*RandomWalkStore, error) {
 			if err := cl.SAdd(ctx, KeyWalksVisiting(nodeID), 0).Err(); err != nil {
 				return nil, err
 			}
+
+			if err := cl.ZIncrBy(ctx, KeyLeaderboard, 1, redisutils.FormatID(nodeID)).Err(); err != nil {
+				return nil, err
+			}
 		}
 
 		if err := RWS.client.HIncrBy(ctx, KeyRWS, KeyLastWalkID, 1).Err(); err != nil {
@@ -610,4 +734,7 @@ func GenerateRWS(cl *redis.Client, nodesNum, walksNum int) (*RandomWalkStore, er
 
 //---------------------------------ERROR-CODES---------------------------------
 
-var ErrNilClient = errors.New("nil redis client pointer")
+var (
+	ErrNilClient = errors.New("nil redis client pointer")
+	ErrNilReport = errors.New("nil check report pointer")
+)
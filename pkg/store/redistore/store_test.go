@@ -11,6 +11,7 @@ import (
 
 	"github.com/redis/go-redis/v9"
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/models/modelstest"
 	"github.com/vertex-lab/crawler/pkg/utils/redisutils"
 )
 
@@ -118,45 +119,33 @@ func TestLoadRWS(t *testing.T) {
 	}
 }
 
-func TestTotalVisits(t *testing.T) {
+func TestLoadRWSLeaderboard(t *testing.T) {
+	ctx := context.Background()
 	cl := redisutils.SetupTestClient()
 	defer redisutils.CleanupRedis(cl)
 
-	testCases := []struct {
-		name                string
-		RWSType             string
-		expectedTotalVisits int
-	}{
-		{
-			name:                "nil RWS",
-			RWSType:             "nil",
-			expectedTotalVisits: 0,
-		},
-		{
-			name:                "empty RWS",
-			RWSType:             "empty",
-			expectedTotalVisits: 0,
-		},
-		{
-			name:                "non-empty RWS",
-			RWSType:             "one-node0",
-			expectedTotalVisits: 1,
-		},
+	if _, err := SetupRWS(cl, "triangle"); err != nil {
+		t.Fatalf("SetupRWS(): expected nil, got %v", err)
 	}
 
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
+	// simulating a RWS populated before the leaderboard existed
+	if err := cl.Del(ctx, KeyLeaderboard).Err(); err != nil {
+		t.Fatalf("Del(): expected nil, got %v", err)
+	}
 
-			RWS, err := SetupRWS(cl, test.RWSType)
-			if err != nil {
-				t.Fatalf("SetupRWS(): expected nil, got %v", err)
-			}
+	RWS, err := NewRWSConnection(ctx, cl)
+	if err != nil {
+		t.Fatalf("NewRWSConnection(): expected nil, got %v", err)
+	}
 
-			visits := RWS.TotalVisits(context.Background())
-			if visits != test.expectedTotalVisits {
-				t.Errorf("TotalVisits(): expected %v, got %v", test.expectedTotalVisits, visits)
-			}
-		})
+	nodeIDs, err := RWS.TopNodes(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("TopNodes(): expected nil, got %v", err)
+	}
+
+	slices.Sort(nodeIDs)
+	if expected := []uint32{0, 1, 2}; !reflect.DeepEqual(nodeIDs, expected) {
+		t.Errorf("TopNodes(): expected %v, got %v", expected, nodeIDs)
 	}
 }
 
@@ -164,18 +153,6 @@ func TestValidate(t *testing.T) {
 	cl := redisutils.SetupTestClient()
 	defer redisutils.CleanupRedis(cl)
 
-	t.Run("nil RWS", func(t *testing.T) {
-		RWS, err := SetupRWS(cl, "nil")
-		if err != nil {
-			t.Fatalf("SetupRWS(): expected nil, got %v", err)
-		}
-
-		err = RWS.Validate()
-		if !errors.Is(err, models.ErrNilRWS) {
-			t.Errorf("Validate(): expected %v, got %v", models.ErrNilRWS, err)
-		}
-	})
-
 	t.Run("invalid walksPerNode", func(t *testing.T) {
 		RWS, _ := NewRWS(context.Background(), cl, 0.85, 1)
 		RWS.walksPerNode = 0
@@ -201,326 +178,8 @@ func TestValidate(t *testing.T) {
 	})
 }
 
-func TestVisitCounts(t *testing.T) {
-	cl := redisutils.SetupTestClient()
-	defer redisutils.CleanupRedis(cl)
-
-	testCases := []struct {
-		name           string
-		RWSType        string
-		nodeIDs        []uint32
-		expectedVisits []int
-		expectedError  error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:           "empty RWS",
-			RWSType:        "empty",
-			nodeIDs:        []uint32{0},
-			expectedVisits: []int{0},
-		},
-		{
-			name:    "nil nodeIDs",
-			RWSType: "one-node0",
-		},
-		{
-			name:    "empty nodeIDs",
-			RWSType: "one-node0",
-			nodeIDs: []uint32{},
-		},
-		{
-			name:           "one node RWS",
-			RWSType:        "one-node0",
-			nodeIDs:        []uint32{0},
-			expectedVisits: []int{1},
-			expectedError:  nil,
-		},
-		{
-			name:           "triangle RWS",
-			RWSType:        "triangle",
-			nodeIDs:        []uint32{0, 1, 2, 99}, // 99 is not in the RWS
-			expectedVisits: []int{3, 3, 3, 0},
-			expectedError:  nil,
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS, err := SetupRWS(cl, test.RWSType)
-			if err != nil {
-				t.Fatalf("SetupRWS(): expected nil, got %v", err)
-			}
-
-			visits, err := RWS.VisitCounts(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("VisitCounts(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(visits, test.expectedVisits) {
-				t.Errorf("VisitCount(0): expected %v, got %v", test.expectedVisits, visits)
-			}
-		})
-	}
-}
-
-func TestWalks(t *testing.T) {
-	cl := redisutils.SetupTestClient()
-	defer redisutils.CleanupRedis(cl)
-
-	testCases := []struct {
-		name          string
-		RWSType       string
-		walkIDs       []uint32
-		expectedWalks []models.RandomWalk
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			walkIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:          "empty RWS",
-			RWSType:       "empty",
-			walkIDs:       []uint32{0},
-			expectedError: models.ErrWalkNotFound,
-		},
-		{
-			name:          "walkID not found in RWS",
-			RWSType:       "one-node0",
-			walkIDs:       []uint32{1},
-			expectedError: models.ErrWalkNotFound,
-		},
-		{
-			name:          "one walkID",
-			RWSType:       "triangle",
-			walkIDs:       []uint32{0},
-			expectedWalks: []models.RandomWalk{{0, 1, 2}},
-		},
-		{
-			name:          "multiple walkID",
-			RWSType:       "triangle",
-			walkIDs:       []uint32{0, 2},
-			expectedWalks: []models.RandomWalk{{0, 1, 2}, {2, 0, 1}},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			RWS, err := SetupRWS(cl, test.RWSType)
-			if err != nil {
-				t.Fatalf("SetupRWS(): expected nil, got %v", err)
-			}
-
-			walks, err := RWS.Walks(context.Background(), test.walkIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("Walks(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walks, test.expectedWalks) {
-				t.Errorf("Walks(): expected %v, got %v", test.expectedWalks, walks)
-			}
-		})
-	}
-}
-
-func TestWalksVisiting(t *testing.T) {
-	testCases := []struct {
-		name          string
-		RWSType       string
-		limit         int
-		nodeIDs       []uint32
-		expectedIDs   []uint32
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			limit:         1,
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:    "nil nodeIDs",
-			RWSType: "one-node0",
-		},
-		{
-			name:    "empty RWS",
-			RWSType: "empty",
-			limit:   1,
-			nodeIDs: []uint32{0},
-		},
-		{
-			name:    "nodeID not found in RWS",
-			RWSType: "one-node0",
-			limit:   1,
-			nodeIDs: []uint32{1},
-		},
-		{
-			name:        "one nodeID",
-			RWSType:     "complex",
-			limit:       1,
-			nodeIDs:     []uint32{3},
-			expectedIDs: []uint32{1},
-		},
-		{
-			name:        "multiple nodeIDs",
-			RWSType:     "triangle",
-			limit:       6,
-			nodeIDs:     []uint32{0, 1},
-			expectedIDs: []uint32{0, 1, 2},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			RWS, err := SetupRWS(cl, test.RWSType)
-			if err != nil {
-				t.Fatalf("SetupRWS(): expected nil, got %v", err)
-			}
-
-			walkIDs, err := RWS.WalksVisiting(context.Background(), test.limit, test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("WalksVisiting(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walkIDs, test.expectedIDs) {
-				t.Errorf("WalksVisiting(): expected %v, got %v", test.expectedIDs, walkIDs)
-			}
-		})
-	}
-}
-
-func TestWalksVisitingAll(t *testing.T) {
-	testCases := []struct {
-		name          string
-		RWSType       string
-		nodeIDs       []uint32
-		expectedIDs   []uint32
-		expectedError error
-	}{
-		{
-			name:          "nil RWS",
-			RWSType:       "nil",
-			nodeIDs:       []uint32{0},
-			expectedError: models.ErrNilRWS,
-		},
-		{
-			name:    "nil nodeIDs",
-			RWSType: "one-node0",
-		},
-		{
-			name:    "empty RWS",
-			RWSType: "empty",
-			nodeIDs: []uint32{0},
-		},
-		{
-			name:    "nodeID not found in RWS",
-			RWSType: "one-node0",
-			nodeIDs: []uint32{1},
-		},
-		{
-			name:        "one nodeID",
-			RWSType:     "complex",
-			nodeIDs:     []uint32{3},
-			expectedIDs: []uint32{1},
-		},
-		{
-			name:        "multiple nodeIDs",
-			RWSType:     "complex",
-			nodeIDs:     []uint32{0, 2},
-			expectedIDs: []uint32{0},
-		},
-	}
-
-	for _, test := range testCases {
-		t.Run(test.name, func(t *testing.T) {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			RWS, err := SetupRWS(cl, test.RWSType)
-			if err != nil {
-				t.Fatalf("SetupRWS(): expected nil, got %v", err)
-			}
-
-			walkIDs, err := RWS.WalksVisitingAll(context.Background(), test.nodeIDs...)
-			if !errors.Is(err, test.expectedError) {
-				t.Fatalf("WalksVisitingAll(): expected %v, got %v", test.expectedError, err)
-			}
-
-			if !reflect.DeepEqual(walkIDs, test.expectedIDs) {
-				t.Errorf("WalksVisitingAll(): expected %v, got %v", test.expectedIDs, walkIDs)
-			}
-		})
-	}
-}
-
+// TestAddWalks checks the keys of the Redis layout, while the behaviour is covered by TestConformance.
 func TestAddWalks(t *testing.T) {
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name          string
-			RWSType       string
-			walks         []models.RandomWalk
-			expectedError error
-		}{
-			{
-				name:          "nil RWS",
-				RWSType:       "nil",
-				expectedError: models.ErrNilRWS,
-			},
-			{
-				name:          "nil walks",
-				RWSType:       "empty",
-				walks:         nil,
-				expectedError: nil,
-			},
-			{
-				name:          "empty walks",
-				RWSType:       "empty",
-				walks:         []models.RandomWalk{},
-				expectedError: nil,
-			},
-			{
-				name:          "one nil walk",
-				RWSType:       "triangle",
-				walks:         []models.RandomWalk{{0}, nil},
-				expectedError: models.ErrNilWalk,
-			},
-			{
-				name:          "one empty walk",
-				RWSType:       "triangle",
-				walks:         []models.RandomWalk{{0}, {}},
-				expectedError: models.ErrEmptyWalk,
-			},
-		}
-
-		for _, test := range testCases {
-			cl := redisutils.SetupTestClient()
-			defer redisutils.CleanupRedis(cl)
-
-			t.Run(test.name, func(t *testing.T) {
-				RWS, err := SetupRWS(cl, test.RWSType)
-				if err != nil {
-					t.Fatalf("SetupRWS(): expected nil, got %v", err)
-				}
-
-				err = RWS.AddWalks(context.Background(), test.walks...)
-				if !errors.Is(err, test.expectedError) {
-					t.Errorf("AddWalk(): expected %v, got %v", test.expectedError, err)
-				}
-			})
-		}
-	})
-
 	t.Run("valid", func(t *testing.T) {
 		cl := redisutils.SetupTestClient()
 		defer redisutils.CleanupRedis(cl)
@@ -612,43 +271,11 @@ func TestAddWalks(t *testing.T) {
 	})
 }
 
+// TestRemoveWalks checks the keys of the Redis layout, while the behaviour is covered by TestConformance.
 func TestRemoveWalks(t *testing.T) {
 	cl := redisutils.SetupTestClient()
 	defer redisutils.CleanupRedis(cl)
 
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name          string
-			RWSType       string
-			expectedError error
-		}{
-			{
-				name:          "nil RWS",
-				RWSType:       "nil",
-				expectedError: models.ErrNilRWS,
-			},
-			{
-				name:          "walk not found",
-				RWSType:       "one-node0",
-				expectedError: models.ErrWalkNotFound,
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				RWS, err := SetupRWS(cl, test.RWSType)
-				if err != nil {
-					t.Fatalf("SetupRWS(): expected nil, got %v", err)
-				}
-
-				err = RWS.RemoveWalks(context.Background(), 0, 69)
-				if !errors.Is(err, test.expectedError) {
-					t.Errorf("RemoveWalks(): expected %v, got %v", test.expectedError, err)
-				}
-			})
-		}
-	})
-
 	t.Run("valid", func(t *testing.T) {
 		RWS, err := SetupRWS(cl, "triangle")
 		if err != nil {
@@ -690,60 +317,11 @@ func TestRemoveWalks(t *testing.T) {
 	})
 }
 
+// TestPruneGraftWalk checks the keys of the Redis layout, while the behaviour is covered by TestConformance.
 func TestPruneGraftWalk(t *testing.T) {
 	cl := redisutils.SetupTestClient()
 	defer redisutils.CleanupRedis(cl)
 
-	t.Run("simple errors", func(t *testing.T) {
-		testCases := []struct {
-			name           string
-			RWSType        string
-			walkID         uint32
-			cutIndex       int
-			newWalkSegment models.RandomWalk
-			expectedError  error
-		}{
-			{
-				name:           "nil RWS",
-				RWSType:        "nil",
-				walkID:         0,
-				cutIndex:       1,
-				newWalkSegment: models.RandomWalk{0},
-				expectedError:  models.ErrNilRWS,
-			},
-			{
-				name:           "walk not found in RWS",
-				RWSType:        "empty",
-				walkID:         0,
-				cutIndex:       1,
-				newWalkSegment: models.RandomWalk{0},
-				expectedError:  redis.Nil,
-			},
-			{
-				name:           "invalid cutIndex",
-				RWSType:        "one-walk0",
-				walkID:         0,
-				cutIndex:       99,
-				newWalkSegment: models.RandomWalk{},
-				expectedError:  models.ErrInvalidWalkIndex,
-			},
-		}
-
-		for _, test := range testCases {
-			t.Run(test.name, func(t *testing.T) {
-				RWS, err := SetupRWS(cl, test.RWSType)
-				if err != nil {
-					t.Fatalf("SetupRWS(): expected nil, got %v", err)
-				}
-
-				err = RWS.PruneGraftWalk(context.Background(), test.walkID, test.cutIndex, test.newWalkSegment)
-				if !errors.Is(err, test.expectedError) {
-					t.Errorf("PruneGraftWalk(): expected %v, got %v", test.expectedError, err)
-				}
-			})
-		}
-	})
-
 	t.Run("valid", func(t *testing.T) {
 		testCases := []struct {
 			name                string
@@ -942,3 +520,16 @@ func BenchmarkVisitCounts(b *testing.B) {
 // 		}
 // 	})
 // }
+
+func TestConformance(t *testing.T) {
+	modelstest.TestRandomWalkStore(t, func(t testing.TB, RWSType string) models.RandomWalkStore {
+		cl := redisutils.SetupTestClient()
+		t.Cleanup(func() { redisutils.CleanupRedis(cl) })
+
+		RWS, err := SetupRWS(cl, RWSType)
+		if err != nil {
+			t.Fatalf("SetupRWS(): expected nil, got %v", err)
+		}
+		return RWS
+	})
+}
@@ -0,0 +1,46 @@
+// The randutils package provides a seedable source of random number generators,
+// used to make the random walks and the pageranks reproducible.
+package randutils
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+Source hands out random number generators derived from a master seed.
+The generators only depend on the seed and on the order of the calls to Rand(),
+so replaying the same sequence of operations produces the same random numbers.
+
+A Source is safe for concurrent use, but reproducibility requires the calls
+to Rand() to happen in a deterministic order, so each goroutine (e.g. ProcessEvents
+or NodeArbiter) should use its own Source.
+
+A nil Source is valid, and produces generators seeded with the current time.
+*/
+type Source struct {
+	mu     sync.Mutex
+	master *rand.Rand
+}
+
+// NewSource() returns a Source with the specified master seed.
+func NewSource(seed int64) *Source {
+	return &Source{master: rand.New(rand.NewSource(seed))}
+}
+
+// Rand() returns a new random number generator, which must not be shared between goroutines.
+func (s *Source) Rand() *rand.Rand {
+	if s == nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rand.New(rand.NewSource(s.master.Int63()))
+}
+
+// Seeded() returns whether the Source has a master seed, i.e. whether its generators are reproducible.
+func (s *Source) Seeded() bool {
+	return s != nil
+}
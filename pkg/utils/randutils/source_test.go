@@ -0,0 +1,47 @@
+package randutils
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRand(t *testing.T) {
+	t.Run("same seed", func(t *testing.T) {
+		src1, src2 := NewSource(69), NewSource(69)
+		for i := 0; i < 10; i++ {
+			rng1, rng2 := src1.Rand(), src2.Rand()
+			for j := 0; j < 10; j++ {
+				if n1, n2 := rng1.Int63(), rng2.Int63(); n1 != n2 {
+					t.Fatalf("Rand(): expected the same numbers, got %d and %d", n1, n2)
+				}
+			}
+		}
+	})
+
+	t.Run("different seeds", func(t *testing.T) {
+		rng1, rng2 := NewSource(69).Rand(), NewSource(420).Rand()
+		if n1, n2 := rng1.Int63(), rng2.Int63(); n1 == n2 {
+			t.Fatalf("Rand(): expected different numbers, got %d and %d", n1, n2)
+		}
+	})
+
+	t.Run("nil source", func(t *testing.T) {
+		var src *Source
+		if rng := src.Rand(); rng == nil {
+			t.Fatalf("Rand(): expected a generator, got nil")
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		src := NewSource(69)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				src.Rand().Int63()
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -5,18 +5,26 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
+	"runtime"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/logger"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 )
 
 /*
 Generate() generates `walksPerNode` random walks for a single node using dampening
 factor `alpha`. The walks are added to the RandomWalkStore.
+The random numbers are drawn from src, which can be nil. If src is seeded,
+the follows are sorted to make the walks reproducible.
 */
 func Generate(
 	ctx context.Context,
+	src *randutils.Source,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32) error {
@@ -29,18 +37,64 @@ func Generate(
 		return fmt.Errorf("failed to generate the walks of nodeID %d: RWS validation failed: %w", nodeID, err)
 	}
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	if err := generateWalks(ctx, rng, DB, RWS, nodeID); err != nil {
+	if src.Seeded() {
+		DB = SortedFollows(DB)
+	}
+
+	if err := generateWalks(ctx, src.Rand(), DB, RWS, nodeID); err != nil {
 		return fmt.Errorf("failed to generate the walks of nodeID %d: %w", nodeID, err)
 	}
 
 	return nil
 }
 
+// GenerateConfig holds the parameters of [GenerateAll].
+type GenerateConfig struct {
+	Log        *logger.Aggregate
+	Workers    int   // the number of goroutines that generate walks concurrently
+	Seed       int64 // worker i uses Seed+i, so the walks are reproducible given Seed and Workers
+	BatchSize  int   // the (minimum) number of walks added to the RWS at once
+	PrintEvery int   // the number of nodes after which the progress is logged. 0 disables it
+	Resume     bool  // if true, nodes whose walks have been generated by an interrupted run are skipped
+}
+
+func NewGenerateConfig() GenerateConfig {
+	return GenerateConfig{
+		Log:        logger.New(os.Stdout),
+		Workers:    runtime.NumCPU(),
+		Seed:       time.Now().UnixNano(),
+		BatchSize:  10000,
+		PrintEvery: 100000,
+		Resume:     false,
+	}
+}
+
+func (c GenerateConfig) Print() {
+	fmt.Printf("Generate\n")
+	fmt.Printf("  Workers: %d\n", c.Workers)
+	fmt.Printf("  Seed: %d\n", c.Seed)
+	fmt.Printf("  BatchSize: %d\n", c.BatchSize)
+	fmt.Printf("  PrintEvery: %d\n", c.PrintEvery)
+	fmt.Printf("  Resume: %v\n", c.Resume)
+}
+
 /*
 GenerateAll() generates `walksPerNode` random walks for ALL nodes in the database
 using dampening factor `alpha`.
 
+The walks are generated by config.Workers goroutines, each with its own random
+number generator seeded from config.Seed. Nodes are sorted and assigned to the
+workers in a round-robin fashion, so the same Seed and Workers produce the same walks
+(the follows are sorted, since the DB returns them in no particular order).
+The DB must be safe for concurrent reads, while the RWS is only written to by
+the calling goroutine, in batches of at least config.BatchSize walks.
+The walks of a node are never split across batches.
+
+The walks of each batch are added with [models.RandomWalkStore.AddGeneratedWalks], which marks
+their nodes as generated. If config.Resume is true, these nodes are skipped, so an interrupted run
+can be restarted without duplicating walks. The marks are cleared once all the walks have been
+generated, after which resuming does nothing.
+
 # NOTE:
 
 This function is computationally expensive and should be called only when
@@ -51,8 +105,10 @@ the Update() method.
 */
 func GenerateAll(
 	ctx context.Context,
+	config GenerateConfig,
 	DB models.Database,
 	RWS models.RandomWalkStore) error {
+
 	if err := DB.Validate(); err != nil {
 		return fmt.Errorf("failed to generate the walks: DB validation failed: %w", err)
 	}
@@ -66,18 +122,180 @@ func GenerateAll(
 		return fmt.Errorf("failed to generate the walks: %w", err)
 	}
 
+	DB = SortedFollows(DB)
+
 	if len(nodeIDs) == 0 {
 		return fmt.Errorf("failed to generate the walks: %w", models.ErrEmptyDB)
 	}
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	if err := generateWalks(ctx, rng, DB, RWS, nodeIDs...); err != nil {
+	slices.Sort(nodeIDs)
+	total := len(nodeIDs)
+
+	if config.Resume {
+		nodeIDs, err = notGenerated(ctx, RWS, config.BatchSize, nodeIDs)
+		if err != nil {
+			return fmt.Errorf("failed to generate the walks: %w", err)
+		}
+
+		if len(nodeIDs) == total && RWS.TotalVisits(ctx) > 0 {
+			// the marks have been cleared by a run that completed
+			config.Log.Info("resuming: the walks have already been generated")
+			return nil
+		}
+
+		if skipped := total - len(nodeIDs); skipped > 0 {
+			config.Log.Info("resuming: %d/%d nodes already have their walks", skipped, total)
+		}
+	}
+
+	if err := generateAll(ctx, config, DB, RWS, nodeIDs); err != nil {
+		return fmt.Errorf("failed to generate the walks: %w", err)
+	}
+
+	if err := RWS.ClearGenerated(ctx); err != nil {
 		return fmt.Errorf("failed to generate the walks: %w", err)
 	}
 
 	return nil
 }
 
+// batch is a group of walks generated by a worker of generateAll(), starting from the nodeIDs.
+type batch struct {
+	walks   []models.RandomWalk
+	nodeIDs []uint32
+}
+
+/*
+generateAll() spreads the nodeIDs among config.Workers goroutines that generate
+the walks, and adds them to the RWS as they come. It stops at the first error,
+giving precedence to the error of a worker over the ones it caused to the RWS by cancelling the context.
+*/
+func generateAll(
+	ctx context.Context,
+	config GenerateConfig,
+	DB models.Database,
+	RWS models.RandomWalkStore,
+	nodeIDs []uint32) error {
+
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+
+	workers := max(1, min(config.Workers, len(nodeIDs)))
+	alpha := RWS.Alpha(ctx)
+	walksPerNode := RWS.WalksPerNode(ctx)
+	nodesPerBatch := max(1, config.BatchSize/max(1, int(walksPerNode)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan batch, workers)
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			var nodes []uint32
+			for i := w; i < len(nodeIDs); i += workers {
+				nodes = append(nodes, nodeIDs[i])
+			}
+
+			rng := rand.New(rand.NewSource(config.Seed + int64(w)))
+			for chunk := range slices.Chunk(nodes, nodesPerBatch) {
+				if err := ctx.Err(); err != nil {
+					errs <- err
+					return
+				}
+
+				b := batch{walks: make([]models.RandomWalk, 0, len(chunk)*int(walksPerNode)), nodeIDs: chunk}
+				for _, ID := range chunk {
+					walks, err := nodeWalks(ctx, rng, DB, ID, alpha, walksPerNode)
+					if err != nil {
+						errs <- err
+						cancel()
+						return
+					}
+					b.walks = append(b.walks, walks...)
+				}
+
+				select {
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				case batches <- b:
+				}
+			}
+		}(w)
+	}
+
+	go func() {
+		wg.Wait()
+		close(batches)
+	}()
+
+	var addErr error
+	done, nextPrint := 0, config.PrintEvery
+	for b := range batches {
+		if ctx.Err() != nil {
+			// draining, so that the workers can return
+			continue
+		}
+
+		if err := RWS.AddGeneratedWalks(ctx, b.nodeIDs, b.walks...); err != nil {
+			if ctx.Err() == nil {
+				// otherwise the error is caused by the cancellation, and the worker's error is in errs
+				addErr = fmt.Errorf("failed to add walks: %w", err)
+			}
+			cancel()
+			continue
+		}
+
+		done += len(b.nodeIDs)
+		if config.PrintEvery > 0 && done >= nextPrint {
+			config.Log.Info("generated the walks of %d/%d nodes", done, len(nodeIDs))
+			nextPrint += config.PrintEvery
+		}
+	}
+
+	if addErr != nil {
+		return addErr
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// notGenerated() returns the nodeIDs that have not been marked as generated in the RWS, fetched in batches.
+func notGenerated(
+	ctx context.Context,
+	RWS models.RandomWalkStore,
+	batchSize int,
+	nodeIDs []uint32) ([]uint32, error) {
+
+	missing := make([]uint32, 0, len(nodeIDs))
+	for chunk := range slices.Chunk(nodeIDs, max(1, batchSize)) {
+		generated, err := RWS.Generated(ctx, chunk...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the generated nodes: %w", err)
+		}
+
+		for i, ID := range chunk {
+			if !generated[i] {
+				missing = append(missing, ID)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
 /*
 generateRandomWalks implement the logic that generates `walksPerNode` random walks,
 starting from each node in the slice nodeIDs. The walks are added to the RandomWalkStore.
@@ -100,18 +318,9 @@ func generateWalks(
 
 	// for each node, perform `walksPerNode` walks and add them to the RWS
 	for _, ID := range nodeIDs {
-		if !DB.ContainsNode(ctx, ID) {
-			return fmt.Errorf("generateWalks(): %w: %v", models.ErrNodeNotFoundDB, ID)
-		}
-
-		walks := make([]models.RandomWalk, walksPerNode)
-		for i := uint16(0); i < walksPerNode; i++ {
-			walk, err := generateWalk(ctx, rng, DB, ID, alpha)
-			if err != nil {
-				return fmt.Errorf("failed to generate walk: %w", err)
-			}
-
-			walks[i] = walk
+		walks, err := nodeWalks(ctx, rng, DB, ID, alpha, walksPerNode)
+		if err != nil {
+			return err
 		}
 
 		if err := RWS.AddWalks(ctx, walks...); err != nil {
@@ -122,6 +331,32 @@ func generateWalks(
 	return nil
 }
 
+// nodeWalks() generates `walksPerNode` walks starting from nodeID.
+func nodeWalks(
+	ctx context.Context,
+	rng *rand.Rand,
+	DB models.Database,
+	nodeID uint32,
+	alpha float32,
+	walksPerNode uint16) ([]models.RandomWalk, error) {
+
+	if !DB.ContainsNode(ctx, nodeID) {
+		return nil, fmt.Errorf("generateWalks(): %w: %v", models.ErrNodeNotFoundDB, nodeID)
+	}
+
+	walks := make([]models.RandomWalk, walksPerNode)
+	for i := uint16(0); i < walksPerNode; i++ {
+		walk, err := generateWalk(ctx, rng, DB, nodeID, alpha)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate walk: %w", err)
+		}
+
+		walks[i] = walk
+	}
+
+	return walks, nil
+}
+
 /*
 generateWalk() generates a single walk from a specified starting node.
 The function returns an error if the DB cannot find the successorIDs of a node.
@@ -173,6 +408,32 @@ func generateWalk(
 	return walk, nil
 }
 
+// SortedFollows() returns the DB with the follows in ascending order. The walks drawn from a seeded
+// generator are reproducible only if the follows come in a stable order, which the DB doesn't guarantee.
+func SortedFollows(DB models.Database) models.Database {
+	return sortedFollows{Database: DB}
+}
+
+// sortedFollows is the Database returned by [SortedFollows].
+type sortedFollows struct {
+	models.Database
+}
+
+func (DB sortedFollows) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	followsByNode, err := DB.Database.Follows(ctx, nodeIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([][]uint32, len(followsByNode))
+	for i, follows := range followsByNode {
+		// cloning, since the follows might be shared with a cache of the DB
+		sorted[i] = slices.Clone(follows)
+		slices.Sort(sorted[i])
+	}
+	return sorted, nil
+}
+
 /*
 performs a walk step nodeID --> nextID in successorIDs and returns
 `nextID` and `stop`.
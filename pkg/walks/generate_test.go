@@ -242,7 +242,7 @@ func TestGenerate(t *testing.T) {
 			DB := mockdb.SetupDB(test.DBType)
 			RWS := mockstore.SetupRWS(test.RWMType)
 
-			err := Generate(ctx, DB, RWS, 0)
+			err := Generate(ctx, nil, DB, RWS, 0)
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("generateWalks(): expected %v, got %v", test.expectedError, err)
 			}
@@ -306,7 +306,7 @@ func TestGenerateAll(t *testing.T) {
 				DB := mockdb.SetupDB(test.DBType)
 				RWS := mockstore.SetupRWS(test.RWMType)
 
-				err := GenerateAll(ctx, DB, RWS)
+				err := GenerateAll(ctx, NewGenerateConfig(), DB, RWS)
 				if !errors.Is(err, test.expectedError) {
 					t.Errorf("GenerateAll(): expected %v, got %v", test.expectedError, err)
 				}
@@ -322,7 +322,7 @@ func TestGenerateAll(t *testing.T) {
 		DB := mockdb.GenerateDB(nodesNum, edgesPerNode, rng)
 		RWS, _ := mockstore.NewRWS(0.85, 10)
 
-		if err := GenerateAll(ctx, DB, RWS); err != nil {
+		if err := GenerateAll(ctx, NewGenerateConfig(), DB, RWS); err != nil {
 			t.Fatalf("GenerateAll(): expected nil got %v", err)
 		}
 
@@ -345,6 +345,215 @@ func TestGenerateAll(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		ctx := context.Background()
+		DB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(42)))
+		config := NewGenerateConfig()
+		config.Workers = 4
+		config.Seed = 69
+		config.BatchSize = 100
+
+		RWS1, _ := mockstore.NewRWS(0.85, 10)
+		if err := GenerateAll(ctx, config, DB, RWS1); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		RWS2, _ := mockstore.NewRWS(0.85, 10)
+		if err := GenerateAll(ctx, config, DB, RWS2); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		for nodeID := uint32(0); nodeID < 200; nodeID++ {
+			walks1 := walksOf(t, RWS1, nodeID)
+			walks2 := walksOf(t, RWS2, nodeID)
+			if !reflect.DeepEqual(walks1, walks2) {
+				t.Fatalf("GenerateAll(): walks of node %d differ: %v and %v", nodeID, walks1, walks2)
+			}
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		ctx := context.Background()
+		DB := mockdb.GenerateDB(100, 10, rand.New(rand.NewSource(42)))
+		mockRWS, _ := mockstore.NewRWS(0.85, 10)
+
+		// an interrupted run that added a few batches
+		config := NewGenerateConfig()
+		config.Workers = 1
+		config.BatchSize = 30
+		if err := GenerateAll(ctx, config, DB, &countingRWS{RandomWalkStore: mockRWS, failAfter: 5}); !errors.Is(err, errRWS) {
+			t.Fatalf("GenerateAll(): expected %v, got %v", errRWS, err)
+		}
+
+		RWS := &countingRWS{RandomWalkStore: mockRWS}
+		config.Resume = true
+		if err := GenerateAll(ctx, config, DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		if RWS.walks != 850 {
+			t.Errorf("GenerateAll(): expected 850 walks added when resuming, got %d", RWS.walks)
+		}
+
+		for nodeID := uint32(0); nodeID < 100; nodeID++ {
+			if walks := walksOf(t, RWS, nodeID); len(walks) != 10 {
+				t.Fatalf("GenerateAll(): expected 10 walks starting from node %d, got %d", nodeID, len(walks))
+			}
+		}
+
+		// resuming a completed run does nothing
+		RWS.walks = 0
+		if err := GenerateAll(ctx, config, DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		if RWS.walks != 0 {
+			t.Errorf("GenerateAll(): expected no walks added, got %d", RWS.walks)
+		}
+	})
+
+	t.Run("worker error", func(t *testing.T) {
+		ctx := context.Background()
+		DB := &failingDB{Database: mockdb.GenerateDB(200, 10, rand.New(rand.NewSource(42))), nodeID: 150}
+		mockRWS, _ := mockstore.NewRWS(0.85, 10)
+
+		// the cancelled AddGeneratedWalks() must not hide the error of the worker
+		if err := GenerateAll(ctx, NewGenerateConfig(), DB, &blockingRWS{RandomWalkStore: mockRWS}); !errors.Is(err, errDB) {
+			t.Fatalf("GenerateAll(): expected %v, got %v", errDB, err)
+		}
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		ctx := context.Background()
+		DB := mockdb.GenerateDB(200, 10, rand.New(rand.NewSource(42)))
+		mockRWS, _ := mockstore.NewRWS(0.85, 10)
+		RWS := &countingRWS{RandomWalkStore: mockRWS}
+
+		config := NewGenerateConfig()
+		config.Workers = 1
+		config.BatchSize = 30
+		if err := GenerateAll(ctx, config, DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+
+		// 3 nodes per batch, 10 walks per node
+		if RWS.calls != 67 {
+			t.Errorf("AddWalks(): expected 67 calls, got %d", RWS.calls)
+		}
+
+		if RWS.walks != 2000 {
+			t.Errorf("AddWalks(): expected 2000 walks, got %d", RWS.walks)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		DB := mockdb.GenerateDB(200, 10, rand.New(rand.NewSource(42)))
+		RWS, _ := mockstore.NewRWS(0.85, 10)
+
+		if err := GenerateAll(ctx, NewGenerateConfig(), DB, RWS); !errors.Is(err, context.Canceled) {
+			t.Fatalf("GenerateAll(): expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+// walksOf() returns the sorted walks starting from nodeID.
+func walksOf(t *testing.T, RWS models.RandomWalkStore, nodeID uint32) []models.RandomWalk {
+	t.Helper()
+	ctx := context.Background()
+	walkIDs, err := RWS.WalksVisiting(ctx, -1, nodeID)
+	if err != nil {
+		t.Fatalf("WalksVisiting(%d): expected nil, got %v", nodeID, err)
+	}
+
+	walks, err := RWS.Walks(ctx, walkIDs...)
+	if err != nil {
+		t.Fatalf("Walks(): expected nil, got %v", err)
+	}
+
+	var own []models.RandomWalk
+	for _, walk := range walks {
+		if startsWith(walk, nodeID) {
+			own = append(own, walk)
+		}
+	}
+
+	slices.SortFunc(own, func(w1, w2 models.RandomWalk) int { return slices.Compare(w1, w2) })
+	return own
+}
+
+// countingRWS counts the calls to AddGeneratedWalks() and the walks added.
+// After failAfter calls (if positive), it fails.
+type countingRWS struct {
+	models.RandomWalkStore
+	calls     int
+	walks     int
+	failAfter int
+}
+
+func (RWS *countingRWS) AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
+	if RWS.failAfter > 0 && RWS.calls >= RWS.failAfter {
+		return errRWS
+	}
+
+	RWS.calls++
+	RWS.walks += len(walks)
+	return RWS.RandomWalkStore.AddGeneratedWalks(ctx, nodeIDs, walks...)
+}
+
+// blockingRWS blocks AddGeneratedWalks() until the context is cancelled.
+type blockingRWS struct {
+	models.RandomWalkStore
+}
+
+func (RWS *blockingRWS) AddGeneratedWalks(ctx context.Context, nodeIDs []uint32, walks ...models.RandomWalk) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// failingDB fails to return the follows of nodeID.
+type failingDB struct {
+	models.Database
+	nodeID uint32
+}
+
+func (DB *failingDB) Follows(ctx context.Context, nodeIDs ...uint32) ([][]uint32, error) {
+	if slices.Contains(nodeIDs, DB.nodeID) {
+		return nil, errDB
+	}
+	return DB.Database.Follows(ctx, nodeIDs...)
+}
+
+var (
+	errRWS = errors.New("RWS failure")
+	errDB  = errors.New("DB failure")
+)
+
+func TestSortedFollows(t *testing.T) {
+	ctx := context.Background()
+	DB := mockdb.NewDatabase()
+	for _, pubkey := range []string{"0", "1", "2", "3", "4"} {
+		if _, err := DB.AddNode(ctx, pubkey); err != nil {
+			t.Fatalf("AddNode(): expected nil, got %v", err)
+		}
+	}
+
+	if err := DB.Update(ctx, &models.Delta{Kind: 3, NodeID: 0, Added: []uint32{4, 2, 3, 1}}); err != nil {
+		t.Fatalf("Update(): expected nil, got %v", err)
+	}
+
+	follows, err := SortedFollows(DB).Follows(ctx, 0, 1)
+	if err != nil {
+		t.Fatalf("Follows(): expected nil, got %v", err)
+	}
+
+	expected := [][]uint32{{1, 2, 3, 4}, {}}
+	if !reflect.DeepEqual(follows, expected) {
+		t.Errorf("Follows(): expected %v, got %v", expected, follows)
+	}
 }
 
 func TestStartsWith(t *testing.T) {
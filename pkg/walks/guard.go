@@ -0,0 +1,99 @@
+package walks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vertex-lab/crawler/pkg/models"
+)
+
+// the number of stripes of the Guard. Walks with the same ID modulo guardStripes share the same lock.
+const guardStripes = 1024
+
+/*
+Guard serializes the prune and graft of the same walk by concurrent calls of [Update]
+(e.g. for different authors), so that a walk is never updated based on an outdated version of it.
+The calls that update the same RandomWalkStore concurrently must share the same Guard.
+
+Each stripe has a lock and a version, which is incremented every time one of its walks
+is updated. Update reads the versions before fetching the walks in batch, and fetches
+a walk again only if its stripe changed in the meantime.
+
+A nil Guard is valid, and doesn't serialize anything, for callers that don't update concurrently.
+*/
+type Guard struct {
+	stripes [guardStripes]stripe
+}
+
+type stripe struct {
+	sync.Mutex
+	version uint64
+}
+
+// NewGuard() returns a Guard for the walks of one RandomWalkStore.
+func NewGuard() *Guard {
+	return &Guard{}
+}
+
+// versions() returns the current version of the stripe of each walkID.
+func (g *Guard) versions(walkIDs []uint32) []uint64 {
+	versions := make([]uint64, len(walkIDs))
+	if g == nil {
+		return versions
+	}
+
+	for i, ID := range walkIDs {
+		s := &g.stripes[ID%guardStripes]
+		s.Lock()
+		versions[i] = s.version
+		s.Unlock()
+	}
+	return versions
+}
+
+/*
+update() locks the walk and calls pruneGraft with its latest version, which is
+the specified walk, unless its stripe changed since version was read.
+
+pruneGraft returns the cutIndex and walkSegment to use in RWS.PruneGraftWalk,
+and false if the walk doesn't need to be updated.
+*/
+func (g *Guard) update(
+	ctx context.Context,
+	RWS models.RandomWalkStore,
+	walkID uint32,
+	walk models.RandomWalk,
+	version uint64,
+	pruneGraft func(walk models.RandomWalk) (int, models.RandomWalk, bool, error)) (bool, error) {
+
+	var s *stripe
+	if g != nil {
+		s = &g.stripes[walkID%guardStripes]
+		s.Lock()
+		defer s.Unlock()
+
+		if s.version != version {
+			walks, err := RWS.Walks(ctx, walkID)
+			if err != nil {
+				return false, err
+			}
+			walk = walks[0]
+		}
+	}
+
+	cutIndex, walkSegment, ok, err := pruneGraft(walk)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if s != nil {
+		// a failed prune and graft might have changed the walk anyway
+		s.version++
+	}
+
+	if err := RWS.PruneGraftWalk(ctx, walkID, cutIndex, walkSegment); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
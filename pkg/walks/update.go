@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"math/rand"
 	"slices"
-	"time"
 
 	"github.com/vertex-lab/crawler/pkg/models"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/utils/sliceutils"
 )
 
@@ -15,6 +15,8 @@ import (
 Update() updates the RandomWalkManager when a node's follows changes.
 These changes are represented by some removed follows, common follows and added follows.
 It returns the number of walks that have been updated, and an error.
+The random numbers are drawn from src, which can be nil. The concurrent calls that
+update the same RWS must share the same guard, which can be nil otherwise (see [Guard]).
 
 # REFERENCES
 
@@ -23,6 +25,8 @@ URL: http://snap.stanford.edu/class/cs224w-readings/bahmani10pagerank.pdf
 */
 func Update(
 	ctx context.Context,
+	src *randutils.Source,
+	guard *Guard,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32,
@@ -40,14 +44,21 @@ func Update(
 		return 0, fmt.Errorf("failed to update the walks of nodeID %d: %w", nodeID, models.ErrNodeNotFoundDB)
 	}
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	updated1, err := updateRemovedNodes(ctx, rng, DB, RWS, nodeID, removed, common)
+	rng := src.Rand()
+	var sampler *rand.Rand
+	if src.Seeded() {
+		// sampling the walks with the rng, and walking the follows in a stable order, to make the update reproducible
+		sampler = rng
+		DB = SortedFollows(DB)
+	}
+
+	updated1, err := updateRemovedNodes(ctx, rng, guard, DB, RWS, nodeID, removed, common)
 	if err != nil {
 		return updated1, fmt.Errorf("failed to update the walks of nodeID %d: updateRemoved: %w", nodeID, err)
 	}
 
 	followsCount := len(common) + len(added)
-	updated2, err := updateAddedNodes(ctx, rng, DB, RWS, nodeID, added, followsCount)
+	updated2, err := updateAddedNodes(ctx, rng, sampler, guard, DB, RWS, nodeID, added, followsCount)
 	if err != nil {
 		return updated1 + updated2, fmt.Errorf("failed to update the walks of nodeID %d: updateAdded: %w", nodeID, err)
 	}
@@ -67,6 +78,7 @@ It returns the number of walks updated, and an error.
 func updateRemovedNodes(
 	ctx context.Context,
 	rng *rand.Rand,
+	guard *Guard,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32,
@@ -88,6 +100,7 @@ func updateRemovedNodes(
 	}
 	walkIDs = sliceutils.Unique(walkIDs) // removing duplicates
 
+	versions := guard.versions(walkIDs)
 	walks, err := RWS.Walks(ctx, walkIDs...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch walks from IDs: %w", err)
@@ -95,25 +108,28 @@ func updateRemovedNodes(
 
 	var updated int
 	for i, ID := range walkIDs {
-		walk := walks[i]
+		ok, err := guard.update(ctx, RWS, ID, walks[i], versions[i], func(walk models.RandomWalk) (int, models.RandomWalk, bool, error) {
+			cutIndex, contains := containsInvalidStep(walk, nodeID, removed)
+			if !contains {
+				return 0, nil, false, nil
+			}
 
-		cutIndex, contains := containsInvalidStep(walk, nodeID, removed)
-		if !contains {
-			continue
-		}
+			// generate a new walk segment that will replace the invalid segment of the walk
+			newSegment, err := generateWalkSegment(ctx, rng, DB, common, walk[:cutIndex], RWS.Alpha(ctx))
+			if err != nil {
+				return 0, nil, false, fmt.Errorf("failed to generateWalkSegment: %w", err)
+			}
 
-		// generate a new walk segment that will replace the invalid segment of the walk
-		newSegment, err := generateWalkSegment(ctx, rng, DB, common, walk[:cutIndex], RWS.Alpha(ctx))
-		if err != nil {
-			return updated, fmt.Errorf("failed to generateWalkSegment: %w", err)
-		}
+			return cutIndex, newSegment, true, nil
+		})
 
-		// prune and graft the walk with the new walk segment
-		if err = RWS.PruneGraftWalk(ctx, ID, cutIndex, newSegment); err != nil {
+		if err != nil {
 			return updated, fmt.Errorf("failed to prune and graft walkID %d: %w", ID, err)
 		}
 
-		updated++
+		if ok {
+			updated++
+		}
 	}
 
 	return updated, nil
@@ -122,10 +138,13 @@ func updateRemovedNodes(
 /*
 a method that updates the RWM by "pruning" some randomly selected walks of nodeID
 and by "grafting" them using the newly added nodes as the starting points.
+The walks are sampled with the sampler, which is nil if they can be sampled by the RWS (see [SampleVisiting]).
 */
 func updateAddedNodes(
 	ctx context.Context,
 	rng *rand.Rand,
+	sampler *rand.Rand,
+	guard *Guard,
 	DB models.Database,
 	RWS models.RandomWalkStore,
 	nodeID uint32,
@@ -141,11 +160,12 @@ func updateAddedNodes(
 		return 0, fmt.Errorf("failed to estimate walks to update: %w", err)
 	}
 
-	walkIDs, err := RWS.WalksVisiting(ctx, limit, nodeID)
+	walkIDs, err := SampleVisiting(ctx, sampler, RWS, limit, nodeID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch walksVisitingAll: %w", err)
+		return 0, fmt.Errorf("failed to fetch walksVisiting: %w", err)
 	}
 
+	versions := guard.versions(walkIDs)
 	walks, err := RWS.Walks(ctx, walkIDs...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch walks from IDs: %w", err)
@@ -153,27 +173,36 @@ func updateAddedNodes(
 
 	var updated int
 	for i, ID := range walkIDs {
-		walk := walks[i]
+		ok, err := guard.update(ctx, RWS, ID, walks[i], versions[i], func(walk models.RandomWalk) (int, models.RandomWalk, bool, error) {
+			index := slices.Index(walk, nodeID)
+			if index == -1 {
+				// the walk no longer visits nodeID, because a concurrent update pruned it
+				return 0, nil, false, nil
+			}
 
-		// prune the walk AFTER the position of nodeID
-		cutIndex := slices.Index(walk, nodeID) + 1
+			// prune the walk AFTER the position of nodeID
+			cutIndex := index + 1
 
-		// with probability alpha, generate a new walk segment that will replace the old segment
-		var newSegment models.RandomWalk
-		if rng.Float32() < RWS.Alpha(ctx) {
+			// with probability alpha, generate a new walk segment that will replace the old segment
+			if rng.Float32() >= RWS.Alpha(ctx) {
+				return cutIndex, nil, true, nil
+			}
 
-			newSegment, err = generateWalkSegment(ctx, rng, DB, added, walk[:cutIndex], RWS.Alpha(ctx))
+			newSegment, err := generateWalkSegment(ctx, rng, DB, added, walk[:cutIndex], RWS.Alpha(ctx))
 			if err != nil {
-				return updated, fmt.Errorf("failed to generateWalkSegment: %w", err)
+				return 0, nil, false, fmt.Errorf("failed to generateWalkSegment: %w", err)
 			}
-		}
 
-		// prune and graft the walk with the new walk segment
-		if err := RWS.PruneGraftWalk(ctx, ID, cutIndex, newSegment); err != nil {
+			return cutIndex, newSegment, true, nil
+		})
+
+		if err != nil {
 			return updated, fmt.Errorf("failed to prune and graft walkID %d: %w", ID, err)
 		}
 
-		updated++
+		if ok {
+			updated++
+		}
 	}
 
 	return updated, nil
@@ -205,6 +234,66 @@ func generateWalkSegment(
 	return sliceutils.DeleteCyclesInPlace(currentWalk, newSegment), nil
 }
 
+/*
+SampleVisiting() returns up to limit walkIDs evenly distributed among the nodeIDs,
+like [models.RandomWalkStore.WalksVisiting], sorted in ascending order.
+
+If rng is nil, the walks are sampled by the RWS (e.g. with SRANDMEMBER), which is cheap but not reproducible.
+Otherwise all the walks of each node are fetched and sampled with the rng, so the result only depends on its seed.
+*/
+func SampleVisiting(
+	ctx context.Context,
+	rng *rand.Rand,
+	RWS models.RandomWalkStore,
+	limit int,
+	nodeIDs ...uint32) ([]uint32, error) {
+
+	if rng == nil || limit <= 0 {
+		walkIDs, err := RWS.WalksVisiting(ctx, limit, nodeIDs...)
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(walkIDs)
+		return walkIDs, nil
+	}
+
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	limitPerNode := limit / len(nodeIDs)
+	if limitPerNode == 0 {
+		return nil, nil
+	}
+
+	walkIDs := make([]uint32, 0, limit)
+	for _, ID := range nodeIDs {
+		IDs, err := RWS.WalksVisiting(ctx, -1, ID)
+		if err != nil {
+			return nil, err
+		}
+		walkIDs = append(walkIDs, sample(rng, IDs, limitPerNode)...)
+	}
+
+	return sliceutils.Unique(walkIDs), nil
+}
+
+// sample() returns `limit` random walkIDs, drawn without replacement using the rng.
+// The walkIDs are sorted, so the result only depends on the rng and their values.
+func sample(rng *rand.Rand, walkIDs []uint32, limit int) []uint32 {
+	slices.Sort(walkIDs)
+	if limit >= len(walkIDs) {
+		return walkIDs
+	}
+
+	for i := 0; i < limit; i++ {
+		j := i + rng.Intn(len(walkIDs)-i)
+		walkIDs[i], walkIDs[j] = walkIDs[j], walkIDs[i]
+	}
+
+	return walkIDs[:max(limit, 0)]
+}
+
 // containsInvalidStep() returns the index or position where the RandomWalk needs to be
 // Pruned and Grafted. This happens if the walk contains an invalid hop nodeID --> removedNode in removedNodes.
 func containsInvalidStep(walk models.RandomWalk, nodeID uint32, removedNodes []uint32) (int, bool) {
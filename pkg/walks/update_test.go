@@ -5,7 +5,9 @@ import (
 	"errors"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"slices"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
 	"github.com/vertex-lab/crawler/pkg/models"
 	mockstore "github.com/vertex-lab/crawler/pkg/store/mock"
+	"github.com/vertex-lab/crawler/pkg/utils/randutils"
 	"github.com/vertex-lab/crawler/pkg/utils/sliceutils"
 )
 
@@ -115,7 +118,7 @@ func TestUpdateRemovedNodes(t *testing.T) {
 				rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 				DB := mockdb.SetupDB(test.DBType)
 				RWS := mockstore.SetupRWS(test.RWMType)
-				updated, err := updateRemovedNodes(ctx, rng, DB, RWS, 0, test.removed, []uint32{2})
+				updated, err := updateRemovedNodes(ctx, rng, nil, DB, RWS, 0, test.removed, []uint32{2})
 
 				if !errors.Is(err, test.expectedError) {
 					t.Fatalf("updateRemovedNodes(): expected %v, got %v", test.expectedError, err)
@@ -157,7 +160,7 @@ func TestUpdateRemovedNodes(t *testing.T) {
 			},
 		}
 
-		updated, err := updateRemovedNodes(ctx, rng, DB, RWS, nodeID, removeFollows, commonFollows)
+		updated, err := updateRemovedNodes(ctx, rng, nil, DB, RWS, nodeID, removeFollows, commonFollows)
 		if err != nil {
 			t.Fatalf("updateRemovedNodes(): expected nil, got %v", err)
 		}
@@ -246,7 +249,7 @@ func TestUpdateAddedNodes(t *testing.T) {
 				DB := mockdb.SetupDB(test.DBType)
 				RWS := mockstore.SetupRWS(test.RWMType)
 
-				updated, err := updateAddedNodes(ctx, rng, DB, RWS, 0, test.addedFollows, test.newOutDegree)
+				updated, err := updateAddedNodes(ctx, rng, rng, nil, DB, RWS, 0, test.addedFollows, test.newOutDegree)
 				if !errors.Is(err, test.expectedError) {
 					t.Fatalf("updateRemovedNodes(): expected %v, got %v", test.expectedError, err)
 				}
@@ -281,7 +284,7 @@ func TestUpdateAddedNodes(t *testing.T) {
 			},
 		}
 
-		updated, err := updateAddedNodes(ctx, rng, DB, RWS, nodeID, addedFollows, len(currentFollows))
+		updated, err := updateAddedNodes(ctx, rng, rng, nil, DB, RWS, nodeID, addedFollows, len(currentFollows))
 		if err != nil {
 			t.Fatalf("updateAddedNodes(): expected nil, got %v", err)
 		}
@@ -405,7 +408,7 @@ func TestUpdate(t *testing.T) {
 				RWS := mockstore.SetupRWS(test.RWMType)
 
 				removed, common, added := sliceutils.Partition(test.oldFollows, test.currentFollows)
-				updated, err := Update(ctx, DB, RWS, test.nodeID, removed, common, added)
+				updated, err := Update(ctx, nil, nil, DB, RWS, test.nodeID, removed, common, added)
 				if !errors.Is(err, test.expectedError) {
 					t.Fatalf("Update(): expected %v, got %v", test.expectedError, err)
 				}
@@ -427,7 +430,7 @@ func TestUpdate(t *testing.T) {
 		DB1 := mockdb.GenerateDB(nodesNum, edgesPerNode, rng1)
 		RWS, _ := mockstore.NewRWS(0.85, 10)
 
-		if err := GenerateAll(ctx, DB1, RWS); err != nil {
+		if err := GenerateAll(ctx, NewGenerateConfig(), DB1, RWS); err != nil {
 			t.Fatalf("GenerateAll(): expected nil got %v", err)
 		}
 
@@ -443,7 +446,7 @@ func TestUpdate(t *testing.T) {
 
 			removed, common, added := sliceutils.Partition(oldFollows.ToSlice(), newFollows.ToSlice())
 
-			if _, err := Update(ctx, DB1, RWS, nodeID, removed, common, added); err != nil {
+			if _, err := Update(ctx, nil, nil, DB1, RWS, nodeID, removed, common, added); err != nil {
 				t.Fatalf("Update(%d): expected nil, got %v", nodeID, err)
 			}
 		}
@@ -468,3 +471,217 @@ func TestUpdate(t *testing.T) {
 		}
 	})
 }
+
+func TestUpdateReproducible(t *testing.T) {
+	ctx := context.Background()
+	DB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(42)))
+	newDB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(69)))
+
+	config := NewGenerateConfig()
+	config.Seed = 69
+	RWS1, _ := mockstore.NewRWS(0.85, 10)
+	RWS2, _ := mockstore.NewRWS(0.85, 10)
+	for _, RWS := range []models.RandomWalkStore{RWS1, RWS2} {
+		if err := GenerateAll(ctx, config, DB, RWS); err != nil {
+			t.Fatalf("GenerateAll(): expected nil, got %v", err)
+		}
+	}
+
+	// replaying the same follow-list updates on the two RWSs
+	src1, src2 := randutils.NewSource(420), randutils.NewSource(420)
+	for nodeID := uint32(0); nodeID < 50; nodeID++ {
+		oldFollows := DB.Follow[nodeID]
+		newFollows := newDB.Follow[nodeID]
+		DB.Follow[nodeID] = newFollows
+
+		removed, common, added := sliceutils.Partition(oldFollows.ToSlice(), newFollows.ToSlice())
+		if _, err := Update(ctx, src1, nil, DB, RWS1, nodeID, removed, common, added); err != nil {
+			t.Fatalf("Update(%d): expected nil, got %v", nodeID, err)
+		}
+
+		if _, err := Update(ctx, src2, nil, DB, RWS2, nodeID, removed, common, added); err != nil {
+			t.Fatalf("Update(%d): expected nil, got %v", nodeID, err)
+		}
+	}
+
+	for nodeID := uint32(0); nodeID < 200; nodeID++ {
+		walks1 := walksOf(t, RWS1, nodeID)
+		walks2 := walksOf(t, RWS2, nodeID)
+		if !reflect.DeepEqual(walks1, walks2) {
+			t.Fatalf("Update(): walks of node %d differ: %v and %v", nodeID, walks1, walks2)
+		}
+	}
+}
+
+// TestUpdateConcurrent updates the walks of different nodes concurrently, which
+// share many walks, and checks that the RWS is consistent with the final DB.
+func TestUpdateConcurrent(t *testing.T) {
+	ctx := context.Background()
+	DB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(42)))
+	newDB := mockdb.GenerateDB(200, 20, rand.New(rand.NewSource(69)))
+
+	mockRWS, _ := mockstore.NewRWS(0.85, 10)
+	RWS := yieldingRWS{mockstore.NewSyncRWS(mockRWS)}
+	if err := GenerateAll(ctx, NewGenerateConfig(), DB, RWS); err != nil {
+		t.Fatalf("GenerateAll(): expected nil, got %v", err)
+	}
+
+	type change struct{ removed, common, added []uint32 }
+	changes := make([]change, 50)
+	for nodeID := range changes {
+		oldFollows := DB.Follow[uint32(nodeID)]
+		newFollows := newDB.Follow[uint32(nodeID)]
+		DB.Follow[uint32(nodeID)] = newFollows
+
+		removed, common, added := sliceutils.Partition(oldFollows.ToSlice(), newFollows.ToSlice())
+		changes[nodeID] = change{removed: removed, common: common, added: added}
+	}
+
+	guard := NewGuard()
+	var wg sync.WaitGroup
+	for nodeID, c := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Update(ctx, nil, guard, DB, RWS, uint32(nodeID), c.removed, c.common, c.added); err != nil {
+				t.Errorf("Update(%d): expected nil, got %v", nodeID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	totalVisits := 0
+	for walkID, walk := range mockRWS.WalkIndex {
+		totalVisits += len(walk)
+		for i, ID := range walk {
+			if i > 0 && !DB.Follow[walk[i-1]].Contains(ID) {
+				t.Fatalf("walk %d: %v contains the invalid step %d -> %d", walkID, walk, walk[i-1], ID)
+			}
+
+			walkIDs, err := RWS.WalksVisiting(ctx, -1, ID)
+			if err != nil {
+				t.Fatalf("WalksVisiting(%d): expected nil, got %v", ID, err)
+			}
+
+			if !slices.Contains(walkIDs, walkID) {
+				t.Fatalf("WalksVisiting(%d): expected to contain walk %d: %v", ID, walkID, walk)
+			}
+		}
+	}
+
+	if RWS.TotalVisits(ctx) != totalVisits {
+		t.Errorf("TotalVisits(): expected %d, got %d", totalVisits, RWS.TotalVisits(ctx))
+	}
+}
+
+// yieldingRWS yields the processor after fetching the walks, to interleave the
+// goroutines like network round-trips would.
+type yieldingRWS struct {
+	*mockstore.SyncRWS
+}
+
+func (y yieldingRWS) Walks(ctx context.Context, walkIDs ...uint32) ([]models.RandomWalk, error) {
+	walks, err := y.SyncRWS.Walks(ctx, walkIDs...)
+	runtime.Gosched()
+	return walks, err
+}
+
+func TestSample(t *testing.T) {
+	testCases := []struct {
+		name     string
+		walkIDs  []uint32
+		limit    int
+		expected int
+	}{
+		{name: "nil walkIDs", walkIDs: nil, limit: 5, expected: 0},
+		{name: "limit zero", walkIDs: []uint32{3, 1, 2}, limit: 0, expected: 0},
+		{name: "limit bigger than walkIDs", walkIDs: []uint32{3, 1, 2}, limit: 5, expected: 3},
+		{name: "valid", walkIDs: []uint32{5, 3, 1, 4, 2, 0}, limit: 3, expected: 3},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rng1 := rand.New(rand.NewSource(69))
+			rng2 := rand.New(rand.NewSource(69))
+
+			// the same rng must give the same sample regardless of the initial order
+			sample1 := sample(rng1, slices.Clone(test.walkIDs), test.limit)
+			reversed := slices.Clone(test.walkIDs)
+			slices.Reverse(reversed)
+			sample2 := sample(rng2, reversed, test.limit)
+
+			if len(sample1) != test.expected {
+				t.Fatalf("sample(): expected %d walkIDs, got %v", test.expected, sample1)
+			}
+
+			if !slices.Equal(sample1, sample2) {
+				t.Errorf("sample(): expected the same walkIDs, got %v and %v", sample1, sample2)
+			}
+
+			if len(sliceutils.Unique(slices.Clone(sample1))) != len(sample1) {
+				t.Errorf("sample(): expected unique walkIDs, got %v", sample1)
+			}
+		})
+	}
+}
+
+func TestSampleVisiting(t *testing.T) {
+	ctx := context.Background()
+	DB := mockdb.GenerateDB(100, 10, rand.New(rand.NewSource(42)))
+	RWS, _ := mockstore.NewRWS(0.85, 10)
+
+	config := NewGenerateConfig()
+	config.Seed = 69
+	if err := GenerateAll(ctx, config, DB, RWS); err != nil {
+		t.Fatalf("GenerateAll(): expected nil, got %v", err)
+	}
+
+	nodeIDs := []uint32{0, 1, 2}
+	testCases := []struct {
+		name  string
+		rng1  *rand.Rand
+		rng2  *rand.Rand
+		limit int
+	}{
+		{name: "sampled by the RWS", limit: 15},
+		{name: "sampled with the rng", rng1: rand.New(rand.NewSource(69)), rng2: rand.New(rand.NewSource(69)), limit: 15},
+		{name: "limit smaller than nodeIDs", rng1: rand.New(rand.NewSource(69)), rng2: rand.New(rand.NewSource(69)), limit: 2},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			walkIDs1, err := SampleVisiting(ctx, test.rng1, RWS, test.limit, nodeIDs...)
+			if err != nil {
+				t.Fatalf("SampleVisiting(): expected nil, got %v", err)
+			}
+
+			walkIDs2, err := SampleVisiting(ctx, test.rng2, RWS, test.limit, nodeIDs...)
+			if err != nil {
+				t.Fatalf("SampleVisiting(): expected nil, got %v", err)
+			}
+
+			if len(walkIDs1) > test.limit {
+				t.Fatalf("SampleVisiting(): expected up to %d walkIDs, got %v", test.limit, walkIDs1)
+			}
+
+			if !slices.IsSorted(walkIDs1) {
+				t.Errorf("SampleVisiting(): expected sorted walkIDs, got %v", walkIDs1)
+			}
+
+			if test.rng1 != nil && !slices.Equal(walkIDs1, walkIDs2) {
+				t.Errorf("SampleVisiting(): expected the same walkIDs, got %v and %v", walkIDs1, walkIDs2)
+			}
+
+			walks, err := RWS.Walks(ctx, walkIDs1...)
+			if err != nil {
+				t.Fatalf("Walks(): expected nil, got %v", err)
+			}
+
+			for i, walk := range walks {
+				if !slices.ContainsFunc(nodeIDs, func(ID uint32) bool { return slices.Contains(walk, ID) }) {
+					t.Errorf("SampleVisiting(): walk %d %v doesn't visit any of %v", walkIDs1[i], walk, nodeIDs)
+				}
+			}
+		})
+	}
+}
@@ -112,7 +112,7 @@ func Acyclic1() (ST StaticSetup, Deltas []*models.Delta) {
 	ST.DB.Follow[3] = mapset.NewSet[uint32](1)
 	ST.DB.Follow[4] = mapset.NewSet[uint32]()
 
-	ST.expectedGlobal = models.PagerankMap{0: 0.11185368285521291, 1: 0.36950360789646736, 2: 0.15943176539450626, 3: 0.24735726099860061, 4: 0.11185368285521291}
+	ST.expectedGlobal = models.PagerankMap{0: 0.11184665823156452, 1: 0.36960427254234446, 2: 0.15938148797997945, 3: 0.24732092301454706, 4: 0.11184665823156452}
 	ST.expectedPersonalized0 = models.PagerankMap{0: 0.39709199748768864, 1: 0.2906949630265446, 2: 0.16876345947470478, 3: 0.14344958001106195, 4: 0.0}
 
 	Deltas = []*models.Delta{
@@ -61,7 +61,7 @@ func TestPagerankStatic(t *testing.T) {
 			DB, expectedGlobal := setup.DB, setup.expectedGlobal
 
 			RWS, _ := mockstore.NewRWS(alpha, walkPerNode)
-			if err := walks.GenerateAll(ctx, DB, RWS); err != nil {
+			if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
 				t.Fatalf("GenerateAll: expected nil, got %v", err)
 			}
 
@@ -91,6 +91,54 @@ when the probability of cycles involving nodeID --> removedNode is high.
 Therefore, test only with acyclic graphs, or graphs large enough that the
 probability of such cycles is very low.
 */
+func TestPowerIteration(t *testing.T) {
+	const alpha = 0.85
+	tests := []struct {
+		name  string
+		setup func() (StaticSetup, []*models.Delta)
+	}{
+		{
+			name:  "all dandling nodes",
+			setup: Dandlings,
+		},
+		{
+			name:  "acyclic graph 1",
+			setup: Acyclic1,
+		},
+		{
+			name:  "acyclic graph 2",
+			setup: Acyclic2,
+		},
+		{
+			name:  "acyclic graph 3",
+			setup: Acyclic3,
+		},
+		{
+			name:  "acyclic graph 4",
+			setup: Acyclic4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setup, _ := test.setup()
+			for _, node := range setup.DB.NodeIndex {
+				node.Status = models.StatusActive // walks start from all nodes, like in GenerateAll
+			}
+
+			pr, err := pagerank.PowerIteration(context.Background(), setup.DB, alpha, 1e-12)
+			if err != nil {
+				t.Fatalf("PowerIteration(): expected nil, got %v", err)
+			}
+
+			// on acyclic graphs the Monte-Carlo and exact pageranks are the same
+			if distance := pagerank.Distance(pr, setup.expectedGlobal); distance > 1e-6 {
+				t.Errorf("PowerIteration(): expected %v, got %v", setup.expectedGlobal, pr)
+			}
+		})
+	}
+}
+
 func TestPagerankDynamic(t *testing.T) {
 	const maxExpectedDistance = 0.01
 	const alpha = 0.85
@@ -141,7 +189,7 @@ func TestPagerankDynamic(t *testing.T) {
 			}
 
 			RWS, _ := mockstore.NewRWS(alpha, walkPerNode)
-			if err := walks.GenerateAll(ctx, DB, RWS); err != nil {
+			if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
 				t.Fatalf("GenerateAll: expected nil, pr %v", err)
 			}
 
@@ -152,7 +200,7 @@ func TestPagerankDynamic(t *testing.T) {
 				t.Fatalf("Update(%v): expected nil, got %v", delta, err)
 			}
 
-			if _, err := walks.Update(ctx, DB, RWS, inverse.NodeID, inverse.Removed, common, inverse.Added); err != nil {
+			if _, err := walks.Update(ctx, nil, nil, DB, RWS, inverse.NodeID, inverse.Removed, common, inverse.Added); err != nil {
 				t.Fatalf("Update: expected nil, pr %v", err)
 			}
 
@@ -220,11 +268,11 @@ func TestPersonalizedPagerank(t *testing.T) {
 			DB, expectedPersonalized0 := setup.DB, setup.expectedPersonalized0
 
 			RWS, _ := mockstore.NewRWS(alpha, walkPerNode)
-			if err := walks.GenerateAll(ctx, DB, RWS); err != nil {
+			if err := walks.GenerateAll(ctx, walks.NewGenerateConfig(), DB, RWS); err != nil {
 				t.Fatalf("GenerateAll: expected nil, got %v", err)
 			}
 
-			pp, err := pagerank.Personalized(ctx, DB, RWS, nodeID, topk)
+			pp, err := pagerank.Personalized(ctx, nil, DB, RWS, nodeID, topk)
 			if err != nil {
 				t.Errorf("Personalized(): expected nil, got %v", err)
 			}
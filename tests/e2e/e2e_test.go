@@ -7,7 +7,6 @@ import (
 	"testing"
 
 	mapset "github.com/deckarep/golang-set/v2"
-	"github.com/redis/go-redis/v9"
 	mockdb "github.com/vertex-lab/crawler/pkg/database/mock"
 	"github.com/vertex-lab/crawler/pkg/database/redisdb"
 	"github.com/vertex-lab/crawler/pkg/models"
@@ -19,14 +18,7 @@ import (
 	"github.com/vertex-lab/crawler/pkg/walks"
 )
 
-/*
-TestWalks() will:
-- fetch walk batches of batchSize
-- verify the consistency of walks (meaning each node visited by a walk contains it's walkID)
-- repeate for iterations (iterating over the whole DB can take minutes)
-
-Therefore, the number of walks checked is (roughly) iterations * batchSize.
-*/
+// TestWalks() verifies the consistency of the walks in prod, using [redistore.Check].
 func TestWalks(t *testing.T) {
 	cl := redisutils.SetupProdClient()
 	ctx := context.Background()
@@ -35,59 +27,24 @@ func TestWalks(t *testing.T) {
 	fmt.Println("Testing the walks consistency")
 	fmt.Printf("-----------------------------\n\n")
 
-	var counter int
-	var batchSize int64 = 10000
-
-	var res []string
-	var cursor uint64
-	var err error
-
-	for {
-		counter++
-		fmt.Printf("\033[1A")
-		fmt.Print("\033[J")
-		fmt.Printf("iteration %d...\n", counter)
-
-		res, cursor, err = cl.HScan(ctx, redistore.KeyWalks, cursor, "", batchSize).Result()
-		if err != nil {
-			t.Fatalf("HScan(): expected nil, got %v", err)
-		}
-
-		if cursor == 0 {
-			break
-		}
-
-		strIDs := make([]string, 0, len(res)/2)
-		strWalks := make([]string, 0, len(res)/2)
-		for i := 0; i < len(res); i += 2 {
-			strIDs = append(strIDs, res[i])
-			strWalks = append(strWalks, res[i+1])
-		}
-
-		walks, err := redisutils.ParseWalks(strWalks)
-		if err != nil {
-			t.Fatalf("ParseWalks(): %v", err)
-		}
+	DB, err := redisdb.NewDatabaseConnection(ctx, cl)
+	if err != nil {
+		t.Fatalf("NewDatabaseConnection(): %v", err)
+	}
 
-		pipe := cl.Pipeline()
-		cmds := make(map[string]*redis.BoolCmd)
-		for i, ID := range strIDs {
-			for _, nodeID := range walks[i] {
-				// the key is the string "<nodeID>:<walkID>". It's unique because a node can be visited by a walk only once
-				key := redisutils.FormatID(nodeID) + ":" + ID
-				cmds[key] = pipe.SIsMember(ctx, redistore.KeyWalksVisiting(nodeID), ID)
-			}
-		}
+	RWS, err := redistore.NewRWSConnection(ctx, cl)
+	if err != nil {
+		t.Fatalf("NewRWSConnection(): %v", err)
+	}
 
-		if _, err := pipe.Exec(ctx); err != nil {
-			t.Fatalf("Pipeline failed: %v", err)
-		}
+	report, err := redistore.Check(ctx, RWS, DB, 10000)
+	if err != nil {
+		t.Fatalf("Check(): %v", err)
+	}
 
-		for key, cmd := range cmds {
-			if !cmd.Val() {
-				t.Errorf("expected true, got %v: %v", cmd.Val(), key)
-			}
-		}
+	fmt.Println(report)
+	if !report.OK() {
+		t.Errorf("the walks are inconsistent: %v", report)
 	}
 }
 
@@ -150,7 +107,7 @@ func TestPagerank(t *testing.T) {
 		}
 
 		if node.Status == models.StatusActive {
-			if err := walks.Generate(ctx, DB_memory, RWS_memory, ID); err != nil {
+			if err := walks.Generate(ctx, nil, DB_memory, RWS_memory, ID); err != nil {
 				t.Fatalf("failed to generate walks for nodeID %d: %v", ID, err)
 			}
 
@@ -233,13 +190,46 @@ func BenchmarkPersonalizedPagerank(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := pagerank.Personalized(ctx, DB, RWS, nodeID, topk)
+		_, err := pagerank.Personalized(ctx, nil, DB, RWS, nodeID, topk)
 		if err != nil {
 			b.Fatalf("Personalized(): benchmark failed: %v", err)
 		}
 	}
 }
 
+func BenchmarkPersonalizedBatch(b *testing.B) {
+	cl := redisutils.SetupProdClient()
+	ctx := context.Background()
+
+	var topk uint16 = 100
+
+	DB, err := redisdb.NewDatabaseConnection(ctx, cl)
+	if err != nil {
+		b.Fatalf("NewDatabase(): benchmark failed: %v", err)
+	}
+	RWS, err := redistore.NewRWSConnection(ctx, cl)
+	if err != nil {
+		b.Fatalf("NewRWSConnection(): benchmark failed: %v", err)
+	}
+
+	sizes := []int{10, 100, 1000}
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("sources=%d", size), func(b *testing.B) {
+			sources := make([]uint32, size)
+			for i := 0; i < size; i++ {
+				sources[i] = uint32(i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := pagerank.PersonalizedBatch(ctx, pagerank.NewBatchConfig(), DB, RWS, sources, topk); err != nil {
+					b.Fatalf("PersonalizedBatch(): benchmark failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkPagerank(b *testing.B) {
 	cl := redisutils.SetupProdClient()
 	ctx := context.Background()